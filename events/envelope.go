@@ -0,0 +1,121 @@
+// Package events defines the envelope of the product events exchanged over
+// RabbitMQ. It is a CloudEvents 1.0 structured-mode message whose data is
+// validated against a versioned JSON Schema. products-api and search-api both
+// build against this module through a replace directive.
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// SpecVersion is the CloudEvents version of the envelope.
+	SpecVersion = "1.0"
+	// ContentType is the AMQP content type of enveloped messages.
+	ContentType = "application/cloudevents+json"
+	// Source identifies products-api as the event producer.
+	Source = "/products-api"
+
+	// SchemaProductV1 describes the data of product.created and product.updated.
+	SchemaProductV1 = "urn:products-api:schema:product:v1"
+	// SchemaProductDeletedV1 describes the data of product.deleted.
+	SchemaProductDeletedV1 = "urn:products-api:schema:product-deleted:v1"
+)
+
+// typeSchemas lists the data schemas each known event type may carry.
+var typeSchemas = map[string][]string{
+	"product.created": {SchemaProductV1},
+	"product.updated": {SchemaProductV1},
+	"product.deleted": {SchemaProductDeletedV1},
+}
+
+// Envelope is a CloudEvents-style event.
+type Envelope struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	DataSchema      string          `json:"dataschema"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// New builds an encoded envelope around data after checking data against dataSchema.
+func New(id, eventType, subject, dataSchema string, at time.Time, data interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s data: %w", eventType, err)
+	}
+	envelope := Envelope{
+		SpecVersion:     SpecVersion,
+		ID:              id,
+		Type:            eventType,
+		Source:          Source,
+		Subject:         subject,
+		Time:            at.UTC(),
+		DataContentType: "application/json",
+		DataSchema:      dataSchema,
+		Data:            encoded,
+	}
+	if err := envelope.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope)
+}
+
+// IsEnvelope reports whether body is an enveloped event rather than a legacy
+// payload, which is the bare product document.
+func IsEnvelope(body []byte) bool {
+	var probe struct {
+		SpecVersion string `json:"specversion"`
+	}
+	return json.Unmarshal(body, &probe) == nil && probe.SpecVersion != ""
+}
+
+// Decode parses and validates an enveloped event.
+func Decode(body []byte) (Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return Envelope{}, fmt.Errorf("decode envelope: %w", err)
+	}
+	if err := envelope.Validate(); err != nil {
+		return Envelope{}, err
+	}
+	return envelope, nil
+}
+
+// Validate checks the required attributes, that the type is known and
+// carries its own schema, and the data against that schema.
+func (e Envelope) Validate() error {
+	switch {
+	case e.SpecVersion != SpecVersion:
+		return fmt.Errorf("unsupported specversion %q", e.SpecVersion)
+	case e.ID == "":
+		return errors.New("envelope id is required")
+	case e.Type == "":
+		return errors.New("envelope type is required")
+	case e.Source == "":
+		return errors.New("envelope source is required")
+	case e.Time.IsZero():
+		return errors.New("envelope time is required")
+	case e.DataSchema == "":
+		return errors.New("envelope dataschema is required")
+	case len(bytes.TrimSpace(e.Data)) == 0:
+		return errors.New("envelope data is required")
+	}
+	allowed, ok := typeSchemas[e.Type]
+	if !ok {
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	if !slices.Contains(allowed, e.DataSchema) {
+		return fmt.Errorf("event type %q does not use data schema %q", e.Type, e.DataSchema)
+	}
+	return ValidateData(e.DataSchema, e.Data)
+}
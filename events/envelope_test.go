@@ -0,0 +1,231 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const productID = "65f1c0ffee0000000000abcd"
+
+func productData() map[string]interface{} {
+	return map[string]interface{}{
+		"id":         productID,
+		"name":       "Luna",
+		"precio":     50,
+		"stock":      3,
+		"variantes":  []interface{}{map[string]interface{}{"sku": "LUNA-50", "precio": 50, "stock": 3}},
+		"notas":      nil,
+		"created_at": "2024-05-01T10:00:00Z",
+		"updated_at": "2024-05-01T10:00:00.123Z",
+		"version":    7,
+	}
+}
+
+// with returns productData with key set to value, or removed when value is remove.
+func with(key string, value interface{}) map[string]interface{} {
+	data := productData()
+	if value == remove {
+		delete(data, key)
+	} else {
+		data[key] = value
+	}
+	return data
+}
+
+var remove = &struct{}{}
+
+func TestValidateDataChecksTheProductSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		wantErr string
+	}{
+		{name: "valid", data: productData()},
+		{name: "extra properties are allowed", data: with("origen", "Francia")},
+		{name: "missing id", data: with("id", remove), wantErr: `data is missing required property "id"`},
+		{name: "missing version", data: with("version", remove), wantErr: `data is missing required property "version"`},
+		{name: "missing variantes", data: with("variantes", remove), wantErr: `data is missing required property "variantes"`},
+		{name: "missing variant sku", data: with("variantes", []interface{}{map[string]interface{}{"precio": 50, "stock": 3}}), wantErr: `data.variantes[0] is missing required property "sku"`},
+		{name: "precio as string", data: with("precio", "50"), wantErr: "data.precio must be of type number"},
+		{name: "fractional stock", data: with("stock", 1.5), wantErr: "data.stock must be of type integer"},
+		{name: "negative stock", data: with("stock", -1), wantErr: "data.stock must be >= 0"},
+		{name: "zero version", data: with("version", 0), wantErr: "data.version must be >= 1"},
+		{name: "name as number", data: with("name", 3), wantErr: "data.name must be of type string"},
+		{name: "notas as string", data: with("notas", "ambar"), wantErr: "data.notas must be of type array or null"},
+		{name: "nota as number", data: with("notas", []interface{}{"ambar", 2}), wantErr: "data.notas[1] must be of type string"},
+		{name: "variantes as object", data: with("variantes", map[string]interface{}{}), wantErr: "data.variantes must be of type array"},
+		{name: "empty sku", data: with("variantes", []interface{}{map[string]interface{}{"sku": "", "precio": 50, "stock": 3}}), wantErr: "data.variantes[0].sku must have at least 1 characters"},
+		{name: "malformed id", data: with("id", "not-an-object-id"), wantErr: "data.id must match"},
+		{name: "malformed date", data: with("created_at", "01/05/2024"), wantErr: "data.created_at must be an RFC 3339 date-time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(tt.data)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			err = ValidateData(SchemaProductV1, raw)
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				var schemaErr SchemaError
+				if !errors.As(err, &schemaErr) || schemaErr.Schema != SchemaProductV1 {
+					t.Fatalf("expected a SchemaError for %s, got %#v", SchemaProductV1, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDataChecksTheDeletedSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "valid", data: `{"id":"` + productID + `","version":2}`},
+		{name: "missing version", data: `{"id":"` + productID + `"}`, wantErr: `data is missing required property "version"`},
+		{name: "unexpected property", data: `{"id":"` + productID + `","version":2,"name":"Luna"}`, wantErr: `data has unexpected property "name"`},
+		{name: "version as string", data: `{"id":"` + productID + `","version":"2"}`, wantErr: "data.version must be of type integer"},
+		{name: "not an object", data: `["` + productID + `"]`, wantErr: "data must be of type object"},
+		{name: "not json", data: `{"id":`, wantErr: "decode data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErr(t, ValidateData(SchemaProductDeletedV1, []byte(tt.data)), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateRejectsIncompleteOrUnknownEnvelopes(t *testing.T) {
+	valid := func() Envelope {
+		return Envelope{
+			SpecVersion:     SpecVersion,
+			ID:              "evt-1",
+			Type:            "product.deleted",
+			Source:          Source,
+			Time:            time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			DataContentType: "application/json",
+			DataSchema:      SchemaProductDeletedV1,
+			Data:            json.RawMessage(`{"id":"` + productID + `","version":2}`),
+		}
+	}
+	tests := []struct {
+		name    string
+		edit    func(e *Envelope)
+		wantErr string
+	}{
+		{name: "valid", edit: func(e *Envelope) {}},
+		{name: "other specversion", edit: func(e *Envelope) { e.SpecVersion = "0.3" }, wantErr: `unsupported specversion "0.3"`},
+		{name: "missing id", edit: func(e *Envelope) { e.ID = "" }, wantErr: "envelope id is required"},
+		{name: "missing type", edit: func(e *Envelope) { e.Type = "" }, wantErr: "envelope type is required"},
+		{name: "missing source", edit: func(e *Envelope) { e.Source = "" }, wantErr: "envelope source is required"},
+		{name: "missing time", edit: func(e *Envelope) { e.Time = time.Time{} }, wantErr: "envelope time is required"},
+		{name: "missing dataschema", edit: func(e *Envelope) { e.DataSchema = "" }, wantErr: "envelope dataschema is required"},
+		{name: "blank data", edit: func(e *Envelope) { e.Data = json.RawMessage(" ") }, wantErr: "envelope data is required"},
+		{name: "unknown type", edit: func(e *Envelope) { e.Type = "product.archived" }, wantErr: `unknown event type "product.archived"`},
+		{name: "type with the wrong schema", edit: func(e *Envelope) { e.DataSchema = SchemaProductV1 }, wantErr: `event type "product.deleted" does not use data schema`},
+		{name: "unknown schema", edit: func(e *Envelope) { e.Type, e.DataSchema = "product.created", "urn:products-api:schema:product:v9" }, wantErr: "does not use data schema"},
+		{name: "data breaking the schema", edit: func(e *Envelope) { e.Data = json.RawMessage(`{"id":"` + productID + `"}`) }, wantErr: `missing required property "version"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope := valid()
+			tt.edit(&envelope)
+			checkErr(t, envelope.Validate(), tt.wantErr)
+		})
+	}
+}
+
+func TestNewRejectsDataThatBreaksItsSchema(t *testing.T) {
+	_, err := New("evt-1", "product.created", productID, SchemaProductV1, time.Now(), with("precio", -5))
+	checkErr(t, err, "data.precio must be >= 0")
+
+	_, err = New("evt-1", "product.created", productID, SchemaProductV1, time.Now(), func() {})
+	checkErr(t, err, "marshal product.created data")
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	tests := []struct {
+		eventType string
+		schema    string
+		data      interface{}
+	}{
+		{eventType: "product.created", schema: SchemaProductV1, data: productData()},
+		{eventType: "product.updated", schema: SchemaProductV1, data: productData()},
+		{eventType: "product.deleted", schema: SchemaProductDeletedV1, data: map[string]interface{}{"id": productID, "version": 8}},
+	}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("ART", -3*3600))
+	for _, tt := range tests {
+		t.Run(tt.eventType, func(t *testing.T) {
+			body, err := New("evt-1", tt.eventType, productID, tt.schema, at, tt.data)
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			if !IsEnvelope(body) {
+				t.Fatalf("expected %s to be recognised as an envelope", body)
+			}
+			envelope, err := Decode(body)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if envelope.ID != "evt-1" || envelope.Type != tt.eventType || envelope.Source != Source ||
+				envelope.Subject != productID || envelope.DataSchema != tt.schema || envelope.DataContentType != "application/json" {
+				t.Fatalf("unexpected envelope: %+v", envelope)
+			}
+			if !envelope.Time.Equal(at) || envelope.Time.Location() != time.UTC {
+				t.Fatalf("expected the time in UTC, got %v", envelope.Time)
+			}
+			want, _ := json.Marshal(tt.data)
+			if string(envelope.Data) != string(want) {
+				t.Fatalf("expected data %s, got %s", want, envelope.Data)
+			}
+		})
+	}
+}
+
+func TestLegacyPayloadsAreNotEnvelopes(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{name: "legacy product", body: `{"id":"` + productID + `","name":"Luna","precio":50}`},
+		{name: "legacy deletion", body: `{"id":"` + productID + `"}`},
+		{name: "empty specversion", body: `{"specversion":"","id":"evt-1"}`},
+		{name: "not json", body: `product.deleted`},
+		{name: "array", body: `[{"specversion":"1.0"}]`},
+		{name: "envelope", body: `{"specversion":"1.0","id":"evt-1"}`, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEnvelope([]byte(tt.body)); got != tt.want {
+				t.Fatalf("IsEnvelope(%s) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+
+	// A legacy payload that reaches Decode is rejected rather than read as
+	// an envelope with empty attributes.
+	if _, err := Decode([]byte(`{"id":"` + productID + `"}`)); err == nil {
+		t.Fatalf("expected decoding a legacy payload as an envelope to fail")
+	}
+	if _, err := Decode([]byte(`{"specversion":`)); err == nil || !strings.Contains(err.Error(), "decode envelope") {
+		t.Fatalf("expected malformed JSON to fail decoding, got %v", err)
+	}
+}
+
+func checkErr(t *testing.T, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected an error containing %q, got %v", want, err)
+	}
+}
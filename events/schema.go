@@ -0,0 +1,237 @@
+package events
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// schemas indexes the embedded JSON Schemas by their $id.
+var schemas = mustLoadSchemas()
+
+// Schema is the subset of JSON Schema used by the event contracts: type,
+// required, properties, additionalProperties, items, enum, minimum,
+// minLength, pattern and the date-time format.
+type Schema struct {
+	ID                   string             `json:"$id"`
+	Type                 schemaTypes        `json:"type"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	MinLength            *int               `json:"minLength"`
+	Pattern              string             `json:"pattern"`
+	Format               string             `json:"format"`
+
+	pattern *regexp.Regexp
+}
+
+// SchemaError describes the first place where a document breaks its schema.
+type SchemaError struct {
+	Schema  string
+	Path    string
+	Message string
+}
+
+func (e SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s %s", e.Schema, e.Path, e.Message)
+}
+
+// ValidateData checks a JSON document against the schema registered under schemaID.
+func ValidateData(schemaID string, data []byte) error {
+	schema, ok := schemas[schemaID]
+	if !ok {
+		return fmt.Errorf("unknown data schema %q", schemaID)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("decode data: %w", err)
+	}
+	return schema.validate(schemaID, "data", doc)
+}
+
+func (s *Schema) validate(schemaID, at string, value interface{}) error {
+	fail := func(format string, args ...interface{}) error {
+		return SchemaError{Schema: schemaID, Path: at, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		return fail("must be of type %s", strings.Join(s.Type, " or "))
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		return fail("must be one of %v", s.Enum)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fail("is missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fail("has unexpected property %q", name)
+				}
+				continue
+			}
+			if err := child.validate(schemaID, at+"."+name, v[name]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(schemaID, fmt.Sprintf("%s[%d]", at, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case json.Number:
+		if s.Minimum != nil {
+			if n, err := v.Float64(); err == nil && n < *s.Minimum {
+				return fail("must be >= %v", *s.Minimum)
+			}
+		}
+	case string:
+		if s.MinLength != nil && len([]rune(v)) < *s.MinLength {
+			return fail("must have at least %d characters", *s.MinLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fail("must match %s", s.Pattern)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				return fail("must be an RFC 3339 date-time")
+			}
+		}
+	}
+	return nil
+}
+
+// schemaTypes accepts both "type": "x" and "type": ["x", "y"].
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+func (t schemaTypes) matches(value interface{}) bool {
+	for _, name := range t {
+		switch v := value.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case json.Number:
+			if name == "number" {
+				return true
+			}
+			if name == "integer" {
+				if n, err := v.Float64(); err == nil && n == math.Trunc(n) {
+					return true
+				}
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	encoded, _ := json.Marshal(value)
+	for _, candidate := range enum {
+		if expected, _ := json.Marshal(candidate); bytes.Equal(encoded, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustLoadSchemas() map[string]*Schema {
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		panic(fmt.Sprintf("read event schemas: %v", err))
+	}
+	loaded := make(map[string]*Schema, len(entries))
+	for _, entry := range entries {
+		raw, err := schemaFiles.ReadFile(path.Join("schemas", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("read event schema %s: %v", entry.Name(), err))
+		}
+		var schema Schema
+		if err := json.Unmarshal(raw, &schema); err != nil {
+			panic(fmt.Sprintf("parse event schema %s: %v", entry.Name(), err))
+		}
+		if err := schema.compile(); err != nil {
+			panic(fmt.Sprintf("compile event schema %s: %v", entry.Name(), err))
+		}
+		loaded[schema.ID] = &schema
+	}
+	return loaded
+}
+
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+	for _, child := range s.Properties {
+		if err := child.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
@@ -40,28 +40,66 @@ func main() {
 		}
 	}()
 
+	indexCtx, indexCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if !database.SupportsTransactions(indexCtx, mongoClient) {
+		log.Fatalf("mongo does not support transactions: run it as a replica set so product changes and their outbox events are written together")
+	}
+	outboxRepo := repositories.NewMongoOutboxRepository(mongoDB.Collection("outbox"))
 	collection := mongoDB.Collection("products")
-	productRepo := repositories.NewMongoProductRepository(collection)
+	productRepo := repositories.NewMongoProductRepository(collection, outboxRepo)
 	purchaseCollection := mongoDB.Collection("purchases")
-	purchaseRepo := repositories.NewMongoPurchaseRepository(purchaseCollection)
-
-	publisher, err := rabbitmq.NewPublisher(cfg)
-	if err != nil {
-		log.Fatalf("rabbitmq init: %v", err)
+	purchaseRepo := repositories.NewMongoPurchaseRepository(purchaseCollection, productRepo)
+	cartRepo := repositories.NewMongoCartRepository(mongoDB.Collection("carts"))
+	reservationRepo := repositories.NewMongoReservationRepository(mongoDB.Collection("reservations"), collection)
+	couponRepo := repositories.NewMongoCouponRepository(mongoDB.Collection("coupons"), mongoDB.Collection("coupon_redemptions"), mongoDB.Collection("coupon_user_uses"))
+	if err := outboxRepo.EnsureIndexes(indexCtx); err != nil {
+		log.Printf("outbox indexes: %v", err)
+	}
+	if err := cartRepo.EnsureIndexes(indexCtx); err != nil {
+		log.Printf("cart indexes: %v", err)
+	}
+	if err := couponRepo.EnsureIndexes(indexCtx); err != nil {
+		log.Printf("coupon indexes: %v", err)
+	}
+	if err := reservationRepo.EnsureIndexes(indexCtx); err != nil {
+		log.Printf("reservation indexes: %v", err)
+	}
+	if migrated, err := productRepo.MigrateSingleVariantProducts(indexCtx); err != nil {
+		log.Printf("variant migration: %v", err)
+	} else if migrated > 0 {
+		log.Printf("variant migration: %d products moved to a single default variant", migrated)
 	}
+	indexCancel()
+
+	publisher := rabbitmq.NewPublisher(cfg)
 	defer publisher.Close()
 
-	productService := services.NewProductService(productRepo, publisher, cfg.UsersAPIURL)
+	productService := services.NewProductService(productRepo, cfg.UsersAPIURL)
 	productHandler := handlers.NewProductHandler(productService)
-	purchaseService := services.NewPurchaseService(productRepo, purchaseRepo, publisher)
+	purchaseService := services.NewPurchaseService(productRepo, purchaseRepo, couponRepo)
 	purchaseHandler := handlers.NewPurchaseHandler(purchaseService)
+	cartService := services.NewCartService(cartRepo, productRepo, purchaseService, time.Duration(cfg.CartTTLHours)*time.Hour)
+	cartHandler := handlers.NewCartHandler(cartService)
+	couponHandler := handlers.NewCouponHandler(services.NewCouponService(couponRepo))
+	reservationService := services.NewReservationService(reservationRepo, productRepo, purchaseService, time.Duration(cfg.ReservationTTLMinutes)*time.Minute)
+	reservationHandler := handlers.NewReservationHandler(reservationService)
+	metricsHandler := handlers.NewMetricsHandler(publisher)
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go reservationService.StartSweeper(backgroundCtx, time.Duration(cfg.ReservationSweepSeconds)*time.Second)
+	go services.NewOutboxRelay(outboxRepo, publisher).Start(backgroundCtx, time.Duration(cfg.OutboxPollMillis)*time.Millisecond)
 	authMiddleware := middleware.AuthMiddleware(cfg.JWTSecret)
+	optionalAuth := middleware.OptionalAuthMiddleware(cfg.JWTSecret)
 
 	mux := http.NewServeMux()
 	mux.Handle("/products", handlers.MethodHandler{
 		Get:  http.HandlerFunc(productHandler.ListProducts),
 		Post: authMiddleware(http.HandlerFunc(productHandler.CreateProduct)),
 	})
+	mux.Handle("/products/export", handlers.MethodHandler{
+		Get: http.HandlerFunc(productHandler.ExportProducts),
+	})
 	mux.Handle("/products/", handlers.MethodHandler{
 		Get:    http.HandlerFunc(productHandler.GetProduct),
 		Put:    authMiddleware(http.HandlerFunc(productHandler.UpdateProduct)),
@@ -73,6 +111,47 @@ func main() {
 	mux.Handle("/compras/mias", handlers.MethodHandler{
 		Get: authMiddleware(http.HandlerFunc(purchaseHandler.ListMyPurchases)),
 	})
+	mux.Handle("/cupones", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Get:  http.HandlerFunc(couponHandler.ListCoupons),
+		Post: http.HandlerFunc(couponHandler.CreateCoupon),
+	})))
+	mux.Handle("/cupones/", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Get:    http.HandlerFunc(couponHandler.GetCoupon),
+		Put:    http.HandlerFunc(couponHandler.UpdateCoupon),
+		Delete: http.HandlerFunc(couponHandler.DeleteCoupon),
+	})))
+	mux.Handle("/reservas", handlers.MethodHandler{
+		Post: authMiddleware(http.HandlerFunc(reservationHandler.CreateReservation)),
+	})
+	mux.Handle("/reservas/stock", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Get: http.HandlerFunc(reservationHandler.StockLevels),
+	})))
+	mux.Handle("/reservas/", authMiddleware(handlers.MethodHandler{
+		Get:    http.HandlerFunc(reservationHandler.GetReservation),
+		Post:   http.HandlerFunc(reservationHandler.ConfirmReservation),
+		Delete: http.HandlerFunc(reservationHandler.ReleaseReservation),
+	}))
+	mux.Handle("/carrito", optionalAuth(handlers.MethodHandler{
+		Get:    http.HandlerFunc(cartHandler.GetCart),
+		Put:    http.HandlerFunc(cartHandler.ReplaceCart),
+		Delete: http.HandlerFunc(cartHandler.ClearCart),
+	}))
+	mux.Handle("/carrito/items", optionalAuth(handlers.MethodHandler{
+		Post: http.HandlerFunc(cartHandler.AddItem),
+	}))
+	mux.Handle("/carrito/items/", optionalAuth(handlers.MethodHandler{
+		Put:    http.HandlerFunc(cartHandler.UpdateItem),
+		Delete: http.HandlerFunc(cartHandler.RemoveItem),
+	}))
+	mux.Handle("/carrito/merge", handlers.MethodHandler{
+		Post: authMiddleware(http.HandlerFunc(cartHandler.MergeCart)),
+	})
+	mux.Handle("/carrito/checkout", handlers.MethodHandler{
+		Post: authMiddleware(http.HandlerFunc(cartHandler.Checkout)),
+	})
+	mux.Handle("/eventos/metricas", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Get: http.HandlerFunc(metricsHandler.PublisherMetrics),
+	})))
 
 	addr := ":" + cfg.ServerPort
 	log.Printf("products-api listening on %s", addr)
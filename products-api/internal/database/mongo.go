@@ -7,6 +7,7 @@ import (
 
 	"products-api/internal/config"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -28,3 +29,16 @@ func InitMongo(cfg *config.Config) (*mongo.Client, *mongo.Database, error) {
 	db := client.Database(cfg.MongoDB)
 	return client, db, nil
 }
+
+// SupportsTransactions reports whether the server is a replica set member or a
+// mongos router, the deployments where multi-document transactions are available.
+func SupportsTransactions(ctx context.Context, client *mongo.Client) bool {
+	var hello bson.M
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false
+	}
+	if _, ok := hello["setName"]; ok {
+		return true
+	}
+	return hello["msg"] == "isdbgrid"
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"products-api/internal/middleware"
+	"products-api/internal/responses"
+	"products-api/internal/services"
+)
+
+// guestHeader carries the client-generated identifier of an anonymous cart.
+const guestHeader = "X-Guest-Id"
+
+// CartHandler exposes the persistent cart endpoints.
+type CartHandler struct {
+	service *services.CartService
+}
+
+// NewCartHandler builds a CartHandler.
+func NewCartHandler(service *services.CartService) *CartHandler {
+	return &CartHandler{service: service}
+}
+
+type cartRequest struct {
+	Items []checkoutItem `json:"items"`
+}
+
+type cartQuantityRequest struct {
+	Cantidad int `json:"cantidad"`
+}
+
+type cartCheckoutRequest struct {
+	Cupon string `json:"cupon"`
+}
+
+type cartMergeRequest struct {
+	GuestID string `json:"guest_id"`
+}
+
+// GetCart handles GET /carrito.
+func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
+	cart, err := h.service.GetCart(cartOwner(r))
+	if err != nil {
+		handleCartError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, cart)
+}
+
+// ReplaceCart handles PUT /carrito.
+func (h *CartHandler) ReplaceCart(w http.ResponseWriter, r *http.Request) {
+	var req cartRequest
+	if err := decodeJSON(r, &req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload")
+		return
+	}
+
+	items := make([]services.CartItemInput, 0, len(req.Items))
+	for _, item := range req.Items {
+		items = append(items, services.CartItemInput{ProductID: item.ProductID, SKU: item.SKU, Cantidad: item.Cantidad})
+	}
+
+	cart, err := h.service.ReplaceCart(cartOwner(r), items)
+	if err != nil {
+		handleCartError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, cart)
+}
+
+// ClearCart handles DELETE /carrito.
+func (h *CartHandler) ClearCart(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.ClearCart(cartOwner(r)); err != nil {
+		handleCartError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddItem handles POST /carrito/items.
+func (h *CartHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	var req checkoutItem
+	if err := decodeJSON(r, &req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload")
+		return
+	}
+
+	cart, err := h.service.AddItem(cartOwner(r), req.ProductID, req.SKU, req.Cantidad)
+	if err != nil {
+		handleCartError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, cart)
+}
+
+// UpdateItem handles PUT /carrito/items/:producto_id?sku=.
+func (h *CartHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	productID, err := extractCartItemID(r.URL.Path)
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Product ID is required")
+		return
+	}
+
+	var req cartQuantityRequest
+	if err := decodeJSON(r, &req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload")
+		return
+	}
+	if req.Cantidad < 0 {
+		responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", "cantidad must be zero or greater")
+		return
+	}
+
+	cart, err := h.service.UpdateItem(cartOwner(r), productID, r.URL.Query().Get("sku"), req.Cantidad)
+	if err != nil {
+		handleCartError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, cart)
+}
+
+// RemoveItem handles DELETE /carrito/items/:producto_id?sku=.
+func (h *CartHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	productID, err := extractCartItemID(r.URL.Path)
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Product ID is required")
+		return
+	}
+
+	cart, err := h.service.RemoveItem(cartOwner(r), productID, r.URL.Query().Get("sku"))
+	if err != nil {
+		handleCartError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, cart)
+}
+
+// MergeCart handles POST /carrito/merge, moving a guest cart into the session user's cart.
+func (h *CartHandler) MergeCart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		responses.WriteError(w, http.StatusUnauthorized, "AUTHENTICATION_FAILED", "User session required")
+		return
+	}
+
+	var req cartMergeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload")
+		return
+	}
+	guestID := strings.TrimSpace(req.GuestID)
+	if guestID == "" {
+		guestID = strings.TrimSpace(r.Header.Get(guestHeader))
+	}
+
+	cart, err := h.service.MergeGuestCart(userID, guestID)
+	if err != nil {
+		handleCartError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, cart)
+}
+
+// Checkout handles POST /carrito/checkout.
+func (h *CartHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		responses.WriteError(w, http.StatusUnauthorized, "AUTHENTICATION_FAILED", "User session required")
+		return
+	}
+
+	var req cartCheckoutRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			responses.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload")
+			return
+		}
+	}
+
+	purchase, err := h.service.Checkout(userID, req.Cupon)
+	if err != nil {
+		handleCartError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusCreated, purchase)
+}
+
+// cartOwner resolves the session user, falling back to the guest header for anonymous requests.
+func cartOwner(r *http.Request) services.CartOwner {
+	if userID, ok := middleware.GetUserID(r.Context()); ok {
+		return services.CartOwner{UserID: userID}
+	}
+	return services.CartOwner{GuestID: r.Header.Get(guestHeader)}
+}
+
+func extractCartItemID(path string) (string, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 || strings.TrimSpace(parts[2]) == "" {
+		return "", http.ErrNoLocation
+	}
+	return strings.TrimSpace(parts[2]), nil
+}
+
+func handleCartError(w http.ResponseWriter, err error) {
+	var valErr services.ValidationError
+	if errors.As(err, &valErr) {
+		switch valErr.Code {
+		case "CART_ITEM_NOT_FOUND":
+			responses.WriteError(w, http.StatusNotFound, valErr.Code, valErr.Error())
+			return
+		case "CART_OWNER_REQUIRED":
+			responses.WriteError(w, http.StatusUnauthorized, valErr.Code, valErr.Error())
+			return
+		case "CART_PRICE_CHANGED":
+			responses.WriteError(w, http.StatusConflict, valErr.Code, valErr.Error())
+			return
+		}
+	}
+	handlePurchaseError(w, err)
+}
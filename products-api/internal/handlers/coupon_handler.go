@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"products-api/internal/repositories"
+	"products-api/internal/responses"
+	"products-api/internal/services"
+)
+
+// CouponHandler exposes the admin coupon endpoints.
+type CouponHandler struct {
+	service *services.CouponService
+}
+
+// NewCouponHandler builds a CouponHandler.
+func NewCouponHandler(service *services.CouponService) *CouponHandler {
+	return &CouponHandler{service: service}
+}
+
+type couponRequest struct {
+	Codigo            string    `json:"codigo"`
+	Descripcion       string    `json:"descripcion"`
+	Tipo              string    `json:"tipo"`
+	Valor             float64   `json:"valor"`
+	ProductoGratisID  string    `json:"producto_gratis_id"`
+	MinimoCompra      float64   `json:"minimo_compra"`
+	MaxUsos           int       `json:"max_usos"`
+	MaxUsosPorUsuario int       `json:"max_usos_por_usuario"`
+	ValidoDesde       time.Time `json:"valido_desde"`
+	ValidoHasta       time.Time `json:"valido_hasta"`
+	Marcas            []string  `json:"marcas"`
+	Tipos             []string  `json:"tipos"`
+	Automatico        bool      `json:"automatico"`
+	Activo            bool      `json:"activo"`
+}
+
+// ListCoupons handles GET /cupones.
+func (h *CouponHandler) ListCoupons(w http.ResponseWriter, r *http.Request) {
+	coupons, err := h.service.ListCoupons()
+	if err != nil {
+		handleCouponError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, coupons)
+}
+
+// CreateCoupon handles POST /cupones.
+func (h *CouponHandler) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req couponRequest
+	if err := decodeJSON(r, &req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload")
+		return
+	}
+
+	coupon, err := h.service.CreateCoupon(toCouponInput(req))
+	if err != nil {
+		handleCouponError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusCreated, coupon)
+}
+
+// GetCoupon handles GET /cupones/:id.
+func (h *CouponHandler) GetCoupon(w http.ResponseWriter, r *http.Request) {
+	id, err := extractID(r.URL.Path)
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Coupon ID is required")
+		return
+	}
+
+	coupon, err := h.service.GetCoupon(id)
+	if err != nil {
+		handleCouponError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, coupon)
+}
+
+// UpdateCoupon handles PUT /cupones/:id.
+func (h *CouponHandler) UpdateCoupon(w http.ResponseWriter, r *http.Request) {
+	id, err := extractID(r.URL.Path)
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Coupon ID is required")
+		return
+	}
+
+	var req couponRequest
+	if err := decodeJSON(r, &req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload")
+		return
+	}
+
+	coupon, err := h.service.UpdateCoupon(id, toCouponInput(req))
+	if err != nil {
+		handleCouponError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, coupon)
+}
+
+// DeleteCoupon handles DELETE /cupones/:id.
+func (h *CouponHandler) DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	id, err := extractID(r.URL.Path)
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Coupon ID is required")
+		return
+	}
+
+	if err := h.service.DeleteCoupon(id); err != nil {
+		handleCouponError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toCouponInput(req couponRequest) services.CouponInput {
+	return services.CouponInput{
+		Codigo:            req.Codigo,
+		Descripcion:       req.Descripcion,
+		Tipo:              req.Tipo,
+		Valor:             req.Valor,
+		ProductoGratisID:  req.ProductoGratisID,
+		MinimoCompra:      req.MinimoCompra,
+		MaxUsos:           req.MaxUsos,
+		MaxUsosPorUsuario: req.MaxUsosPorUsuario,
+		ValidoDesde:       req.ValidoDesde,
+		ValidoHasta:       req.ValidoHasta,
+		Marcas:            req.Marcas,
+		Tipos:             req.Tipos,
+		Automatico:        req.Automatico,
+		Activo:            req.Activo,
+	}
+}
+
+func handleCouponError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrCouponNotFound):
+		responses.WriteError(w, http.StatusNotFound, "COUPON_NOT_FOUND", "Coupon not found")
+	case errors.Is(err, repositories.ErrDuplicateCouponCode):
+		responses.WriteError(w, http.StatusConflict, "DUPLICATE_COUPON_CODE", "Coupon code already exists")
+	default:
+		handleServiceError(w, err)
+	}
+}
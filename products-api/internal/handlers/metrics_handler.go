@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"products-api/internal/rabbitmq"
+	"products-api/internal/responses"
+)
+
+// PublisherMetricsSource exposes the RabbitMQ publisher statistics.
+type PublisherMetricsSource interface {
+	Metrics() rabbitmq.PublisherMetrics
+}
+
+// MetricsHandler exposes operational metrics to admins.
+type MetricsHandler struct {
+	publisher PublisherMetricsSource
+}
+
+// NewMetricsHandler builds a MetricsHandler.
+func NewMetricsHandler(publisher PublisherMetricsSource) *MetricsHandler {
+	return &MetricsHandler{publisher: publisher}
+}
+
+// PublisherMetrics handles GET /eventos/metricas (admin only).
+func (h *MetricsHandler) PublisherMetrics(w http.ResponseWriter, r *http.Request) {
+	responses.WriteJSON(w, http.StatusOK, h.publisher.Metrics())
+}
@@ -3,12 +3,15 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"products-api/internal/middleware"
+	"products-api/internal/models"
 	"products-api/internal/repositories"
 	"products-api/internal/responses"
 	"products-api/internal/services"
@@ -25,29 +28,50 @@ func NewProductHandler(service *services.ProductService) *ProductHandler {
 }
 
 type productRequest struct {
-	Name        string   `json:"name"`
-	Descripcion string   `json:"descripcion"`
-	Precio      float64  `json:"precio"`
-	Stock       int      `json:"stock"`
-	Tipo        string   `json:"tipo"`
-	Estacion    string   `json:"estacion"`
-	Ocasion     string   `json:"ocasion"`
-	Notas       []string `json:"notas"`
-	Genero      string   `json:"genero"`
-	Marca       string   `json:"marca"`
-	Imagen      string   `json:"imagen"`
+	Name        string           `json:"name"`
+	Descripcion string           `json:"descripcion"`
+	Precio      float64          `json:"precio"`
+	Stock       int              `json:"stock"`
+	Tipo        string           `json:"tipo"`
+	Estacion    string           `json:"estacion"`
+	Ocasion     string           `json:"ocasion"`
+	Notas       []string         `json:"notas"`
+	Genero      string           `json:"genero"`
+	Marca       string           `json:"marca"`
+	Imagen      string           `json:"imagen"`
+	Variantes   []variantRequest `json:"variantes"`
+}
+
+type variantRequest struct {
+	SKU           string  `json:"sku"`
+	TamanoML      int     `json:"tamano_ml"`
+	Concentracion string  `json:"concentracion"`
+	Precio        float64 `json:"precio"`
+	Stock         int     `json:"stock"`
 }
 
 // ListProducts handles GET /products.
 func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	filter := repositories.ProductFilter{
-		Tipo:     query.Get("tipo"),
-		Estacion: query.Get("estacion"),
-		Ocasion:  query.Get("ocasion"),
-		Genero:   query.Get("genero"),
-		Marca:    query.Get("marca"),
-		Texto:    query.Get("q"),
+		Tipo:       parseList(query["tipo"]),
+		Estacion:   parseList(query["estacion"]),
+		Ocasion:    parseList(query["ocasion"]),
+		Genero:     parseList(query["genero"]),
+		Marca:      parseList(query["marca"]),
+		Notas:      parseList(query["notas"]),
+		NotasMatch: strings.ToLower(strings.TrimSpace(query.Get("notas_match"))),
+		InStock:    strings.EqualFold(strings.TrimSpace(query.Get("in_stock")), "true"),
+		Texto:      query.Get("q"),
+	}
+	var err error
+	if filter.PrecioMin, err = parseFloat(query.Get("precio_min")); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_FIELD_VALUE", "precio_min must be a number")
+		return
+	}
+	if filter.PrecioMax, err = parseFloat(query.Get("precio_max")); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_FIELD_VALUE", "precio_max must be a number")
+		return
 	}
 
 	page := parseInt(query.Get("page"), 1)
@@ -70,6 +94,25 @@ func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ExportProducts handles GET /products/export. It walks the whole catalog in
+// id order: clients pass back next_cursor until it comes back empty.
+func (h *ProductHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	items, next, err := h.service.ExportProducts(query.Get("cursor"), parseInt(query.Get("limit"), 0))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	if items == nil {
+		items = []models.Product{}
+	}
+
+	responses.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"items":       items,
+		"next_cursor": next,
+	})
+}
+
 // GetProduct handles GET /products/:id.
 func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	id, err := extractID(r.URL.Path)
@@ -179,6 +222,36 @@ func parseInt(value string, def int) int {
 	return parsed
 }
 
+// parseFloat reads an optional finite number; an empty value is zero.
+func parseFloat(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", value)
+	}
+	return parsed, nil
+}
+
+// parseList reads a multi-value parameter given as comma-separated values,
+// repeated parameters or both: marca=Dior,Chanel or marca=Dior&marca=Chanel.
+func parseList(raw []string) []string {
+	var values []string
+	for _, item := range raw {
+		for _, value := range strings.Split(item, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
 func extractID(path string) (string, error) {
 	parts := strings.Split(strings.Trim(path, "/"), "/")
 	if len(parts) < 2 {
@@ -192,6 +265,16 @@ func extractID(path string) (string, error) {
 }
 
 func toInput(req productRequest, ownerID string) services.CreateProductInput {
+	var variantes []services.VariantInput
+	for _, variant := range req.Variantes {
+		variantes = append(variantes, services.VariantInput{
+			SKU:           variant.SKU,
+			TamanoML:      variant.TamanoML,
+			Concentracion: variant.Concentracion,
+			Precio:        variant.Precio,
+			Stock:         variant.Stock,
+		})
+	}
 	return services.CreateProductInput{
 		Name:        req.Name,
 		Descripcion: req.Descripcion,
@@ -205,6 +288,7 @@ func toInput(req productRequest, ownerID string) services.CreateProductInput {
 		Marca:       req.Marca,
 		Imagen:      req.Imagen,
 		OwnerID:     ownerID,
+		Variantes:   variantes,
 	}
 }
 
@@ -228,6 +312,11 @@ func handleServiceError(w http.ResponseWriter, err error) {
 		return
 	}
 
+	if errors.Is(err, repositories.ErrVersionConflict) {
+		responses.WriteError(w, http.StatusConflict, "VERSION_CONFLICT", "Product was modified concurrently, retry the request")
+		return
+	}
+
 	log.Printf("product operation failed: %v", err)
 	responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Unexpected error")
 }
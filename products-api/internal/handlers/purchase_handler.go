@@ -24,10 +24,12 @@ func NewPurchaseHandler(service *services.PurchaseService) *PurchaseHandler {
 
 type checkoutRequest struct {
 	Items []checkoutItem `json:"items"`
+	Cupon string         `json:"cupon"`
 }
 
 type checkoutItem struct {
 	ProductID string `json:"producto_id"`
+	SKU       string `json:"sku"`
 	Cantidad  int    `json:"cantidad"`
 }
 
@@ -45,7 +47,7 @@ func (h *PurchaseHandler) CreatePurchase(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	purchase, err := h.service.Checkout(userID, toCheckoutInput(req.Items))
+	purchase, err := h.service.CheckoutWithCoupon(userID, toCheckoutInput(req.Items), req.Cupon)
 	if err != nil {
 		handlePurchaseError(w, err)
 		return
@@ -77,6 +79,7 @@ func toCheckoutInput(items []checkoutItem) []services.CheckoutItemInput {
 	for _, item := range items {
 		result = append(result, services.CheckoutItemInput{
 			ProductID: item.ProductID,
+			SKU:       item.SKU,
 			Cantidad:  item.Cantidad,
 		})
 	}
@@ -113,6 +116,11 @@ func handlePurchaseError(w http.ResponseWriter, err error) {
 		return
 	}
 
+	if errors.Is(err, repositories.ErrVersionConflict) {
+		responses.WriteError(w, http.StatusConflict, "VERSION_CONFLICT", "Uno de los productos cambio durante la compra, intenta nuevamente.")
+		return
+	}
+
 	log.Printf("purchase error: %v", err)
 	responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not create purchase")
 }
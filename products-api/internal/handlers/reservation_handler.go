@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"products-api/internal/middleware"
+	"products-api/internal/repositories"
+	"products-api/internal/responses"
+	"products-api/internal/services"
+)
+
+// ReservationHandler exposes stock reservation endpoints.
+type ReservationHandler struct {
+	service *services.ReservationService
+}
+
+// NewReservationHandler builds a ReservationHandler.
+func NewReservationHandler(service *services.ReservationService) *ReservationHandler {
+	return &ReservationHandler{service: service}
+}
+
+type confirmReservationRequest struct {
+	Cupon string `json:"cupon"`
+}
+
+// CreateReservation handles POST /reservas.
+func (h *ReservationHandler) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		responses.WriteError(w, http.StatusUnauthorized, "AUTHENTICATION_FAILED", "User session required")
+		return
+	}
+
+	var req checkoutRequest
+	if err := decodeJSON(r, &req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload")
+		return
+	}
+
+	reservation, err := h.service.Reserve(userID, toCheckoutInput(req.Items))
+	if err != nil {
+		handleReservationError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusCreated, reservation)
+}
+
+// GetReservation handles GET /reservas/:id.
+func (h *ReservationHandler) GetReservation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		responses.WriteError(w, http.StatusUnauthorized, "AUTHENTICATION_FAILED", "User session required")
+		return
+	}
+	role, _ := middleware.GetUserRole(r.Context())
+
+	id, err := extractID(r.URL.Path)
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Reservation ID is required")
+		return
+	}
+
+	reservation, err := h.service.GetReservation(id, userID, role == "admin")
+	if err != nil {
+		handleReservationError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, reservation)
+}
+
+// ConfirmReservation handles POST /reservas/:id/confirmar.
+func (h *ReservationHandler) ConfirmReservation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		responses.WriteError(w, http.StatusUnauthorized, "AUTHENTICATION_FAILED", "User session required")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[2] != "confirmar" {
+		responses.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Resource not found")
+		return
+	}
+
+	var req confirmReservationRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			responses.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload")
+			return
+		}
+	}
+
+	purchase, err := h.service.Confirm(parts[1], userID, req.Cupon)
+	if err != nil {
+		handleReservationError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusCreated, purchase)
+}
+
+// ReleaseReservation handles DELETE /reservas/:id.
+func (h *ReservationHandler) ReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		responses.WriteError(w, http.StatusUnauthorized, "AUTHENTICATION_FAILED", "User session required")
+		return
+	}
+	role, _ := middleware.GetUserRole(r.Context())
+
+	id, err := extractID(r.URL.Path)
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Reservation ID is required")
+		return
+	}
+
+	if err := h.service.Release(id, userID, role == "admin"); err != nil {
+		handleReservationError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StockLevels handles GET /reservas/stock (admin only).
+func (h *ReservationHandler) StockLevels(w http.ResponseWriter, r *http.Request) {
+	levels, err := h.service.StockLevels()
+	if err != nil {
+		handleReservationError(w, err)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, levels)
+}
+
+func handleReservationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repositories.ErrReservationNotFound) {
+		responses.WriteError(w, http.StatusNotFound, "RESERVATION_NOT_FOUND", "Reservation not found")
+		return
+	}
+	var valErr services.ValidationError
+	if errors.As(err, &valErr) {
+		switch valErr.Code {
+		case "FORBIDDEN":
+			responses.WriteError(w, http.StatusForbidden, valErr.Code, valErr.Error())
+			return
+		case "RESERVATION_NOT_ACTIVE", "RESERVATION_EXPIRED":
+			responses.WriteError(w, http.StatusConflict, valErr.Code, valErr.Error())
+			return
+		}
+	}
+	handlePurchaseError(w, err)
+}
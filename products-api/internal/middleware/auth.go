@@ -50,6 +50,22 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 	}
 }
 
+// OptionalAuthMiddleware injects claims when a Bearer token is present and lets
+// anonymous requests through untouched. Invalid tokens are still rejected.
+func OptionalAuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
+	required := AuthMiddleware(jwtSecret)
+	return func(next http.Handler) http.Handler {
+		withAuth := required(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			withAuth.ServeHTTP(w, r)
+		})
+	}
+}
+
 // RequireAdmin ensures the authenticated user has the admin role.
 func RequireAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CartItem stores a product kept in a cart together with the last known price.
+type CartItem struct {
+	ProductID      primitive.ObjectID `bson:"product_id" json:"product_id"`
+	SKU            string             `bson:"sku,omitempty" json:"sku,omitempty"`
+	TamanoML       int                `bson:"tamano_ml,omitempty" json:"tamano_ml,omitempty"`
+	Concentracion  string             `bson:"concentracion,omitempty" json:"concentracion,omitempty"`
+	Nombre         string             `bson:"nombre" json:"nombre"`
+	Marca          string             `bson:"marca" json:"marca"`
+	Imagen         string             `bson:"imagen" json:"imagen"`
+	PrecioUnitario float64            `bson:"precio_unitario" json:"precio_unitario"`
+	Cantidad       int                `bson:"cantidad" json:"cantidad"`
+	AddedAt        time.Time          `bson:"added_at" json:"added_at"`
+
+	// Fields below are computed on every read and never persisted.
+	PrecioAnterior  float64 `bson:"-" json:"precio_anterior,omitempty"`
+	PrecioCambiado  bool    `bson:"-" json:"precio_cambiado"`
+	StockDisponible int     `bson:"-" json:"stock_disponible"`
+	SinStock        bool    `bson:"-" json:"sin_stock"`
+	NoDisponible    bool    `bson:"-" json:"no_disponible"`
+	Subtotal        float64 `bson:"-" json:"subtotal"`
+}
+
+// Cart is a persistent shopping cart owned by a user or by an anonymous guest.
+type Cart struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OwnerKey  string             `bson:"owner_key" json:"-"`
+	UserID    string             `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	GuestID   string             `bson:"guest_id,omitempty" json:"guest_id,omitempty"`
+	Items     []CartItem         `bson:"items" json:"items"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+
+	Total float64 `bson:"-" json:"total"`
+}
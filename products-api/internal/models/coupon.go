@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Coupon discount types.
+const (
+	CouponPercentage = "porcentaje"
+	CouponFixed      = "monto_fijo"
+	CouponFreeItem   = "producto_gratis"
+)
+
+// Coupon describes an admin-managed discount. Automatic coupons act as
+// promotions: they apply to every eligible checkout without a code.
+type Coupon struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Codigo            string             `bson:"codigo,omitempty" json:"codigo,omitempty"`
+	Descripcion       string             `bson:"descripcion" json:"descripcion"`
+	Tipo              string             `bson:"tipo" json:"tipo"`
+	Valor             float64            `bson:"valor" json:"valor"`
+	ProductoGratisID  string             `bson:"producto_gratis_id,omitempty" json:"producto_gratis_id,omitempty"`
+	MinimoCompra      float64            `bson:"minimo_compra" json:"minimo_compra"`
+	MaxUsos           int                `bson:"max_usos" json:"max_usos"`
+	MaxUsosPorUsuario int                `bson:"max_usos_por_usuario" json:"max_usos_por_usuario"`
+	Usos              int                `bson:"usos" json:"usos"`
+	ValidoDesde       time.Time          `bson:"valido_desde" json:"valido_desde"`
+	ValidoHasta       time.Time          `bson:"valido_hasta" json:"valido_hasta"`
+	Marcas            []string           `bson:"marcas,omitempty" json:"marcas,omitempty"`
+	Tipos             []string           `bson:"tipos,omitempty" json:"tipos,omitempty"`
+	Automatico        bool               `bson:"automatico" json:"automatico"`
+	Activo            bool               `bson:"activo" json:"activo"`
+	CreatedAt         time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// CouponRedemption records that a user consumed a coupon in a purchase.
+type CouponRedemption struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CouponID   primitive.ObjectID `bson:"coupon_id" json:"coupon_id"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	PurchaseID primitive.ObjectID `bson:"purchase_id" json:"purchase_id"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
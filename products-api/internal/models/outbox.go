@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Outbox event statuses.
+const (
+	OutboxPending = "pendiente"
+	OutboxSent    = "enviado"
+)
+
+// OutboxEvent is a domain event stored together with the data change that
+// produced it and relayed to RabbitMQ afterwards.
+type OutboxEvent struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	AggregateID   string             `bson:"aggregate_id" json:"aggregate_id"`
+	RoutingKey    string             `bson:"routing_key" json:"routing_key"`
+	ContentType   string             `bson:"content_type,omitempty" json:"content_type,omitempty"`
+	Payload       []byte             `bson:"payload" json:"-"`
+	Status        string             `bson:"status" json:"status"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	LastError     string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	SentAt        *time.Time         `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+}
@@ -6,13 +6,35 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Product models a perfume entry stored in MongoDB.
+// Supported variant concentrations.
+const (
+	ConcentrationEDC    = "edc"
+	ConcentrationEDT    = "edt"
+	ConcentrationEDP    = "edp"
+	ConcentrationParfum = "parfum"
+)
+
+// ProductVariant is a sellable presentation of a perfume (bottle size and concentration).
+type ProductVariant struct {
+	SKU           string  `bson:"sku" json:"sku"`
+	TamanoML      int     `bson:"tamano_ml" json:"tamano_ml"`
+	Concentracion string  `bson:"concentracion" json:"concentracion"`
+	Precio        float64 `bson:"precio" json:"precio"`
+	Stock         int     `bson:"stock" json:"stock"`
+}
+
+// Product models a perfume entry stored in MongoDB. Precio and Stock mirror
+// the cheapest variant price and the total variant stock so listings and
+// legacy clients keep working. Version grows by one on every change so event
+// consumers can discard stale or duplicated updates.
 type Product struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Name        string             `bson:"name" json:"name"`
 	Descripcion string             `bson:"descripcion" json:"descripcion"`
 	Precio      float64            `bson:"precio" json:"precio"`
 	Stock       int                `bson:"stock" json:"stock"`
+	Variantes   []ProductVariant   `bson:"variantes,omitempty" json:"variantes"`
+	Reservados  map[string]int     `bson:"reservados,omitempty" json:"-"`
 	Tipo        string             `bson:"tipo" json:"tipo"`
 	Estacion    string             `bson:"estacion" json:"estacion"`
 	Ocasion     string             `bson:"ocasion" json:"ocasion"`
@@ -24,4 +46,83 @@ type Product struct {
 	Score       float64            `bson:"score,omitempty" json:"score"`
 	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	Version     int64              `bson:"version" json:"version"`
+}
+
+// Reserved returns the stock of every variant held by active reservations.
+func (p *Product) Reserved() int {
+	reserved := 0
+	for _, quantity := range p.Reservados {
+		reserved += quantity
+	}
+	return reserved
+}
+
+// Available returns the stock that is not held by active reservations.
+func (p *Product) Available() int {
+	available := p.Stock - p.Reserved()
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// Variant returns the variant with the given SKU. An empty SKU selects the
+// only variant of single-variant products.
+func (p *Product) Variant(sku string) (*ProductVariant, bool) {
+	if sku == "" {
+		if len(p.Variantes) == 1 {
+			return &p.Variantes[0], true
+		}
+		return nil, false
+	}
+	for i := range p.Variantes {
+		if p.Variantes[i].SKU == sku {
+			return &p.Variantes[i], true
+		}
+	}
+	return nil, false
+}
+
+// VariantAvailable returns the stock of a variant not held by active reservations.
+func (p *Product) VariantAvailable(sku string) int {
+	variant, ok := p.Variant(sku)
+	if !ok {
+		return 0
+	}
+	available := variant.Stock - p.Reservados[variant.SKU]
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// SyncFromVariants recomputes Precio and Stock from the variants.
+func (p *Product) SyncFromVariants() {
+	if len(p.Variantes) == 0 {
+		return
+	}
+	precio := p.Variantes[0].Precio
+	stock := 0
+	for _, variant := range p.Variantes {
+		if variant.Precio < precio {
+			precio = variant.Precio
+		}
+		stock += variant.Stock
+	}
+	p.Precio = precio
+	p.Stock = stock
+}
+
+// EnsureDefaultVariant gives legacy products without variants a single
+// variant built from Precio and Stock, keyed by the product id.
+func (p *Product) EnsureDefaultVariant() {
+	if len(p.Variantes) > 0 {
+		return
+	}
+	p.Variantes = []ProductVariant{{
+		SKU:    p.ID.Hex(),
+		Precio: p.Precio,
+		Stock:  p.Stock,
+	}}
 }
@@ -6,14 +6,28 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// PriceAdjustment is a discount applied to a purchase line by a coupon or promotion.
+type PriceAdjustment struct {
+	CouponID    primitive.ObjectID `bson:"coupon_id" json:"coupon_id"`
+	Codigo      string             `bson:"codigo,omitempty" json:"codigo,omitempty"`
+	Descripcion string             `bson:"descripcion" json:"descripcion"`
+	Automatico  bool               `bson:"automatico" json:"automatico"`
+	Monto       float64            `bson:"monto" json:"monto"`
+}
+
 // PurchaseItem stores a snapshot of a product included in a purchase.
 type PurchaseItem struct {
 	ProductID      primitive.ObjectID `bson:"product_id" json:"product_id"`
+	SKU            string             `bson:"sku,omitempty" json:"sku,omitempty"`
+	TamanoML       int                `bson:"tamano_ml,omitempty" json:"tamano_ml,omitempty"`
+	Concentracion  string             `bson:"concentracion,omitempty" json:"concentracion,omitempty"`
 	Nombre         string             `bson:"nombre" json:"nombre"`
 	Marca          string             `bson:"marca" json:"marca"`
 	Imagen         string             `bson:"imagen" json:"imagen"`
 	PrecioUnitario float64            `bson:"precio_unitario" json:"precio_unitario"`
 	Cantidad       int                `bson:"cantidad" json:"cantidad"`
+	Ajustes        []PriceAdjustment  `bson:"ajustes,omitempty" json:"ajustes,omitempty"`
+	TotalLinea     float64            `bson:"total_linea" json:"total_linea"`
 }
 
 // Purchase describes a completed checkout operation.
@@ -21,6 +35,8 @@ type Purchase struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID      string             `bson:"user_id" json:"user_id"`
 	FechaCompra time.Time          `bson:"fecha_compra" json:"fecha_compra"`
+	Subtotal    float64            `bson:"subtotal" json:"subtotal"`
+	Descuento   float64            `bson:"descuento" json:"descuento"`
 	Total       float64            `bson:"total" json:"total"`
 	Items       []PurchaseItem     `bson:"items" json:"items"`
 }
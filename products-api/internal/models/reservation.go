@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reservation statuses.
+const (
+	ReservationActive    = "activa"
+	ReservationConfirmed = "confirmada"
+	ReservationReleased  = "liberada"
+	ReservationExpired   = "expirada"
+)
+
+// ReservationItem is a quantity of a product held by a reservation.
+type ReservationItem struct {
+	ProductID primitive.ObjectID `bson:"product_id" json:"product_id"`
+	SKU       string             `bson:"sku,omitempty" json:"sku,omitempty"`
+	Cantidad  int                `bson:"cantidad" json:"cantidad"`
+}
+
+// Reservation is a time-limited hold on product stock placed during checkout.
+type Reservation struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	Items      []ReservationItem  `bson:"items" json:"items"`
+	Status     string             `bson:"status" json:"status"`
+	PurchaseID primitive.ObjectID `bson:"purchase_id,omitempty" json:"purchase_id,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+}
+
+// StockLevel reports reserved versus available stock for a product variant.
+type StockLevel struct {
+	ProductID  string `json:"producto_id"`
+	SKU        string `json:"sku"`
+	Nombre     string `json:"nombre"`
+	Stock      int    `json:"stock"`
+	Reservado  int    `json:"reservado"`
+	Disponible int    `json:"disponible"`
+}
@@ -2,131 +2,378 @@ package rabbitmq
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"sync"
 	"time"
 
 	"products-api/internal/config"
 	"products-api/internal/models"
 
 	amqp "github.com/rabbitmq/amqp091-go"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Publisher sends product events to RabbitMQ.
+var (
+	// ErrPublisherClosed is returned after Close was called.
+	ErrPublisherClosed = errors.New("publisher closed")
+	// ErrBufferFull is returned when the broker is unreachable and the outage buffer is full.
+	ErrBufferFull = errors.New("publish buffer full")
+	// ErrUnroutable is returned when no queue is bound for the routing key.
+	ErrUnroutable = errors.New("message unroutable")
+	// ErrNacked is returned when the broker refused the message.
+	ErrNacked = errors.New("message nacked by broker")
+)
+
+const (
+	minReconnectBackoff = 500 * time.Millisecond
+	returnBufferSize    = 16
+)
+
+// PublisherMetrics summarizes the publisher activity since startup.
+type PublisherMetrics struct {
+	Connected       bool       `json:"connected"`
+	Reconnects      int64      `json:"reconnects"`
+	ConnectFailures int64      `json:"connect_failures"`
+	Published       int64      `json:"published"`
+	Failed          int64      `json:"failed"`
+	Unroutable      int64      `json:"unroutable"`
+	Rejected        int64      `json:"rejected"`
+	Buffered        int        `json:"buffered"`
+	BufferCapacity  int        `json:"buffer_capacity"`
+	AvgLatencyMS    float64    `json:"avg_latency_ms"`
+	MaxLatencyMS    float64    `json:"max_latency_ms"`
+	LastLatencyMS   float64    `json:"last_latency_ms"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Publisher sends product events to RabbitMQ. It keeps reconnecting in the
+// background when the broker goes away, buffers publish requests in a bounded
+// queue during outages and reports success only once the broker confirmed
+// that the message was routed.
 type Publisher struct {
-	conn     *amqp.Connection
-	channel  *amqp.Channel
-	exchange string
+	url        string
+	exchange   string
+	maxBackoff time.Duration
+	// dial opens a session to the broker; it is connect outside tests.
+	dial func() (*session, error)
+
+	requests  chan *publishRequest
+	closed    chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu           sync.Mutex
+	metrics      PublisherMetrics
+	totalLatency time.Duration
+}
+
+type publishRequest struct {
+	ctx        context.Context
+	routingKey string
+	msg        amqp.Publishing
+	result     chan error
+}
+
+type session struct {
+	conn       io.Closer
+	channel    publishChannel
+	returns    chan amqp.Return
+	connClosed chan *amqp.Error
+	chanClosed chan *amqp.Error
+}
+
+// publishChannel is the part of an AMQP channel in confirm mode the
+// publisher uses.
+type publishChannel interface {
+	// publish sends a mandatory message and returns its pending confirm.
+	publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (confirmation, error)
+	IsClosed() bool
+	Close() error
+}
+
+// confirmation is the broker's pending answer to a published message.
+type confirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// amqpChannel adapts *amqp.Channel to publishChannel.
+type amqpChannel struct {
+	*amqp.Channel
 }
 
-// NewPublisher configures the RabbitMQ exchange and channel.
-func NewPublisher(cfg *config.Config) (*Publisher, error) {
-	conn, err := amqp.Dial(cfg.RabbitMQURL)
+func (c amqpChannel) publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (confirmation, error) {
+	confirm, err := c.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, true, false, msg)
 	if err != nil {
-		return nil, fmt.Errorf("dial rabbitmq: %w", err)
+		return nil, err
+	}
+	return confirm, nil
+}
+
+// NewPublisher starts a publisher that connects to RabbitMQ in the background.
+// Publishing before the first connection succeeds buffers the request.
+func NewPublisher(cfg *config.Config) *Publisher {
+	p := newPublisher(cfg)
+	p.dial = p.connect
+	go p.run()
+	return p
+}
+
+// newPublisher builds a publisher without dial and without starting it.
+func newPublisher(cfg *config.Config) *Publisher {
+	bufferSize := cfg.RabbitMQBufferSize
+	if bufferSize <= 0 {
+		bufferSize = 1000
+	}
+	maxBackoff := time.Duration(cfg.RabbitMQReconnectMaxSeconds) * time.Second
+	if maxBackoff < minReconnectBackoff {
+		maxBackoff = 30 * time.Second
+	}
+	p := &Publisher{
+		url:        cfg.RabbitMQURL,
+		exchange:   cfg.RabbitMQExchange,
+		maxBackoff: maxBackoff,
+		requests:   make(chan *publishRequest, bufferSize),
+		closed:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	p.metrics.BufferCapacity = bufferSize
+	return p
+}
+
+// Close stops the reconnect loop and releases RabbitMQ resources.
+func (p *Publisher) Close() {
+	p.closeOnce.Do(func() { close(p.closed) })
+	<-p.done
+}
+
+// Metrics returns a snapshot of the publisher statistics.
+func (p *Publisher) Metrics() PublisherMetrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	metrics := p.metrics
+	metrics.Buffered = len(p.requests)
+	return metrics
+}
+
+// PublishEvent publishes an outbox event and waits for the broker to confirm it.
+// Events stored before the envelope was introduced go out as plain JSON.
+func (p *Publisher) PublishEvent(ctx context.Context, event models.OutboxEvent) error {
+	contentType := event.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	return p.publish(ctx, event.RoutingKey, amqp.Publishing{
+		ContentType:  contentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    event.ID.Hex(),
+		Body:         event.Payload,
+	})
+}
+
+func (p *Publisher) publish(ctx context.Context, routingKey string, msg amqp.Publishing) error {
+	req := &publishRequest{ctx: ctx, routingKey: routingKey, msg: msg, result: make(chan error, 1)}
+
+	select {
+	case <-p.closed:
+		return ErrPublisherClosed
+	default:
+	}
+	select {
+	case p.requests <- req:
+	default:
+		p.recordFailure(ErrBufferFull, func(m *PublisherMetrics) { m.Rejected++ })
+		return ErrBufferFull
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.closed:
+		return ErrPublisherClosed
+	}
+}
+
+func (p *Publisher) run() {
+	defer close(p.done)
+
+	backoff := minReconnectBackoff
+	connectedBefore := false
+	for {
+		s, err := p.dial()
+		if err != nil {
+			p.mu.Lock()
+			p.metrics.ConnectFailures++
+			p.mu.Unlock()
+			log.Printf("rabbitmq publisher: connect failed, retrying in %s: %v", backoff, err)
+			select {
+			case <-p.closed:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, p.maxBackoff)
+			continue
+		}
+
+		backoff = minReconnectBackoff
+		p.mu.Lock()
+		p.metrics.Connected = true
+		if connectedBefore {
+			p.metrics.Reconnects++
+		}
+		p.mu.Unlock()
+		connectedBefore = true
+
+		err = p.serve(s)
+		s.close()
+		p.mu.Lock()
+		p.metrics.Connected = false
+		p.mu.Unlock()
+		if err == nil {
+			return
+		}
+		log.Printf("rabbitmq publisher: connection lost, reconnecting: %v", err)
 	}
+}
 
+func (p *Publisher) connect() (*session, error) {
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return nil, fmt.Errorf("dial rabbitmq: %w", err)
+	}
 	ch, err := conn.Channel()
 	if err != nil {
 		_ = conn.Close()
 		return nil, fmt.Errorf("create channel: %w", err)
 	}
-
-	if err := ch.ExchangeDeclare(
-		cfg.RabbitMQExchange,
-		"topic",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	); err != nil {
-		_ = ch.Close()
+	if err := ch.ExchangeDeclare(p.exchange, "topic", true, false, false, false, nil); err != nil {
 		_ = conn.Close()
 		return nil, fmt.Errorf("declare exchange: %w", err)
 	}
+	if err := ch.Confirm(false); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("enable publisher confirms: %w", err)
+	}
 
-	return &Publisher{
-		conn:     conn,
-		channel:  ch,
-		exchange: cfg.RabbitMQExchange,
+	return &session{
+		conn:       conn,
+		channel:    amqpChannel{ch},
+		returns:    ch.NotifyReturn(make(chan amqp.Return, returnBufferSize)),
+		connClosed: conn.NotifyClose(make(chan *amqp.Error, 1)),
+		chanClosed: ch.NotifyClose(make(chan *amqp.Error, 1)),
 	}, nil
 }
 
-// Close releases RabbitMQ resources.
-func (p *Publisher) Close() {
-	if p.channel != nil {
-		_ = p.channel.Close()
-	}
-	if p.conn != nil {
-		_ = p.conn.Close()
+// serve publishes buffered requests one at a time until the session breaks
+// (returning the cause) or the publisher is closed (returning nil).
+func (p *Publisher) serve(s *session) error {
+	for {
+		select {
+		case <-p.closed:
+			return nil
+		case err := <-s.connClosed:
+			return fmt.Errorf("connection closed: %v", err)
+		case err := <-s.chanClosed:
+			return fmt.Errorf("channel closed: %v", err)
+		case req := <-p.requests:
+			if err := req.ctx.Err(); err != nil {
+				// The caller gave up while the request was buffered.
+				req.result <- err
+				continue
+			}
+			err := p.publishOne(s, req)
+			req.result <- err
+			if s.channel.IsClosed() {
+				return fmt.Errorf("channel closed: %v", err)
+			}
+		}
 	}
 }
 
-// PublishProductCreated emits product.created.
-func (p *Publisher) PublishProductCreated(product *models.Product) error {
-	return p.publish("product.created", productPayload(product))
+func (p *Publisher) publishOne(s *session, req *publishRequest) error {
+	start := time.Now()
+	req.msg.Timestamp = start.UTC()
+
+	confirmation, err := s.channel.publish(req.ctx, p.exchange, req.routingKey, req.msg)
+	if err != nil {
+		err = fmt.Errorf("publish %s: %w", req.routingKey, err)
+		p.recordFailure(err, nil)
+		return err
+	}
+	acked, err := confirmation.WaitContext(req.ctx)
+	if err != nil {
+		err = fmt.Errorf("wait confirm for %s: %w", req.routingKey, err)
+		p.recordFailure(err, nil)
+		return err
+	}
+	if !acked {
+		err = fmt.Errorf("%s: %w", req.routingKey, ErrNacked)
+		p.recordFailure(err, nil)
+		return err
+	}
+
+	// The broker sends basic.return before the confirm of an unroutable
+	// mandatory message, so any return for this message is already queued.
+	if returned(s.returns, req.msg.MessageId) {
+		err = fmt.Errorf("%s: %w", req.routingKey, ErrUnroutable)
+		p.recordFailure(err, func(m *PublisherMetrics) { m.Unroutable++ })
+		return err
+	}
+
+	p.recordSuccess(time.Since(start))
+	return nil
 }
 
-// PublishProductUpdated emits product.updated.
-func (p *Publisher) PublishProductUpdated(product *models.Product) error {
-	return p.publish("product.updated", productPayload(product))
+// returned drains the pending returns and reports whether one belongs to messageID.
+func returned(returns <-chan amqp.Return, messageID string) bool {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return false
+			}
+			if ret.MessageId == messageID {
+				return true
+			}
+			log.Printf("rabbitmq publisher: stale return for message %s (%s)", ret.MessageId, ret.ReplyText)
+		default:
+			return false
+		}
+	}
 }
 
-// PublishProductDeleted emits product.deleted.
-func (p *Publisher) PublishProductDeleted(id string) error {
-	payload := map[string]string{"id": id}
-	return p.publish("product.deleted", payload)
+func (p *Publisher) recordSuccess(latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.metrics.Published++
+	p.totalLatency += latency
+	ms := float64(latency) / float64(time.Millisecond)
+	p.metrics.LastLatencyMS = ms
+	p.metrics.MaxLatencyMS = max(p.metrics.MaxLatencyMS, ms)
+	p.metrics.AvgLatencyMS = float64(p.totalLatency) / float64(time.Millisecond) / float64(p.metrics.Published)
 }
 
-func (p *Publisher) publish(routingKey string, payload interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (p *Publisher) recordFailure(err error, update func(m *PublisherMetrics)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now().UTC()
+	p.metrics.Failed++
+	p.metrics.LastError = err.Error()
+	p.metrics.LastErrorAt = &now
+	if update != nil {
+		update(&p.metrics)
+	}
+}
 
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("marshal event: %w", err)
-	}
-
-	return p.channel.PublishWithContext(
-		ctx,
-		p.exchange,
-		routingKey,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-			Timestamp:   time.Now().UTC(),
-		},
-	)
-}
-
-func productPayload(p *models.Product) map[string]interface{} {
-	if p == nil {
-		return map[string]interface{}{}
-	}
-	id := ""
-	if p.ID != primitive.NilObjectID {
-		id = p.ID.Hex()
-	}
-	return map[string]interface{}{
-		"id":          id,
-		"name":        p.Name,
-		"descripcion": p.Descripcion,
-		"precio":      p.Precio,
-		"stock":       p.Stock,
-		"tipo":        p.Tipo,
-		"estacion":    p.Estacion,
-		"ocasion":     p.Ocasion,
-		"notas":       p.Notas,
-		"genero":      p.Genero,
-		"marca":       p.Marca,
-		"imagen":      p.Imagen,
-		"owner_id":    p.OwnerID,
-		"score":       p.Score,
-		"created_at":  p.CreatedAt,
-		"updated_at":  p.UpdatedAt,
+func (s *session) close() {
+	if s.channel != nil {
+		_ = s.channel.Close()
+	}
+	if s.conn != nil {
+		_ = s.conn.Close()
 	}
 }
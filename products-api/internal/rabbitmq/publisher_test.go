@@ -0,0 +1,228 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"products-api/internal/config"
+	"products-api/internal/models"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeChannel records published messages and answers them as configured.
+type fakeChannel struct {
+	mu         sync.Mutex
+	published  []amqp.Publishing
+	nack       bool
+	unroutable bool
+	closed     bool
+	returns    chan amqp.Return
+}
+
+func newFakeChannel() *fakeChannel {
+	return &fakeChannel{returns: make(chan amqp.Return, returnBufferSize)}
+}
+
+func (c *fakeChannel) publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (confirmation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, msg)
+	if c.unroutable {
+		// The broker returns an unroutable message before confirming it.
+		c.returns <- amqp.Return{MessageId: msg.MessageId, ReplyText: "NO_ROUTE"}
+	}
+	return fakeConfirmation(!c.nack), nil
+}
+
+func (c *fakeChannel) IsClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *fakeChannel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeChannel) publishedCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.published)
+}
+
+// session wraps the channel in a session whose connection can be broken
+// by sending on connClosed.
+func (c *fakeChannel) session() *session {
+	return &session{
+		conn:       nopCloser{},
+		channel:    c,
+		returns:    c.returns,
+		connClosed: make(chan *amqp.Error, 1),
+		chanClosed: make(chan *amqp.Error, 1),
+	}
+}
+
+type fakeConfirmation bool
+
+func (c fakeConfirmation) WaitContext(ctx context.Context) (bool, error) {
+	return bool(c), nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// startPublisher runs a publisher that connects with the sessions sent on
+// the returned channel, waiting for one on every (re)connection.
+func startPublisher(t *testing.T, bufferSize int) (*Publisher, chan<- *session) {
+	t.Helper()
+	dials := make(chan *session)
+	p := newPublisher(&config.Config{RabbitMQExchange: "products", RabbitMQBufferSize: bufferSize})
+	p.dial = func() (*session, error) {
+		select {
+		case s := <-dials:
+			return s, nil
+		case <-p.closed:
+			return nil, ErrPublisherClosed
+		}
+	}
+	go p.run()
+	t.Cleanup(p.Close)
+	return p, dials
+}
+
+func testEvent() models.OutboxEvent {
+	return models.OutboxEvent{ID: primitive.NewObjectID(), RoutingKey: "product.updated", Payload: []byte(`{}`)}
+}
+
+// waitFor polls cond until it holds or a second passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPublisherReportsNackedMessages(t *testing.T) {
+	p, dials := startPublisher(t, 10)
+	ch := newFakeChannel()
+	ch.nack = true
+	dials <- ch.session()
+
+	if err := p.PublishEvent(context.Background(), testEvent()); !errors.Is(err, ErrNacked) {
+		t.Fatalf("expected a nack, got %v", err)
+	}
+	if metrics := p.Metrics(); metrics.Failed != 1 || metrics.Published != 0 || metrics.LastError == "" {
+		t.Fatalf("expected the nack to be counted as a failure, got %+v", metrics)
+	}
+}
+
+func TestPublisherReportsReturnedMessages(t *testing.T) {
+	p, dials := startPublisher(t, 10)
+	ch := newFakeChannel()
+	ch.unroutable = true
+	dials <- ch.session()
+	ctx := context.Background()
+
+	if err := p.PublishEvent(ctx, testEvent()); !errors.Is(err, ErrUnroutable) {
+		t.Fatalf("expected the message to be unroutable, got %v", err)
+	}
+
+	// A return left over from another message does not fail this one.
+	ch.mu.Lock()
+	ch.unroutable = false
+	ch.returns <- amqp.Return{MessageId: "other"}
+	ch.mu.Unlock()
+	if err := p.PublishEvent(ctx, testEvent()); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if metrics := p.Metrics(); metrics.Unroutable != 1 || metrics.Published != 1 {
+		t.Fatalf("expected one unroutable and one published message, got %+v", metrics)
+	}
+}
+
+func TestPublisherBuffersMessagesUntilItReconnects(t *testing.T) {
+	p, dials := startPublisher(t, 3)
+	ctx := context.Background()
+	first := newFakeChannel()
+	firstSession := first.session()
+	dials <- firstSession
+	if err := p.PublishEvent(ctx, testEvent()); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	firstSession.connClosed <- amqp.ErrClosed
+	waitFor(t, "the connection to drop", func() bool { return !p.Metrics().Connected })
+	if !first.IsClosed() {
+		t.Fatalf("expected the broken session to be closed")
+	}
+
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() { results <- p.PublishEvent(ctx, testEvent()) }()
+	}
+	waitFor(t, "the messages to be buffered", func() bool { return p.Metrics().Buffered == 3 })
+	if err := p.PublishEvent(ctx, testEvent()); !errors.Is(err, ErrBufferFull) {
+		t.Fatalf("expected a full buffer to reject the message, got %v", err)
+	}
+
+	second := newFakeChannel()
+	dials <- second.session()
+	for i := 0; i < 3; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("publish after reconnecting: %v", err)
+		}
+	}
+	if second.publishedCount() != 3 || first.publishedCount() != 1 {
+		t.Fatalf("expected the buffered messages on the new channel, got %d and %d", first.publishedCount(), second.publishedCount())
+	}
+	if metrics := p.Metrics(); metrics.Reconnects != 1 || metrics.Published != 4 || metrics.Rejected != 1 {
+		t.Fatalf("unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestPublisherCloseFailsBufferedMessages(t *testing.T) {
+	p, _ := startPublisher(t, 10)
+	ctx := context.Background()
+
+	result := make(chan error, 1)
+	go func() { result <- p.PublishEvent(ctx, testEvent()) }()
+	waitFor(t, "the message to be buffered", func() bool { return p.Metrics().Buffered == 1 })
+
+	p.Close()
+	if err := <-result; !errors.Is(err, ErrPublisherClosed) {
+		t.Fatalf("expected the buffered message to fail, got %v", err)
+	}
+	if err := p.PublishEvent(ctx, testEvent()); !errors.Is(err, ErrPublisherClosed) {
+		t.Fatalf("expected publishing after Close to fail, got %v", err)
+	}
+}
+
+func TestPublisherCloseReleasesTheSession(t *testing.T) {
+	p, dials := startPublisher(t, 10)
+	ch := newFakeChannel()
+	dials <- ch.session()
+	if err := p.PublishEvent(context.Background(), testEvent()); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	p.Close()
+	if !ch.IsClosed() {
+		t.Fatalf("expected Close to close the channel")
+	}
+	if p.Metrics().Connected {
+		t.Fatalf("expected the publisher to report it is disconnected")
+	}
+}
@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"products-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrCartNotFound indicates that the requested cart does not exist.
+var ErrCartNotFound = errors.New("cart not found")
+
+// CartRepository defines persistence operations for shopping carts.
+type CartRepository interface {
+	FindByOwner(ownerKey string) (*models.Cart, error)
+	Save(cart *models.Cart) error
+	DeleteByOwner(ownerKey string) error
+}
+
+// MongoCartRepository stores carts inside MongoDB, one document per owner.
+type MongoCartRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoCartRepository builds a repository backed by a Mongo collection.
+func NewMongoCartRepository(collection *mongo.Collection) *MongoCartRepository {
+	return &MongoCartRepository{collection: collection}
+}
+
+// EnsureIndexes creates the unique owner index and the TTL index that lets
+// MongoDB drop abandoned carts once expires_at is reached.
+func (r *MongoCartRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "owner_key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("create cart indexes: %w", err)
+	}
+	return nil
+}
+
+// FindByOwner returns the cart stored for the given owner key.
+func (r *MongoCartRepository) FindByOwner(ownerKey string) (*models.Cart, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var cart models.Cart
+	if err := r.collection.FindOne(ctx, bson.M{"owner_key": ownerKey}).Decode(&cart); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCartNotFound
+		}
+		return nil, fmt.Errorf("find cart: %w", err)
+	}
+	return &cart, nil
+}
+
+// Save upserts the cart for its owner.
+func (r *MongoCartRepository) Save(cart *models.Cart) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"owner_key": cart.OwnerKey}
+	update := bson.M{
+		"$set": bson.M{
+			"user_id":    cart.UserID,
+			"guest_id":   cart.GuestID,
+			"items":      cart.Items,
+			"updated_at": cart.UpdatedAt,
+			"expires_at": cart.ExpiresAt,
+		},
+		"$setOnInsert": bson.M{
+			"created_at": cart.CreatedAt,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var saved models.Cart
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&saved); err != nil {
+		return fmt.Errorf("save cart: %w", err)
+	}
+	cart.ID = saved.ID
+	cart.CreatedAt = saved.CreatedAt
+	return nil
+}
+
+// DeleteByOwner removes the cart of the given owner, if any.
+func (r *MongoCartRepository) DeleteByOwner(ownerKey string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"owner_key": ownerKey}); err != nil {
+		return fmt.Errorf("delete cart: %w", err)
+	}
+	return nil
+}
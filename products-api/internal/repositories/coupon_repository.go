@@ -0,0 +1,339 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"products-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrCouponNotFound indicates that the coupon does not exist.
+	ErrCouponNotFound = errors.New("coupon not found")
+	// ErrCouponExhausted indicates that the coupon reached its global usage limit.
+	ErrCouponExhausted = errors.New("coupon usage limit reached")
+	// ErrCouponUserLimit indicates that the user reached the coupon's per-user usage limit.
+	ErrCouponUserLimit = errors.New("coupon usage limit reached for this user")
+	// ErrDuplicateCouponCode indicates that another coupon already uses the code.
+	ErrDuplicateCouponCode = errors.New("coupon code already exists")
+)
+
+// CouponRepository defines persistence operations for coupons and their redemptions.
+type CouponRepository interface {
+	Create(coupon *models.Coupon) error
+	Update(coupon *models.Coupon) error
+	Delete(id string) error
+	FindByID(id string) (*models.Coupon, error)
+	FindByCode(code string) (*models.Coupon, error)
+	FindAll() ([]models.Coupon, error)
+	FindActiveAutomatic(now time.Time) ([]models.Coupon, error)
+	IncrementUses(id primitive.ObjectID, maxUses int) error
+	DecrementUses(id primitive.ObjectID) error
+	ReserveUserUse(couponID primitive.ObjectID, userID string, maxPerUser int) error
+	ReleaseUserUse(couponID primitive.ObjectID, userID string) error
+	RecordRedemption(redemption *models.CouponRedemption) error
+	DeleteRedemptions(purchaseID primitive.ObjectID) error
+}
+
+// MongoCouponRepository stores coupons and redemptions in MongoDB.
+type MongoCouponRepository struct {
+	coupons     *mongo.Collection
+	redemptions *mongo.Collection
+	userUses    *mongo.Collection
+}
+
+// NewMongoCouponRepository builds a repository backed by the coupons and
+// redemptions collections, and by userUses, which counts the uses of each
+// coupon by each user.
+func NewMongoCouponRepository(coupons, redemptions, userUses *mongo.Collection) *MongoCouponRepository {
+	return &MongoCouponRepository{coupons: coupons, redemptions: redemptions, userUses: userUses}
+}
+
+// EnsureIndexes creates the unique code index and the redemption lookup index.
+func (r *MongoCouponRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coupons.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "codigo", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			"codigo": bson.M{"$type": "string"},
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("create coupon indexes: %w", err)
+	}
+	_, err = r.redemptions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "coupon_id", Value: 1}, {Key: "user_id", Value: 1}},
+	})
+	if err == nil {
+		_, err = r.redemptions.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "purchase_id", Value: 1}},
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("create redemption indexes: %w", err)
+	}
+	return nil
+}
+
+// Create inserts a new coupon.
+func (r *MongoCouponRepository) Create(coupon *models.Coupon) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := r.coupons.InsertOne(ctx, coupon)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateCouponCode
+		}
+		return fmt.Errorf("insert coupon: %w", err)
+	}
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		coupon.ID = oid
+	}
+	return nil
+}
+
+// Update persists changes to the editable coupon fields. The usage counter is
+// left untouched so concurrent redemptions are not lost.
+func (r *MongoCouponRepository) Update(coupon *models.Coupon) error {
+	if coupon.ID.IsZero() {
+		return errors.New("coupon id is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{
+		"descripcion":          coupon.Descripcion,
+		"tipo":                 coupon.Tipo,
+		"valor":                coupon.Valor,
+		"producto_gratis_id":   coupon.ProductoGratisID,
+		"minimo_compra":        coupon.MinimoCompra,
+		"max_usos":             coupon.MaxUsos,
+		"max_usos_por_usuario": coupon.MaxUsosPorUsuario,
+		"valido_desde":         coupon.ValidoDesde,
+		"valido_hasta":         coupon.ValidoHasta,
+		"marcas":               coupon.Marcas,
+		"tipos":                coupon.Tipos,
+		"automatico":           coupon.Automatico,
+		"activo":               coupon.Activo,
+		"updated_at":           coupon.UpdatedAt,
+	}
+	update := bson.M{"$set": set}
+	if coupon.Codigo != "" {
+		set["codigo"] = coupon.Codigo
+	} else {
+		update["$unset"] = bson.M{"codigo": ""}
+	}
+
+	res, err := r.coupons.UpdateOne(ctx, bson.M{"_id": coupon.ID}, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateCouponCode
+		}
+		return fmt.Errorf("update coupon: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrCouponNotFound
+	}
+	return nil
+}
+
+// Delete removes a coupon by ID.
+func (r *MongoCouponRepository) Delete(id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrCouponNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := r.coupons.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return fmt.Errorf("delete coupon: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrCouponNotFound
+	}
+	return nil
+}
+
+// FindByID locates a coupon by ID.
+func (r *MongoCouponRepository) FindByID(id string) (*models.Coupon, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrCouponNotFound
+	}
+	return r.findOne(bson.M{"_id": oid})
+}
+
+// FindByCode locates a coupon by its (case-insensitive) code.
+func (r *MongoCouponRepository) FindByCode(code string) (*models.Coupon, error) {
+	return r.findOne(bson.M{"codigo": strings.ToUpper(strings.TrimSpace(code))})
+}
+
+// FindAll lists every coupon, newest first.
+func (r *MongoCouponRepository) FindAll() ([]models.Coupon, error) {
+	return r.find(bson.M{})
+}
+
+// FindActiveAutomatic returns the automatic promotions valid at the given instant.
+func (r *MongoCouponRepository) FindActiveAutomatic(now time.Time) ([]models.Coupon, error) {
+	return r.find(bson.M{
+		"automatico":   true,
+		"activo":       true,
+		"valido_desde": bson.M{"$lte": now},
+		"valido_hasta": bson.M{"$gte": now},
+	})
+}
+
+// IncrementUses atomically consumes one use, failing when maxUses (if positive) was reached.
+func (r *MongoCouponRepository) IncrementUses(id primitive.ObjectID, maxUses int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id}
+	if maxUses > 0 {
+		filter["usos"] = bson.M{"$lt": maxUses}
+	}
+	res, err := r.coupons.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"usos": 1}})
+	if err != nil {
+		return fmt.Errorf("increment coupon uses: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrCouponExhausted
+	}
+	return nil
+}
+
+// DecrementUses gives back a use consumed by a checkout that did not complete.
+func (r *MongoCouponRepository) DecrementUses(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.coupons.UpdateOne(ctx, bson.M{"_id": id, "usos": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"usos": -1}})
+	if err != nil {
+		return fmt.Errorf("decrement coupon uses: %w", err)
+	}
+	return nil
+}
+
+// ReserveUserUse atomically consumes one of the user's uses of the coupon,
+// failing with ErrCouponUserLimit when maxPerUser were already consumed. The
+// uses are counted in one document per coupon and user, updated only while
+// below the limit; a missing document is seeded from the redemptions
+// recorded before it existed, and its unique _id makes concurrent first uses
+// fall back to the conditional update.
+func (r *MongoCouponRepository) ReserveUserUse(couponID primitive.ObjectID, userID string, maxPerUser int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	id := userUseID(couponID, userID)
+	for attempt := 0; attempt < 2; attempt++ {
+		res, err := r.userUses.UpdateOne(ctx, bson.M{"_id": id, "usos": bson.M{"$lt": maxPerUser}}, bson.M{"$inc": bson.M{"usos": 1}})
+		if err != nil {
+			return fmt.Errorf("reserve coupon user use: %w", err)
+		}
+		if res.MatchedCount > 0 {
+			return nil
+		}
+
+		recorded, err := r.redemptions.CountDocuments(ctx, bson.M{"coupon_id": couponID, "user_id": userID})
+		if err != nil {
+			return fmt.Errorf("count redemptions: %w", err)
+		}
+		if recorded >= int64(maxPerUser) {
+			return ErrCouponUserLimit
+		}
+		_, err = r.userUses.InsertOne(ctx, bson.M{"_id": id, "usos": recorded + 1})
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("reserve coupon user use: %w", err)
+		}
+	}
+	return ErrCouponUserLimit
+}
+
+// ReleaseUserUse gives back a use reserved by a checkout that did not complete.
+func (r *MongoCouponRepository) ReleaseUserUse(couponID primitive.ObjectID, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.userUses.UpdateOne(ctx, bson.M{"_id": userUseID(couponID, userID), "usos": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"usos": -1}})
+	if err != nil {
+		return fmt.Errorf("release coupon user use: %w", err)
+	}
+	return nil
+}
+
+func userUseID(couponID primitive.ObjectID, userID string) bson.D {
+	return bson.D{{Key: "coupon_id", Value: couponID}, {Key: "user_id", Value: userID}}
+}
+
+// RecordRedemption stores a redemption entry.
+func (r *MongoCouponRepository) RecordRedemption(redemption *models.CouponRedemption) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := r.redemptions.InsertOne(ctx, redemption)
+	if err != nil {
+		return fmt.Errorf("insert redemption: %w", err)
+	}
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		redemption.ID = oid
+	}
+	return nil
+}
+
+// DeleteRedemptions removes the redemptions recorded for a purchase that was not completed.
+func (r *MongoCouponRepository) DeleteRedemptions(purchaseID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := r.redemptions.DeleteMany(ctx, bson.M{"purchase_id": purchaseID}); err != nil {
+		return fmt.Errorf("delete redemptions: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoCouponRepository) findOne(filter bson.M) (*models.Coupon, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var coupon models.Coupon
+	if err := r.coupons.FindOne(ctx, filter).Decode(&coupon); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, fmt.Errorf("find coupon: %w", err)
+	}
+	return &coupon, nil
+}
+
+func (r *MongoCouponRepository) find(filter bson.M) ([]models.Coupon, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.coupons.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find coupons: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	coupons := []models.Coupon{}
+	if err := cursor.All(ctx, &coupons); err != nil {
+		return nil, fmt.Errorf("decode coupons: %w", err)
+	}
+	return coupons, nil
+}
@@ -0,0 +1,169 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"products-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sentOutboxRetention is how long relayed events are kept for troubleshooting.
+const sentOutboxRetention = 7 * 24 * time.Hour
+
+// OutboxRepository gives the relay access to pending events.
+type OutboxRepository interface {
+	// FindDue returns due pending events oldest first, leaving out those
+	// with an older pending event of the same aggregate.
+	FindDue(now time.Time, limit int64) ([]models.OutboxEvent, error)
+	MarkSent(id primitive.ObjectID, sentAt time.Time) error
+	MarkFailed(id primitive.ObjectID, attempts int, nextAttemptAt time.Time, lastError string) error
+}
+
+// MongoOutboxRepository stores outbox events in MongoDB. Events are written
+// in the same transaction as the data change, which requires MongoDB to run
+// as a replica set.
+type MongoOutboxRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoOutboxRepository builds an outbox over the given collection.
+func NewMongoOutboxRepository(collection *mongo.Collection) *MongoOutboxRepository {
+	return &MongoOutboxRepository{collection: collection}
+}
+
+// EnsureIndexes creates the relay index and the TTL index that purges sent events.
+func (r *MongoOutboxRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "sent_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(sentOutboxRetention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("create outbox indexes: %w", err)
+	}
+	return nil
+}
+
+// FindDue returns pending events whose next attempt is due, oldest first.
+// An event is held back while an older event of the same aggregate is still
+// pending, even if that one is not due yet, so a product's events are
+// published in the order they were written.
+func (r *MongoOutboxRepository) FindDue(now time.Time, limit int64) ([]models.OutboxEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"status": models.OutboxPending}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find outbox events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var events []models.OutboxEvent
+	blocked := map[string]bool{}
+	for cursor.Next(ctx) && (limit <= 0 || int64(len(events)) < limit) {
+		var event models.OutboxEvent
+		if err := cursor.Decode(&event); err != nil {
+			return nil, fmt.Errorf("decode outbox event: %w", err)
+		}
+		if blocked[event.AggregateID] {
+			continue
+		}
+		if event.NextAttemptAt.After(now) {
+			blocked[event.AggregateID] = true
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("find outbox events: %w", err)
+	}
+	return events, nil
+}
+
+// MarkSent flags an event as relayed.
+func (r *MongoOutboxRepository) MarkSent(id primitive.ObjectID, sentAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"status":  models.OutboxSent,
+		"sent_at": sentAt,
+	}})
+	if err != nil {
+		return fmt.Errorf("mark outbox event sent: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed records a failed relay attempt and schedules the next one.
+func (r *MongoOutboxRepository) MarkFailed(id primitive.ObjectID, attempts int, nextAttemptAt time.Time, lastError string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}})
+	if err != nil {
+		return fmt.Errorf("mark outbox event failed: %w", err)
+	}
+	return nil
+}
+
+// withEvents runs write and stores events in one transaction, so the relay
+// never sees an event for a change that was not applied nor misses one that
+// was.
+func (r *MongoOutboxRepository) withEvents(ctx context.Context, events []models.OutboxEvent, write func(ctx context.Context) error) error {
+	if len(events) == 0 {
+		return write(ctx)
+	}
+	return inTransaction(ctx, r.collection.Database().Client(), func(ctx context.Context) error {
+		if err := write(ctx); err != nil {
+			return err
+		}
+		return r.insert(ctx, events)
+	})
+}
+
+// insert stores events as pending, inside the caller's transaction.
+func (r *MongoOutboxRepository) insert(ctx context.Context, events []models.OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, 0, len(events))
+	for i := range events {
+		if events[i].ID.IsZero() {
+			events[i].ID = primitive.NewObjectID()
+		}
+		docs = append(docs, events[i])
+	}
+	if _, err := r.collection.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("insert outbox events: %w", err)
+	}
+	return nil
+}
+
+// inTransaction runs fn in a transaction of client; writes made with the
+// context fn receives are committed or discarded together.
+func inTransaction(ctx context.Context, client *mongo.Client, fn func(ctx context.Context) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return fmt.Errorf("start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
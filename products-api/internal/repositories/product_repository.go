@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	"products-api/internal/models"
@@ -14,76 +15,116 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// ErrNotFound indicates that a product was not located in the database.
-var ErrNotFound = errors.New("product not found")
+var (
+	// ErrNotFound indicates that a product was not located in the database.
+	ErrNotFound = errors.New("product not found")
+	// ErrVersionConflict indicates that the product changed since it was read.
+	ErrVersionConflict = errors.New("product was modified concurrently")
+)
 
 // ProductFilter encapsulates optional filters for listing products.
 type ProductFilter struct {
-	Tipo     string
-	Estacion string
-	Ocasion  string
-	Genero   string
-	Marca    string
-	Texto    string
+	// Tipo, Estacion, Ocasion, Genero and Marca match products with any of
+	// the given values, ignoring case.
+	Tipo     []string
+	Estacion []string
+	Ocasion  []string
+	Genero   []string
+	Marca    []string
+	// Notas matches products with any or, with NotasMatch NotasMatchAll,
+	// all of the given notes, ignoring case.
+	Notas      []string
+	NotasMatch string
+	// PrecioMin and PrecioMax bound the price; zero leaves the bound open.
+	PrecioMin float64
+	PrecioMax float64
+	// InStock keeps only products with stock.
+	InStock bool
+	Texto   string
 }
 
+// NotasMatchAny and NotasMatchAll are the ways ProductFilter.Notas can match.
+const (
+	NotasMatchAny = "any"
+	NotasMatchAll = "all"
+)
+
 // Pagination controls paging for list operations.
 type Pagination struct {
 	Page     int
 	PageSize int
 }
 
-// ProductRepository defines the data access contract.
+// ProductRepository defines the data access contract. Write operations store
+// the given events in the outbox atomically with the change. Update expects
+// p.Version to be one more than the stored version and Delete the stored
+// version itself; otherwise they fail with ErrVersionConflict.
 type ProductRepository interface {
-	Create(p *models.Product) error
-	Update(p *models.Product) error
-	Delete(id string) error
+	Create(p *models.Product, events ...models.OutboxEvent) error
+	Update(p *models.Product, events ...models.OutboxEvent) error
+	Delete(id string, version int64, events ...models.OutboxEvent) error
 	FindByID(id string) (*models.Product, error)
 	FindAll(filter ProductFilter, pagination Pagination) ([]models.Product, int64, error)
+	FindAfter(afterID string, limit int) ([]models.Product, error)
 }
 
 // MongoProductRepository persists products in MongoDB.
 type MongoProductRepository struct {
 	collection *mongo.Collection
+	outbox     *MongoOutboxRepository
 }
 
-// NewMongoProductRepository builds a Mongo-backed repository.
-func NewMongoProductRepository(collection *mongo.Collection) *MongoProductRepository {
-	return &MongoProductRepository{collection: collection}
+// NewMongoProductRepository builds a Mongo-backed repository. outbox may be
+// nil, in which case events passed to write operations are dropped.
+func NewMongoProductRepository(collection *mongo.Collection, outbox *MongoOutboxRepository) *MongoProductRepository {
+	return &MongoProductRepository{collection: collection, outbox: outbox}
 }
 
 // Create inserts a new product document.
-func (r *MongoProductRepository) Create(p *models.Product) error {
+func (r *MongoProductRepository) Create(p *models.Product, events ...models.OutboxEvent) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	res, err := r.collection.InsertOne(ctx, p)
-	if err != nil {
-		return fmt.Errorf("insert product: %w", err)
-	}
+	return r.withEvents(ctx, events, func(ctx context.Context) error {
+		res, err := r.collection.InsertOne(ctx, p)
+		if err != nil {
+			return fmt.Errorf("insert product: %w", err)
+		}
 
-	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
-		p.ID = oid
-	}
-	return nil
+		if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+			p.ID = oid
+		}
+		return nil
+	})
 }
 
 // Update persists changes for an existing product.
-func (r *MongoProductRepository) Update(p *models.Product) error {
-	if p.ID.IsZero() {
-		return errors.New("product id is required")
-	}
-
+func (r *MongoProductRepository) Update(p *models.Product, events ...models.OutboxEvent) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{"_id": p.ID}
+	return r.withEvents(ctx, events, func(ctx context.Context) error {
+		return r.update(ctx, p, nil)
+	})
+}
+
+// update writes p with Update's version check and the extra conditions of
+// guard, inside the caller's transaction if ctx carries one.
+func (r *MongoProductRepository) update(ctx context.Context, p *models.Product, guard bson.M) error {
+	if p.ID.IsZero() {
+		return errors.New("product id is required")
+	}
+	filter := bson.M{"_id": p.ID, "version": versionMatch(p.Version - 1)}
+	for field, condition := range guard {
+		filter[field] = condition
+	}
 	update := bson.M{
 		"$set": bson.M{
 			"name":        p.Name,
 			"descripcion": p.Descripcion,
 			"precio":      p.Precio,
 			"stock":       p.Stock,
+			"variantes":   p.Variantes,
 			"tipo":        p.Tipo,
 			"estacion":    p.Estacion,
 			"ocasion":     p.Ocasion,
@@ -93,6 +134,7 @@ func (r *MongoProductRepository) Update(p *models.Product) error {
 			"imagen":      p.Imagen,
 			"score":       p.Score,
 			"updated_at":  p.UpdatedAt,
+			"version":     p.Version,
 		},
 	}
 
@@ -101,13 +143,13 @@ func (r *MongoProductRepository) Update(p *models.Product) error {
 		return fmt.Errorf("update product: %w", err)
 	}
 	if res.MatchedCount == 0 {
-		return ErrNotFound
+		return r.missOrConflict(ctx, p.ID)
 	}
 	return nil
 }
 
 // Delete removes a product by ID.
-func (r *MongoProductRepository) Delete(id string) error {
+func (r *MongoProductRepository) Delete(id string, version int64, events ...models.OutboxEvent) error {
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return fmt.Errorf("invalid id: %w", err)
@@ -116,14 +158,68 @@ func (r *MongoProductRepository) Delete(id string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": oid})
+	return r.withEvents(ctx, events, func(ctx context.Context) error {
+		res, err := r.collection.DeleteOne(ctx, bson.M{"_id": oid, "version": versionMatch(version)})
+		if err != nil {
+			return fmt.Errorf("delete product: %w", err)
+		}
+		if res.DeletedCount == 0 {
+			return r.missOrConflict(ctx, oid)
+		}
+		return nil
+	})
+}
+
+// missOrConflict explains why a versioned write matched no document.
+func (r *MongoProductRepository) missOrConflict(ctx context.Context, id primitive.ObjectID) error {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
 	if err != nil {
-		return fmt.Errorf("delete product: %w", err)
+		return fmt.Errorf("check product: %w", err)
 	}
-	if res.DeletedCount == 0 {
+	if count == 0 {
 		return ErrNotFound
 	}
-	return nil
+	return ErrVersionConflict
+}
+
+// reservedAtMost matches products holding at most caps[sku] of each SKU in
+// reservations; nil when there are no caps.
+func reservedAtMost(caps map[string]int) bson.M {
+	if len(caps) == 0 {
+		return nil
+	}
+	conditions := make(bson.A, 0, len(caps))
+	for sku, limit := range caps {
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"reservados." + sku: bson.M{"$lte": limit}},
+			bson.M{"reservados." + sku: bson.M{"$exists": false}},
+		}})
+	}
+	return bson.M{"$and": conditions}
+}
+
+// versionMatch matches the given stored version; products written before
+// versioning have no version field and count as version 0.
+func versionMatch(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+func (r *MongoProductRepository) withEvents(ctx context.Context, events []models.OutboxEvent, write func(ctx context.Context) error) error {
+	if r.outbox == nil {
+		return write(ctx)
+	}
+	return r.outbox.withEvents(ctx, events, write)
+}
+
+// insertEvents stores events inside the caller's transaction.
+func (r *MongoProductRepository) insertEvents(ctx context.Context, events []models.OutboxEvent) error {
+	if r.outbox == nil {
+		return nil
+	}
+	return r.outbox.insert(ctx, events)
 }
 
 // FindByID locates a product by ID.
@@ -143,6 +239,7 @@ func (r *MongoProductRepository) FindByID(id string) (*models.Product, error) {
 		}
 		return nil, fmt.Errorf("find product: %w", err)
 	}
+	product.EnsureDefaultVariant()
 	return &product, nil
 }
 
@@ -173,6 +270,9 @@ func (r *MongoProductRepository) FindAll(filter ProductFilter, pagination Pagina
 	if err := cursor.All(ctx, &products); err != nil {
 		return nil, 0, fmt.Errorf("decode products: %w", err)
 	}
+	for i := range products {
+		products[i].EnsureDefaultVariant()
+	}
 
 	total, err := r.collection.CountDocuments(ctx, query)
 	if err != nil {
@@ -182,22 +282,106 @@ func (r *MongoProductRepository) FindAll(filter ProductFilter, pagination Pagina
 	return products, total, nil
 }
 
-func buildQuery(filter ProductFilter) bson.M {
+// FindAfter returns up to limit products ordered by id, starting after
+// afterID. An empty afterID starts from the first product. Paging by id keeps
+// the export stable while products are created or deleted between pages.
+func (r *MongoProductRepository) FindAfter(afterID string, limit int) ([]models.Product, error) {
 	query := bson.M{}
-	if filter.Tipo != "" {
-		query["tipo"] = filter.Tipo
+	if afterID != "" {
+		oid, err := primitive.ObjectIDFromHex(afterID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		query["_id"] = bson.M{"$gt": oid}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("export products: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, fmt.Errorf("decode products: %w", err)
+	}
+	for i := range products {
+		products[i].EnsureDefaultVariant()
+	}
+	return products, nil
+}
+
+// MigrateSingleVariantProducts gives every product stored before variants
+// existed a single variant built from its precio and stock, keyed by the
+// product id, and moves any reserved quantity onto that variant.
+func (r *MongoProductRepository) MigrateSingleVariantProducts(ctx context.Context) (int64, error) {
+	filter := bson.M{"variantes": bson.M{"$exists": false}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"variantes": bson.A{bson.M{
+				"sku":           bson.M{"$toString": "$_id"},
+				"tamano_ml":     0,
+				"concentracion": "",
+				"precio":        "$precio",
+				"stock":         "$stock",
+			}},
+			"reservados": bson.M{"$arrayToObject": bson.A{bson.A{bson.M{
+				"k": bson.M{"$toString": "$_id"},
+				"v": bson.M{"$ifNull": bson.A{"$reservado", 0}},
+			}}}},
+		}}},
+		{{Key: "$unset", Value: "reservado"}},
+	}
+
+	res, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("migrate product variants: %w", err)
 	}
-	if filter.Estacion != "" {
-		query["estacion"] = filter.Estacion
+	return res.ModifiedCount, nil
+}
+
+func buildQuery(filter ProductFilter) bson.M {
+	query := bson.M{}
+	for field, values := range map[string][]string{
+		"tipo":     filter.Tipo,
+		"estacion": filter.Estacion,
+		"ocasion":  filter.Ocasion,
+		"genero":   filter.Genero,
+		"marca":    filter.Marca,
+	} {
+		switch len(values) {
+		case 0:
+		case 1:
+			query[field] = equalFold(values[0])
+		default:
+			query[field] = bson.M{"$in": equalFoldAll(values)}
+		}
 	}
-	if filter.Ocasion != "" {
-		query["ocasion"] = filter.Ocasion
+	if len(filter.Notas) > 0 {
+		operator := "$in"
+		if filter.NotasMatch == NotasMatchAll {
+			operator = "$all"
+		}
+		query["notas"] = bson.M{operator: equalFoldAll(filter.Notas)}
 	}
-	if filter.Genero != "" {
-		query["genero"] = filter.Genero
+	if filter.PrecioMin > 0 || filter.PrecioMax > 0 {
+		precio := bson.M{}
+		if filter.PrecioMin > 0 {
+			precio["$gte"] = filter.PrecioMin
+		}
+		if filter.PrecioMax > 0 {
+			precio["$lte"] = filter.PrecioMax
+		}
+		query["precio"] = precio
 	}
-	if filter.Marca != "" {
-		query["marca"] = filter.Marca
+	if filter.InStock {
+		query["stock"] = bson.M{"$gt": 0}
 	}
 	if filter.Texto != "" {
 		regex := primitive.Regex{Pattern: filter.Texto, Options: "i"}
@@ -208,3 +392,17 @@ func buildQuery(filter ProductFilter) bson.M {
 	}
 	return query
 }
+
+// equalFold matches values equal to value ignoring case. Values are stored
+// as typed ("Dior") while callers such as search-api send them lowercased.
+func equalFold(value string) primitive.Regex {
+	return primitive.Regex{Pattern: "^" + regexp.QuoteMeta(value) + "$", Options: "i"}
+}
+
+func equalFoldAll(values []string) []primitive.Regex {
+	regexes := make([]primitive.Regex, 0, len(values))
+	for _, value := range values {
+		regexes = append(regexes, equalFold(value))
+	}
+	return regexes
+}
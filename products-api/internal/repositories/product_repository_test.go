@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"regexp"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matchesRegex evaluates a Mongo regex the way the server does for the
+// options used by buildQuery.
+func matchesRegex(t *testing.T, regex primitive.Regex, value string) bool {
+	t.Helper()
+	pattern := regex.Pattern
+	if regex.Options == "i" {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.MustCompile(pattern).MatchString(value)
+}
+
+func TestBuildQueryMatchesFilterValuesIgnoringCase(t *testing.T) {
+	// search-api forwards filters lowercased while its backend is down.
+	query := buildQuery(ProductFilter{Marca: []string{"dior"}, Tipo: []string{"floral", "c.tricos"}})
+
+	marca, ok := query["marca"].(primitive.Regex)
+	if !ok {
+		t.Fatalf("expected a regex for marca, got %#v", query["marca"])
+	}
+	if !matchesRegex(t, marca, "Dior") || !matchesRegex(t, marca, "DIOR") {
+		t.Fatalf("expected dior to match the brand as typed")
+	}
+	if matchesRegex(t, marca, "Dior Homme") {
+		t.Fatalf("expected the whole value to be compared")
+	}
+
+	tipos := query["tipo"].(bson.M)["$in"].([]primitive.Regex)
+	if len(tipos) != 2 || !matchesRegex(t, tipos[0], "Floral") {
+		t.Fatalf("expected one case-insensitive regex per tipo, got %#v", tipos)
+	}
+	if matchesRegex(t, tipos[1], "citricos") {
+		t.Fatalf("expected filter values to be matched literally")
+	}
+}
+
+func TestReservedAtMostCapsEverySKU(t *testing.T) {
+	if reservedAtMost(nil) != nil {
+		t.Fatalf("expected no condition without caps")
+	}
+	conditions := reservedAtMost(map[string]int{"a": 2, "b": 0})["$and"].(bson.A)
+	if len(conditions) != 2 {
+		t.Fatalf("expected one condition per SKU, got %#v", conditions)
+	}
+	for _, condition := range conditions {
+		alternatives := condition.(bson.M)["$or"].(bson.A)
+		capped := alternatives[0].(bson.M)
+		if len(capped) != 1 {
+			t.Fatalf("expected a cap on one SKU, got %#v", capped)
+		}
+		for field, cap := range capped {
+			want := map[string]int{"reservados.a": 2, "reservados.b": 0}[field]
+			if cap.(bson.M)["$lte"] != want {
+				t.Fatalf("expected %s capped at %d, got %#v", field, want, cap)
+			}
+		}
+	}
+}
+
+func TestBuildQueryMatchesNotesIgnoringCase(t *testing.T) {
+	query := buildQuery(ProductFilter{Notas: []string{"vainilla", "rosa"}, NotasMatch: NotasMatchAll})
+
+	notas := query["notas"].(bson.M)["$all"].([]primitive.Regex)
+	if len(notas) != 2 || !matchesRegex(t, notas[0], "Vainilla") || !matchesRegex(t, notas[1], "Rosa") {
+		t.Fatalf("expected case-insensitive notes, got %#v", notas)
+	}
+}
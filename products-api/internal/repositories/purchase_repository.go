@@ -13,35 +13,68 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// PurchaseRepository defines operations for persisting purchases.
+// StockUpdate is a product whose stock a purchase changes, written like
+// ProductRepository.Update, and the events stored with the change.
+// Reservations do not change the product version, so MaxReserved caps, by
+// SKU, the quantity they may hold for the write to apply; a hold placed
+// after the product was read that no longer fits in the new stock makes the
+// write fail with ErrVersionConflict.
+type StockUpdate struct {
+	Product     *models.Product
+	Events      []models.OutboxEvent
+	MaxReserved map[string]int
+}
+
+// PurchaseRepository defines operations for persisting purchases. Create
+// stores the purchase together with the stock updates of its products in one
+// transaction, so either all of them are written or none is; an update of a
+// product that changed since it was read fails with ErrVersionConflict.
 type PurchaseRepository interface {
-	Create(purchase *models.Purchase) error
+	Create(purchase *models.Purchase, updates ...StockUpdate) error
 	FindByUserID(userID string) ([]models.Purchase, error)
 }
 
 // MongoPurchaseRepository stores purchases inside MongoDB.
 type MongoPurchaseRepository struct {
 	collection *mongo.Collection
+	products   *MongoProductRepository
 }
 
-// NewMongoPurchaseRepository builds a repository backed by a Mongo collection.
-func NewMongoPurchaseRepository(collection *mongo.Collection) *MongoPurchaseRepository {
-	return &MongoPurchaseRepository{collection: collection}
+// NewMongoPurchaseRepository builds a repository backed by a Mongo
+// collection, writing stock updates through products.
+func NewMongoPurchaseRepository(collection *mongo.Collection, products *MongoProductRepository) *MongoPurchaseRepository {
+	return &MongoPurchaseRepository{collection: collection, products: products}
 }
 
-// Create persists a purchase record.
-func (r *MongoPurchaseRepository) Create(purchase *models.Purchase) error {
+// Create persists a purchase record and the stock updates of its products.
+func (r *MongoPurchaseRepository) Create(purchase *models.Purchase, updates ...StockUpdate) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	res, err := r.collection.InsertOne(ctx, purchase)
-	if err != nil {
-		return fmt.Errorf("insert purchase: %w", err)
+	insert := func(ctx context.Context) error {
+		res, err := r.collection.InsertOne(ctx, purchase)
+		if err != nil {
+			return fmt.Errorf("insert purchase: %w", err)
+		}
+		if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+			purchase.ID = oid
+		}
+		return nil
 	}
-	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
-		purchase.ID = oid
+	if len(updates) == 0 {
+		return insert(ctx)
 	}
-	return nil
+	return inTransaction(ctx, r.collection.Database().Client(), func(ctx context.Context) error {
+		for _, update := range updates {
+			if err := r.products.update(ctx, update.Product, reservedAtMost(update.MaxReserved)); err != nil {
+				return err
+			}
+			if err := r.products.insertEvents(ctx, update.Events); err != nil {
+				return err
+			}
+		}
+		return insert(ctx)
+	})
 }
 
 // FindByUserID returns purchases for a given user sorted by newest first.
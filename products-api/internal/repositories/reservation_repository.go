@@ -0,0 +1,221 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"products-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrReservationNotFound indicates that the reservation does not exist.
+	ErrReservationNotFound = errors.New("reservation not found")
+	// ErrReservationConflict indicates that the reservation is no longer in the expected status.
+	ErrReservationConflict = errors.New("reservation status changed")
+	// ErrStockUnavailable indicates that a hold could not be placed on the requested quantity.
+	ErrStockUnavailable = errors.New("stock unavailable")
+)
+
+// ReservationRepository persists reservations and the reserved counters on products.
+type ReservationRepository interface {
+	Create(reservation *models.Reservation) error
+	FindByID(id string) (*models.Reservation, error)
+	FindExpired(now time.Time, limit int64) ([]models.Reservation, error)
+	Transition(id primitive.ObjectID, from, to string, purchaseID primitive.ObjectID) error
+	HoldStock(productID primitive.ObjectID, sku string, quantity int) error
+	ReleaseStock(productID primitive.ObjectID, sku string, quantity int) error
+	FindReservedStock() ([]models.Product, error)
+}
+
+// MongoReservationRepository stores reservations in MongoDB and keeps the
+// reservados counters of each product, by variant SKU, in sync.
+type MongoReservationRepository struct {
+	reservations *mongo.Collection
+	products     *mongo.Collection
+}
+
+// NewMongoReservationRepository builds a repository over the reservations and products collections.
+func NewMongoReservationRepository(reservations, products *mongo.Collection) *MongoReservationRepository {
+	return &MongoReservationRepository{reservations: reservations, products: products}
+}
+
+// EnsureIndexes creates the index used by the expiry sweeper.
+func (r *MongoReservationRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.reservations.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("create reservation indexes: %w", err)
+	}
+	return nil
+}
+
+// Create inserts a reservation.
+func (r *MongoReservationRepository) Create(reservation *models.Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := r.reservations.InsertOne(ctx, reservation)
+	if err != nil {
+		return fmt.Errorf("insert reservation: %w", err)
+	}
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		reservation.ID = oid
+	}
+	return nil
+}
+
+// FindByID locates a reservation by ID.
+func (r *MongoReservationRepository) FindByID(id string) (*models.Reservation, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrReservationNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var reservation models.Reservation
+	if err := r.reservations.FindOne(ctx, bson.M{"_id": oid}).Decode(&reservation); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrReservationNotFound
+		}
+		return nil, fmt.Errorf("find reservation: %w", err)
+	}
+	return &reservation, nil
+}
+
+// FindExpired returns active reservations whose hold elapsed before now.
+func (r *MongoReservationRepository) FindExpired(now time.Time, limit int64) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "expires_at", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := r.reservations.Find(ctx, bson.M{
+		"status":     models.ReservationActive,
+		"expires_at": bson.M{"$lt": now},
+	}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find expired reservations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var reservations []models.Reservation
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return nil, fmt.Errorf("decode reservations: %w", err)
+	}
+	return reservations, nil
+}
+
+// Transition moves a reservation between statuses only if it is still in the
+// from status, so concurrent confirm/release/expire calls cannot both win.
+func (r *MongoReservationRepository) Transition(id primitive.ObjectID, from, to string, purchaseID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{"status": to, "updated_at": time.Now().UTC()}
+	if !purchaseID.IsZero() {
+		set["purchase_id"] = purchaseID
+	}
+	res, err := r.reservations.UpdateOne(ctx, bson.M{"_id": id, "status": from}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("update reservation: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrReservationConflict
+	}
+	return nil
+}
+
+// HoldStock atomically increases the reserved counter of the variant when
+// enough variant stock is available.
+func (r *MongoReservationRepository) HoldStock(productID primitive.ObjectID, sku string, quantity int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	variantStock := bson.M{"$first": bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$variantes", bson.A{}}},
+			"as":    "v",
+			"cond":  bson.M{"$eq": bson.A{"$$v.sku", sku}},
+		}},
+		"as": "v",
+		"in": "$$v.stock",
+	}}}
+	filter := bson.M{
+		"_id": productID,
+		"$expr": bson.M{"$gte": bson.A{
+			bson.M{"$subtract": bson.A{
+				bson.M{"$ifNull": bson.A{variantStock, 0}},
+				bson.M{"$ifNull": bson.A{"$reservados." + sku, 0}},
+			}},
+			quantity,
+		}},
+	}
+	update := bson.M{"$inc": bson.M{"reservados." + sku: quantity}}
+
+	res, err := r.products.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("hold stock: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrStockUnavailable
+	}
+	return nil
+}
+
+// ReleaseStock decreases the reserved counter of the variant without letting it go negative.
+func (r *MongoReservationRepository) ReleaseStock(productID primitive.ObjectID, sku string, quantity int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	field := "reservados." + sku
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{field: bson.M{"$max": bson.A{
+		0,
+		bson.M{"$subtract": bson.A{bson.M{"$ifNull": bson.A{"$" + field, 0}}, quantity}},
+	}}}}}}
+	if _, err := r.products.UpdateOne(ctx, bson.M{"_id": productID}, update); err != nil {
+		return fmt.Errorf("release stock: %w", err)
+	}
+	return nil
+}
+
+// FindReservedStock returns products that currently have stock on hold, the
+// most reserved first.
+func (r *MongoReservationRepository) FindReservedStock() ([]models.Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reserved := bson.M{"$sum": bson.M{"$map": bson.M{
+		"input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$reservados", bson.M{}}}},
+		"in":    "$$this.v",
+	}}}
+	cursor, err := r.products.Find(ctx, bson.M{"$expr": bson.M{"$gt": bson.A{reserved, 0}}})
+	if err != nil {
+		return nil, fmt.Errorf("find reserved stock: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	products := []models.Product{}
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, fmt.Errorf("decode products: %w", err)
+	}
+	for i := range products {
+		products[i].EnsureDefaultVariant()
+	}
+	sort.SliceStable(products, func(i, j int) bool {
+		return products[i].Reserved() > products[j].Reserved()
+	})
+	return products, nil
+}
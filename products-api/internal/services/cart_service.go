@@ -0,0 +1,462 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"products-api/internal/models"
+	"products-api/internal/repositories"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxCartItemQuantity = 99
+
+// ErrCartItemNotFound indicates that the product variant is not part of the cart.
+var ErrCartItemNotFound = ValidationError{Code: "CART_ITEM_NOT_FOUND", Message: "product is not in the cart"}
+
+// CartOwner identifies who a cart belongs to: an authenticated user or a guest.
+type CartOwner struct {
+	UserID  string
+	GuestID string
+}
+
+func (o CartOwner) key() string {
+	if strings.TrimSpace(o.UserID) != "" {
+		return "user:" + strings.TrimSpace(o.UserID)
+	}
+	return "guest:" + strings.TrimSpace(o.GuestID)
+}
+
+// CartItemInput represents a product and quantity sent by the client.
+type CartItemInput struct {
+	ProductID string
+	SKU       string
+	Cantidad  int
+}
+
+// Checkouter is the subset of PurchaseService used to turn a cart into a purchase.
+type Checkouter interface {
+	CheckoutWithCoupon(userID string, items []CheckoutItemInput, couponCode string) (*models.Purchase, error)
+}
+
+// CartService manages persistent carts and revalidates them against the catalog.
+type CartService struct {
+	cartRepo    repositories.CartRepository
+	productRepo repositories.ProductRepository
+	checkouter  Checkouter
+	ttl         time.Duration
+}
+
+// NewCartService builds a CartService. Carts untouched for longer than ttl expire.
+func NewCartService(cartRepo repositories.CartRepository, productRepo repositories.ProductRepository, checkouter Checkouter, ttl time.Duration) *CartService {
+	if ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+	return &CartService{
+		cartRepo:    cartRepo,
+		productRepo: productRepo,
+		checkouter:  checkouter,
+		ttl:         ttl,
+	}
+}
+
+// GetCart returns the owner's cart with live prices and stock.
+func (s *CartService) GetCart(owner CartOwner) (*models.Cart, error) {
+	cart, err := s.loadCart(owner)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := s.revalidate(cart)
+	if err != nil {
+		return nil, err
+	}
+	if changed && !cart.ID.IsZero() {
+		if err := s.save(cart); err != nil {
+			return nil, err
+		}
+	}
+	return cart, nil
+}
+
+// ReplaceCart overwrites the cart contents with the given items.
+func (s *CartService) ReplaceCart(owner CartOwner, items []CartItemInput) (*models.Cart, error) {
+	cart, err := s.loadCart(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	cart.Items = []models.CartItem{}
+	for _, input := range items {
+		if err := s.putItem(cart, input.ProductID, input.SKU, input.Cantidad, true); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.revalidate(cart); err != nil {
+		return nil, err
+	}
+	if err := s.save(cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// AddItem adds a quantity of a product variant to the cart. The SKU may be
+// empty for single-variant products.
+func (s *CartService) AddItem(owner CartOwner, productID, sku string, cantidad int) (*models.Cart, error) {
+	cart, err := s.loadCart(owner)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.putItem(cart, productID, sku, cantidad, true); err != nil {
+		return nil, err
+	}
+	if _, err := s.revalidate(cart); err != nil {
+		return nil, err
+	}
+	if err := s.save(cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// UpdateItem sets the quantity of a line already in the cart. A zero quantity removes it.
+func (s *CartService) UpdateItem(owner CartOwner, productID, sku string, cantidad int) (*models.Cart, error) {
+	if cantidad == 0 {
+		return s.RemoveItem(owner, productID, sku)
+	}
+	cart, err := s.loadCart(owner)
+	if err != nil {
+		return nil, err
+	}
+	idx := findCartItem(cart, productID, sku)
+	if idx < 0 {
+		return nil, ErrCartItemNotFound
+	}
+	if err := s.putItem(cart, productID, cart.Items[idx].SKU, cantidad, false); err != nil {
+		return nil, err
+	}
+	if _, err := s.revalidate(cart); err != nil {
+		return nil, err
+	}
+	if err := s.save(cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// RemoveItem drops a line from the cart. An empty SKU removes the first line of the product.
+func (s *CartService) RemoveItem(owner CartOwner, productID, sku string) (*models.Cart, error) {
+	cart, err := s.loadCart(owner)
+	if err != nil {
+		return nil, err
+	}
+	idx := findCartItem(cart, productID, sku)
+	if idx < 0 {
+		return nil, ErrCartItemNotFound
+	}
+	cart.Items = append(cart.Items[:idx], cart.Items[idx+1:]...)
+	if _, err := s.revalidate(cart); err != nil {
+		return nil, err
+	}
+	if err := s.save(cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// ClearCart deletes the owner's cart.
+func (s *CartService) ClearCart(owner CartOwner) error {
+	if err := validateCartOwner(owner); err != nil {
+		return err
+	}
+	return s.cartRepo.DeleteByOwner(owner.key())
+}
+
+// MergeGuestCart moves the items of a guest cart into the user's cart, typically right after login.
+func (s *CartService) MergeGuestCart(userID, guestID string) (*models.Cart, error) {
+	if strings.TrimSpace(userID) == "" {
+		return nil, ValidationError{Code: "VALIDATION_ERROR", Message: "user id is required"}
+	}
+	guestOwner := CartOwner{GuestID: guestID}
+	if err := validateCartOwner(guestOwner); err != nil {
+		return nil, err
+	}
+
+	userOwner := CartOwner{UserID: userID}
+	cart, err := s.loadCart(userOwner)
+	if err != nil {
+		return nil, err
+	}
+	guestCart, err := s.loadCart(guestOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range guestCart.Items {
+		product, err := s.productRepo.FindByID(item.ProductID.Hex())
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		variant, err := resolveVariant(product, item.SKU)
+		if err != nil {
+			continue
+		}
+		quantity := item.Cantidad
+		if idx := findCartItem(cart, product.ID.Hex(), variant.SKU); idx >= 0 {
+			quantity += cart.Items[idx].Cantidad
+		}
+		quantity = min(quantity, product.VariantAvailable(variant.SKU), maxCartItemQuantity)
+		if quantity <= 0 {
+			continue
+		}
+		setCartItem(cart, product, variant, quantity)
+	}
+
+	if _, err := s.revalidate(cart); err != nil {
+		return nil, err
+	}
+	if err := s.save(cart); err != nil {
+		return nil, err
+	}
+	if err := s.cartRepo.DeleteByOwner(guestOwner.key()); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// Checkout turns the user's cart into a purchase, redeeming the optional coupon
+// code, and empties the cart on success.
+// If prices changed since the cart was last seen, the updated cart is stored and
+// the checkout is rejected so the customer can review the new amounts.
+func (s *CartService) Checkout(userID, couponCode string) (*models.Purchase, error) {
+	if strings.TrimSpace(userID) == "" {
+		return nil, ValidationError{Code: "VALIDATION_ERROR", Message: "user id is required"}
+	}
+	owner := CartOwner{UserID: userID}
+	cart, err := s.loadCart(owner)
+	if err != nil {
+		return nil, err
+	}
+	if len(cart.Items) == 0 {
+		return nil, ValidationError{Code: "CART_EMPTY", Message: "cart is empty"}
+	}
+
+	changed, err := s.revalidate(cart)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		if err := s.save(cart); err != nil {
+			return nil, err
+		}
+	}
+
+	items := make([]CheckoutItemInput, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		switch {
+		case item.NoDisponible:
+			return nil, ValidationError{Code: "CART_ITEM_UNAVAILABLE", Message: "product " + item.ProductID.Hex() + " is no longer available"}
+		case item.PrecioCambiado:
+			return nil, ValidationError{Code: "CART_PRICE_CHANGED", Message: "prices changed since the cart was last reviewed"}
+		case item.SinStock:
+			return nil, InsufficientStockError{ProductID: item.ProductID.Hex(), SKU: item.SKU, Requested: item.Cantidad, Available: item.StockDisponible}
+		}
+		items = append(items, CheckoutItemInput{ProductID: item.ProductID.Hex(), SKU: item.SKU, Cantidad: item.Cantidad})
+	}
+
+	purchase, err := s.checkouter.CheckoutWithCoupon(userID, items, couponCode)
+	if err != nil {
+		return nil, err
+	}
+	// The purchase is already recorded: failing here would make a retry buy
+	// the same cart again.
+	if err := s.cartRepo.DeleteByOwner(owner.key()); err != nil {
+		log.Printf("clear cart of user %s after purchase %s failed: %v", userID, purchase.ID.Hex(), err)
+	}
+	return purchase, nil
+}
+
+func (s *CartService) loadCart(owner CartOwner) (*models.Cart, error) {
+	if err := validateCartOwner(owner); err != nil {
+		return nil, err
+	}
+
+	cart, err := s.cartRepo.FindByOwner(owner.key())
+	if err != nil && !errors.Is(err, repositories.ErrCartNotFound) {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if cart == nil || (!cart.ExpiresAt.IsZero() && cart.ExpiresAt.Before(now)) {
+		// Mongo's TTL monitor runs periodically, so expired carts may still be found.
+		var id primitive.ObjectID
+		if cart != nil {
+			id = cart.ID
+		}
+		cart = &models.Cart{ID: id, CreatedAt: now}
+	}
+	cart.OwnerKey = owner.key()
+	cart.UserID = strings.TrimSpace(owner.UserID)
+	if cart.UserID == "" {
+		cart.GuestID = strings.TrimSpace(owner.GuestID)
+	}
+	if cart.Items == nil {
+		cart.Items = []models.CartItem{}
+	}
+	return cart, nil
+}
+
+func (s *CartService) save(cart *models.Cart) error {
+	now := time.Now().UTC()
+	cart.UpdatedAt = now
+	cart.ExpiresAt = now.Add(s.ttl)
+	return s.cartRepo.Save(cart)
+}
+
+// putItem validates the variant and quantity and stores it in the cart. When
+// accumulate is true the quantity is added to any existing line.
+func (s *CartService) putItem(cart *models.Cart, productID, sku string, cantidad int, accumulate bool) error {
+	productID = strings.TrimSpace(productID)
+	if productID == "" {
+		return ValidationError{Code: "VALIDATION_ERROR", Message: "producto_id is required"}
+	}
+	if cantidad <= 0 {
+		return ValidationError{Code: "VALIDATION_ERROR", Message: "cantidad must be greater than zero"}
+	}
+
+	product, err := s.productRepo.FindByID(productID)
+	if err != nil {
+		return err
+	}
+
+	variant, err := resolveVariant(product, strings.TrimSpace(sku))
+	if err != nil {
+		return err
+	}
+
+	quantity := cantidad
+	if idx := findCartItem(cart, product.ID.Hex(), variant.SKU); idx >= 0 && accumulate {
+		quantity += cart.Items[idx].Cantidad
+	}
+	if quantity > maxCartItemQuantity {
+		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "cantidad exceeds the maximum allowed per product"}
+	}
+	available := product.VariantAvailable(variant.SKU)
+	if quantity > available {
+		return InsufficientStockError{ProductID: product.ID.Hex(), SKU: variant.SKU, Requested: quantity, Available: available}
+	}
+
+	setCartItem(cart, product, variant, quantity)
+	return nil
+}
+
+// revalidate refreshes every line with the current catalog data and computes
+// totals. It reports whether the persisted snapshot changed. Lines of
+// deleted products are marked unavailable; other lookup failures are
+// returned.
+func (s *CartService) revalidate(cart *models.Cart) (bool, error) {
+	changed := false
+	var total float64
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		item.PrecioAnterior, item.PrecioCambiado = 0, false
+		item.NoDisponible, item.SinStock = false, false
+		product, err := s.productRepo.FindByID(item.ProductID.Hex())
+		if errors.Is(err, repositories.ErrNotFound) {
+			item.NoDisponible = true
+			item.Subtotal = 0
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		product.EnsureDefaultVariant()
+		variant, ok := product.Variant(item.SKU)
+		if !ok {
+			item.NoDisponible = true
+			item.Subtotal = 0
+			continue
+		}
+
+		if item.Nombre != product.Name || item.Marca != product.Marca || item.Imagen != product.Imagen ||
+			item.SKU != variant.SKU || item.TamanoML != variant.TamanoML || item.Concentracion != variant.Concentracion {
+			item.Nombre = product.Name
+			item.Marca = product.Marca
+			item.Imagen = product.Imagen
+			item.SKU = variant.SKU
+			item.TamanoML = variant.TamanoML
+			item.Concentracion = variant.Concentracion
+			changed = true
+		}
+		if item.PrecioUnitario != variant.Precio {
+			item.PrecioAnterior = item.PrecioUnitario
+			item.PrecioCambiado = true
+			item.PrecioUnitario = variant.Precio
+			changed = true
+		}
+		item.StockDisponible = product.VariantAvailable(variant.SKU)
+		item.SinStock = item.StockDisponible < item.Cantidad
+		item.Subtotal = item.PrecioUnitario * float64(item.Cantidad)
+		total += item.Subtotal
+	}
+	cart.Total = total
+	return changed, nil
+}
+
+func setCartItem(cart *models.Cart, product *models.Product, variant *models.ProductVariant, quantity int) {
+	if idx := findCartItem(cart, product.ID.Hex(), variant.SKU); idx >= 0 {
+		cart.Items[idx].SKU = variant.SKU
+		cart.Items[idx].Cantidad = quantity
+		return
+	}
+	cart.Items = append(cart.Items, models.CartItem{
+		ProductID:      product.ID,
+		SKU:            variant.SKU,
+		TamanoML:       variant.TamanoML,
+		Concentracion:  variant.Concentracion,
+		Nombre:         product.Name,
+		Marca:          product.Marca,
+		Imagen:         product.Imagen,
+		PrecioUnitario: variant.Precio,
+		Cantidad:       quantity,
+		AddedAt:        time.Now().UTC(),
+	})
+}
+
+// findCartItem locates the line of a product variant. An empty sku matches
+// the first line of the product, and lines stored before variants existed
+// match any sku of their product.
+func findCartItem(cart *models.Cart, productID, sku string) int {
+	productID = strings.TrimSpace(productID)
+	sku = strings.TrimSpace(sku)
+	for i, item := range cart.Items {
+		if item.ProductID.Hex() != productID {
+			continue
+		}
+		if sku == "" || item.SKU == "" || item.SKU == sku {
+			return i
+		}
+	}
+	return -1
+}
+
+func validateCartOwner(owner CartOwner) error {
+	if strings.TrimSpace(owner.UserID) != "" {
+		return nil
+	}
+	guestID := strings.TrimSpace(owner.GuestID)
+	if guestID == "" {
+		return ValidationError{Code: "CART_OWNER_REQUIRED", Message: "a user session or X-Guest-Id header is required"}
+	}
+	if len(guestID) > 64 {
+		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "guest id must have 64 characters or fewer"}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"products-api/internal/models"
+	"products-api/internal/repositories"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCartRevalidatesPriceAndStock(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Name: "Luna", Precio: 50, Stock: 5},
+		},
+	}
+	cartRepo := newFakeCartRepo()
+	service := NewCartService(cartRepo, productRepo, nil, time.Hour)
+	owner := CartOwner{UserID: "1"}
+
+	if _, err := service.AddItem(owner, productID.Hex(), "", 2); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+
+	productRepo.products[productID.Hex()].Precio = 60
+	productRepo.products[productID.Hex()].Stock = 1
+
+	cart, err := service.GetCart(owner)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	item := cart.Items[0]
+	if !item.PrecioCambiado || item.PrecioAnterior != 50 || item.PrecioUnitario != 60 {
+		t.Fatalf("expected price change to be flagged, got %+v", item)
+	}
+	if !item.SinStock || item.StockDisponible != 1 {
+		t.Fatalf("expected stock shortage to be flagged, got %+v", item)
+	}
+	if cart.Total != 120 {
+		t.Fatalf("expected total 120, got %f", cart.Total)
+	}
+	if cartRepo.carts["user:1"].Items[0].PrecioUnitario != 60 {
+		t.Fatalf("expected refreshed price to be persisted")
+	}
+}
+
+func TestCartAddItemRejectsQuantityAboveStock(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 10, Stock: 2},
+		},
+	}
+	service := NewCartService(newFakeCartRepo(), productRepo, nil, time.Hour)
+
+	_, err := service.AddItem(CartOwner{GuestID: "guest-1"}, productID.Hex(), "", 3)
+	var stockErr InsufficientStockError
+	if !errors.As(err, &stockErr) {
+		t.Fatalf("expected InsufficientStockError, got %v", err)
+	}
+}
+
+func TestCartMergeGuestCartIntoUserCart(t *testing.T) {
+	first := primitive.NewObjectID()
+	second := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			first.Hex():  {ID: first, Precio: 10, Stock: 3},
+			second.Hex(): {ID: second, Precio: 20, Stock: 5},
+		},
+	}
+	cartRepo := newFakeCartRepo()
+	service := NewCartService(cartRepo, productRepo, nil, time.Hour)
+
+	if _, err := service.AddItem(CartOwner{UserID: "1"}, first.Hex(), "", 2); err != nil {
+		t.Fatalf("add user item: %v", err)
+	}
+	if _, err := service.AddItem(CartOwner{GuestID: "guest-1"}, first.Hex(), "", 2); err != nil {
+		t.Fatalf("add guest item: %v", err)
+	}
+	if _, err := service.AddItem(CartOwner{GuestID: "guest-1"}, second.Hex(), "", 1); err != nil {
+		t.Fatalf("add guest item: %v", err)
+	}
+
+	cart, err := service.MergeGuestCart("1", "guest-1")
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if len(cart.Items) != 2 {
+		t.Fatalf("expected 2 lines after merge, got %d", len(cart.Items))
+	}
+	if cart.Items[0].Cantidad != 3 {
+		t.Fatalf("expected merged quantity capped at stock 3, got %d", cart.Items[0].Cantidad)
+	}
+	if _, ok := cartRepo.carts["guest:guest-1"]; ok {
+		t.Fatalf("expected guest cart to be removed after merge")
+	}
+}
+
+func TestCartCheckoutCreatesPurchaseAndClearsCart(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Name: "Luna", Precio: 25, Stock: 4},
+		},
+	}
+	cartRepo := newFakeCartRepo()
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	purchases := NewPurchaseService(productRepo, purchaseRepo, nil)
+	service := NewCartService(cartRepo, productRepo, purchases, time.Hour)
+
+	if _, err := service.AddItem(CartOwner{UserID: "1"}, productID.Hex(), "", 2); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+
+	purchase, err := service.Checkout("1", "")
+	if err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	if purchase.Total != 50 {
+		t.Fatalf("expected total 50, got %f", purchase.Total)
+	}
+	if _, ok := cartRepo.carts["user:1"]; ok {
+		t.Fatalf("expected cart to be cleared after checkout")
+	}
+}
+
+func TestCartCheckoutReturnsThePurchaseWhenTheCartCannotBeCleared(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 25, Stock: 4},
+		},
+	}
+	cartRepo := newFakeCartRepo()
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	service := NewCartService(cartRepo, productRepo, NewPurchaseService(productRepo, purchaseRepo, nil), time.Hour)
+
+	if _, err := service.AddItem(CartOwner{UserID: "1"}, productID.Hex(), "", 1); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	cartRepo.deleteErr = errors.New("mongo down")
+
+	purchase, err := service.Checkout("1", "")
+	if err != nil || purchase == nil || purchaseRepo.created == nil {
+		t.Fatalf("expected the recorded purchase to be returned, got %+v err=%v", purchase, err)
+	}
+}
+
+func TestCartLookupFailuresAreNotReportedAsUnavailableProducts(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 25, Stock: 4},
+		},
+	}
+	service := NewCartService(newFakeCartRepo(), productRepo, nil, time.Hour)
+	owner := CartOwner{UserID: "1"}
+	if _, err := service.AddItem(owner, productID.Hex(), "", 1); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+
+	productRepo.findErr = errors.New("mongo timeout")
+	if _, err := service.GetCart(owner); !errors.Is(err, productRepo.findErr) {
+		t.Fatalf("expected the lookup failure, got %v", err)
+	}
+
+	productRepo.findErr = nil
+	delete(productRepo.products, productID.Hex())
+	cart, err := service.GetCart(owner)
+	if err != nil || !cart.Items[0].NoDisponible {
+		t.Fatalf("expected the deleted product to be unavailable, got %+v err=%v", cart, err)
+	}
+}
+
+func TestCartCheckoutRejectsChangedPrices(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 25, Stock: 4},
+		},
+	}
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	service := NewCartService(newFakeCartRepo(), productRepo, NewPurchaseService(productRepo, purchaseRepo, nil), time.Hour)
+
+	if _, err := service.AddItem(CartOwner{UserID: "1"}, productID.Hex(), "", 1); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	productRepo.products[productID.Hex()].Precio = 30
+
+	_, err := service.Checkout("1", "")
+	var valErr ValidationError
+	if !errors.As(err, &valErr) || valErr.Code != "CART_PRICE_CHANGED" {
+		t.Fatalf("expected CART_PRICE_CHANGED, got %v", err)
+	}
+	if purchaseRepo.created != nil {
+		t.Fatalf("purchase should not be created when prices changed")
+	}
+
+	if _, err := service.Checkout("1", ""); err != nil {
+		t.Fatalf("second checkout should accept the reviewed price: %v", err)
+	}
+}
+
+// --- fakes ---
+
+type fakeCartRepo struct {
+	carts     map[string]*models.Cart
+	deleteErr error
+}
+
+func newFakeCartRepo() *fakeCartRepo {
+	return &fakeCartRepo{carts: map[string]*models.Cart{}}
+}
+
+func (f *fakeCartRepo) FindByOwner(ownerKey string) (*models.Cart, error) {
+	cart, ok := f.carts[ownerKey]
+	if !ok {
+		return nil, repositories.ErrCartNotFound
+	}
+	cpy := *cart
+	cpy.Items = append([]models.CartItem(nil), cart.Items...)
+	return &cpy, nil
+}
+
+func (f *fakeCartRepo) Save(cart *models.Cart) error {
+	if cart.ID.IsZero() {
+		cart.ID = primitive.NewObjectID()
+	}
+	cpy := *cart
+	cpy.Items = append([]models.CartItem(nil), cart.Items...)
+	f.carts[cart.OwnerKey] = &cpy
+	return nil
+}
+
+func (f *fakeCartRepo) DeleteByOwner(ownerKey string) error {
+	if f.deleteErr != nil {
+		return f.deleteErr
+	}
+	delete(f.carts, ownerKey)
+	return nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"products-api/internal/models"
+	"products-api/internal/repositories"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// CouponInput groups the admin-editable coupon fields.
+type CouponInput struct {
+	Codigo            string
+	Descripcion       string
+	Tipo              string
+	Valor             float64
+	ProductoGratisID  string
+	MinimoCompra      float64
+	MaxUsos           int
+	MaxUsosPorUsuario int
+	ValidoDesde       time.Time
+	ValidoHasta       time.Time
+	Marcas            []string
+	Tipos             []string
+	Automatico        bool
+	Activo            bool
+}
+
+// CouponService manages coupons and automatic promotions.
+type CouponService struct {
+	repo repositories.CouponRepository
+}
+
+// NewCouponService builds a CouponService.
+func NewCouponService(repo repositories.CouponRepository) *CouponService {
+	return &CouponService{repo: repo}
+}
+
+// CreateCoupon validates and stores a new coupon.
+func (s *CouponService) CreateCoupon(input CouponInput) (*models.Coupon, error) {
+	input = normalizeCouponInput(input)
+	if err := validateCouponInput(input); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	coupon := &models.Coupon{CreatedAt: now}
+	applyCouponInput(coupon, input)
+	coupon.UpdatedAt = now
+
+	if err := s.repo.Create(coupon); err != nil {
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// UpdateCoupon replaces the editable fields of a coupon.
+func (s *CouponService) UpdateCoupon(id string, input CouponInput) (*models.Coupon, error) {
+	coupon, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	input = normalizeCouponInput(input)
+	if err := validateCouponInput(input); err != nil {
+		return nil, err
+	}
+	applyCouponInput(coupon, input)
+	coupon.UpdatedAt = time.Now().UTC()
+
+	if err := s.repo.Update(coupon); err != nil {
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// DeleteCoupon removes a coupon.
+func (s *CouponService) DeleteCoupon(id string) error {
+	return s.repo.Delete(id)
+}
+
+// GetCoupon fetches a coupon by id.
+func (s *CouponService) GetCoupon(id string) (*models.Coupon, error) {
+	return s.repo.FindByID(id)
+}
+
+// ListCoupons returns every coupon.
+func (s *CouponService) ListCoupons() ([]models.Coupon, error) {
+	return s.repo.FindAll()
+}
+
+func applyCouponInput(coupon *models.Coupon, input CouponInput) {
+	coupon.Codigo = input.Codigo
+	coupon.Descripcion = input.Descripcion
+	coupon.Tipo = input.Tipo
+	coupon.Valor = input.Valor
+	coupon.ProductoGratisID = input.ProductoGratisID
+	coupon.MinimoCompra = input.MinimoCompra
+	coupon.MaxUsos = input.MaxUsos
+	coupon.MaxUsosPorUsuario = input.MaxUsosPorUsuario
+	coupon.ValidoDesde = input.ValidoDesde
+	coupon.ValidoHasta = input.ValidoHasta
+	coupon.Marcas = input.Marcas
+	coupon.Tipos = input.Tipos
+	coupon.Automatico = input.Automatico
+	coupon.Activo = input.Activo
+}
+
+func normalizeCouponInput(input CouponInput) CouponInput {
+	input.Codigo = strings.ToUpper(strings.TrimSpace(input.Codigo))
+	input.Descripcion = strings.TrimSpace(input.Descripcion)
+	input.Tipo = strings.ToLower(strings.TrimSpace(input.Tipo))
+	input.ProductoGratisID = strings.TrimSpace(input.ProductoGratisID)
+	input.ValidoDesde = input.ValidoDesde.UTC()
+	input.ValidoHasta = input.ValidoHasta.UTC()
+	for i, tipo := range input.Tipos {
+		input.Tipos[i] = strings.ToLower(strings.TrimSpace(tipo))
+	}
+	for i, marca := range input.Marcas {
+		input.Marcas[i] = strings.TrimSpace(marca)
+	}
+	return input
+}
+
+func validateCouponInput(input CouponInput) error {
+	if input.Codigo == "" && !input.Automatico {
+		return ValidationError{Code: "VALIDATION_ERROR", Message: "codigo is required unless the coupon is automatico"}
+	}
+	if input.Codigo != "" && !couponCodePattern.MatchString(input.Codigo) {
+		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "codigo must have 3-32 letters, digits, '-' or '_'"}
+	}
+	if input.Descripcion == "" {
+		return ValidationError{Code: "VALIDATION_ERROR", Message: "descripcion is required"}
+	}
+
+	switch input.Tipo {
+	case models.CouponPercentage:
+		if input.Valor <= 0 || input.Valor > 100 {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "valor must be between 0 and 100 for porcentaje coupons"}
+		}
+	case models.CouponFixed:
+		if input.Valor <= 0 {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "valor must be greater than zero"}
+		}
+	case models.CouponFreeItem:
+		if input.ProductoGratisID != "" {
+			if _, err := primitive.ObjectIDFromHex(input.ProductoGratisID); err != nil {
+				return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "producto_gratis_id is not a valid id"}
+			}
+		}
+	case "":
+		return ValidationError{Code: "VALIDATION_ERROR", Message: "tipo is required"}
+	default:
+		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "tipo has an invalid value"}
+	}
+
+	if input.MinimoCompra < 0 {
+		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "minimo_compra must be zero or greater"}
+	}
+	if input.MaxUsos < 0 || input.MaxUsosPorUsuario < 0 {
+		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "usage limits must be zero or greater"}
+	}
+	if input.ValidoDesde.IsZero() || input.ValidoHasta.IsZero() {
+		return ValidationError{Code: "VALIDATION_ERROR", Message: "valido_desde and valido_hasta are required"}
+	}
+	if !input.ValidoHasta.After(input.ValidoDesde) {
+		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "valido_hasta must be after valido_desde"}
+	}
+	for _, tipo := range input.Tipos {
+		if _, ok := allowedTipos[tipo]; !ok {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "tipos has an invalid value"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"events"
+	"products-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Routing keys of the product events consumed by search-api.
+const (
+	EventProductCreated = "product.created"
+	EventProductUpdated = "product.updated"
+	EventProductDeleted = "product.deleted"
+)
+
+// productEvent builds the outbox event describing the current state of a product.
+func productEvent(routingKey string, product *models.Product) (models.OutboxEvent, error) {
+	return newOutboxEvent(routingKey, product.ID.Hex(), events.SchemaProductV1, productPayload(product))
+}
+
+// productDeletedEvent builds the outbox event for a removed product. version
+// is the one the product would have had after the change, so the deletion
+// orders after every earlier update.
+func productDeletedEvent(id string, version int64) (models.OutboxEvent, error) {
+	return newOutboxEvent(EventProductDeleted, id, events.SchemaProductDeletedV1, map[string]interface{}{"id": id, "version": version})
+}
+
+// newOutboxEvent wraps payload in a v1 envelope whose id is the outbox event
+// id, so consumers can deduplicate redeliveries. Payloads that break their
+// schema are rejected before anything is written.
+func newOutboxEvent(routingKey, aggregateID, dataSchema string, payload interface{}) (models.OutboxEvent, error) {
+	id := primitive.NewObjectID()
+	now := time.Now().UTC()
+	body, err := events.New(id.Hex(), routingKey, aggregateID, dataSchema, now, payload)
+	if err != nil {
+		return models.OutboxEvent{}, fmt.Errorf("build %s event: %w", routingKey, err)
+	}
+	return models.OutboxEvent{
+		ID:            id,
+		AggregateID:   aggregateID,
+		RoutingKey:    routingKey,
+		ContentType:   events.ContentType,
+		Payload:       body,
+		Status:        models.OutboxPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, nil
+}
+
+func productPayload(p *models.Product) map[string]interface{} {
+	id := ""
+	if p.ID != primitive.NilObjectID {
+		id = p.ID.Hex()
+	}
+	return map[string]interface{}{
+		"id":          id,
+		"name":        p.Name,
+		"descripcion": p.Descripcion,
+		"precio":      p.Precio,
+		"stock":       p.Stock,
+		"variantes":   p.Variantes,
+		"tipo":        p.Tipo,
+		"estacion":    p.Estacion,
+		"ocasion":     p.Ocasion,
+		"notas":       p.Notas,
+		"genero":      p.Genero,
+		"marca":       p.Marca,
+		"imagen":      p.Imagen,
+		"owner_id":    p.OwnerID,
+		"score":       p.Score,
+		"created_at":  p.CreatedAt,
+		"updated_at":  p.UpdatedAt,
+		"version":     p.Version,
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"events"
+	"products-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProductEventIsWrappedInAVersionedEnvelope(t *testing.T) {
+	product := &models.Product{
+		ID:        primitive.NewObjectID(),
+		Name:      "Luna",
+		Precio:    50,
+		Stock:     3,
+		Variantes: []models.ProductVariant{{SKU: "LUNA-50", TamanoML: 50, Precio: 50, Stock: 3}},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Version:   2,
+	}
+
+	event, err := productEvent(EventProductUpdated, product)
+	if err != nil {
+		t.Fatalf("build event: %v", err)
+	}
+	if event.ContentType != events.ContentType {
+		t.Fatalf("expected cloudevents content type, got %q", event.ContentType)
+	}
+
+	envelope, err := events.Decode(event.Payload)
+	if err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	if envelope.ID != event.ID.Hex() || envelope.Type != EventProductUpdated || envelope.Subject != product.ID.Hex() {
+		t.Fatalf("unexpected envelope attributes: %+v", envelope)
+	}
+	if envelope.Source != events.Source || envelope.DataSchema != events.SchemaProductV1 {
+		t.Fatalf("expected products-api v1 schema, got %s %s", envelope.Source, envelope.DataSchema)
+	}
+}
+
+func TestProductEventRejectsDataThatBreaksTheSchema(t *testing.T) {
+	product := &models.Product{
+		ID:        primitive.NewObjectID(),
+		Name:      "Luna",
+		Stock:     -1,
+		Variantes: []models.ProductVariant{{SKU: "LUNA-50", Precio: 50}},
+		Version:   1,
+	}
+
+	_, err := productEvent(EventProductCreated, product)
+	var schemaErr events.SchemaError
+	if !errors.As(err, &schemaErr) || schemaErr.Path != "data.stock" {
+		t.Fatalf("expected schema error on data.stock, got %v", err)
+	}
+
+	if _, err := productDeletedEvent(product.ID.Hex(), 0); err == nil {
+		t.Fatalf("expected deleted event without a version to be rejected")
+	}
+}
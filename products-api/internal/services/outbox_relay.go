@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"products-api/internal/models"
+	"products-api/internal/repositories"
+)
+
+const (
+	outboxBatchSize      = 100
+	outboxMinBackoff     = time.Second
+	outboxMaxBackoff     = 5 * time.Minute
+	outboxPublishTimeout = 10 * time.Second
+)
+
+// OutboxPublisher delivers an outbox event to the broker and returns only once
+// the broker confirmed it.
+type OutboxPublisher interface {
+	PublishEvent(ctx context.Context, event models.OutboxEvent) error
+}
+
+// OutboxRelay moves events from the outbox to RabbitMQ, guaranteeing
+// at-least-once delivery: an event is marked sent only after the broker
+// confirmed it, and failed attempts are retried with exponential backoff.
+type OutboxRelay struct {
+	repo      repositories.OutboxRepository
+	publisher OutboxPublisher
+}
+
+// NewOutboxRelay builds an OutboxRelay.
+func NewOutboxRelay(repo repositories.OutboxRepository, publisher OutboxPublisher) *OutboxRelay {
+	return &OutboxRelay{repo: repo, publisher: publisher}
+}
+
+// RelayPending publishes every due event in creation order and returns how
+// many were sent. It stops at the first failure, which usually means the
+// broker is down; until the failed event is sent, FindDue holds back the
+// later events of its product so they are not delivered ahead of it.
+func (r *OutboxRelay) RelayPending(ctx context.Context, now time.Time) (int, error) {
+	sent := 0
+	for {
+		events, err := r.repo.FindDue(now, outboxBatchSize)
+		if err != nil {
+			return sent, err
+		}
+		for _, event := range events {
+			publishCtx, cancel := context.WithTimeout(ctx, outboxPublishTimeout)
+			err := r.publisher.PublishEvent(publishCtx, event)
+			cancel()
+			if err != nil {
+				attempts := event.Attempts + 1
+				if markErr := r.repo.MarkFailed(event.ID, attempts, now.Add(outboxBackoff(attempts)), err.Error()); markErr != nil {
+					log.Printf("outbox: mark event %s failed: %v", event.ID.Hex(), markErr)
+				}
+				return sent, err
+			}
+			if err := r.repo.MarkSent(event.ID, time.Now().UTC()); err != nil {
+				// The event will be published again; consumers tolerate duplicates.
+				return sent, err
+			}
+			sent++
+		}
+		if len(events) < outboxBatchSize {
+			return sent, nil
+		}
+	}
+}
+
+// Start relays pending events every interval until ctx is canceled.
+func (r *OutboxRelay) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.RelayPending(ctx, time.Now().UTC()); err != nil {
+				log.Printf("outbox relay: %v", err)
+			}
+		}
+	}
+}
+
+// outboxBackoff doubles the wait after each failed attempt, up to outboxMaxBackoff.
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxMinBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, outboxMaxBackoff)
+}
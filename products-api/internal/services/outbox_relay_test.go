@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"products-api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOutboxRelayPublishesInOrderAndMarksSent(t *testing.T) {
+	now := time.Now().UTC()
+	repo := newFakeOutboxRepo(now, "product.created", "product.updated")
+	publisher := &fakeOutboxPublisher{}
+	relay := NewOutboxRelay(repo, publisher)
+
+	sent, err := relay.RelayPending(context.Background(), now)
+	if err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if sent != 2 || len(publisher.published) != 2 {
+		t.Fatalf("expected 2 events published, got %d", sent)
+	}
+	if publisher.published[0] != "product.created" || publisher.published[1] != "product.updated" {
+		t.Fatalf("expected events in creation order, got %v", publisher.published)
+	}
+	for _, event := range repo.events {
+		if event.Status != models.OutboxSent {
+			t.Fatalf("expected event %s to be marked sent", event.ID.Hex())
+		}
+	}
+}
+
+func TestOutboxRelayRetriesWithBackoff(t *testing.T) {
+	now := time.Now().UTC()
+	repo := newFakeOutboxRepo(now, "product.updated", "product.deleted")
+	publisher := &fakeOutboxPublisher{err: errors.New("broker down")}
+	relay := NewOutboxRelay(repo, publisher)
+
+	if _, err := relay.RelayPending(context.Background(), now); err == nil {
+		t.Fatalf("expected relay error")
+	}
+	first := repo.events[0]
+	if first.Status != models.OutboxPending || first.Attempts != 1 || !first.NextAttemptAt.Equal(now.Add(time.Second)) {
+		t.Fatalf("expected first attempt to be rescheduled, got %+v", first)
+	}
+	if len(publisher.published) != 1 {
+		t.Fatalf("expected relay to stop after the first failure")
+	}
+
+	publisher.err = nil
+	sent, err := relay.RelayPending(context.Background(), now.Add(2*time.Second))
+	if err != nil || sent != 2 {
+		t.Fatalf("expected both events sent after recovery, got %d (%v)", sent, err)
+	}
+
+	if outboxBackoff(30) != outboxMaxBackoff {
+		t.Fatalf("expected backoff to be capped")
+	}
+}
+
+func TestOutboxRelayKeepsTheOrderOfEachProduct(t *testing.T) {
+	now := time.Now().UTC()
+	repo := newFakeOutboxRepo(now, "product.created", "product.created", "product.updated")
+	repo.events[0].AggregateID, repo.events[1].AggregateID, repo.events[2].AggregateID = "a", "b", "a"
+	publisher := &fakeOutboxPublisher{err: errors.New("broker down")}
+	relay := NewOutboxRelay(repo, publisher)
+
+	if _, err := relay.RelayPending(context.Background(), now); err == nil {
+		t.Fatalf("expected relay error")
+	}
+	publisher.err = nil
+	publisher.published = nil
+	sent, err := relay.RelayPending(context.Background(), now)
+	if err != nil || sent != 1 || repo.events[1].Status != models.OutboxSent {
+		t.Fatalf("expected only the other product's event to be sent, got %d (%v)", sent, err)
+	}
+	if repo.events[2].Status != models.OutboxPending {
+		t.Fatalf("expected the update to wait for the failed create of its product")
+	}
+
+	sent, err = relay.RelayPending(context.Background(), now.Add(2*time.Second))
+	if err != nil || sent != 2 || publisher.published[1] != "product.created" || publisher.published[2] != "product.updated" {
+		t.Fatalf("expected the product's events in order after the retry, got %v (%v)", publisher.published, err)
+	}
+}
+
+// --- fakes ---
+
+type fakeOutboxRepo struct {
+	events []*models.OutboxEvent
+}
+
+func newFakeOutboxRepo(now time.Time, routingKeys ...string) *fakeOutboxRepo {
+	repo := &fakeOutboxRepo{}
+	for i, key := range routingKeys {
+		repo.events = append(repo.events, &models.OutboxEvent{
+			ID:            primitive.NewObjectID(),
+			RoutingKey:    key,
+			Status:        models.OutboxPending,
+			NextAttemptAt: now,
+			CreatedAt:     now.Add(time.Duration(i) * time.Millisecond),
+		})
+	}
+	return repo
+}
+
+func (f *fakeOutboxRepo) FindDue(now time.Time, limit int64) ([]models.OutboxEvent, error) {
+	var out []models.OutboxEvent
+	blocked := map[string]bool{}
+	for _, event := range f.events {
+		if event.Status != models.OutboxPending || blocked[event.AggregateID] {
+			continue
+		}
+		if event.NextAttemptAt.After(now) {
+			blocked[event.AggregateID] = true
+			continue
+		}
+		out = append(out, *event)
+	}
+	return out, nil
+}
+
+func (f *fakeOutboxRepo) MarkSent(id primitive.ObjectID, sentAt time.Time) error {
+	for _, event := range f.events {
+		if event.ID == id {
+			event.Status = models.OutboxSent
+			event.SentAt = &sentAt
+		}
+	}
+	return nil
+}
+
+func (f *fakeOutboxRepo) MarkFailed(id primitive.ObjectID, attempts int, nextAttemptAt time.Time, lastError string) error {
+	for _, event := range f.events {
+		if event.ID == id {
+			event.Attempts = attempts
+			event.NextAttemptAt = nextAttemptAt
+			event.LastError = lastError
+		}
+	}
+	return nil
+}
+
+type fakeOutboxPublisher struct {
+	err       error
+	published []string
+}
+
+func (f *fakeOutboxPublisher) PublishEvent(ctx context.Context, event models.OutboxEvent) error {
+	f.published = append(f.published, event.RoutingKey)
+	return f.err
+}
@@ -4,29 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
 	"products-api/internal/models"
 	"products-api/internal/repositories"
-)
 
-// EventPublisher abstracts the event emission layer.
-type EventPublisher interface {
-	PublishProductCreated(product *models.Product) error
-	PublishProductUpdated(product *models.Product) error
-	PublishProductDeleted(id string) error
-}
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 // ProductService coordinates product operations.
 type ProductService struct {
-	repo         repositories.ProductRepository
-	publisher    EventPublisher
-	usersAPIURL  string
-	httpClient   *http.Client
+	repo           repositories.ProductRepository
+	usersAPIURL    string
+	httpClient     *http.Client
 	requestTimeout time.Duration
 }
 
@@ -41,12 +35,11 @@ func (e ValidationError) Error() string {
 }
 
 // NewProductService wires a service with its dependencies.
-func NewProductService(repo repositories.ProductRepository, publisher EventPublisher, usersAPIURL string) *ProductService {
+func NewProductService(repo repositories.ProductRepository, usersAPIURL string) *ProductService {
 	return &ProductService{
-		repo:          repo,
-		publisher:     publisher,
-		usersAPIURL:   strings.TrimRight(usersAPIURL, "/"),
-		httpClient:    &http.Client{Timeout: 4 * time.Second},
+		repo:           repo,
+		usersAPIURL:    strings.TrimRight(usersAPIURL, "/"),
+		httpClient:     &http.Client{Timeout: 4 * time.Second},
 		requestTimeout: 4 * time.Second,
 	}
 }
@@ -65,6 +58,16 @@ type CreateProductInput struct {
 	Marca       string
 	Imagen      string
 	OwnerID     string
+	Variantes   []VariantInput
+}
+
+// VariantInput describes a sellable size/concentration of a product.
+type VariantInput struct {
+	SKU           string
+	TamanoML      int
+	Concentracion string
+	Precio        float64
+	Stock         int
 }
 
 // UpdateProductInput mirrors the fields that can be updated.
@@ -82,14 +85,11 @@ func (s *ProductService) CreateProduct(input CreateProductInput, authToken strin
 		return nil, err
 	}
 
-	score := computeProductScore(input)
-
 	now := time.Now().UTC()
 	product := &models.Product{
+		ID:          primitive.NewObjectID(),
 		Name:        strings.TrimSpace(input.Name),
 		Descripcion: strings.TrimSpace(input.Descripcion),
-		Precio:      input.Precio,
-		Stock:       input.Stock,
 		Tipo:        input.Tipo,
 		Estacion:    input.Estacion,
 		Ocasion:     input.Ocasion,
@@ -98,19 +98,25 @@ func (s *ProductService) CreateProduct(input CreateProductInput, authToken strin
 		Marca:       input.Marca,
 		Imagen:      strings.TrimSpace(input.Imagen),
 		OwnerID:     input.OwnerID,
-		Score:       score,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Version:     1,
 	}
-
-	if err := s.repo.Create(product); err != nil {
+	variantes, err := buildVariants(product.ID, input)
+	if err != nil {
 		return nil, err
 	}
+	product.Variantes = variantes
+	product.SyncFromVariants()
+	input.Precio = product.Precio
+	product.Score = computeProductScore(input)
 
-	if s.publisher != nil {
-		if err := s.publisher.PublishProductCreated(product); err != nil {
-			log.Printf("publish product.created failed: %v", err)
-		}
+	event, err := productEvent(EventProductCreated, product)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(product, event); err != nil {
+		return nil, err
 	}
 	return product, nil
 }
@@ -138,7 +144,10 @@ func (s *ProductService) UpdateProduct(id string, requesterID string, isAdmin bo
 		return nil, err
 	}
 
-	score := computeProductScore(input)
+	variantes, err := updatedVariants(product, input)
+	if err != nil {
+		return nil, err
+	}
 
 	if strings.TrimSpace(product.OwnerID) == "" {
 		product.OwnerID = requesterID
@@ -146,8 +155,8 @@ func (s *ProductService) UpdateProduct(id string, requesterID string, isAdmin bo
 
 	product.Name = strings.TrimSpace(input.Name)
 	product.Descripcion = strings.TrimSpace(input.Descripcion)
-	product.Precio = input.Precio
-	product.Stock = input.Stock
+	product.Variantes = variantes
+	product.SyncFromVariants()
 	product.Tipo = input.Tipo
 	product.Estacion = input.Estacion
 	product.Ocasion = input.Ocasion
@@ -155,17 +164,17 @@ func (s *ProductService) UpdateProduct(id string, requesterID string, isAdmin bo
 	product.Genero = input.Genero
 	product.Marca = input.Marca
 	product.Imagen = strings.TrimSpace(input.Imagen)
-	product.Score = score
+	input.Precio = product.Precio
+	product.Score = computeProductScore(input)
 	product.UpdatedAt = time.Now().UTC()
+	product.Version++
 
-	if err := s.repo.Update(product); err != nil {
+	event, err := productEvent(EventProductUpdated, product)
+	if err != nil {
 		return nil, err
 	}
-
-	if s.publisher != nil {
-		if err := s.publisher.PublishProductUpdated(product); err != nil {
-			log.Printf("publish product.updated failed: %v", err)
-		}
+	if err := s.repo.Update(product, event); err != nil {
+		return nil, err
 	}
 
 	return product, nil
@@ -189,17 +198,11 @@ func (s *ProductService) DeleteProduct(id string, requesterID string, isAdmin bo
 		}
 	}
 
-	if err := s.repo.Delete(id); err != nil {
+	event, err := productDeletedEvent(product.ID.Hex(), product.Version+1)
+	if err != nil {
 		return err
 	}
-
-	if s.publisher != nil {
-		if err := s.publisher.PublishProductDeleted(id); err != nil {
-			log.Printf("publish product.deleted failed: %v", err)
-		}
-	}
-
-	return nil
+	return s.repo.Delete(id, product.Version, event)
 }
 
 // GetProductByID fetches a product.
@@ -209,6 +212,9 @@ func (s *ProductService) GetProductByID(id string) (*models.Product, error) {
 
 // ListProducts obtains products and the total count.
 func (s *ProductService) ListProducts(filter repositories.ProductFilter, pagination repositories.Pagination) ([]models.Product, repositories.Pagination, int64, error) {
+	if err := validateProductFilter(filter); err != nil {
+		return nil, pagination, 0, err
+	}
 	page, size := sanitizePagination(pagination.Page, pagination.PageSize)
 	pagination.Page = page
 	pagination.PageSize = size
@@ -217,6 +223,61 @@ func (s *ProductService) ListProducts(filter repositories.ProductFilter, paginat
 	return items, pagination, total, err
 }
 
+// maxFilterValues bounds the values of a multi-value list filter.
+const maxFilterValues = 20
+
+func validateProductFilter(filter repositories.ProductFilter) error {
+	for name, values := range map[string][]string{
+		"tipo": filter.Tipo, "estacion": filter.Estacion, "ocasion": filter.Ocasion,
+		"genero": filter.Genero, "marca": filter.Marca, "notas": filter.Notas,
+	} {
+		if len(values) > maxFilterValues {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: fmt.Sprintf("%s accepts at most %d values", name, maxFilterValues)}
+		}
+	}
+	switch filter.NotasMatch {
+	case "", repositories.NotasMatchAny, repositories.NotasMatchAll:
+	default:
+		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "notas_match must be any or all"}
+	}
+	if filter.PrecioMin < 0 || filter.PrecioMax < 0 {
+		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "precio_min and precio_max must be zero or greater"}
+	}
+	if filter.PrecioMax > 0 && filter.PrecioMin > filter.PrecioMax {
+		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "precio_min must not be greater than precio_max"}
+	}
+	return nil
+}
+
+// ExportProducts returns the page of products that follows cursor, ordered by
+// id, and the cursor of the next page. The next cursor is empty once the last
+// page has been returned.
+func (s *ProductService) ExportProducts(cursor string, limit int) ([]models.Product, string, error) {
+	const (
+		defaultExportLimit = 200
+		maxExportLimit     = 500
+	)
+	if cursor != "" && !primitive.IsValidObjectID(cursor) {
+		return nil, "", ValidationError{Code: "INVALID_CURSOR", Message: "cursor must be a product id"}
+	}
+	if limit < 1 {
+		limit = defaultExportLimit
+	}
+	if limit > maxExportLimit {
+		limit = maxExportLimit
+	}
+
+	items, err := s.repo.FindAfter(cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(items) == limit {
+		next = items[len(items)-1].ID.Hex()
+	}
+	return items, next, nil
+}
+
 func sanitizePagination(page, size int) (int, int) {
 	const (
 		defaultPageSize = 10
@@ -234,7 +295,15 @@ func sanitizePagination(page, size int) (int, int) {
 	return page, size
 }
 
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
 var (
+	allowedConcentraciones = map[string]struct{}{
+		models.ConcentrationEDC:    {},
+		models.ConcentrationEDT:    {},
+		models.ConcentrationEDP:    {},
+		models.ConcentrationParfum: {},
+	}
 	allowedTipos = map[string]struct{}{
 		"floral":    {},
 		"citrico":   {},
@@ -270,11 +339,17 @@ func validateProductInput(input CreateProductInput) error {
 	if strings.TrimSpace(input.Descripcion) == "" {
 		return ValidationError{Code: "VALIDATION_ERROR", Message: "descripcion is required"}
 	}
-	if input.Precio <= 0 {
-		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "precio must be greater than zero"}
-	}
-	if input.Stock < 0 {
-		return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "stock must be zero or greater"}
+	if len(input.Variantes) > 0 {
+		if err := validateVariants(input.Variantes); err != nil {
+			return err
+		}
+	} else {
+		if input.Precio <= 0 {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "precio must be greater than zero"}
+		}
+		if input.Stock < 0 {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "stock must be zero or greater"}
+		}
 	}
 	if err := validateField("tipo", input.Tipo, allowedTipos); err != nil {
 		return err
@@ -302,6 +377,105 @@ func validateProductInput(input CreateProductInput) error {
 	return nil
 }
 
+func validateVariants(variants []VariantInput) error {
+	seen := make(map[string]struct{}, len(variants))
+	presentations := make(map[string]struct{}, len(variants))
+	for _, variant := range variants {
+		sku := strings.TrimSpace(variant.SKU)
+		if sku != "" {
+			if !skuPattern.MatchString(sku) {
+				return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "sku must have 1-64 letters, digits, '-' or '_'"}
+			}
+			if _, ok := seen[sku]; ok {
+				return ValidationError{Code: "INVALID_FIELD_VALUE", Message: fmt.Sprintf("sku %s is repeated", sku)}
+			}
+			seen[sku] = struct{}{}
+		}
+		if variant.TamanoML <= 0 || variant.TamanoML > 1000 {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "tamano_ml must be between 1 and 1000"}
+		}
+		concentracion := strings.ToLower(strings.TrimSpace(variant.Concentracion))
+		if _, ok := allowedConcentraciones[concentracion]; !ok {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "concentracion has an invalid value"}
+		}
+		presentation := fmt.Sprintf("%d ml %s", variant.TamanoML, concentracion)
+		if _, ok := presentations[presentation]; ok {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: fmt.Sprintf("variant %s is repeated", presentation)}
+		}
+		presentations[presentation] = struct{}{}
+		if variant.Precio <= 0 {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "precio must be greater than zero"}
+		}
+		if variant.Stock < 0 {
+			return ValidationError{Code: "INVALID_FIELD_VALUE", Message: "stock must be zero or greater"}
+		}
+	}
+	return nil
+}
+
+// buildVariants converts the input into stored variants. Inputs without
+// variants produce a single variant keyed by the product id, mirroring the
+// migration applied to legacy products. SKUs must be unique once generated,
+// as an explicit one may equal the one generated for another variant.
+func buildVariants(productID primitive.ObjectID, input CreateProductInput) ([]models.ProductVariant, error) {
+	if len(input.Variantes) == 0 {
+		return []models.ProductVariant{{SKU: productID.Hex(), Precio: input.Precio, Stock: input.Stock}}, nil
+	}
+	variants := make([]models.ProductVariant, 0, len(input.Variantes))
+	seen := make(map[string]struct{}, len(input.Variantes))
+	for _, variant := range input.Variantes {
+		concentracion := strings.ToLower(strings.TrimSpace(variant.Concentracion))
+		sku := strings.TrimSpace(variant.SKU)
+		if sku == "" {
+			sku = strings.ToUpper(fmt.Sprintf("%s-%d-%s", productID.Hex()[16:], variant.TamanoML, concentracion))
+		}
+		if _, ok := seen[sku]; ok {
+			return nil, ValidationError{Code: "INVALID_FIELD_VALUE", Message: fmt.Sprintf("sku %s is repeated", sku)}
+		}
+		seen[sku] = struct{}{}
+		variants = append(variants, models.ProductVariant{
+			SKU:           sku,
+			TamanoML:      variant.TamanoML,
+			Concentracion: concentracion,
+			Precio:        variant.Precio,
+			Stock:         variant.Stock,
+		})
+	}
+	return variants, nil
+}
+
+// updatedVariants computes the variants of an existing product after an
+// update. Legacy payloads without variantes only edit single-variant products.
+func updatedVariants(product *models.Product, input UpdateProductInput) ([]models.ProductVariant, error) {
+	if len(input.Variantes) == 0 {
+		if len(product.Variantes) > 1 {
+			return nil, ValidationError{Code: "VALIDATION_ERROR", Message: "variantes is required for products with multiple variants"}
+		}
+		variant := models.ProductVariant{SKU: product.ID.Hex()}
+		if len(product.Variantes) == 1 {
+			variant = product.Variantes[0]
+		}
+		variant.Precio = input.Precio
+		variant.Stock = input.Stock
+		return []models.ProductVariant{variant}, nil
+	}
+
+	variants, err := buildVariants(product.ID, input)
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[string]struct{}, len(variants))
+	for _, variant := range variants {
+		kept[variant.SKU] = struct{}{}
+	}
+	for sku, reserved := range product.Reservados {
+		if _, ok := kept[sku]; !ok && reserved > 0 {
+			return nil, ValidationError{Code: "VALIDATION_ERROR", Message: fmt.Sprintf("variant %s has reserved stock and cannot be removed", sku)}
+		}
+	}
+	return variants, nil
+}
+
 func validateField(name, value string, allowed map[string]struct{}) error {
 	value = strings.TrimSpace(value)
 	if value == "" {
@@ -409,6 +583,8 @@ func TranslateError(err error) string {
 		return "validation_error"
 	case errors.Is(err, repositories.ErrNotFound):
 		return "not_found"
+	case errors.Is(err, repositories.ErrVersionConflict):
+		return "conflict"
 	default:
 		return "internal_error"
 	}
@@ -2,12 +2,15 @@ package services
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
+	"events"
 	"products-api/internal/models"
 	"products-api/internal/repositories"
 
@@ -24,16 +27,15 @@ func (roundTripOK) RoundTrip(req *http.Request) (*http.Response, error) {
 	}, nil
 }
 
-func newTestService(repo repositories.ProductRepository, publisher EventPublisher) *ProductService {
-	s := NewProductService(repo, publisher, "http://users-api")
+func newTestService(repo repositories.ProductRepository) *ProductService {
+	s := NewProductService(repo, "http://users-api")
 	s.httpClient = &http.Client{Transport: roundTripOK{}}
 	return s
 }
 
 func TestCreateProductSuccess(t *testing.T) {
 	repo := &mockProductRepo{}
-	publisher := &mockPublisher{}
-	service := newTestService(repo, publisher)
+	service := newTestService(repo)
 
 	input := CreateProductInput{
 		Name:        "Luna",
@@ -60,14 +62,110 @@ func TestCreateProductSuccess(t *testing.T) {
 	if repo.createCount != 1 {
 		t.Fatalf("expected create to be called once")
 	}
-	if !publisher.createdCalled {
-		t.Fatalf("expected publish created to be called")
+	if !hasEvent(repo.events, EventProductCreated, product.ID.Hex()) {
+		t.Fatalf("expected product.created to be stored in the outbox")
+	}
+}
+
+func TestCreateProductWithVariantsSyncsPriceAndStock(t *testing.T) {
+	repo := &mockProductRepo{}
+	service := newTestService(repo)
+
+	input := CreateProductInput{
+		Name:        "Luna",
+		Descripcion: "Notas frescas",
+		Tipo:        "fresco",
+		Estacion:    "verano",
+		Ocasion:     "dia",
+		Notas:       []string{"bergamota"},
+		Genero:      "unisex",
+		Marca:       "Aromas",
+		Imagen:      "https://example.com/luna.jpg",
+		OwnerID:     "owner-1",
+		Variantes: []VariantInput{
+			{SKU: "LUNA-100-EDP", TamanoML: 100, Concentracion: "EDP", Precio: 150, Stock: 2},
+			{TamanoML: 50, Concentracion: "edt", Precio: 90, Stock: 5},
+		},
+	}
+
+	product, err := service.CreateProduct(input, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if product.Precio != 90 || product.Stock != 7 {
+		t.Fatalf("expected precio 90 and stock 7, got %f and %d", product.Precio, product.Stock)
+	}
+	if product.Variantes[0].Concentracion != models.ConcentrationEDP || product.Variantes[1].SKU == "" {
+		t.Fatalf("expected normalized concentration and generated sku, got %+v", product.Variantes)
+	}
+
+	input.Variantes = append(input.Variantes, VariantInput{SKU: "LUNA-100-EDP", TamanoML: 30, Concentracion: "edc", Precio: 40})
+	var valErr ValidationError
+	if _, err := service.CreateProduct(input, ""); !errors.As(err, &valErr) {
+		t.Fatalf("expected validation error for repeated sku, got %v", err)
+	}
+}
+
+func TestVariantSKUsAreUnique(t *testing.T) {
+	var valErr ValidationError
+	err := validateVariants([]VariantInput{
+		{TamanoML: 50, Concentracion: "edt", Precio: 90},
+		{TamanoML: 50, Concentracion: "EDT", Precio: 95},
+	})
+	if !errors.As(err, &valErr) {
+		t.Fatalf("expected validation error for a repeated size and concentration, got %v", err)
+	}
+
+	// An explicit SKU may equal the one generated for another variant.
+	productID := primitive.NewObjectID()
+	generated := strings.ToUpper(productID.Hex()[16:] + "-50-edt")
+	_, err = buildVariants(productID, CreateProductInput{Variantes: []VariantInput{
+		{SKU: generated, TamanoML: 100, Concentracion: "edp", Precio: 150},
+		{TamanoML: 50, Concentracion: "edt", Precio: 90},
+	}})
+	if !errors.As(err, &valErr) {
+		t.Fatalf("expected validation error for a generated sku already in use, got %v", err)
+	}
+}
+
+func TestUpdateProductRequiresVariantsWhenSeveralExist(t *testing.T) {
+	productID := primitive.NewObjectID()
+	repo := &mockProductRepo{findProduct: &models.Product{
+		ID:      productID,
+		OwnerID: "owner-1",
+		Variantes: []models.ProductVariant{
+			{SKU: "A", TamanoML: 50, Concentracion: "edt", Precio: 10, Stock: 1},
+			{SKU: "B", TamanoML: 100, Concentracion: "edt", Precio: 20, Stock: 1},
+		},
+	}}
+	service := newTestService(repo)
+
+	input := UpdateProductInput{
+		Name:        "Luna",
+		Descripcion: "Notas frescas",
+		Precio:      15,
+		Stock:       3,
+		Tipo:        "fresco",
+		Estacion:    "verano",
+		Ocasion:     "dia",
+		Notas:       []string{"bergamota"},
+		Genero:      "unisex",
+		Marca:       "Aromas",
+		Imagen:      "https://example.com/luna.jpg",
+		OwnerID:     "owner-1",
+	}
+	var valErr ValidationError
+	if _, err := service.UpdateProduct(productID.Hex(), "owner-1", false, "", input); !errors.As(err, &valErr) || !strings.Contains(valErr.Message, "variantes") {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if repo.updateCount != 0 {
+		t.Fatalf("expected no update")
 	}
 }
 
 func TestCreateProductValidationError(t *testing.T) {
 	repo := &mockProductRepo{}
-	service := newTestService(repo, nil)
+	service := newTestService(repo)
 
 	input := CreateProductInput{
 		Name:        "",
@@ -117,8 +215,7 @@ func TestUpdateProductSuccess(t *testing.T) {
 	repo := &mockProductRepo{
 		findProduct: existing,
 	}
-	publisher := &mockPublisher{}
-	service := newTestService(repo, publisher)
+	service := newTestService(repo)
 
 	input := UpdateProductInput{
 		Name:        "Nuevo",
@@ -144,8 +241,8 @@ func TestUpdateProductSuccess(t *testing.T) {
 	if repo.updateCount != 1 {
 		t.Fatalf("expected update to be called once")
 	}
-	if !publisher.updatedCalled {
-		t.Fatalf("expected publish updated to be called")
+	if !hasEvent(repo.events, EventProductUpdated, oid.Hex()) {
+		t.Fatalf("expected product.updated to be stored in the outbox")
 	}
 }
 
@@ -157,8 +254,7 @@ func TestDeleteProduct(t *testing.T) {
 			OwnerID: "owner-1",
 		},
 	}
-	publisher := &mockPublisher{}
-	service := newTestService(repo, publisher)
+	service := newTestService(repo)
 
 	err := service.DeleteProduct(productID.Hex(), "owner-1", true, "")
 	if err != nil {
@@ -167,8 +263,109 @@ func TestDeleteProduct(t *testing.T) {
 	if repo.deleteCount != 1 {
 		t.Fatalf("expected delete count to be 1")
 	}
-	if !publisher.deletedCalled {
-		t.Fatalf("expected delete event to be published")
+	if !hasEvent(repo.events, EventProductDeleted, productID.Hex()) {
+		t.Fatalf("expected product.deleted to be stored in the outbox")
+	}
+}
+
+func TestProductEventsCarryIncreasingVersions(t *testing.T) {
+	productID := primitive.NewObjectID()
+	repo := &mockProductRepo{
+		findProduct: &models.Product{
+			ID:        productID,
+			OwnerID:   "owner-1",
+			Variantes: []models.ProductVariant{{SKU: productID.Hex(), Precio: 100, Stock: 5}},
+			Version:   3,
+		},
+	}
+	service := newTestService(repo)
+
+	input := UpdateProductInput{
+		Name:        "Nuevo",
+		Descripcion: "Actualizado",
+		Precio:      150,
+		Stock:       7,
+		Tipo:        "amaderado",
+		Estacion:    "otono",
+		Ocasion:     "noche",
+		Genero:      "mujer",
+		Marca:       "MarcaX",
+		Imagen:      "https://example.com/nuevo.jpg",
+	}
+	updated, err := service.UpdateProduct(productID.Hex(), "owner-1", true, "", input)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.Version != 4 || eventVersion(t, repo.events[0]) != 4 {
+		t.Fatalf("expected update to bump the version to 4, got %d", updated.Version)
+	}
+
+	if err := service.DeleteProduct(productID.Hex(), "owner-1", true, ""); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if repo.deleteVersion != 4 || eventVersion(t, repo.events[1]) != 5 {
+		t.Fatalf("expected delete of version 4 to publish version 5, got %d", eventVersion(t, repo.events[1]))
+	}
+}
+
+func TestExportProductsWalksTheCatalogWithACursor(t *testing.T) {
+	repo := &mockProductRepo{}
+	for i := 0; i < 5; i++ {
+		repo.catalog = append(repo.catalog, models.Product{ID: primitive.NewObjectID(), Name: "Producto"})
+	}
+	service := NewProductService(repo, "http://users-api")
+
+	var seen int
+	cursor, pages := "", 0
+	for {
+		items, next, err := service.ExportProducts(cursor, 2)
+		if err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		seen += len(items)
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if seen != 5 || pages != 3 {
+		t.Fatalf("expected 5 products over 3 pages, got %d over %d", seen, pages)
+	}
+
+	if _, _, err := service.ExportProducts("not-an-id", 2); err == nil {
+		t.Fatalf("expected invalid cursor to be rejected")
+	}
+}
+
+func TestListProductsValidatesRangeAndMultiValueFilters(t *testing.T) {
+	repo := &mockProductRepo{}
+	service := NewProductService(repo, "http://users-api")
+
+	for _, filter := range []repositories.ProductFilter{
+		{PrecioMin: 200, PrecioMax: 100},
+		{PrecioMax: -5},
+		{Notas: []string{"vainilla"}, NotasMatch: "most"},
+	} {
+		var valErr ValidationError
+		if _, _, _, err := service.ListProducts(filter, repositories.Pagination{}); !errors.As(err, &valErr) {
+			t.Fatalf("expected %+v to be rejected, got %v", filter, err)
+		}
+	}
+	if repo.findAllCount != 0 {
+		t.Fatalf("expected invalid filters not to reach the repository")
+	}
+
+	filter := repositories.ProductFilter{
+		Marca:      []string{"Dior", "Chanel"},
+		Notas:      []string{"vainilla", "ambar"},
+		NotasMatch: repositories.NotasMatchAll,
+		PrecioMin:  50,
+		PrecioMax:  150,
+		InStock:    true,
+	}
+	if _, _, _, err := service.ListProducts(filter, repositories.Pagination{}); err != nil {
+		t.Fatalf("list: %v", err)
 	}
 }
 
@@ -177,22 +374,32 @@ type mockProductRepo struct {
 	updateCount int
 	deleteCount int
 
-	findProduct *models.Product
+	deleteVersion int64
+	findProduct   *models.Product
+	catalog       []models.Product
+	events        []models.OutboxEvent
+	findAllCount  int
 }
 
-func (m *mockProductRepo) Create(p *models.Product) error {
+func (m *mockProductRepo) Create(p *models.Product, events ...models.OutboxEvent) error {
 	m.createCount++
-	p.ID = primitive.NewObjectID()
+	m.events = append(m.events, events...)
+	if p.ID.IsZero() {
+		p.ID = primitive.NewObjectID()
+	}
 	return nil
 }
 
-func (m *mockProductRepo) Update(p *models.Product) error {
+func (m *mockProductRepo) Update(p *models.Product, events ...models.OutboxEvent) error {
 	m.updateCount++
+	m.events = append(m.events, events...)
 	return nil
 }
 
-func (m *mockProductRepo) Delete(id string) error {
+func (m *mockProductRepo) Delete(id string, version int64, events ...models.OutboxEvent) error {
 	m.deleteCount++
+	m.deleteVersion = version
+	m.events = append(m.events, events...)
 	return nil
 }
 
@@ -204,26 +411,40 @@ func (m *mockProductRepo) FindByID(id string) (*models.Product, error) {
 }
 
 func (m *mockProductRepo) FindAll(filter repositories.ProductFilter, pagination repositories.Pagination) ([]models.Product, int64, error) {
+	m.findAllCount++
 	return []models.Product{}, 0, nil
 }
 
-type mockPublisher struct {
-	createdCalled bool
-	updatedCalled bool
-	deletedCalled bool
-}
-
-func (m *mockPublisher) PublishProductCreated(product *models.Product) error {
-	m.createdCalled = true
-	return nil
+func (m *mockProductRepo) FindAfter(afterID string, limit int) ([]models.Product, error) {
+	var page []models.Product
+	for _, product := range m.catalog {
+		if product.ID.Hex() > afterID && len(page) < limit {
+			page = append(page, product)
+		}
+	}
+	return page, nil
 }
 
-func (m *mockPublisher) PublishProductUpdated(product *models.Product) error {
-	m.updatedCalled = true
-	return nil
+func eventVersion(t *testing.T, event models.OutboxEvent) int64 {
+	t.Helper()
+	envelope, err := events.Decode(event.Payload)
+	if err != nil {
+		t.Fatalf("decode event envelope: %v", err)
+	}
+	var data struct {
+		Version int64 `json:"version"`
+	}
+	if err := json.Unmarshal(envelope.Data, &data); err != nil {
+		t.Fatalf("decode event data: %v", err)
+	}
+	return data.Version
 }
 
-func (m *mockPublisher) PublishProductDeleted(id string) error {
-	m.deletedCalled = true
-	return nil
+func hasEvent(events []models.OutboxEvent, routingKey, aggregateID string) bool {
+	for _, event := range events {
+		if event.RoutingKey == routingKey && event.AggregateID == aggregateID {
+			return true
+		}
+	}
+	return false
 }
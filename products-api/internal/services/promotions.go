@@ -0,0 +1,162 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"products-api/internal/models"
+)
+
+// pricedLine is a checkout line while discounts are being evaluated.
+type pricedLine struct {
+	product  *models.Product
+	variant  *models.ProductVariant
+	quantity int
+	discount float64
+	ajustes  []models.PriceAdjustment
+}
+
+// unitPrice is the variant price, falling back to the product price for
+// lines built without a resolved variant.
+func (l *pricedLine) unitPrice() float64 {
+	if l.variant != nil {
+		return l.variant.Precio
+	}
+	return l.product.Precio
+}
+
+func (l *pricedLine) gross() float64 {
+	return l.unitPrice() * float64(l.quantity)
+}
+
+func (l *pricedLine) net() float64 {
+	return l.gross() - l.discount
+}
+
+// couponIneligible explains why a coupon cannot be applied to an order.
+func couponIneligible(code, message string) ValidationError {
+	return ValidationError{Code: code, Message: message}
+}
+
+// evaluateCoupon computes the discount the coupon grants on each line, keyed by
+// line index. It only performs stateless checks; usage limits are enforced by
+// the caller because they require the repository.
+func evaluateCoupon(coupon models.Coupon, lines []*pricedLine, now time.Time) (map[int]float64, error) {
+	if !coupon.Activo {
+		return nil, couponIneligible("COUPON_INACTIVE", "coupon is not active")
+	}
+	if (!coupon.ValidoDesde.IsZero() && now.Before(coupon.ValidoDesde)) || (!coupon.ValidoHasta.IsZero() && now.After(coupon.ValidoHasta)) {
+		return nil, couponIneligible("COUPON_EXPIRED", "coupon is not valid at this time")
+	}
+
+	var subtotal float64
+	for _, line := range lines {
+		subtotal += line.gross()
+	}
+	if coupon.MinimoCompra > 0 && subtotal < coupon.MinimoCompra {
+		return nil, couponIneligible("COUPON_MINIMUM_NOT_MET", "purchase does not reach the coupon minimum")
+	}
+
+	eligible := make([]int, 0, len(lines))
+	var eligibleNet float64
+	for i, line := range lines {
+		if couponAppliesTo(coupon, line.product) && line.net() > 0 {
+			eligible = append(eligible, i)
+			eligibleNet += line.net()
+		}
+	}
+	if len(eligible) == 0 {
+		return nil, couponIneligible("COUPON_NOT_APPLICABLE", "coupon does not apply to any item")
+	}
+
+	amounts := make(map[int]float64, len(eligible))
+	switch coupon.Tipo {
+	case models.CouponPercentage:
+		for _, i := range eligible {
+			amounts[i] = roundCents(lines[i].net() * coupon.Valor / 100)
+		}
+	case models.CouponFixed:
+		amount := math.Min(coupon.Valor, eligibleNet)
+		remaining := roundCents(amount)
+		for n, i := range eligible {
+			share := roundCents(amount * lines[i].net() / eligibleNet)
+			if n == len(eligible)-1 {
+				share = remaining
+			}
+			amounts[i] = share
+			remaining = roundCents(remaining - share)
+		}
+	case models.CouponFreeItem:
+		target := -1
+		for _, i := range eligible {
+			if coupon.ProductoGratisID != "" {
+				if lines[i].product.ID.Hex() == coupon.ProductoGratisID {
+					target = i
+					break
+				}
+				continue
+			}
+			if target < 0 || lines[i].unitPrice() < lines[target].unitPrice() {
+				target = i
+			}
+		}
+		if target < 0 {
+			return nil, couponIneligible("COUPON_NOT_APPLICABLE", "coupon does not apply to any item")
+		}
+		amounts[target] = roundCents(math.Min(lines[target].unitPrice(), lines[target].net()))
+	default:
+		return nil, couponIneligible("COUPON_NOT_APPLICABLE", "coupon type is not supported")
+	}
+
+	var total float64
+	for _, amount := range amounts {
+		total += amount
+	}
+	if total <= 0 {
+		return nil, couponIneligible("COUPON_NOT_APPLICABLE", "coupon does not apply to any item")
+	}
+	return amounts, nil
+}
+
+// applyCoupon records the computed amounts as line-level adjustments.
+func applyCoupon(coupon models.Coupon, lines []*pricedLine, amounts map[int]float64) {
+	for i, amount := range amounts {
+		if amount <= 0 {
+			continue
+		}
+		line := lines[i]
+		amount = math.Min(amount, line.net())
+		line.discount = roundCents(line.discount + amount)
+		line.ajustes = append(line.ajustes, models.PriceAdjustment{
+			CouponID:    coupon.ID,
+			Codigo:      coupon.Codigo,
+			Descripcion: coupon.Descripcion,
+			Automatico:  coupon.Automatico,
+			Monto:       amount,
+		})
+	}
+}
+
+func couponAppliesTo(coupon models.Coupon, product *models.Product) bool {
+	if len(coupon.Marcas) > 0 && !containsFold(coupon.Marcas, product.Marca) {
+		return false
+	}
+	if len(coupon.Tipos) > 0 && !containsFold(coupon.Tipos, product.Tipo) {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(strings.TrimSpace(value), strings.TrimSpace(target)) {
+			return true
+		}
+	}
+	return false
+}
+
+func roundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"products-api/internal/models"
+	"products-api/internal/repositories"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheckoutAppliesCouponAndAutomaticPromotion(t *testing.T) {
+	dior := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			dior.Hex():  {ID: dior, Name: "Sauvage", Marca: "Dior", Tipo: "fresco", Precio: 100, Stock: 5},
+			other.Hex(): {ID: other, Name: "Luna", Marca: "Aromas", Tipo: "floral", Precio: 50, Stock: 5},
+		},
+	}
+	coupons := newFakeCouponRepo(
+		activeCoupon(models.Coupon{Codigo: "DIOR10", Descripcion: "10% Dior", Tipo: models.CouponPercentage, Valor: 10, Marcas: []string{"dior"}}),
+		activeCoupon(models.Coupon{Descripcion: "20 off over 200", Tipo: models.CouponFixed, Valor: 20, MinimoCompra: 200, Automatico: true}),
+	)
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	service := NewPurchaseService(productRepo, purchaseRepo, coupons)
+
+	purchase, err := service.CheckoutWithCoupon("1", []CheckoutItemInput{
+		{ProductID: dior.Hex(), Cantidad: 2},
+		{ProductID: other.Hex(), Cantidad: 1},
+	}, "dior10")
+	if err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+
+	// automatic 20 off split 200/250 and 50/250 -> 16 + 4, then 10% of Dior's remaining 184.
+	if purchase.Subtotal != 250 {
+		t.Fatalf("expected subtotal 250, got %f", purchase.Subtotal)
+	}
+	if purchase.Descuento != 38.4 {
+		t.Fatalf("expected discount 38.4, got %f", purchase.Descuento)
+	}
+	if purchase.Total != 211.6 {
+		t.Fatalf("expected total 211.6, got %f", purchase.Total)
+	}
+	if len(purchase.Items[0].Ajustes) != 2 || len(purchase.Items[1].Ajustes) != 1 {
+		t.Fatalf("expected line-level adjustments, got %+v", purchase.Items)
+	}
+	if len(coupons.redemptions) != 2 {
+		t.Fatalf("expected 2 redemptions, got %d", len(coupons.redemptions))
+	}
+}
+
+func TestCheckoutRejectsIneligibleCoupon(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Marca: "Aromas", Precio: 50, Stock: 5},
+		},
+	}
+	coupons := newFakeCouponRepo(
+		activeCoupon(models.Coupon{Codigo: "MIN100", Descripcion: "min", Tipo: models.CouponFixed, Valor: 10, MinimoCompra: 100}),
+	)
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	service := NewPurchaseService(productRepo, purchaseRepo, coupons)
+
+	_, err := service.CheckoutWithCoupon("1", []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 1}}, "MIN100")
+	var valErr ValidationError
+	if !errors.As(err, &valErr) || valErr.Code != "COUPON_MINIMUM_NOT_MET" {
+		t.Fatalf("expected COUPON_MINIMUM_NOT_MET, got %v", err)
+	}
+	if purchaseRepo.created != nil {
+		t.Fatalf("purchase should not be created with an ineligible coupon")
+	}
+	if productRepo.products[productID.Hex()].Stock != 5 {
+		t.Fatalf("stock should not change when the coupon is rejected")
+	}
+}
+
+func TestCheckoutEnforcesCouponUsageLimits(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 50, Stock: 10},
+		},
+	}
+	coupons := newFakeCouponRepo(
+		activeCoupon(models.Coupon{Codigo: "UNAVEZ", Descripcion: "once", Tipo: models.CouponFreeItem, MaxUsos: 2, MaxUsosPorUsuario: 1}),
+	)
+	service := NewPurchaseService(productRepo, &fakePurchasesRepo{products: productRepo}, coupons)
+	items := []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 2}}
+
+	purchase, err := service.CheckoutWithCoupon("1", items, "UNAVEZ")
+	if err != nil {
+		t.Fatalf("first checkout: %v", err)
+	}
+	if purchase.Total != 50 {
+		t.Fatalf("expected one free unit, got total %f", purchase.Total)
+	}
+
+	_, err = service.CheckoutWithCoupon("1", items, "UNAVEZ")
+	var valErr ValidationError
+	if !errors.As(err, &valErr) || valErr.Code != "COUPON_USER_LIMIT" {
+		t.Fatalf("expected COUPON_USER_LIMIT, got %v", err)
+	}
+
+	if _, err := service.CheckoutWithCoupon("2", items, "UNAVEZ"); err != nil {
+		t.Fatalf("second user checkout: %v", err)
+	}
+	_, err = service.CheckoutWithCoupon("3", items, "UNAVEZ")
+	if !errors.As(err, &valErr) || valErr.Code != "COUPON_EXHAUSTED" {
+		t.Fatalf("expected COUPON_EXHAUSTED, got %v", err)
+	}
+	// The exhausted coupon gave back the use it had reserved for user 3.
+	if _, err := service.CheckoutWithCoupon("3", items, ""); err != nil {
+		t.Fatalf("checkout without coupon: %v", err)
+	}
+	if uses := coupons.userUses[coupons.coupons[0].ID.Hex()+"/3"]; uses != 0 {
+		t.Fatalf("expected the reserved use of user 3 to be released, got %d", uses)
+	}
+}
+
+func TestCheckoutFailsWhenTheRedemptionCannotBeRecorded(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 50, Stock: 10},
+		},
+	}
+	coupons := newFakeCouponRepo(
+		activeCoupon(models.Coupon{Codigo: "UNAVEZ", Descripcion: "once", Tipo: models.CouponFixed, Valor: 5, MaxUsos: 2, MaxUsosPorUsuario: 1}),
+	)
+	coupons.recordErr = errors.New("mongo down")
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	service := NewPurchaseService(productRepo, purchaseRepo, coupons)
+	items := []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 1}}
+
+	if _, err := service.CheckoutWithCoupon("1", items, "UNAVEZ"); err == nil {
+		t.Fatalf("expected the checkout to fail")
+	}
+	if purchaseRepo.created != nil || productRepo.products[productID.Hex()].Stock != 10 {
+		t.Fatalf("expected nothing to be written")
+	}
+	if coupons.coupons[0].Usos != 0 || coupons.userUses[coupons.coupons[0].ID.Hex()+"/1"] != 0 {
+		t.Fatalf("expected the consumed uses to be given back")
+	}
+
+	coupons.recordErr = nil
+	purchase, err := service.CheckoutWithCoupon("1", items, "UNAVEZ")
+	if err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	if len(coupons.redemptions) != 1 || coupons.redemptions[0].PurchaseID != purchase.ID {
+		t.Fatalf("expected the redemption to reference the purchase, got %+v", coupons.redemptions)
+	}
+}
+
+func activeCoupon(c models.Coupon) models.Coupon {
+	c.ID = primitive.NewObjectID()
+	c.Activo = true
+	c.ValidoDesde = time.Now().Add(-time.Hour)
+	c.ValidoHasta = time.Now().Add(time.Hour)
+	return c
+}
+
+// --- fakes ---
+
+type fakeCouponRepo struct {
+	coupons     []*models.Coupon
+	redemptions []models.CouponRedemption
+	userUses    map[string]int
+	recordErr   error
+}
+
+func newFakeCouponRepo(coupons ...models.Coupon) *fakeCouponRepo {
+	repo := &fakeCouponRepo{userUses: make(map[string]int)}
+	for i := range coupons {
+		c := coupons[i]
+		repo.coupons = append(repo.coupons, &c)
+	}
+	return repo
+}
+
+func (f *fakeCouponRepo) Create(coupon *models.Coupon) error {
+	coupon.ID = primitive.NewObjectID()
+	f.coupons = append(f.coupons, coupon)
+	return nil
+}
+
+func (f *fakeCouponRepo) Update(coupon *models.Coupon) error {
+	return nil
+}
+
+func (f *fakeCouponRepo) Delete(id string) error {
+	return nil
+}
+
+func (f *fakeCouponRepo) FindByID(id string) (*models.Coupon, error) {
+	for _, c := range f.coupons {
+		if c.ID.Hex() == id {
+			cpy := *c
+			return &cpy, nil
+		}
+	}
+	return nil, repositories.ErrCouponNotFound
+}
+
+func (f *fakeCouponRepo) FindByCode(code string) (*models.Coupon, error) {
+	for _, c := range f.coupons {
+		if c.Codigo != "" && strings.EqualFold(c.Codigo, code) {
+			cpy := *c
+			return &cpy, nil
+		}
+	}
+	return nil, repositories.ErrCouponNotFound
+}
+
+func (f *fakeCouponRepo) FindAll() ([]models.Coupon, error) {
+	out := make([]models.Coupon, 0, len(f.coupons))
+	for _, c := range f.coupons {
+		out = append(out, *c)
+	}
+	return out, nil
+}
+
+func (f *fakeCouponRepo) FindActiveAutomatic(now time.Time) ([]models.Coupon, error) {
+	var out []models.Coupon
+	for _, c := range f.coupons {
+		if c.Automatico && c.Activo {
+			out = append(out, *c)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeCouponRepo) IncrementUses(id primitive.ObjectID, maxUses int) error {
+	for _, c := range f.coupons {
+		if c.ID == id {
+			if maxUses > 0 && c.Usos >= maxUses {
+				return repositories.ErrCouponExhausted
+			}
+			c.Usos++
+			return nil
+		}
+	}
+	return repositories.ErrCouponNotFound
+}
+
+func (f *fakeCouponRepo) DecrementUses(id primitive.ObjectID) error {
+	for _, c := range f.coupons {
+		if c.ID == id && c.Usos > 0 {
+			c.Usos--
+		}
+	}
+	return nil
+}
+
+func (f *fakeCouponRepo) ReserveUserUse(couponID primitive.ObjectID, userID string, maxPerUser int) error {
+	key := couponID.Hex() + "/" + userID
+	if f.userUses[key] >= maxPerUser {
+		return repositories.ErrCouponUserLimit
+	}
+	f.userUses[key]++
+	return nil
+}
+
+func (f *fakeCouponRepo) ReleaseUserUse(couponID primitive.ObjectID, userID string) error {
+	key := couponID.Hex() + "/" + userID
+	if f.userUses[key] > 0 {
+		f.userUses[key]--
+	}
+	return nil
+}
+
+func (f *fakeCouponRepo) RecordRedemption(redemption *models.CouponRedemption) error {
+	if f.recordErr != nil {
+		return f.recordErr
+	}
+	f.redemptions = append(f.redemptions, *redemption)
+	return nil
+}
+
+func (f *fakeCouponRepo) DeleteRedemptions(purchaseID primitive.ObjectID) error {
+	kept := f.redemptions[:0]
+	for _, r := range f.redemptions {
+		if r.PurchaseID != purchaseID {
+			kept = append(kept, r)
+		}
+	}
+	f.redemptions = kept
+	return nil
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -8,11 +9,14 @@ import (
 
 	"products-api/internal/models"
 	"products-api/internal/repositories"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // CheckoutItemInput represents a product included in the checkout payload.
 type CheckoutItemInput struct {
 	ProductID string
+	SKU       string
 	Cantidad  int
 }
 
@@ -20,21 +24,22 @@ type CheckoutItemInput struct {
 type PurchaseService struct {
 	productRepo  repositories.ProductRepository
 	purchaseRepo repositories.PurchaseRepository
-	publisher    EventPublisher
+	couponRepo   repositories.CouponRepository
 }
 
-// NewPurchaseService builds a PurchaseService.
-func NewPurchaseService(productRepo repositories.ProductRepository, purchaseRepo repositories.PurchaseRepository, publisher EventPublisher) *PurchaseService {
+// NewPurchaseService builds a PurchaseService. couponRepo may be nil to disable discounts.
+func NewPurchaseService(productRepo repositories.ProductRepository, purchaseRepo repositories.PurchaseRepository, couponRepo repositories.CouponRepository) *PurchaseService {
 	return &PurchaseService{
 		productRepo:  productRepo,
 		purchaseRepo: purchaseRepo,
-		publisher:    publisher,
+		couponRepo:   couponRepo,
 	}
 }
 
 // InsufficientStockError indicates a product without stock.
 type InsufficientStockError struct {
 	ProductID string
+	SKU       string
 	Requested int
 	Available int
 }
@@ -43,8 +48,24 @@ func (e InsufficientStockError) Error() string {
 	return fmt.Sprintf("insufficient stock for product %s", e.ProductID)
 }
 
-// Checkout validates stock, stores a purchase and emits stock updates.
+// Checkout validates stock, stores a purchase and records stock update events.
+// Automatic promotions still apply.
 func (s *PurchaseService) Checkout(userID string, items []CheckoutItemInput) (*models.Purchase, error) {
+	return s.CheckoutWithCoupon(userID, items, "")
+}
+
+// CheckoutWithCoupon behaves like Checkout and additionally redeems the given coupon code.
+func (s *PurchaseService) CheckoutWithCoupon(userID string, items []CheckoutItemInput, couponCode string) (*models.Purchase, error) {
+	return s.checkout(userID, items, couponCode, false)
+}
+
+// CheckoutReserved converts items whose quantities are already held by a
+// reservation into a purchase. The caller releases the hold afterwards.
+func (s *PurchaseService) CheckoutReserved(userID string, items []CheckoutItemInput, couponCode string) (*models.Purchase, error) {
+	return s.checkout(userID, items, couponCode, true)
+}
+
+func (s *PurchaseService) checkout(userID string, items []CheckoutItemInput, couponCode string, held bool) (*models.Purchase, error) {
 	if strings.TrimSpace(userID) == "" {
 		return nil, ValidationError{Code: "VALIDATION_ERROR", Message: "user id is required"}
 	}
@@ -57,74 +78,284 @@ func (s *PurchaseService) Checkout(userID string, items []CheckoutItemInput) (*m
 		return nil, ValidationError{Code: "VALIDATION_ERROR", Message: "no purchase items received"}
 	}
 
-	type selection struct {
-		product  *models.Product
-		quantity int
+	// A product that changed between reading it and writing the purchase
+	// makes the attempt fail without writing anything, so it is retried
+	// from a fresh read.
+	for attempt := 1; ; attempt++ {
+		purchase, err := s.tryCheckout(userID, aggregated, couponCode, held)
+		if errors.Is(err, repositories.ErrVersionConflict) && attempt < checkoutAttempts {
+			continue
+		}
+		return purchase, err
 	}
+}
+
+// checkoutAttempts bounds the retries of a checkout whose products keep
+// changing concurrently.
+const checkoutAttempts = 3
 
-	selected := make([]selection, 0, len(aggregated))
+func (s *PurchaseService) tryCheckout(userID string, aggregated []aggregatedItem, couponCode string, held bool) (*models.Purchase, error) {
+	var err error
+	products := make(map[string]*models.Product, len(aggregated))
+	touched := make([]*models.Product, 0, len(aggregated))
+	lines := make([]*pricedLine, 0, len(aggregated))
+	// Lines naming a variant by SKU and lines leaving it implicit resolve to
+	// the same variant, so quantities are merged per resolved variant
+	// before checking its availability.
+	byVariant := make(map[string]*pricedLine, len(aggregated))
 	for _, entry := range aggregated {
-		product, err := s.productRepo.FindByID(entry.productID)
+		product, ok := products[entry.productID]
+		if !ok {
+			product, err = s.productRepo.FindByID(entry.productID)
+			if err != nil {
+				return nil, err
+			}
+			products[entry.productID] = product
+			touched = append(touched, product)
+		}
+		variant, err := resolveVariant(product, entry.sku)
 		if err != nil {
 			return nil, err
 		}
-		if product.Stock < entry.quantity {
-			return nil, InsufficientStockError{
-				ProductID: product.ID.Hex(),
-				Requested: entry.quantity,
-				Available: product.Stock,
-			}
+		key := product.ID.Hex() + "/" + variant.SKU
+		if line, ok := byVariant[key]; ok {
+			line.quantity += entry.quantity
+			continue
 		}
-		selected = append(selected, selection{
+		line := &pricedLine{
 			product:  product,
+			variant:  variant,
 			quantity: entry.quantity,
-		})
+		}
+		byVariant[key] = line
+		lines = append(lines, line)
+	}
+	for _, line := range lines {
+		available := line.product.VariantAvailable(line.variant.SKU)
+		if held {
+			available = min(available+line.quantity, line.variant.Stock)
+		}
+		if available < line.quantity {
+			return nil, InsufficientStockError{
+				ProductID: line.product.ID.Hex(),
+				SKU:       line.variant.SKU,
+				Requested: line.quantity,
+				Available: available,
+			}
+		}
 	}
 
 	now := time.Now().UTC()
-	itemsSnapshot := make([]models.PurchaseItem, 0, len(selected))
-	var total float64
-
-	for _, entry := range selected {
-		entry.product.Stock -= entry.quantity
-		if entry.product.Stock < 0 {
-			entry.product.Stock = 0
+	redeemed, err := s.applyDiscounts(userID, couponCode, lines, now)
+	if err != nil {
+		return nil, err
+	}
+	// Redemptions are recorded before anything else is written so that a
+	// failure to record them fails the checkout; later failures delete them
+	// along with the uses they consumed.
+	purchaseID := primitive.NewObjectID()
+	releaseCoupons := func() {
+		if len(redeemed) > 0 {
+			if err := s.couponRepo.DeleteRedemptions(purchaseID); err != nil {
+				log.Printf("delete redemptions of purchase %s failed: %v", purchaseID.Hex(), err)
+			}
 		}
-		entry.product.UpdatedAt = now
-		if err := s.productRepo.Update(entry.product); err != nil {
+		s.releaseCoupons(userID, redeemed)
+	}
+	for _, coupon := range redeemed {
+		redemption := &models.CouponRedemption{
+			CouponID:   coupon.ID,
+			UserID:     userID,
+			PurchaseID: purchaseID,
+			CreatedAt:  now,
+		}
+		if err := s.couponRepo.RecordRedemption(redemption); err != nil {
+			releaseCoupons()
 			return nil, err
 		}
-		if s.publisher != nil {
-			if err := s.publisher.PublishProductUpdated(entry.product); err != nil {
-				log.Printf("publish product.updated after checkout failed: %v", err)
-			}
+	}
+
+	itemsSnapshot := make([]models.PurchaseItem, 0, len(lines))
+	var subtotal, discount float64
+
+	for _, line := range lines {
+		line.variant.Stock -= line.quantity
+		if line.variant.Stock < 0 {
+			releaseCoupons()
+			return nil, fmt.Errorf("stock of variant %s of product %s would drop to %d", line.variant.SKU, line.product.ID.Hex(), line.variant.Stock)
 		}
 
 		itemsSnapshot = append(itemsSnapshot, models.PurchaseItem{
-			ProductID:      entry.product.ID,
-			Nombre:         entry.product.Name,
-			Marca:          entry.product.Marca,
-			Imagen:         entry.product.Imagen,
-			PrecioUnitario: entry.product.Precio,
-			Cantidad:       entry.quantity,
+			ProductID:      line.product.ID,
+			SKU:            line.variant.SKU,
+			TamanoML:       line.variant.TamanoML,
+			Concentracion:  line.variant.Concentracion,
+			Nombre:         line.product.Name,
+			Marca:          line.product.Marca,
+			Imagen:         line.product.Imagen,
+			PrecioUnitario: line.variant.Precio,
+			Cantidad:       line.quantity,
+			Ajustes:        line.ajustes,
+			TotalLinea:     roundCents(line.net()),
+		})
+		subtotal += line.gross()
+		discount += line.discount
+	}
+
+	// The stock written must still cover what other reservations hold;
+	// a held checkout's own hold is released afterwards.
+	maxReserved := make(map[string]map[string]int, len(touched))
+	for _, line := range lines {
+		caps, ok := maxReserved[line.product.ID.Hex()]
+		if !ok {
+			caps = map[string]int{}
+			maxReserved[line.product.ID.Hex()] = caps
+		}
+		caps[line.variant.SKU] = line.variant.Stock
+		if held {
+			caps[line.variant.SKU] += line.quantity
+		}
+	}
+
+	updates := make([]repositories.StockUpdate, 0, len(touched))
+	for _, product := range touched {
+		product.SyncFromVariants()
+		product.UpdatedAt = now
+		product.Version++
+		event, err := productEvent(EventProductUpdated, product)
+		if err != nil {
+			releaseCoupons()
+			return nil, err
+		}
+		updates = append(updates, repositories.StockUpdate{
+			Product:     product,
+			Events:      []models.OutboxEvent{event},
+			MaxReserved: maxReserved[product.ID.Hex()],
 		})
-		total += entry.product.Precio * float64(entry.quantity)
 	}
 
 	purchase := &models.Purchase{
+		ID:          purchaseID,
 		UserID:      userID,
 		FechaCompra: now,
-		Total:       total,
+		Subtotal:    roundCents(subtotal),
+		Descuento:   roundCents(discount),
+		Total:       roundCents(subtotal - discount),
 		Items:       itemsSnapshot,
 	}
 
-	if err := s.purchaseRepo.Create(purchase); err != nil {
+	if err := s.purchaseRepo.Create(purchase, updates...); err != nil {
+		releaseCoupons()
 		return nil, err
 	}
 
 	return purchase, nil
 }
 
+// releaseCoupons gives back the uses, global and per user, consumed by
+// coupons of a checkout that did not complete.
+func (s *PurchaseService) releaseCoupons(userID string, coupons []models.Coupon) {
+	for _, coupon := range coupons {
+		if err := s.couponRepo.DecrementUses(coupon.ID); err != nil {
+			log.Printf("release coupon %s failed: %v", coupon.ID.Hex(), err)
+		}
+		if coupon.MaxUsosPorUsuario > 0 {
+			if err := s.couponRepo.ReleaseUserUse(coupon.ID, userID); err != nil {
+				log.Printf("release coupon %s use of user %s failed: %v", coupon.ID.Hex(), userID, err)
+			}
+		}
+	}
+}
+
+// applyDiscounts evaluates automatic promotions and the optional coupon code,
+// consuming one use of every coupon that ends up applied, and one of the
+// user's uses when the coupon limits them. Ineligible automatic
+// promotions are skipped silently; an ineligible coupon code fails the checkout.
+func (s *PurchaseService) applyDiscounts(userID, couponCode string, lines []*pricedLine, now time.Time) ([]models.Coupon, error) {
+	couponCode = strings.TrimSpace(couponCode)
+	if s.couponRepo == nil {
+		if couponCode != "" {
+			return nil, ValidationError{Code: "COUPON_NOT_FOUND", Message: "coupon does not exist"}
+		}
+		return nil, nil
+	}
+
+	candidates, err := s.couponRepo.FindActiveAutomatic(now)
+	if err != nil {
+		return nil, err
+	}
+	if couponCode != "" {
+		coupon, err := s.couponRepo.FindByCode(couponCode)
+		if err != nil {
+			if errors.Is(err, repositories.ErrCouponNotFound) {
+				return nil, ValidationError{Code: "COUPON_NOT_FOUND", Message: "coupon does not exist"}
+			}
+			return nil, err
+		}
+		candidates = append(candidates, *coupon)
+	}
+
+	var redeemed []models.Coupon
+	fail := func(err error) ([]models.Coupon, error) {
+		s.releaseCoupons(userID, redeemed)
+		return nil, err
+	}
+
+	applied := make(map[string]struct{}, len(candidates))
+	for _, coupon := range candidates {
+		if _, ok := applied[coupon.ID.Hex()]; ok {
+			continue
+		}
+		explicit := !coupon.Automatico || (couponCode != "" && strings.EqualFold(coupon.Codigo, couponCode))
+
+		// The user's use is reserved up front, so concurrent checkouts of
+		// the same user cannot both pass the limit.
+		if coupon.MaxUsosPorUsuario > 0 {
+			if err := s.couponRepo.ReserveUserUse(coupon.ID, userID, coupon.MaxUsosPorUsuario); err != nil {
+				if errors.Is(err, repositories.ErrCouponUserLimit) {
+					if explicit {
+						return fail(ValidationError{Code: "COUPON_USER_LIMIT", Message: "coupon usage limit reached for this user"})
+					}
+					continue
+				}
+				return fail(err)
+			}
+		}
+		releaseUserUse := func() {
+			if coupon.MaxUsosPorUsuario > 0 {
+				if err := s.couponRepo.ReleaseUserUse(coupon.ID, userID); err != nil {
+					log.Printf("release coupon %s use of user %s failed: %v", coupon.ID.Hex(), userID, err)
+				}
+			}
+		}
+
+		amounts, err := evaluateCoupon(coupon, lines, now)
+		if err != nil {
+			releaseUserUse()
+			if explicit {
+				return fail(err)
+			}
+			continue
+		}
+
+		if err := s.couponRepo.IncrementUses(coupon.ID, coupon.MaxUsos); err != nil {
+			releaseUserUse()
+			if errors.Is(err, repositories.ErrCouponExhausted) {
+				if explicit {
+					return fail(ValidationError{Code: "COUPON_EXHAUSTED", Message: "coupon usage limit reached"})
+				}
+				continue
+			}
+			return fail(err)
+		}
+
+		applyCoupon(coupon, lines, amounts)
+		applied[coupon.ID.Hex()] = struct{}{}
+		redeemed = append(redeemed, coupon)
+	}
+	return redeemed, nil
+}
+
 // ListByUser returns the purchase history for a user.
 func (s *PurchaseService) ListByUser(userID string) ([]models.Purchase, error) {
 	if strings.TrimSpace(userID) == "" {
@@ -135,6 +366,7 @@ func (s *PurchaseService) ListByUser(userID string) ([]models.Purchase, error) {
 
 type aggregatedItem struct {
 	productID string
+	sku       string
 	quantity  int
 }
 
@@ -153,15 +385,32 @@ func aggregateItems(items []CheckoutItemInput) ([]aggregatedItem, error) {
 		if item.Cantidad <= 0 {
 			return nil, ValidationError{Code: "VALIDATION_ERROR", Message: "cantidad must be greater than zero"}
 		}
-		if idx, ok := seen[id]; ok {
+		sku := strings.TrimSpace(item.SKU)
+		key := id + "/" + sku
+		if idx, ok := seen[key]; ok {
 			order[idx].quantity += item.Cantidad
 			continue
 		}
-		seen[id] = len(order)
+		seen[key] = len(order)
 		order = append(order, aggregatedItem{
 			productID: id,
+			sku:       sku,
 			quantity:  item.Cantidad,
 		})
 	}
 	return order, nil
 }
+
+// resolveVariant finds the variant a line refers to. The SKU may be omitted
+// only for products with a single variant.
+func resolveVariant(product *models.Product, sku string) (*models.ProductVariant, error) {
+	product.EnsureDefaultVariant()
+	variant, ok := product.Variant(sku)
+	if ok {
+		return variant, nil
+	}
+	if sku == "" {
+		return nil, ValidationError{Code: "VARIANT_REQUIRED", Message: fmt.Sprintf("sku is required for product %s", product.ID.Hex())}
+	}
+	return nil, ValidationError{Code: "VARIANT_NOT_FOUND", Message: fmt.Sprintf("variant %s does not exist", sku)}
+}
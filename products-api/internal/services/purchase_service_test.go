@@ -29,10 +29,8 @@ func TestCheckoutReducesStockAndCreatesPurchase(t *testing.T) {
 			},
 		},
 	}
-	purchaseRepo := &fakePurchasesRepo{}
-	publisher := &mockPublisher{}
-
-	service := NewPurchaseService(productRepo, purchaseRepo, publisher)
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	service := NewPurchaseService(productRepo, purchaseRepo, nil)
 
 	purchase, err := service.Checkout("1", []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 2}})
 	if err != nil {
@@ -53,8 +51,8 @@ func TestCheckoutReducesStockAndCreatesPurchase(t *testing.T) {
 	if purchaseRepo.created == nil {
 		t.Fatalf("expected purchase to be persisted")
 	}
-	if !publisher.updatedCalled {
-		t.Fatalf("expected product.updated event to be emitted")
+	if !hasEvent(productRepo.events, EventProductUpdated, productID.Hex()) {
+		t.Fatalf("expected product.updated event to be stored in the outbox")
 	}
 }
 
@@ -75,7 +73,7 @@ func TestCheckoutFailsOnInsufficientStock(t *testing.T) {
 			},
 		},
 	}
-	purchaseRepo := &fakePurchasesRepo{}
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
 
 	service := NewPurchaseService(productRepo, purchaseRepo, nil)
 
@@ -92,29 +90,215 @@ func TestCheckoutFailsOnInsufficientStock(t *testing.T) {
 	}
 }
 
+func TestCheckoutUsesVariantPriceAndStock(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {
+				ID:     productID,
+				Name:   "Test",
+				Precio: 30,
+				Stock:  5,
+				Variantes: []models.ProductVariant{
+					{SKU: "T-50-EDT", TamanoML: 50, Concentracion: "edt", Precio: 30, Stock: 4},
+					{SKU: "T-100-EDP", TamanoML: 100, Concentracion: "edp", Precio: 80, Stock: 1},
+				},
+			},
+		},
+	}
+	service := NewPurchaseService(productRepo, &fakePurchasesRepo{products: productRepo}, nil)
+
+	var valErr ValidationError
+	_, err := service.Checkout("1", []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 1}})
+	if !errors.As(err, &valErr) || valErr.Code != "VARIANT_REQUIRED" {
+		t.Fatalf("expected VARIANT_REQUIRED, got %v", err)
+	}
+
+	_, err = service.Checkout("1", []CheckoutItemInput{{ProductID: productID.Hex(), SKU: "T-100-EDP", Cantidad: 2}})
+	var stockErr InsufficientStockError
+	if !errors.As(err, &stockErr) || stockErr.SKU != "T-100-EDP" {
+		t.Fatalf("expected InsufficientStockError for the variant, got %v", err)
+	}
+
+	purchase, err := service.Checkout("1", []CheckoutItemInput{
+		{ProductID: productID.Hex(), SKU: "T-100-EDP", Cantidad: 1},
+		{ProductID: productID.Hex(), SKU: "T-50-EDT", Cantidad: 2},
+	})
+	if err != nil {
+		t.Fatalf("checkout returned error: %v", err)
+	}
+	if purchase.Total != 140 {
+		t.Fatalf("expected total 140, got %f", purchase.Total)
+	}
+	if purchase.Items[0].TamanoML != 100 || purchase.Items[0].PrecioUnitario != 80 {
+		t.Fatalf("expected variant snapshot, got %+v", purchase.Items[0])
+	}
+	product := productRepo.products[productID.Hex()]
+	if product.Stock != 2 || product.Precio != 30 {
+		t.Fatalf("expected stock 2 and precio 30, got %d and %f", product.Stock, product.Precio)
+	}
+}
+
+func TestCheckoutMergesLinesOfTheSameVariant(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {
+				ID:        productID,
+				Name:      "Test",
+				Precio:    30,
+				Stock:     3,
+				Variantes: []models.ProductVariant{{SKU: "T-50-EDT", TamanoML: 50, Concentracion: "edt", Precio: 30, Stock: 3}},
+			},
+		},
+	}
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	service := NewPurchaseService(productRepo, purchaseRepo, nil)
+
+	// Without a SKU the line resolves to the only variant, the same one the
+	// second line names.
+	_, err := service.Checkout("1", []CheckoutItemInput{
+		{ProductID: productID.Hex(), Cantidad: 2},
+		{ProductID: productID.Hex(), SKU: "T-50-EDT", Cantidad: 2},
+	})
+	var stockErr InsufficientStockError
+	if !errors.As(err, &stockErr) || stockErr.Requested != 4 || stockErr.Available != 3 {
+		t.Fatalf("expected the merged quantity to exceed the stock, got %v", err)
+	}
+	if purchaseRepo.created != nil || productRepo.products[productID.Hex()].Variantes[0].Stock != 3 {
+		t.Fatalf("expected nothing to be sold")
+	}
+
+	purchase, err := service.Checkout("1", []CheckoutItemInput{
+		{ProductID: productID.Hex(), Cantidad: 1},
+		{ProductID: productID.Hex(), SKU: "T-50-EDT", Cantidad: 2},
+	})
+	if err != nil {
+		t.Fatalf("checkout returned error: %v", err)
+	}
+	if len(purchase.Items) != 1 || purchase.Items[0].Cantidad != 3 {
+		t.Fatalf("expected a single line for the variant, got %+v", purchase.Items)
+	}
+	if stock := productRepo.products[productID.Hex()].Variantes[0].Stock; stock != 0 {
+		t.Fatalf("expected the variant to sell out, got stock %d", stock)
+	}
+}
+
+func TestCheckoutWritesNothingWhenAProductConflicts(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			first.Hex():  {ID: first, Precio: 10, Stock: 5},
+			second.Hex(): {ID: second, Precio: 20, Stock: 5},
+		},
+	}
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	// Every attempt finds the second product edited since it was read.
+	purchaseRepo.beforeCommit = func() { productRepo.products[second.Hex()].Version++ }
+	service := NewPurchaseService(productRepo, purchaseRepo, nil)
+
+	_, err := service.Checkout("1", []CheckoutItemInput{
+		{ProductID: first.Hex(), Cantidad: 2},
+		{ProductID: second.Hex(), Cantidad: 1},
+	})
+	if !errors.Is(err, repositories.ErrVersionConflict) {
+		t.Fatalf("expected a version conflict, got %v", err)
+	}
+	if stock := productRepo.products[first.Hex()].Stock; stock != 5 {
+		t.Fatalf("expected the first product to keep its stock, got %d", stock)
+	}
+	if len(productRepo.events) != 0 || purchaseRepo.created != nil {
+		t.Fatalf("expected no events nor purchase, got %d events", len(productRepo.events))
+	}
+}
+
+func TestCheckoutRetriesAfterAConflict(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 10, Stock: 5},
+		},
+	}
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	// A concurrent checkout sells one unit after this one read the product.
+	purchaseRepo.beforeCommit = func() {
+		purchaseRepo.beforeCommit = nil
+		concurrent := *productRepo.products[productID.Hex()]
+		concurrent.Stock--
+		concurrent.Version++
+		productRepo.products[productID.Hex()] = &concurrent
+	}
+	service := NewPurchaseService(productRepo, purchaseRepo, nil)
+
+	if _, err := service.Checkout("1", []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 2}}); err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	if product := productRepo.products[productID.Hex()]; product.Stock != 2 || product.Version != 2 {
+		t.Fatalf("expected both sales to be applied, got stock %d version %d", product.Stock, product.Version)
+	}
+}
+
+func TestCheckoutSeesHoldsPlacedAfterReadingTheProduct(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 10, Stock: 3},
+		},
+	}
+	reservations := newFakeReservationRepo(productRepo)
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	// Another buyer holds two units between the checkout's read and write,
+	// which leaves the product version unchanged.
+	purchaseRepo.beforeCommit = func() {
+		purchaseRepo.beforeCommit = nil
+		if err := reservations.HoldStock(productID, productID.Hex(), 2); err != nil {
+			t.Fatalf("hold: %v", err)
+		}
+	}
+	service := NewPurchaseService(productRepo, purchaseRepo, nil)
+
+	_, err := service.Checkout("1", []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 2}})
+	var stockErr InsufficientStockError
+	if !errors.As(err, &stockErr) || stockErr.Available != 1 {
+		t.Fatalf("expected the hold to leave 1 unit available, got %v", err)
+	}
+	if product := productRepo.products[productID.Hex()]; product.Stock != 3 || product.Reservados[productID.Hex()] != 2 {
+		t.Fatalf("expected the stock to still cover the hold, got stock %d reserved %v", product.Stock, product.Reservados)
+	}
+}
+
 // --- fakes ---
 
 type fakePurchaseProductRepo struct {
 	products map[string]*models.Product
+	events   []models.OutboxEvent
+	findErr  error
 }
 
-func (f *fakePurchaseProductRepo) Create(p *models.Product) error {
+func (f *fakePurchaseProductRepo) Create(p *models.Product, events ...models.OutboxEvent) error {
+	f.events = append(f.events, events...)
 	return nil
 }
 
-func (f *fakePurchaseProductRepo) Update(p *models.Product) error {
+func (f *fakePurchaseProductRepo) Update(p *models.Product, events ...models.OutboxEvent) error {
 	f.products[p.ID.Hex()] = p
+	f.events = append(f.events, events...)
 	return nil
 }
 
-func (f *fakePurchaseProductRepo) Delete(id string) error {
+func (f *fakePurchaseProductRepo) Delete(id string, version int64, events ...models.OutboxEvent) error {
+	f.events = append(f.events, events...)
 	delete(f.products, id)
 	return nil
 }
 
 func (f *fakePurchaseProductRepo) FindByID(id string) (*models.Product, error) {
+	if f.findErr != nil {
+		return nil, f.findErr
+	}
 	if product, ok := f.products[id]; ok {
 		copy := *product
+		copy.Variantes = append([]models.ProductVariant(nil), product.Variantes...)
 		return &copy, nil
 	}
 	return nil, repositories.ErrNotFound
@@ -124,11 +308,41 @@ func (f *fakePurchaseProductRepo) FindAll(filter repositories.ProductFilter, pag
 	return nil, 0, nil
 }
 
+func (f *fakePurchaseProductRepo) FindAfter(afterID string, limit int) ([]models.Product, error) {
+	return nil, nil
+}
+
+// fakePurchasesRepo stores purchases and applies their stock updates to
+// products all or nothing, checking versions like the Mongo repository.
 type fakePurchasesRepo struct {
-	created *models.Purchase
+	products *fakePurchaseProductRepo
+	created  *models.Purchase
+	// beforeCommit runs before the stock updates are checked, to simulate
+	// concurrent writes.
+	beforeCommit func()
 }
 
-func (f *fakePurchasesRepo) Create(purchase *models.Purchase) error {
+func (f *fakePurchasesRepo) Create(purchase *models.Purchase, updates ...repositories.StockUpdate) error {
+	if f.beforeCommit != nil {
+		f.beforeCommit()
+	}
+	for _, update := range updates {
+		stored, ok := f.products.products[update.Product.ID.Hex()]
+		if !ok {
+			return repositories.ErrNotFound
+		}
+		if stored.Version != update.Product.Version-1 {
+			return repositories.ErrVersionConflict
+		}
+		for sku, limit := range update.MaxReserved {
+			if stored.Reservados[sku] > limit {
+				return repositories.ErrVersionConflict
+			}
+		}
+	}
+	for _, update := range updates {
+		f.products.Update(update.Product, update.Events...)
+	}
 	cpy := *purchase
 	f.created = &cpy
 	return nil
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"products-api/internal/models"
+	"products-api/internal/repositories"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const expiredReservationBatch = 100
+
+// ReservedCheckouter is the subset of PurchaseService used to confirm reservations.
+type ReservedCheckouter interface {
+	CheckoutReserved(userID string, items []CheckoutItemInput, couponCode string) (*models.Purchase, error)
+}
+
+// ReservationService places time-limited holds on stock and turns them into purchases.
+type ReservationService struct {
+	repo        repositories.ReservationRepository
+	productRepo repositories.ProductRepository
+	purchases   ReservedCheckouter
+	ttl         time.Duration
+}
+
+// NewReservationService builds a ReservationService. Holds expire after ttl.
+func NewReservationService(repo repositories.ReservationRepository, productRepo repositories.ProductRepository, purchases ReservedCheckouter, ttl time.Duration) *ReservationService {
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	return &ReservationService{
+		repo:        repo,
+		productRepo: productRepo,
+		purchases:   purchases,
+		ttl:         ttl,
+	}
+}
+
+// Reserve holds the requested quantities for the user. Either every item is
+// held or none is.
+func (s *ReservationService) Reserve(userID string, items []CheckoutItemInput) (*models.Reservation, error) {
+	if strings.TrimSpace(userID) == "" {
+		return nil, ValidationError{Code: "VALIDATION_ERROR", Message: "user id is required"}
+	}
+	aggregated, err := aggregateItems(items)
+	if err != nil {
+		return nil, err
+	}
+
+	held := make([]models.ReservationItem, 0, len(aggregated))
+	rollback := func() { s.releaseItems(held) }
+
+	for _, entry := range aggregated {
+		product, err := s.productRepo.FindByID(entry.productID)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		variant, err := resolveVariant(product, entry.sku)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		if err := s.repo.HoldStock(product.ID, variant.SKU, entry.quantity); err != nil {
+			rollback()
+			if errors.Is(err, repositories.ErrStockUnavailable) {
+				available := product.VariantAvailable(variant.SKU)
+				if fresh, findErr := s.productRepo.FindByID(entry.productID); findErr == nil {
+					fresh.EnsureDefaultVariant()
+					available = fresh.VariantAvailable(variant.SKU)
+				}
+				return nil, InsufficientStockError{ProductID: product.ID.Hex(), SKU: variant.SKU, Requested: entry.quantity, Available: available}
+			}
+			return nil, err
+		}
+		held = append(held, models.ReservationItem{ProductID: product.ID, SKU: variant.SKU, Cantidad: entry.quantity})
+	}
+
+	now := time.Now().UTC()
+	reservation := &models.Reservation{
+		UserID:    userID,
+		Items:     held,
+		Status:    models.ReservationActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+	if err := s.repo.Create(reservation); err != nil {
+		rollback()
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// GetReservation returns a reservation visible to the requester.
+func (s *ReservationService) GetReservation(id, requesterID string, isAdmin bool) (*models.Reservation, error) {
+	reservation, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin && reservation.UserID != requesterID {
+		return nil, ValidationError{Code: "FORBIDDEN", Message: "Admin role or ownership required"}
+	}
+	return reservation, nil
+}
+
+// Confirm converts an active reservation into a purchase.
+func (s *ReservationService) Confirm(id, userID, couponCode string) (*models.Purchase, error) {
+	reservation, err := s.GetReservation(id, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Status != models.ReservationActive {
+		return nil, ValidationError{Code: "RESERVATION_NOT_ACTIVE", Message: "reservation is no longer active"}
+	}
+	if time.Now().UTC().After(reservation.ExpiresAt) {
+		return nil, ValidationError{Code: "RESERVATION_EXPIRED", Message: "reservation has expired"}
+	}
+
+	if err := s.repo.Transition(reservation.ID, models.ReservationActive, models.ReservationConfirmed, primitive.NilObjectID); err != nil {
+		if errors.Is(err, repositories.ErrReservationConflict) {
+			return nil, ValidationError{Code: "RESERVATION_NOT_ACTIVE", Message: "reservation is no longer active"}
+		}
+		return nil, err
+	}
+
+	items := make([]CheckoutItemInput, 0, len(reservation.Items))
+	for _, item := range reservation.Items {
+		items = append(items, CheckoutItemInput{ProductID: item.ProductID.Hex(), SKU: item.SKU, Cantidad: item.Cantidad})
+	}
+
+	purchase, err := s.purchases.CheckoutReserved(userID, items, couponCode)
+	if err != nil {
+		if revertErr := s.repo.Transition(reservation.ID, models.ReservationConfirmed, models.ReservationActive, primitive.NilObjectID); revertErr != nil {
+			log.Printf("reactivate reservation %s failed: %v", reservation.ID.Hex(), revertErr)
+		}
+		return nil, err
+	}
+
+	// Stock was decremented by the purchase, so the hold is no longer needed.
+	s.releaseItems(reservation.Items)
+	if err := s.repo.Transition(reservation.ID, models.ReservationConfirmed, models.ReservationConfirmed, purchase.ID); err != nil {
+		log.Printf("link reservation %s to purchase failed: %v", reservation.ID.Hex(), err)
+	}
+	return purchase, nil
+}
+
+// Release cancels an active reservation and gives the stock back.
+func (s *ReservationService) Release(id, requesterID string, isAdmin bool) error {
+	reservation, err := s.GetReservation(id, requesterID, isAdmin)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Transition(reservation.ID, models.ReservationActive, models.ReservationReleased, primitive.NilObjectID); err != nil {
+		if errors.Is(err, repositories.ErrReservationConflict) {
+			return ValidationError{Code: "RESERVATION_NOT_ACTIVE", Message: "reservation is no longer active"}
+		}
+		return err
+	}
+	s.releaseItems(reservation.Items)
+	return nil
+}
+
+// ReleaseExpired expires every active reservation past its deadline and
+// returns how many were released.
+func (s *ReservationService) ReleaseExpired(now time.Time) (int, error) {
+	released := 0
+	for {
+		expired, err := s.repo.FindExpired(now, expiredReservationBatch)
+		if err != nil {
+			return released, err
+		}
+		for _, reservation := range expired {
+			if err := s.repo.Transition(reservation.ID, models.ReservationActive, models.ReservationExpired, primitive.NilObjectID); err != nil {
+				if errors.Is(err, repositories.ErrReservationConflict) {
+					continue
+				}
+				return released, err
+			}
+			s.releaseItems(reservation.Items)
+			released++
+		}
+		if len(expired) < expiredReservationBatch {
+			return released, nil
+		}
+	}
+}
+
+// StartSweeper releases expired reservations every interval until ctx is canceled.
+func (s *ReservationService) StartSweeper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, err := s.ReleaseExpired(time.Now().UTC())
+			if err != nil {
+				log.Printf("reservation sweeper: %v", err)
+			}
+			if released > 0 {
+				log.Printf("reservation sweeper released %d expired reservations", released)
+			}
+		}
+	}
+}
+
+// StockLevels reports reserved versus available quantities for every
+// variant of the products with active holds.
+func (s *ReservationService) StockLevels() ([]models.StockLevel, error) {
+	products, err := s.repo.FindReservedStock()
+	if err != nil {
+		return nil, err
+	}
+	levels := make([]models.StockLevel, 0, len(products))
+	for i := range products {
+		product := &products[i]
+		for _, variant := range product.Variantes {
+			levels = append(levels, models.StockLevel{
+				ProductID:  product.ID.Hex(),
+				SKU:        variant.SKU,
+				Nombre:     product.Name,
+				Stock:      variant.Stock,
+				Reservado:  product.Reservados[variant.SKU],
+				Disponible: product.VariantAvailable(variant.SKU),
+			})
+		}
+	}
+	return levels, nil
+}
+
+func (s *ReservationService) releaseItems(items []models.ReservationItem) {
+	for _, item := range items {
+		sku := item.SKU
+		if sku == "" {
+			// Holds placed before variants existed were migrated to the default variant.
+			sku = item.ProductID.Hex()
+		}
+		if err := s.repo.ReleaseStock(item.ProductID, sku, item.Cantidad); err != nil {
+			log.Printf("release stock for %s failed: %v", item.ProductID.Hex(), err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"products-api/internal/models"
+	"products-api/internal/repositories"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReserveHoldsStockForOtherBuyers(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 10, Stock: 3},
+		},
+	}
+	reservations := newFakeReservationRepo(productRepo)
+	purchases := NewPurchaseService(productRepo, &fakePurchasesRepo{products: productRepo}, nil)
+	service := NewReservationService(reservations, productRepo, purchases, time.Minute)
+
+	if _, err := service.Reserve("1", []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 2}}); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	_, err := service.Reserve("2", []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 2}})
+	var stockErr InsufficientStockError
+	if !errors.As(err, &stockErr) || stockErr.Available != 1 {
+		t.Fatalf("expected InsufficientStockError with 1 available, got %v", err)
+	}
+
+	_, err = purchases.Checkout("2", []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 2}})
+	if !errors.As(err, &stockErr) {
+		t.Fatalf("expected direct checkout to respect held stock, got %v", err)
+	}
+}
+
+func TestConfirmReservationCreatesPurchaseAndReleasesHold(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 10, Stock: 2},
+		},
+	}
+	reservations := newFakeReservationRepo(productRepo)
+	purchaseRepo := &fakePurchasesRepo{products: productRepo}
+	service := NewReservationService(reservations, productRepo, NewPurchaseService(productRepo, purchaseRepo, nil), time.Minute)
+
+	reservation, err := service.Reserve("1", []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 2}})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	if _, err := service.Confirm(reservation.ID.Hex(), "2", ""); err == nil {
+		t.Fatalf("expected other users to be rejected")
+	}
+
+	purchase, err := service.Confirm(reservation.ID.Hex(), "1", "")
+	if err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if purchase.Total != 20 {
+		t.Fatalf("expected total 20, got %f", purchase.Total)
+	}
+	product := productRepo.products[productID.Hex()]
+	if product.Stock != 0 || product.Reserved() != 0 {
+		t.Fatalf("expected stock 0 and no hold, got stock=%d reservado=%d", product.Stock, product.Reserved())
+	}
+	if reservations.items[reservation.ID].Status != models.ReservationConfirmed {
+		t.Fatalf("expected reservation to be confirmed")
+	}
+
+	if _, err := service.Confirm(reservation.ID.Hex(), "1", ""); err == nil {
+		t.Fatalf("expected a second confirmation to fail")
+	}
+}
+
+func TestReleaseExpiredReservations(t *testing.T) {
+	productID := primitive.NewObjectID()
+	productRepo := &fakePurchaseProductRepo{
+		products: map[string]*models.Product{
+			productID.Hex(): {ID: productID, Precio: 10, Stock: 5},
+		},
+	}
+	reservations := newFakeReservationRepo(productRepo)
+	service := NewReservationService(reservations, productRepo, nil, time.Minute)
+
+	reservation, err := service.Reserve("1", []CheckoutItemInput{{ProductID: productID.Hex(), Cantidad: 4}})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	released, err := service.ReleaseExpired(time.Now().Add(2 * time.Minute))
+	if err != nil {
+		t.Fatalf("release expired: %v", err)
+	}
+	if released != 1 {
+		t.Fatalf("expected 1 released reservation, got %d", released)
+	}
+	if productRepo.products[productID.Hex()].Reserved() != 0 {
+		t.Fatalf("expected hold to be released")
+	}
+	if reservations.items[reservation.ID].Status != models.ReservationExpired {
+		t.Fatalf("expected reservation to be expired")
+	}
+}
+
+// --- fakes ---
+
+type fakeReservationRepo struct {
+	products *fakePurchaseProductRepo
+	items    map[primitive.ObjectID]*models.Reservation
+}
+
+func newFakeReservationRepo(products *fakePurchaseProductRepo) *fakeReservationRepo {
+	return &fakeReservationRepo{products: products, items: map[primitive.ObjectID]*models.Reservation{}}
+}
+
+func (f *fakeReservationRepo) Create(reservation *models.Reservation) error {
+	reservation.ID = primitive.NewObjectID()
+	cpy := *reservation
+	f.items[reservation.ID] = &cpy
+	return nil
+}
+
+func (f *fakeReservationRepo) FindByID(id string) (*models.Reservation, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, repositories.ErrReservationNotFound
+	}
+	reservation, ok := f.items[oid]
+	if !ok {
+		return nil, repositories.ErrReservationNotFound
+	}
+	cpy := *reservation
+	return &cpy, nil
+}
+
+func (f *fakeReservationRepo) FindExpired(now time.Time, limit int64) ([]models.Reservation, error) {
+	var out []models.Reservation
+	for _, reservation := range f.items {
+		if reservation.Status == models.ReservationActive && reservation.ExpiresAt.Before(now) {
+			out = append(out, *reservation)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeReservationRepo) Transition(id primitive.ObjectID, from, to string, purchaseID primitive.ObjectID) error {
+	reservation, ok := f.items[id]
+	if !ok || reservation.Status != from {
+		return repositories.ErrReservationConflict
+	}
+	reservation.Status = to
+	if !purchaseID.IsZero() {
+		reservation.PurchaseID = purchaseID
+	}
+	return nil
+}
+
+func (f *fakeReservationRepo) HoldStock(productID primitive.ObjectID, sku string, quantity int) error {
+	product, ok := f.products.products[productID.Hex()]
+	if !ok {
+		return repositories.ErrStockUnavailable
+	}
+	product.EnsureDefaultVariant()
+	if product.VariantAvailable(sku) < quantity {
+		return repositories.ErrStockUnavailable
+	}
+	if product.Reservados == nil {
+		product.Reservados = map[string]int{}
+	}
+	product.Reservados[sku] += quantity
+	return nil
+}
+
+func (f *fakeReservationRepo) ReleaseStock(productID primitive.ObjectID, sku string, quantity int) error {
+	if product, ok := f.products.products[productID.Hex()]; ok {
+		if product.Reservados != nil {
+			product.Reservados[sku] = max(0, product.Reservados[sku]-quantity)
+		}
+	}
+	return nil
+}
+
+func (f *fakeReservationRepo) FindReservedStock() ([]models.Product, error) {
+	var out []models.Product
+	for _, product := range f.products.products {
+		if product.Reserved() > 0 {
+			out = append(out, *product)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"search-api/internal/config"
+	"search-api/internal/embedded"
+	"search-api/internal/services"
+	"search-api/internal/solr"
+)
+
+// Search backends selectable with SEARCH_BACKEND.
+const (
+	backendSolr     = "solr"
+	backendEmbedded = "embedded"
+)
+
+// embeddedCore names the live embedded index in reindex status and in the
+// files of the cores rebuilt next to it.
+const embeddedCore = "search-index"
+
+// searchBackend is everything search-api needs from an index: searches and
+// writes, cores to rebuild into and a scan for reconciliation.
+type searchBackend interface {
+	services.IndexRepository
+	services.CoreAdmin
+	services.IndexScanner
+}
+
+// openSearchBackend opens the configured index and returns it with the name
+// of its live core.
+func openSearchBackend(cfg *config.Config) (searchBackend, string, error) {
+	switch cfg.SearchBackend {
+	case backendSolr:
+		solrClient := solr.NewClient(cfg.SolrURL, cfg.SolrCore).EnableBatching(solrBatchConfig(cfg))
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := solrClient.EnsureSchema(ctx); err != nil {
+			return nil, "", fmt.Errorf("solr schema: %w", err)
+		}
+		return solrClient, cfg.SolrCore, nil
+	case backendEmbedded:
+		index, err := embedded.Open(cfg.EmbeddedIndexPath)
+		if err != nil {
+			return nil, "", err
+		}
+		return index, embeddedCore, nil
+	default:
+		return nil, "", fmt.Errorf("unknown SEARCH_BACKEND %q: use %s or %s", cfg.SearchBackend, backendSolr, backendEmbedded)
+	}
+}
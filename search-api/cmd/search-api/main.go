@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
@@ -22,50 +23,115 @@ import (
 
 func main() {
 	cfg := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		os.Exit(runReindex(cfg, os.Args[2:]))
+	}
+
 	rabbitHost := cfg.RabbitURL
 	if parsed, err := url.Parse(cfg.RabbitURL); err == nil {
 		rabbitHost = parsed.Host
 	}
-	log.Printf("search-api config: port=%s solr=%s core=%s memcached=%s rabbit_host=%s rabbit_queue=%s cache_ttl=%ds", cfg.ServerPort, cfg.SolrURL, cfg.SolrCore, cfg.MemcachedAddr, rabbitHost, cfg.RabbitQueue, cfg.CacheTTLSeconds)
+	log.Printf("search-api config: port=%s backend=%s solr=%s core=%s memcached=%s rabbit_host=%s rabbit_queue=%s cache_ttl=%ds", cfg.ServerPort, cfg.SearchBackend, cfg.SolrURL, cfg.SolrCore, cfg.MemcachedAddr, rabbitHost, cfg.RabbitQueue, cfg.CacheTTLSeconds)
 
 	cacheTTL := time.Duration(cfg.CacheTTLSeconds) * time.Second
 	memoryCache := cache.NewCCacheLayer(cfg.CacheMaxEntries)
 	distributedCache := cache.NewMemcachedLayer(cfg.MemcachedAddr)
-	layeredCache := cache.NewLayeredCache(memoryCache, distributedCache, cacheTTL)
+	suggestTTL := time.Duration(cfg.SuggestCacheTTLSeconds) * time.Second
+	layeredCache := cache.NewLayeredCache(memoryCache, distributedCache, cacheTTL).
+		WithPrefixTTL(services.SuggestCacheKeyPrefix, suggestTTL).
+		WithSharedPrefix(services.GenerationKeyPrefix).
+		WithSharedPrefix(services.ProductTagsKeyPrefix).
+		WithJitter(float64(cfg.CacheTTLJitterPercent) / 100)
 
-	solrClient := solr.NewClient(cfg.SolrURL, cfg.SolrCore)
-	searchService := services.NewSearchService(solrClient, layeredCache, cacheTTL)
+	index, liveCore, err := openSearchBackend(cfg)
+	if err != nil {
+		log.Fatalf("search backend: %v", err)
+	}
+	if closer, ok := index.(io.Closer); ok {
+		defer closer.Close()
+	}
+	catalog := services.NewProductsAPISource(cfg.ProductsAPIURL)
+	breaker := services.NewCircuitBreaker(cfg.SearchBreakerFailures, time.Duration(cfg.SearchBreakerOpenSeconds)*time.Second)
+	searchService := services.NewSearchService(services.WithCircuitBreaker(index, breaker), layeredCache, cacheTTL).
+		WithSuggestCacheTTL(suggestTTL).
+		WithStaleCache(time.Duration(cfg.CacheStaleTTLSeconds) * time.Second).
+		WithStaleWhileRevalidate(time.Duration(cfg.CacheRevalidateSeconds) * time.Second).
+		WithFallback(catalog)
 	eventProcessor := services.NewEventProcessor(searchService, cfg.ProductsAPIURL)
+	reindexer := services.NewReindexer(searchService, catalog, index, liveCore)
+	reconciler := services.NewReconciler(searchService, catalog, index, cfg.ReconcilePageSize)
 
 	consumer, err := rabbitmq.NewConsumer(rabbitmq.ConsumerConfig{
-		URL:      cfg.RabbitURL,
-		Exchange: cfg.RabbitExchange,
-		Queue:    cfg.RabbitQueue,
+		URL:            cfg.RabbitURL,
+		Exchange:       cfg.RabbitExchange,
+		Queue:          cfg.RabbitQueue,
+		MaxAttempts:    cfg.RabbitMaxAttempts,
+		RetryBaseDelay: time.Duration(cfg.RabbitRetryBaseMS) * time.Millisecond,
+		Workers:        cfg.RabbitWorkers,
+		Prefetch:       cfg.RabbitPrefetch,
 	}, eventProcessor)
 	if err != nil {
 		log.Fatalf("rabbitmq init: %v", err)
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	consumerDone := make(chan struct{})
 	go func() {
+		defer close(consumerDone)
 		if err := consumer.Start(ctx); err != nil && err != context.Canceled {
 			log.Printf("rabbit consumer stopped: %v", err)
 		}
 	}()
 	defer consumer.Close()
+	go reconciler.Start(ctx, time.Duration(cfg.ReconcileIntervalSeconds)*time.Second)
 
 	searchHandler := handlers.NewSearchHandler(searchService)
+	eventsHandler := handlers.NewEventsHandler(consumer)
+	reindexHandler := handlers.NewReindexHandler(ctx, reindexer)
+	reconcileHandler := handlers.NewReconcileHandler(reconciler)
+	cacheHandler := handlers.NewCacheHandler(searchService)
 	authMiddleware := middleware.AuthMiddleware(cfg.JWTSecret)
 
 	mux := http.NewServeMux()
 	mux.Handle("/search/products", handlers.MethodHandler{Get: http.HandlerFunc(searchHandler.SearchProducts)})
+	mux.Handle("/search/products/", handlers.MethodHandler{Get: http.HandlerFunc(searchHandler.SimilarProducts)})
+	mux.Handle("/search/suggest", handlers.MethodHandler{Get: http.HandlerFunc(searchHandler.SuggestProducts)})
 	mux.Handle("/search/cache/flush", authMiddleware(middleware.RequireAdmin(http.HandlerFunc(searchHandler.FlushCache))))
+	mux.Handle("/search/events/dead-letters", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Get:    http.HandlerFunc(eventsHandler.ListDeadLetters),
+		Delete: http.HandlerFunc(eventsHandler.PurgeDeadLetters),
+	})))
+	mux.Handle("/search/events/dead-letters/replay", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Post: http.HandlerFunc(eventsHandler.ReplayDeadLetters),
+	})))
+	mux.Handle("/search/admin/reindex", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Get:  http.HandlerFunc(reindexHandler.ReindexStatus),
+		Post: http.HandlerFunc(reindexHandler.StartReindex),
+	})))
+	mux.Handle("/search/admin/reconcile", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Get:  http.HandlerFunc(reconcileHandler.DriftReport),
+		Post: http.HandlerFunc(reconcileHandler.Reconcile),
+	})))
+	mux.Handle("/search/admin/cache/stats", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Get: http.HandlerFunc(cacheHandler.Stats),
+	})))
+	mux.Handle("/search/admin/cache/entry", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Get:    http.HandlerFunc(cacheHandler.Entry),
+		Delete: http.HandlerFunc(cacheHandler.EvictEntry),
+	})))
+	mux.Handle("/search/admin/cache/warm", authMiddleware(middleware.RequireAdmin(handlers.MethodHandler{
+		Post: http.HandlerFunc(cacheHandler.Warm),
+	})))
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			responses.WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 			return
 		}
-		responses.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		status := "ok"
+		if breaker.State() != services.CircuitClosed {
+			status = "degraded"
+		}
+		responses.WriteJSON(w, http.StatusOK, map[string]string{"status": status, "search_backend": breaker.State()})
 	})
 
 	server := &http.Server{
@@ -89,4 +155,14 @@ func main() {
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
+	// Let the consumer finish the events already handed to its workers.
+	<-consumerDone
+}
+
+func solrBatchConfig(cfg *config.Config) solr.BatchConfig {
+	return solr.BatchConfig{
+		MaxDocs:     cfg.SolrBatchSize,
+		Interval:    time.Duration(cfg.SolrBatchIntervalMS) * time.Millisecond,
+		MaxAttempts: cfg.SolrBatchAttempts,
+	}
 }
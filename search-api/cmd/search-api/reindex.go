@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"search-api/internal/cache"
+	"search-api/internal/config"
+	"search-api/internal/services"
+	"search-api/internal/solr"
+)
+
+// runReindex implements `search-api reindex [-new-core] [-batch-size N]`. It
+// rebuilds the index once and exits with a non-zero status on failure.
+//
+// Events are not mirrored into the new core by this process, so while the
+// service is consuming events prefer POST /search/admin/reindex for -new-core.
+func runReindex(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	newCore := fs.Bool("new-core", false, "build into a new core and swap it with the live one when finished")
+	batchSize := fs.Int("batch-size", 200, "products fetched and indexed per batch")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if cfg.SearchBackend == backendEmbedded {
+		// The running service owns the embedded index file and would
+		// overwrite whatever this process wrote.
+		log.Printf("reindex: not supported with SEARCH_BACKEND=%s, use POST /search/admin/reindex", backendEmbedded)
+		return 2
+	}
+
+	cacheTTL := time.Duration(cfg.CacheTTLSeconds) * time.Second
+	// Only the shared layer matters here: the flush at the end must reach
+	// the running instances.
+	distributedCache := cache.NewMemcachedLayer(cfg.MemcachedAddr)
+	solrClient := solr.NewClient(cfg.SolrURL, cfg.SolrCore).EnableBatching(solrBatchConfig(cfg))
+	searchService := services.NewSearchService(solrClient, distributedCache, cacheTTL)
+	reindexer := services.NewReindexer(searchService, services.NewProductsAPISource(cfg.ProductsAPIURL), solrClient, cfg.SolrCore)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := solrClient.EnsureSchema(ctx); err != nil {
+		log.Printf("solr schema: %v", err)
+		return 1
+	}
+
+	log.Printf("reindexing %s from %s (new core: %t, batch size: %d)", cfg.SolrCore, cfg.ProductsAPIURL, *newCore, *batchSize)
+	if _, err := reindexer.Run(ctx, services.ReindexOptions{BatchSize: *batchSize, NewCore: *newCore}); err != nil {
+		log.Printf("reindex: %v", err)
+		return 1
+	}
+	return 0
+}
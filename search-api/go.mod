@@ -8,4 +8,9 @@ require (
 	github.com/rabbitmq/amqp091-go v1.10.0
 )
 
-require github.com/bradfitz/gomemcache v0.0.0-20250403215159-8d39553ac7cf
+require (
+	events v0.0.0
+	github.com/bradfitz/gomemcache v0.0.0-20250403215159-8d39553ac7cf
+)
+
+replace events => ../events
@@ -2,6 +2,9 @@ package cache
 
 import (
 	"log"
+	"math/rand"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
@@ -19,6 +22,9 @@ type Cache interface {
 // CCacheLayer implements Cache backed by an in-memory CCache instance.
 type CCacheLayer struct {
 	cache *ccache.Cache[[]byte]
+	stats keyedCounters
+	// evictions accumulates the drops CCache reports since the last read.
+	evictions atomic.Int64
 }
 
 // NewCCacheLayer builds a CCache layer with a maximum number of entries.
@@ -35,8 +41,11 @@ func (c *CCacheLayer) Get(key string) ([]byte, bool) {
 	if c == nil || c.cache == nil {
 		return nil, false
 	}
+	started := time.Now()
 	item := c.cache.Get(key)
-	if item == nil || item.Expired() {
+	hit := item != nil && !item.Expired()
+	c.stats.forKey(key).lookup(hit, started)
+	if !hit {
 		return nil, false
 	}
 	return item.Value(), true
@@ -46,13 +55,16 @@ func (c *CCacheLayer) Set(key string, value []byte, ttl time.Duration) {
 	if c == nil || c.cache == nil {
 		return
 	}
+	started := time.Now()
 	c.cache.Set(key, value, ttl)
+	c.stats.forKey(key).set(started)
 }
 
 func (c *CCacheLayer) Delete(key string) {
 	if c == nil || c.cache == nil {
 		return
 	}
+	c.stats.forKey(key).deletes.Add(1)
 	c.cache.Delete(key)
 }
 
@@ -64,9 +76,29 @@ func (c *CCacheLayer) Flush() error {
 	return nil
 }
 
+func (c *CCacheLayer) countApart(prefix string) {
+	if c != nil {
+		c.stats.prefixes = append(c.stats.prefixes, prefix)
+	}
+}
+
+// Stats returns the counters of the layer. Evictions are the entries CCache
+// dropped when it was full.
+func (c *CCacheLayer) Stats() Stats {
+	if c == nil || c.cache == nil {
+		return Stats{}
+	}
+	stats := c.stats.snapshot()
+	stats.Evictions = c.evictions.Add(int64(c.cache.GetDropped()))
+	stats.Entries = int64(c.cache.ItemCount())
+	return stats
+}
+
 // MemcachedLayer implements Cache using a Memcached backend.
 type MemcachedLayer struct {
+	addr   string
 	client *memcache.Client
+	stats  keyedCounters
 }
 
 // NewMemcachedLayer builds a Memcached cache pointing at the given address.
@@ -74,16 +106,20 @@ func NewMemcachedLayer(addr string) *MemcachedLayer {
 	if addr == "" {
 		return nil
 	}
-	return &MemcachedLayer{client: memcache.New(addr)}
+	return &MemcachedLayer{addr: addr, client: memcache.New(addr)}
 }
 
 func (m *MemcachedLayer) Get(key string) ([]byte, bool) {
 	if m == nil || m.client == nil {
 		return nil, false
 	}
+	started := time.Now()
 	item, err := m.client.Get(key)
+	counters := m.stats.forKey(key)
+	counters.lookup(err == nil, started)
 	if err != nil {
 		if err != memcache.ErrCacheMiss {
+			counters.errors.Add(1)
 			log.Printf("memcached get %s: %v", key, err)
 		}
 		return nil, false
@@ -98,8 +134,16 @@ func (m *MemcachedLayer) Set(key string, value []byte, ttl time.Duration) {
 	expiration := int32(ttl.Seconds())
 	if ttl <= 0 {
 		expiration = 0
+	} else if expiration == 0 {
+		// Memcached counts whole seconds and reads 0 as never expiring.
+		expiration = 1
 	}
-	if err := m.client.Set(&memcache.Item{Key: key, Value: value, Expiration: expiration}); err != nil {
+	started := time.Now()
+	err := m.client.Set(&memcache.Item{Key: key, Value: value, Expiration: expiration})
+	counters := m.stats.forKey(key)
+	counters.set(started)
+	if err != nil {
+		counters.errors.Add(1)
 		log.Printf("memcached set %s: %v", key, err)
 	}
 }
@@ -108,7 +152,10 @@ func (m *MemcachedLayer) Delete(key string) {
 	if m == nil || m.client == nil {
 		return
 	}
+	counters := m.stats.forKey(key)
+	counters.deletes.Add(1)
 	if err := m.client.Delete(key); err != nil && err != memcache.ErrCacheMiss {
+		counters.errors.Add(1)
 		log.Printf("memcached delete %s: %v", key, err)
 	}
 }
@@ -124,11 +171,44 @@ func (m *MemcachedLayer) Flush() error {
 	return nil
 }
 
+func (m *MemcachedLayer) countApart(prefix string) {
+	if m != nil {
+		m.stats.prefixes = append(m.stats.prefixes, prefix)
+	}
+}
+
+// Stats returns the counters of the layer. Evictions and entries come from
+// the server and are left at 0 when it cannot be reached.
+func (m *MemcachedLayer) Stats() Stats {
+	if m == nil || m.client == nil {
+		return Stats{}
+	}
+	stats := m.stats.snapshot()
+	server, err := memcachedServerStats(m.addr)
+	if err != nil {
+		log.Printf("memcached stats: %v", err)
+		return stats
+	}
+	stats.Evictions = server["evictions"]
+	stats.Entries = server["curr_items"]
+	return stats
+}
+
 // LayeredCache combines a fast in-memory cache with an optional distributed cache.
 type LayeredCache struct {
 	memory      Cache
 	distributed Cache
 	warmTTL     time.Duration
+	// prefixTTLs overrides warmTTL for keys with a given prefix, so
+	// short-lived entries stay short-lived when copied into memory.
+	prefixTTLs map[string]time.Duration
+	// sharedPrefixes are kept out of the memory layer, see WithSharedPrefix.
+	sharedPrefixes []string
+	// jitter shortens each expiration by a random fraction up to jitter,
+	// so entries written together do not all expire together.
+	jitter float64
+	random func() float64
+	stats  keyedCounters
 }
 
 // NewLayeredCache wires the cache layers together.
@@ -140,20 +220,95 @@ func NewLayeredCache(memory Cache, distributed Cache, warmTTL time.Duration) *La
 	}
 }
 
+// WithPrefixTTL makes entries whose key starts with prefix live at most ttl
+// in the memory layer when they are warmed from the distributed one.
+func (c *LayeredCache) WithPrefixTTL(prefix string, ttl time.Duration) *LayeredCache {
+	if c.prefixTTLs == nil {
+		c.prefixTTLs = map[string]time.Duration{}
+	}
+	c.prefixTTLs[prefix] = ttl
+	return c
+}
+
+// WithSharedPrefix keeps entries whose key starts with prefix out of the
+// memory layer, so every read sees the latest value written by any
+// instance. It suits small bookkeeping entries that other entries depend
+// on; without a distributed layer they stay in memory. The cache and its
+// layers count the operations on these entries under Stats.Bookkeeping.
+func (c *LayeredCache) WithSharedPrefix(prefix string) *LayeredCache {
+	c.sharedPrefixes = append(c.sharedPrefixes, prefix)
+	c.stats.prefixes = append(c.stats.prefixes, prefix)
+	for _, layer := range []Cache{c.memory, c.distributed} {
+		if counter, ok := layer.(bookkeepingCounter); ok {
+			counter.countApart(prefix)
+		}
+	}
+	return c
+}
+
+// memoryFor returns the memory layer to use for key, nil when there is none
+// or key is shared.
+func (c *LayeredCache) memoryFor(key string) Cache {
+	if c.memory == nil || layerDisabled(c.distributed) {
+		return c.memory
+	}
+	for _, prefix := range c.sharedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return nil
+		}
+	}
+	return c.memory
+}
+
+// WithJitter shortens the TTL of every entry set by a random fraction of up
+// to jitter (0.1 for 10%). Entries without expiration are left alone.
+func (c *LayeredCache) WithJitter(jitter float64) *LayeredCache {
+	c.jitter = min(max(jitter, 0), 1)
+	return c
+}
+
+func (c *LayeredCache) jittered(ttl time.Duration) time.Duration {
+	if c.jitter == 0 || ttl <= 0 {
+		return ttl
+	}
+	random := rand.Float64
+	if c.random != nil {
+		random = c.random
+	}
+	return ttl - time.Duration(float64(ttl)*c.jitter*random())
+}
+
+func (c *LayeredCache) warmTTLFor(key string) time.Duration {
+	for prefix, ttl := range c.prefixTTLs {
+		if strings.HasPrefix(key, prefix) {
+			return ttl
+		}
+	}
+	return c.warmTTL
+}
+
 func (c *LayeredCache) Get(key string) ([]byte, bool) {
 	if c == nil {
 		return nil, false
 	}
-	if c.memory != nil {
-		if val, ok := c.memory.Get(key); ok {
+	started := time.Now()
+	val, ok := c.get(key)
+	c.stats.forKey(key).lookup(ok, started)
+	return val, ok
+}
+
+func (c *LayeredCache) get(key string) ([]byte, bool) {
+	memory := c.memoryFor(key)
+	if memory != nil {
+		if val, ok := memory.Get(key); ok {
 			return val, true
 		}
 	}
 
 	if c.distributed != nil {
 		if val, ok := c.distributed.Get(key); ok {
-			if c.memory != nil && c.warmTTL > 0 {
-				c.memory.Set(key, val, c.warmTTL)
+			if ttl := c.warmTTLFor(key); memory != nil && ttl > 0 {
+				memory.Set(key, val, c.jittered(ttl))
 			}
 			return val, true
 		}
@@ -165,15 +320,17 @@ func (c *LayeredCache) Set(key string, value []byte, ttl time.Duration) {
 	if c == nil {
 		return
 	}
+	defer c.stats.forKey(key).set(time.Now())
+	ttl = c.jittered(ttl)
 	if c.distributed != nil {
 		c.distributed.Set(key, value, ttl)
 	}
-	if c.memory != nil {
+	if memory := c.memoryFor(key); memory != nil {
 		effectiveTTL := ttl
 		if effectiveTTL <= 0 {
-			effectiveTTL = c.warmTTL
+			effectiveTTL = c.warmTTLFor(key)
 		}
-		c.memory.Set(key, value, effectiveTTL)
+		memory.Set(key, value, effectiveTTL)
 	}
 }
 
@@ -181,8 +338,9 @@ func (c *LayeredCache) Delete(key string) {
 	if c == nil {
 		return
 	}
-	if c.memory != nil {
-		c.memory.Delete(key)
+	c.stats.forKey(key).deletes.Add(1)
+	if memory := c.memoryFor(key); memory != nil {
+		memory.Delete(key)
 	}
 	if c.distributed != nil {
 		c.distributed.Delete(key)
@@ -201,3 +359,29 @@ func (c *LayeredCache) Flush() error {
 	}
 	return nil
 }
+
+// Stats returns the counters of the cache as a whole: a hit is a hit in any
+// layer and latencies include warming the memory layer. Evictions and
+// entries are reported by the layers.
+func (c *LayeredCache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	return c.stats.snapshot()
+}
+
+// LayerStats returns the Stats of the cache as a whole under "layered" and
+// those of each enabled layer that keeps them under "memory" and
+// "distributed".
+func (c *LayeredCache) LayerStats() map[string]Stats {
+	if c == nil {
+		return nil
+	}
+	stats := map[string]Stats{"layered": c.Stats()}
+	for name, layer := range map[string]Cache{"memory": c.memory, "distributed": c.distributed} {
+		if reporter, ok := layer.(StatsReporter); ok && !layerDisabled(layer) {
+			stats[name] = reporter.Stats()
+		}
+	}
+	return stats
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// ttlLayer records the TTL of the last entry set.
+type ttlLayer struct {
+	lastTTL time.Duration
+}
+
+func (l *ttlLayer) Get(key string) ([]byte, bool) { return nil, false }
+
+func (l *ttlLayer) Set(key string, value []byte, ttl time.Duration) { l.lastTTL = ttl }
+
+func (l *ttlLayer) Delete(key string) {}
+
+func (l *ttlLayer) Flush() error { return nil }
+
+func TestLayeredCacheJittersExpirations(t *testing.T) {
+	memory, distributed := &ttlLayer{}, &ttlLayer{}
+	layered := NewLayeredCache(memory, distributed, time.Minute).WithJitter(0.1)
+	layered.random = func() float64 { return 0.5 }
+
+	layered.Set("search:a", []byte("x"), 100*time.Second)
+	if distributed.lastTTL != 95*time.Second || memory.lastTTL != 95*time.Second {
+		t.Fatalf("expected a 5%% shorter TTL in both layers, got %s and %s", distributed.lastTTL, memory.lastTTL)
+	}
+
+	layered.Set("gen:all", []byte("x"), 0)
+	if distributed.lastTTL != 0 {
+		t.Fatalf("expected entries without expiration to keep none, got %s", distributed.lastTTL)
+	}
+}
+
+func TestLayeredCacheCountsOperationsPerLayer(t *testing.T) {
+	memory := NewCCacheLayer(10)
+	var distributed *MemcachedLayer
+	layered := NewLayeredCache(memory, distributed, time.Minute)
+
+	layered.Get("search:a")
+	layered.Set("search:a", []byte("x"), time.Minute)
+	layered.Get("search:a")
+	layered.Delete("search:a")
+
+	stats := layered.LayerStats()
+	if _, ok := stats["distributed"]; ok {
+		t.Fatalf("expected no stats for a layer without address")
+	}
+	for _, name := range []string{"layered", "memory"} {
+		s := stats[name]
+		if s.Hits != 1 || s.Misses != 1 || s.Sets != 1 || s.Deletes != 1 || s.HitRatio != 0.5 {
+			t.Fatalf("unexpected %s stats: %+v", name, s)
+		}
+		if s.GetLatency.Count != 2 || s.SetLatency.Count != 1 {
+			t.Fatalf("expected the %s latencies to be recorded, got %+v", name, s)
+		}
+	}
+}
+
+func TestCCacheLayerCountsEvictions(t *testing.T) {
+	memory := NewCCacheLayer(5)
+	for i := 0; i < 50; i++ {
+		memory.Set(fmt.Sprintf("search:%d", i), []byte("x"), time.Minute)
+	}
+	memory.cache.SyncUpdates()
+	if stats := memory.Stats(); stats.Evictions == 0 || stats.Entries > 5 {
+		t.Fatalf("expected entries beyond the maximum to be evicted, got %+v", stats)
+	}
+}
+
+func TestMemcachedServerStatsReadsTheStatsCommand(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		if line != "stats\r\n" {
+			fmt.Fprint(conn, "ERROR\r\n")
+			return
+		}
+		fmt.Fprint(conn, "STAT pid 1\r\nSTAT version 1.6.21\r\nSTAT curr_items 42\r\nSTAT evictions 7\r\nEND\r\n")
+	}()
+
+	stats, err := memcachedServerStats(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats["curr_items"] != 42 || stats["evictions"] != 7 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+// mapLayer is a Cache over a map, ignoring TTLs.
+type mapLayer map[string][]byte
+
+func (l mapLayer) Get(key string) ([]byte, bool) {
+	value, ok := l[key]
+	return value, ok
+}
+
+func (l mapLayer) Set(key string, value []byte, ttl time.Duration) { l[key] = value }
+
+func (l mapLayer) Delete(key string) { delete(l, key) }
+
+func (l mapLayer) Flush() error { return nil }
+
+func TestSharedPrefixesAreReadFromTheDistributedLayer(t *testing.T) {
+	memory, distributed := mapLayer{}, mapLayer{}
+	layered := NewLayeredCache(memory, distributed, time.Minute).WithSharedPrefix("gen:")
+
+	layered.Set("gen:all", []byte("1"), 0)
+	layered.Set("search:a", []byte("x"), time.Minute)
+	if _, ok := memory["gen:all"]; ok {
+		t.Fatalf("expected the shared entry to stay out of memory")
+	}
+	// Another instance bumps the generation.
+	distributed["gen:all"] = []byte("2")
+	if value, _ := layered.Get("gen:all"); string(value) != "2" {
+		t.Fatalf("expected the latest shared value, got %q", value)
+	}
+	if _, ok := memory["gen:all"]; ok || memory["search:a"] == nil {
+		t.Fatalf("expected only the other entries to be warmed into memory")
+	}
+
+	alone := mapLayer{}
+	var missing *MemcachedLayer
+	NewLayeredCache(alone, missing, time.Minute).WithSharedPrefix("gen:").Set("gen:all", []byte("1"), 0)
+	if _, ok := alone["gen:all"]; !ok {
+		t.Fatalf("expected shared entries to be kept in memory without a distributed layer")
+	}
+}
+
+func TestBookkeepingEntriesAreCountedApart(t *testing.T) {
+	memory := NewCCacheLayer(10)
+	var distributed *MemcachedLayer
+	layered := NewLayeredCache(memory, distributed, time.Minute).WithSharedPrefix("gen:")
+
+	layered.Get("gen:all")
+	layered.Set("gen:all", []byte("1"), 0)
+	layered.Get("gen:all")
+	layered.Get("search:a")
+	layered.Set("search:a", []byte("x"), time.Minute)
+	layered.Get("search:a")
+	layered.Get("search:a")
+
+	stats := layered.LayerStats()
+	for _, name := range []string{"layered", "memory"} {
+		s := stats[name]
+		if s.Hits != 2 || s.Misses != 1 || s.Sets != 1 || s.GetLatency.Count != 3 {
+			t.Fatalf("expected only the response lookups in %s, got %+v", name, s)
+		}
+		if s.Bookkeeping == nil || s.Bookkeeping.Hits != 1 || s.Bookkeeping.Misses != 1 || s.Bookkeeping.Sets != 1 {
+			t.Fatalf("expected the bookkeeping lookups apart in %s, got %+v", name, s.Bookkeeping)
+		}
+	}
+
+	if stats := NewLayeredCache(NewCCacheLayer(10), distributed, time.Minute).Stats(); stats.Bookkeeping != nil {
+		t.Fatalf("expected no bookkeeping stats without shared prefixes")
+	}
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the counters of a cache since it was created.
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// HitRatio is Hits over the lookups, 0 before any.
+	HitRatio float64 `json:"hit_ratio"`
+	Sets     int64   `json:"sets"`
+	Deletes  int64   `json:"deletes"`
+	// Evictions counts entries dropped to make room for others. Memcached
+	// reports it for the whole server, which other services may share.
+	Evictions int64 `json:"evictions"`
+	// Entries is the number of entries held, server-wide for Memcached.
+	Entries int64 `json:"entries"`
+	// Errors counts operations that failed rather than missed.
+	Errors     int64   `json:"errors"`
+	GetLatency Latency `json:"get_latency"`
+	SetLatency Latency `json:"set_latency"`
+	// Bookkeeping counts the operations on bookkeeping entries (see
+	// LayeredCache.WithSharedPrefix) apart from the counters above, so
+	// their small, frequent reads do not skew those of cached responses.
+	Bookkeeping *Stats `json:"bookkeeping,omitempty"`
+}
+
+// Latency summarizes the duration of one kind of operation.
+type Latency struct {
+	Count int64   `json:"count"`
+	AvgMS float64 `json:"avg_ms"`
+	MaxMS float64 `json:"max_ms"`
+}
+
+// StatsReporter is implemented by caches that keep Stats.
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// counters records the operations of a cache; it is safe for concurrent use.
+type counters struct {
+	hits, misses, sets, deletes, errors atomic.Int64
+	getLatency, setLatency              latencyRecorder
+}
+
+// keyedCounters records the operations on bookkeeping entries, those whose
+// key starts with one of prefixes, apart from the others.
+type keyedCounters struct {
+	counters
+	bookkeeping counters
+	prefixes    []string
+}
+
+// forKey returns the counters for operations on key.
+func (c *keyedCounters) forKey(key string) *counters {
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return &c.bookkeeping
+		}
+	}
+	return &c.counters
+}
+
+func (c *keyedCounters) snapshot() Stats {
+	stats := c.counters.snapshot()
+	if len(c.prefixes) > 0 {
+		bookkeeping := c.bookkeeping.snapshot()
+		stats.Bookkeeping = &bookkeeping
+	}
+	return stats
+}
+
+// bookkeepingCounter is implemented by the layers that can count the
+// operations on bookkeeping entries apart.
+type bookkeepingCounter interface {
+	countApart(prefix string)
+}
+
+func (c *counters) lookup(hit bool, started time.Time) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	c.getLatency.record(time.Since(started))
+}
+
+func (c *counters) set(started time.Time) {
+	c.sets.Add(1)
+	c.setLatency.record(time.Since(started))
+}
+
+func (c *counters) snapshot() Stats {
+	stats := Stats{
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Sets:       c.sets.Load(),
+		Deletes:    c.deletes.Load(),
+		Errors:     c.errors.Load(),
+		GetLatency: c.getLatency.snapshot(),
+		SetLatency: c.setLatency.snapshot(),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+type latencyRecorder struct {
+	count, total, max atomic.Int64
+}
+
+func (l *latencyRecorder) record(d time.Duration) {
+	l.count.Add(1)
+	l.total.Add(int64(d))
+	for {
+		current := l.max.Load()
+		if int64(d) <= current || l.max.CompareAndSwap(current, int64(d)) {
+			return
+		}
+	}
+}
+
+func (l *latencyRecorder) snapshot() Latency {
+	latency := Latency{Count: l.count.Load(), MaxMS: milliseconds(l.max.Load())}
+	if latency.Count > 0 {
+		latency.AvgMS = milliseconds(l.total.Load() / latency.Count)
+	}
+	return latency
+}
+
+func milliseconds(nanos int64) float64 {
+	return float64(nanos) / float64(time.Millisecond)
+}
+
+// layerDisabled tells whether layer is missing, including a nil pointer
+// such as the MemcachedLayer built without an address.
+func layerDisabled(layer Cache) bool {
+	if layer == nil {
+		return true
+	}
+	v := reflect.ValueOf(layer)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// memcachedServerStats reads the counters of the Memcached server at addr
+// with the text protocol stats command, which the client does not expose.
+func memcachedServerStats(addr string) (map[string]int64, error) {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(time.Second)); err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprint(conn, "stats\r\n"); err != nil {
+		return nil, err
+	}
+
+	stats := map[string]int64{}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "END" {
+			return stats, nil
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			return nil, fmt.Errorf("unexpected stats line %q", line)
+		}
+		if value, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			stats[fields[1]] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("stats response ended without END")
+}
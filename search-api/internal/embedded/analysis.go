@@ -0,0 +1,124 @@
+package embedded
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The analysis mirrors the Solr field types closely enough for the same
+// queries to match: text fields are tokenized, lowercased, stripped of
+// Spanish stop words, lightly stemmed and folded (text_es); prefixes and
+// spellcheck work on whole lowercased words.
+
+// words splits text into lowercased words of letters and digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// analyze returns the text_es terms of text.
+func analyze(text string) []string {
+	var terms []string
+	for _, word := range words(text) {
+		if _, stop := stopWords[word]; stop {
+			continue
+		}
+		terms = append(terms, fold(stem(word)))
+	}
+	return terms
+}
+
+// prefixTerms returns the folded words of text, as the edge n-gram fields
+// index them.
+func prefixTerms(text string) []string {
+	list := words(text)
+	for i, word := range list {
+		list[i] = fold(word)
+	}
+	return list
+}
+
+// stem removes plural and gender endings, like Solr's light Spanish stemmer:
+// "flores" and "flor", "vainillas" and "vainilla" share a stem.
+func stem(word string) string {
+	runes := []rune(word)
+	switch n := len(runes); {
+	case n >= 6 && runes[n-2] == 'e' && runes[n-1] == 's':
+		runes = runes[:n-2]
+	case n >= 5 && runes[n-1] == 's':
+		runes = runes[:n-1]
+	}
+	if n := len(runes); n >= 5 && strings.ContainsRune("aeoáéó", runes[n-1]) {
+		runes = runes[:n-1]
+	}
+	return string(runes)
+}
+
+// fold strips accents, one rune per rune.
+func fold(text string) string {
+	return strings.Map(func(r rune) rune {
+		if folded, ok := accentFolds[r]; ok {
+			return folded
+		}
+		return r
+	}, text)
+}
+
+var accentFolds = map[rune]rune{
+	'á': 'a', 'à': 'a', 'â': 'a', 'ä': 'a', 'ã': 'a',
+	'é': 'e', 'è': 'e', 'ê': 'e', 'ë': 'e',
+	'í': 'i', 'ì': 'i', 'î': 'i', 'ï': 'i',
+	'ó': 'o', 'ò': 'o', 'ô': 'o', 'ö': 'o', 'õ': 'o',
+	'ú': 'u', 'ù': 'u', 'û': 'u', 'ü': 'u',
+	'ñ': 'n', 'ç': 'c',
+}
+
+// stopWords are the most frequent Spanish words, dropped from text terms.
+var stopWords = map[string]struct{}{
+	"a": {}, "al": {}, "con": {}, "de": {}, "del": {}, "e": {}, "el": {}, "en": {},
+	"es": {}, "la": {}, "las": {}, "lo": {}, "los": {}, "o": {}, "para": {}, "por": {},
+	"que": {}, "se": {}, "sin": {}, "su": {}, "sus": {}, "u": {}, "un": {}, "una": {},
+	"y": {},
+}
+
+// containsSequence tells whether seq appears in terms as consecutive terms.
+func containsSequence(terms, seq []string) bool {
+	if len(seq) == 0 {
+		return false
+	}
+	for i := 0; i+len(seq) <= len(terms); i++ {
+		match := true
+		for j := range seq {
+			if terms[i+j] != seq[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
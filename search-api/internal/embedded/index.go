@@ -0,0 +1,334 @@
+// Package embedded implements the search index in-process, for deployments
+// without Solr. Documents are kept in memory and persisted to a JSON
+// snapshot plus a log of the writes since, see journal.go; queries scan
+// them with the same analysis, filters, scoring rules and facets as the
+// Solr client.
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"search-api/internal/models"
+	"search-api/internal/services"
+)
+
+// document is one indexed product or tombstone.
+type document struct {
+	Product   models.ProductDocument `json:"product"`
+	Tombstone bool                   `json:"tombstone,omitempty"`
+	Revision  int64                  `json:"revision"`
+
+	terms fields
+}
+
+// fields holds the analyzed terms of a document, rebuilt when it is loaded.
+type fields struct {
+	name, marca, notas, descripcion []string
+	// prefixes are the folded words of name, marca and notas.
+	namePrefix, marcaPrefix, notasPrefix []string
+}
+
+func analyzeDocument(doc *document) {
+	p := doc.Product
+	doc.terms = fields{
+		name:        analyze(p.Name),
+		marca:       analyze(p.Marca),
+		notas:       analyze(strings.Join(p.Notas, " ")),
+		descripcion: analyze(p.Descripcion),
+		namePrefix:  prefixTerms(p.Name),
+		marcaPrefix: prefixTerms(p.Marca),
+		notasPrefix: prefixTerms(strings.Join(p.Notas, " ")),
+	}
+}
+
+// snapshot is the on-disk format of an Index.
+type snapshot struct {
+	Revision  int64       `json:"revision"`
+	Documents []*document `json:"documents"`
+}
+
+// Index is an embedded services.IndexRepository. It also implements
+// services.IndexScanner for reconciliation and services.CoreAdmin, keeping
+// staging cores next to its snapshot file.
+type Index struct {
+	path string
+	// log is the open write log, nil for an index kept in memory only;
+	// logSize is its length and logged the records it holds.
+	log     *os.File
+	logSize int64
+	logged  int
+
+	// revisions numbers the writes; staging cores share it with the live
+	// index so revisions stay unique across a swap.
+	revisions *atomic.Int64
+
+	mu    sync.RWMutex
+	docs  map[string]*document
+	cores map[string]*Index
+}
+
+// Open loads the index persisted at path and the writes logged since, or
+// starts an empty one if nothing was persisted yet. An empty path keeps the
+// index in memory only. Close releases the log.
+func Open(path string) (*Index, error) {
+	idx := &Index{path: path, revisions: new(atomic.Int64), docs: map[string]*document{}, cores: map[string]*Index{}}
+	if path == "" {
+		return idx, nil
+	}
+	var snap snapshot
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("read embedded index: %w", err)
+	default:
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("decode embedded index %s: %w", path, err)
+		}
+	}
+	idx.revisions.Store(snap.Revision)
+	for _, doc := range snap.Documents {
+		analyzeDocument(doc)
+		idx.docs[doc.Product.ID] = doc
+	}
+	if err := idx.openLog(snap.Revision); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Close closes the write logs of the index and its staging cores.
+func (idx *Index) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, core := range idx.cores {
+		core.mu.Lock()
+		core.closeLog()
+		core.mu.Unlock()
+	}
+	return idx.closeLog()
+}
+
+// save writes the snapshot to a temporary file renamed over the previous
+// one, so a crash never leaves a half-written index. Only compact calls it.
+// Callers hold mu.
+func (idx *Index) save() error {
+	if idx.path == "" {
+		return nil
+	}
+	snap := snapshot{Revision: idx.revisions.Load(), Documents: make([]*document, 0, len(idx.docs))}
+	for _, id := range idx.sortedIDs() {
+		snap.Documents = append(snap.Documents, idx.docs[id])
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encode embedded index: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0o755); err != nil {
+		return services.BackendError{Message: "create embedded index directory", Err: err}
+	}
+	// The snapshot reaches the disk before it replaces the previous one,
+	// and the rename before the caller empties the log.
+	tmp := idx.path + ".tmp"
+	if err := writeSynced(tmp, data); err != nil {
+		return services.BackendError{Message: "write embedded index", Err: err}
+	}
+	if err := os.Rename(tmp, idx.path); err != nil {
+		return services.BackendError{Message: "replace embedded index", Err: err}
+	}
+	if err := syncDir(filepath.Dir(idx.path)); err != nil {
+		return services.BackendError{Message: "sync embedded index directory", Err: err}
+	}
+	return nil
+}
+
+// writeSynced writes data to path and flushes it to disk.
+func writeSynced(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// syncDir flushes the entries of dir, such as a rename or a new file, to disk.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// sortedIDs returns the ids of every document, tombstones included, in order.
+func (idx *Index) sortedIDs() []string {
+	ids := make([]string, 0, len(idx.docs))
+	for id := range idx.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// IndexedVersion returns the version bookkeeping of a product.
+func (idx *Index) IndexedVersion(ctx context.Context, id string) (services.IndexedVersion, bool, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	doc, ok := idx.docs[id]
+	if !ok {
+		return services.IndexedVersion{}, false, nil
+	}
+	return services.IndexedVersion{Version: doc.Product.Version, Tombstone: doc.Tombstone, Revision: doc.Revision}, true, nil
+}
+
+// IndexProduct adds or replaces a product. A non-zero revision makes the
+// write conditional, as with Solr's _version_.
+func (idx *Index) IndexProduct(ctx context.Context, product models.ProductDocument, revision int64) error {
+	return idx.put(&document{Product: product}, revision)
+}
+
+// DeleteProduct replaces a product with a tombstone keeping the deletion
+// version, so older events for the product are recognized as stale.
+func (idx *Index) DeleteProduct(ctx context.Context, id string, version, revision int64) error {
+	tombstone := models.ProductDocument{ID: id, Version: version, UpdatedAt: time.Now().UTC()}
+	return idx.put(&document{Product: tombstone, Tombstone: true}, revision)
+}
+
+func (idx *Index) put(doc *document, revision int64) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	current, exists := idx.docs[doc.Product.ID]
+	switch {
+	case revision == services.RevisionAbsent && exists:
+		return services.ErrRevisionConflict
+	case revision > 0 && (!exists || current.Revision != revision):
+		return services.ErrRevisionConflict
+	}
+	doc.Revision = idx.revisions.Add(1)
+	analyzeDocument(doc)
+	if err := idx.appendLog(doc); err != nil {
+		// Keep memory and disk in step: the write did not happen.
+		return err
+	}
+	idx.docs[doc.Product.ID] = doc
+	idx.compactIfDue()
+	return nil
+}
+
+// ScanIndex pages through every document, tombstones included, ordered by
+// id. The cursor is the last id returned and is empty after the last page.
+func (idx *Index) ScanIndex(ctx context.Context, cursor string, limit int) ([]services.IndexEntry, string, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ids := idx.sortedIDs()
+	start := sort.SearchStrings(ids, cursor)
+	if start < len(ids) && ids[start] == cursor {
+		start++
+	}
+	end := min(start+limit, len(ids))
+	entries := make([]services.IndexEntry, 0, end-start)
+	for _, id := range ids[start:end] {
+		doc := idx.docs[id]
+		entries = append(entries, services.IndexEntry{
+			ID:        id,
+			Version:   doc.Product.Version,
+			Tombstone: doc.Tombstone,
+			UpdatedAt: doc.Product.UpdatedAt,
+		})
+	}
+	next := ""
+	if end < len(ids) && len(entries) > 0 {
+		next = entries[len(entries)-1].ID
+	}
+	return entries, next, nil
+}
+
+// CreateCore starts an empty staging index persisted next to this one.
+func (idx *Index) CreateCore(ctx context.Context, name string) (services.IndexRepository, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, exists := idx.cores[name]; exists {
+		return nil, services.BackendError{Message: fmt.Sprintf("embedded core %s already exists", name)}
+	}
+	core := &Index{revisions: idx.revisions, docs: map[string]*document{}, cores: map[string]*Index{}}
+	if idx.path != "" {
+		core.path = filepath.Join(filepath.Dir(idx.path), name+".json")
+		if err := core.removeFiles(); err != nil {
+			return nil, err
+		}
+		if err := core.openLog(0); err != nil {
+			return nil, err
+		}
+	}
+	idx.cores[name] = core
+	return core, nil
+}
+
+// SwapCores exchanges the documents of this index with those of the staging
+// core other; core names this index and is only used in messages.
+func (idx *Index) SwapCores(ctx context.Context, core, other string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	staging, ok := idx.cores[other]
+	if !ok {
+		return services.BackendError{Message: fmt.Sprintf("embedded core %s not found to swap with %s", other, core)}
+	}
+	staging.mu.Lock()
+	defer staging.mu.Unlock()
+	idx.docs, staging.docs = staging.docs, idx.docs
+	if err := idx.compact(); err != nil {
+		idx.docs, staging.docs = staging.docs, idx.docs
+		return err
+	}
+	return staging.compact()
+}
+
+// UnloadCore drops a staging core and its snapshot file.
+func (idx *Index) UnloadCore(ctx context.Context, name string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	core, ok := idx.cores[name]
+	if !ok {
+		return services.BackendError{Message: fmt.Sprintf("embedded core %s not found", name)}
+	}
+	delete(idx.cores, name)
+	core.mu.Lock()
+	defer core.mu.Unlock()
+	if err := core.closeLog(); err != nil {
+		log.Printf("embedded core %s: close log: %v", name, err)
+	}
+	return core.removeFiles()
+}
+
+// removeFiles deletes the snapshot and log of a core.
+func (idx *Index) removeFiles() error {
+	if idx.path == "" {
+		return nil
+	}
+	for _, path := range []string{idx.path, logPath(idx.path)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return services.BackendError{Message: "remove embedded core", Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"search-api/internal/indextest"
+	"search-api/internal/models"
+	"search-api/internal/services"
+)
+
+func TestIndexContract(t *testing.T) {
+	indextest.Run(t, func(t *testing.T) services.IndexRepository {
+		idx, err := Open(filepath.Join(t.TempDir(), "index.json"))
+		if err != nil {
+			t.Fatalf("open index: %v", err)
+		}
+		return idx
+	})
+}
+
+func TestIndexPersistsWritesAcrossOpens(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index.json")
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatalf("open index: %v", err)
+	}
+	if err := idx.IndexProduct(ctx, models.ProductDocument{ID: "p1", Name: "Rosa Imperial", Version: 1}, 0); err != nil {
+		t.Fatalf("index p1: %v", err)
+	}
+	if err := idx.DeleteProduct(ctx, "p2", 3, 0); err != nil {
+		t.Fatalf("delete p2: %v", err)
+	}
+	before, _, _ := idx.IndexedVersion(ctx, "p1")
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen index: %v", err)
+	}
+	result, err := reopened.Search(ctx, services.SearchFilters{Query: "rosa", Page: 1, Size: 10})
+	if err != nil || result.Total != 1 {
+		t.Fatalf("expected p1 to be searchable after reopening, got %+v err=%v", result, err)
+	}
+	after, _, _ := reopened.IndexedVersion(ctx, "p1")
+	if after != before {
+		t.Fatalf("expected the revision to survive, got %+v want %+v", after, before)
+	}
+	if state, _, _ := reopened.IndexedVersion(ctx, "p2"); !state.Tombstone || state.Version != 3 {
+		t.Fatalf("expected the tombstone to survive, got %+v", state)
+	}
+	if err := reopened.IndexProduct(ctx, models.ProductDocument{ID: "p3"}, 0); err != nil {
+		t.Fatalf("index p3: %v", err)
+	}
+	if state, _, _ := reopened.IndexedVersion(ctx, "p3"); state.Revision <= after.Revision {
+		t.Fatalf("expected revisions to keep growing, got %d after %d", state.Revision, after.Revision)
+	}
+}
+
+func TestIndexSwapsInARebuiltCore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	idx, err := Open(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatalf("open index: %v", err)
+	}
+	if err := idx.IndexProduct(ctx, models.ProductDocument{ID: "old"}, 0); err != nil {
+		t.Fatalf("index old: %v", err)
+	}
+	staging, err := idx.CreateCore(ctx, "staging")
+	if err != nil {
+		t.Fatalf("create core: %v", err)
+	}
+	if err := staging.IndexProduct(ctx, models.ProductDocument{ID: "new"}, 0); err != nil {
+		t.Fatalf("index new: %v", err)
+	}
+	if err := idx.SwapCores(ctx, "live", "staging"); err != nil {
+		t.Fatalf("swap cores: %v", err)
+	}
+	if err := idx.UnloadCore(ctx, "staging"); err != nil {
+		t.Fatalf("unload core: %v", err)
+	}
+
+	reopened, err := Open(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatalf("reopen index: %v", err)
+	}
+	entries, next, err := reopened.ScanIndex(ctx, "", 10)
+	if err != nil || next != "" || len(entries) != 1 || entries[0].ID != "new" {
+		t.Fatalf("expected only the rebuilt document, got %+v next=%q err=%v", entries, next, err)
+	}
+}
+
+func TestScanIndexPagesInIDOrder(t *testing.T) {
+	ctx := context.Background()
+	idx, _ := Open("")
+	for _, id := range []string{"c", "a", "b"} {
+		if err := idx.IndexProduct(ctx, models.ProductDocument{ID: id}, 0); err != nil {
+			t.Fatalf("index %s: %v", id, err)
+		}
+	}
+	var got []string
+	cursor := ""
+	for {
+		entries, next, err := idx.ScanIndex(ctx, cursor, 2)
+		if err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		for _, entry := range entries {
+			got = append(got, entry.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("expected a, b, c, got %v", got)
+	}
+}
+
+func TestIndexLogsWritesAndCompactsThemIntoTheSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index.json")
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatalf("open index: %v", err)
+	}
+	defer idx.Close()
+	for i := 0; i < minCompactRecords-1; i++ {
+		if err := idx.IndexProduct(ctx, models.ProductDocument{ID: fmt.Sprintf("p%04d", i)}, 0); err != nil {
+			t.Fatalf("index: %v", err)
+		}
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected writes to go to the log only, got %v", err)
+	}
+
+	if err := idx.IndexProduct(ctx, models.ProductDocument{ID: "p9999"}, 0); err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	if info, err := os.Stat(logPath(path)); err != nil || info.Size() != 0 {
+		t.Fatalf("expected the log to be compacted into the snapshot, got %v", err)
+	}
+	if err := idx.IndexProduct(ctx, models.ProductDocument{ID: "p0000", Name: "Rosa"}, -1); err == nil {
+		t.Fatalf("expected a conditional write on an existing document to conflict")
+	}
+	state, _, _ := idx.IndexedVersion(ctx, "p0000")
+	if err := idx.IndexProduct(ctx, models.ProductDocument{ID: "p0000", Name: "Rosa"}, state.Revision); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen index: %v", err)
+	}
+	defer reopened.Close()
+	entries, _, _ := reopened.ScanIndex(ctx, "", 2*minCompactRecords)
+	if len(entries) != minCompactRecords {
+		t.Fatalf("expected every document from the snapshot and the log, got %d", len(entries))
+	}
+	if result, _ := reopened.Search(ctx, services.SearchFilters{Query: "rosa", Page: 1, Size: 10}); result.Total != 1 {
+		t.Fatalf("expected the update logged after compaction to be replayed, got %+v", result)
+	}
+}
+
+func TestIndexDropsATornLogRecord(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index.json")
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatalf("open index: %v", err)
+	}
+	if err := idx.IndexProduct(ctx, models.ProductDocument{ID: "p1"}, 0); err != nil {
+		t.Fatalf("index p1: %v", err)
+	}
+	idx.Close()
+	// A crash in the middle of the next append.
+	file, err := os.OpenFile(logPath(path), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	file.WriteString(`{"product":{"id":"p2"`)
+	file.Close()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen index: %v", err)
+	}
+	if err := reopened.IndexProduct(ctx, models.ProductDocument{ID: "p3"}, 0); err != nil {
+		t.Fatalf("index p3: %v", err)
+	}
+	reopened.Close()
+
+	again, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen index: %v", err)
+	}
+	defer again.Close()
+	entries, _, _ := again.ScanIndex(ctx, "", 10)
+	if len(entries) != 2 || entries[0].ID != "p1" || entries[1].ID != "p3" {
+		t.Fatalf("expected the torn record dropped and later writes kept, got %+v", entries)
+	}
+}
@@ -0,0 +1,155 @@
+package embedded
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"search-api/internal/services"
+)
+
+// Writes are appended to a log next to the snapshot, one JSON document per
+// line, and synced before they are acknowledged, so a write costs the size
+// of its document rather than of the whole index. The log is compacted into
+// the snapshot once it holds as many records as the index has documents,
+// which keeps the bytes written per document constant on average however
+// large the index grows.
+
+// minCompactRecords is the fewest log records worth a compaction.
+const minCompactRecords = 1000
+
+// logPath returns the path of the write log of the snapshot at path.
+func logPath(path string) string {
+	return path + ".log"
+}
+
+// openLog replays the write log over the loaded snapshot and opens it for
+// appending. Records the snapshot already includes, those with a revision
+// up to snapshotRevision, are skipped. A torn last record, left by a crash
+// mid-write, is dropped.
+func (idx *Index) openLog(snapshotRevision int64) error {
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0o755); err != nil {
+		return services.BackendError{Message: "create embedded index directory", Err: err}
+	}
+	file, err := os.OpenFile(logPath(idx.path), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return services.BackendError{Message: "open embedded index log", Err: err}
+	}
+	if err := syncDir(filepath.Dir(idx.path)); err != nil {
+		file.Close()
+		return services.BackendError{Message: "sync embedded index directory", Err: err}
+	}
+
+	reader := bufio.NewReader(file)
+	var size int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				log.Printf("embedded index %s: dropping a torn log record", idx.path)
+			}
+			break
+		}
+		if err != nil {
+			file.Close()
+			return services.BackendError{Message: "read embedded index log", Err: err}
+		}
+		doc := &document{}
+		if err := json.Unmarshal(line, doc); err != nil {
+			log.Printf("embedded index %s: dropping the log from an unreadable record: %v", idx.path, err)
+			break
+		}
+		size += int64(len(line))
+		idx.logged++
+		if doc.Revision <= snapshotRevision {
+			continue
+		}
+		analyzeDocument(doc)
+		idx.docs[doc.Product.ID] = doc
+		if doc.Revision > idx.revisions.Load() {
+			idx.revisions.Store(doc.Revision)
+		}
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return services.BackendError{Message: "truncate embedded index log", Err: err}
+	}
+	idx.log, idx.logSize = file, size
+	return nil
+}
+
+// appendLog records doc in the write log and syncs it to disk. A failed
+// append is cut off so the records after it stay readable. Callers hold mu.
+func (idx *Index) appendLog(doc *document) error {
+	if idx.log == nil {
+		return nil
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("encode embedded index record: %w", err)
+	}
+	data = append(data, '\n')
+	_, err = idx.log.Write(data)
+	if err == nil {
+		err = idx.log.Sync()
+	}
+	if err != nil {
+		if truncErr := idx.log.Truncate(idx.logSize); truncErr != nil {
+			log.Printf("embedded index %s: cut off failed log record: %v", idx.path, truncErr)
+		}
+		return services.BackendError{Message: "append to embedded index log", Err: err}
+	}
+	idx.logSize += int64(len(data))
+	idx.logged++
+	return nil
+}
+
+// compactIfDue compacts the log once it holds as many records as there are
+// documents. Writes are already synced to the log, so a failure is only
+// logged and compaction is retried on the next write. Callers hold mu.
+func (idx *Index) compactIfDue() {
+	if idx.log == nil || idx.logged < max(minCompactRecords, len(idx.docs)) {
+		return
+	}
+	if err := idx.compact(); err != nil {
+		log.Printf("embedded index %s: compaction failed: %v", idx.path, err)
+	}
+}
+
+// compact writes the snapshot and, once it is synced, empties the log.
+// Emptying it is only housekeeping: the snapshot revision tells replay to
+// skip every record already in the log, so a crash or failure after saving
+// loses nothing. Callers hold mu.
+func (idx *Index) compact() error {
+	if idx.path == "" {
+		return nil
+	}
+	if err := idx.save(); err != nil {
+		return err
+	}
+	idx.logged = 0
+	if idx.log == nil {
+		return nil
+	}
+	if err := idx.log.Truncate(0); err != nil {
+		log.Printf("embedded index %s: empty log: %v", idx.path, err)
+		return nil
+	}
+	idx.logSize = 0
+	return nil
+}
+
+// closeLog closes the write log, if open. Callers hold mu.
+func (idx *Index) closeLog() error {
+	if idx.log == nil {
+		return nil
+	}
+	err := idx.log.Close()
+	idx.log = nil
+	return err
+}
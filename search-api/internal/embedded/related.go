@@ -0,0 +1,294 @@
+package embedded
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"search-api/internal/models"
+	"search-api/internal/services"
+)
+
+const (
+	// Suggest boosts, as in the Solr suggest query fields.
+	nameSuggestBoost  = 3
+	marcaSuggestBoost = 2
+	notasSuggestBoost = 1
+	// maxPrefixLength is the longest edge n-gram Solr indexes; longer
+	// words typed in full no longer match as prefixes.
+	maxPrefixLength = 20
+	// suggestFacetLimit bounds the brand and note values returned.
+	suggestFacetLimit = 50
+
+	// Spellcheck settings mirror the DirectSolrSpellChecker defaults of
+	// the /spell_es handler.
+	spellMinWordLength  = 4
+	spellMaxEdits       = 2
+	spellMinAccuracy    = 0.5
+	spellCandidates     = 5
+	spellCollations     = 3
+	spellCollationTries = 10
+)
+
+// Suggest finds the products matching every typed word as a word prefix of
+// their name, brand or notes, and counts their brands and notes.
+func (idx *Index) Suggest(ctx context.Context, query string, limit int) (*services.SuggestCandidates, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	typed := prefixTerms(query)
+	candidates := &services.SuggestCandidates{}
+	if len(typed) == 0 {
+		return candidates, nil
+	}
+	brands := map[string]int64{}
+	notes := map[string]int64{}
+	var hits []hit
+	for _, doc := range idx.docs {
+		if doc.Tombstone {
+			continue
+		}
+		score, ok := suggestScore(doc.terms, typed)
+		if !ok {
+			continue
+		}
+		hits = append(hits, hit{doc: doc, score: score})
+		countFacet(brands, "marca", doc.Product)
+		countFacet(notes, "notas", doc.Product)
+	}
+	sortHits(hits, []services.SortOption{{Field: services.SortRelevance}})
+	for _, h := range hits[:min(limit, len(hits))] {
+		candidates.Products = append(candidates.Products, models.ProductDocument{
+			ID:    h.doc.Product.ID,
+			Name:  h.doc.Product.Name,
+			Marca: h.doc.Product.Marca,
+		})
+	}
+	candidates.Brands = topCounts(brands, suggestFacetLimit)
+	candidates.Notes = topCounts(notes, suggestFacetLimit)
+	return candidates, nil
+}
+
+func suggestScore(t fields, typed []string) (float64, bool) {
+	var score float64
+	for _, prefix := range typed {
+		if utf8.RuneCountInString(prefix) > maxPrefixLength {
+			return 0, false
+		}
+		switch {
+		case hasPrefix(t.namePrefix, prefix):
+			score += nameSuggestBoost
+		case hasPrefix(t.marcaPrefix, prefix):
+			score += marcaSuggestBoost
+		case hasPrefix(t.notasPrefix, prefix):
+			score += notasSuggestBoost
+		default:
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+func hasPrefix(terms []string, prefix string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(term, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func topCounts(counts map[string]int64, limit int) []services.FacetCount {
+	values := make([]services.FacetCount, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, services.FacetCount{Value: value, Count: count})
+	}
+	sortFacetCounts(values)
+	return values[:min(limit, len(values))]
+}
+
+// SpellCheck returns corrected versions of the text query of filters, best
+// first, with the number of products each matches under the same filters.
+// Words missing from the indexed text are replaced by indexed words at most
+// two edits away that start with the same letter.
+func (idx *Index) SpellCheck(ctx context.Context, filters services.SearchFilters) ([]services.Collation, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	typed := words(filters.Query)
+	if len(typed) == 0 {
+		return nil, nil
+	}
+	vocabulary := idx.vocabulary()
+	options := make([][]string, len(typed))
+	misspelled := false
+	for i, word := range typed {
+		options[i] = []string{word}
+		if _, known := vocabulary[word]; known || utf8.RuneCountInString(word) < spellMinWordLength {
+			continue
+		}
+		if corrections := spellCorrections(word, vocabulary); len(corrections) > 0 {
+			options[i] = corrections
+			misspelled = true
+		}
+	}
+	if !misspelled {
+		return nil, nil
+	}
+
+	var collations []services.Collation
+	for _, choice := range rankedChoices(options, spellCollationTries) {
+		query := make([]string, len(typed))
+		for i, rank := range choice {
+			query[i] = options[i][rank]
+		}
+		corrected := filters
+		corrected.Query = strings.Join(query, " ")
+		hits, _ := idx.run(corrected, nil)
+		if len(hits) == 0 {
+			continue
+		}
+		collations = append(collations, services.Collation{Query: corrected.Query, Hits: int64(len(hits))})
+		if len(collations) == spellCollations {
+			break
+		}
+	}
+	return collations, nil
+}
+
+// vocabulary counts the live documents each lowercased word appears in.
+func (idx *Index) vocabulary() map[string]int {
+	vocabulary := map[string]int{}
+	for _, doc := range idx.docs {
+		if doc.Tombstone {
+			continue
+		}
+		p := doc.Product
+		text := strings.Join(append([]string{p.Name, p.Marca, p.Descripcion}, p.Notas...), " ")
+		for _, word := range dedupe(words(text)) {
+			vocabulary[word]++
+		}
+	}
+	return vocabulary
+}
+
+// spellCorrections returns the closest known words, fewest edits first and
+// then the most frequent.
+func spellCorrections(word string, vocabulary map[string]int) []string {
+	type candidate struct {
+		word     string
+		distance int
+		freq     int
+	}
+	typed := []rune(word)
+	var candidates []candidate
+	for known, freq := range vocabulary {
+		runes := []rune(known)
+		if runes[0] != typed[0] {
+			continue
+		}
+		distance := editDistance(typed, runes)
+		accuracy := 1 - float64(distance)/float64(max(len(typed), len(runes)))
+		if distance <= spellMaxEdits && accuracy >= spellMinAccuracy {
+			candidates = append(candidates, candidate{known, distance, freq})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		if a.freq != b.freq {
+			return a.freq > b.freq
+		}
+		return a.word < b.word
+	})
+	corrections := make([]string, 0, spellCandidates)
+	for _, c := range candidates[:min(spellCandidates, len(candidates))] {
+		corrections = append(corrections, c.word)
+	}
+	return corrections
+}
+
+// rankedChoices returns up to limit combinations of one option per word,
+// as option indexes, the ones made of better-ranked options first.
+func rankedChoices(options [][]string, limit int) [][]int {
+	maxSum := 0
+	for _, opts := range options {
+		maxSum += len(opts) - 1
+	}
+	var choices [][]int
+	var pick func(choice []int, word, remaining int)
+	pick = func(choice []int, word, remaining int) {
+		if len(choices) == limit {
+			return
+		}
+		if word == len(options) {
+			if remaining == 0 {
+				choices = append(choices, append([]int(nil), choice...))
+			}
+			return
+		}
+		for rank := 0; rank < len(options[word]) && rank <= remaining; rank++ {
+			pick(append(choice, rank), word+1, remaining-rank)
+		}
+	}
+	for sum := 0; sum <= maxSum && len(choices) < limit; sum++ {
+		pick(nil, 0, sum)
+	}
+	return choices
+}
+
+// Similar returns the products sharing the most notes with product id, then
+// its tipo, estacion and ocasion, skipping deleted and out-of-stock products
+// and the product itself.
+func (idx *Index) Similar(ctx context.Context, id string, limit int) ([]models.ProductDocument, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	source, ok := idx.docs[id]
+	if !ok || source.Tombstone {
+		return nil, nil
+	}
+	var hits []hit
+	for _, doc := range idx.docs {
+		if doc.Tombstone || doc.Product.Stock < 1 || doc.Product.ID == id {
+			continue
+		}
+		if score := similarity(source, doc); score > 0 {
+			hits = append(hits, hit{doc: doc, score: score})
+		}
+	}
+	sortHits(hits, []services.SortOption{{Field: services.SortRelevance}})
+	products := make([]models.ProductDocument, 0, min(limit, len(hits)))
+	for _, h := range hits[:min(limit, len(hits))] {
+		products = append(products, h.doc.Product)
+	}
+	return products, nil
+}
+
+// similarity weights shared notes three times and the tipo twice as much as
+// the estacion and the ocasion, like the Solr MoreLikeThis query.
+func similarity(source, doc *document) float64 {
+	var score float64
+	for _, term := range dedupe(source.terms.notas) {
+		if slices.Contains(doc.terms.notas, term) {
+			score += 3
+		}
+	}
+	for _, field := range []struct {
+		a, b   string
+		weight float64
+	}{
+		{source.Product.Tipo, doc.Product.Tipo, 2},
+		{source.Product.Estacion, doc.Product.Estacion, 1},
+		{source.Product.Ocasion, doc.Product.Ocasion, 1},
+	} {
+		if field.a != "" && strings.EqualFold(field.a, field.b) {
+			score += field.weight
+		}
+	}
+	return score
+}
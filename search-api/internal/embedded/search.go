@@ -0,0 +1,464 @@
+package embedded
+
+import (
+	"cmp"
+	"context"
+	"html"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"search-api/internal/models"
+	"search-api/internal/services"
+)
+
+const (
+	// Field boosts, as in the Solr qf and pf parameters: matches in the
+	// name rank above the brand, the notes and the description, and the
+	// whole query appearing as a phrase adds to them.
+	nameBoost        = 8
+	marcaBoost       = 4
+	notasBoost       = 2
+	descripcionBoost = 1
+	namePhraseBoost  = 16
+	descPhraseBoost  = 2
+
+	// facetLimit bounds the values returned per facet field.
+	facetLimit = 30
+	// fragmentSize bounds highlighted fragments, in characters.
+	fragmentSize = 160
+	// highlightSnippets bounds the fragments per field.
+	highlightSnippets = 2
+)
+
+// hit is a document matching a search, with its relevance.
+type hit struct {
+	doc   *document
+	score float64
+}
+
+// Search runs a query and returns a paginated result with the requested
+// facets and highlights.
+func (idx *Index) Search(ctx context.Context, filters services.SearchFilters) (*services.SearchResult, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	hits, facets := idx.run(filters, filters.Facets)
+	sortHits(hits, filters.Sorts)
+
+	start := max((filters.Page-1)*filters.Size, 0)
+	end := min(start+filters.Size, len(hits))
+	start = min(start, end)
+	items := make([]models.ProductDocument, 0, end-start)
+	for _, h := range hits[start:end] {
+		items = append(items, h.doc.Product)
+	}
+	return &services.SearchResult{
+		Items:      items,
+		Page:       filters.Page,
+		Size:       filters.Size,
+		Total:      int64(len(hits)),
+		Facets:     facets,
+		Highlights: highlightHits(hits[start:end], filters),
+	}, nil
+}
+
+// run returns the live documents matching the text query and the filters,
+// and counts facets. Each facet ignores the filter on its own field, so
+// selecting a value keeps the alternatives. Callers hold mu.
+func (idx *Index) run(filters services.SearchFilters, facetNames []string) ([]hit, map[string][]services.FacetCount) {
+	query := idx.parseQuery(filters.Query)
+	counters := make(map[string]map[string]int64, len(facetNames))
+	for _, facet := range facetNames {
+		counters[facet] = map[string]int64{}
+	}
+
+	var hits []hit
+	for _, doc := range idx.docs {
+		if doc.Tombstone {
+			continue
+		}
+		score, ok := query.score(doc)
+		if !ok {
+			continue
+		}
+		failed := failedFilters(doc.Product, filters)
+		if len(failed) == 0 {
+			hits = append(hits, hit{doc: doc, score: score})
+		}
+		for _, facet := range facetNames {
+			if len(failed) == 0 || (len(failed) == 1 && failed[0] == facet) {
+				countFacet(counters[facet], facet, doc.Product)
+			}
+		}
+	}
+
+	if len(facetNames) == 0 {
+		return hits, nil
+	}
+	facets := make(map[string][]services.FacetCount, len(facetNames))
+	for _, facet := range facetNames {
+		facets[facet] = facetCounts(facet, counters[facet])
+	}
+	return hits, facets
+}
+
+// textQuery is an analyzed text query, with the inverse document frequency
+// of its terms.
+type textQuery struct {
+	terms []string
+	idf   map[string]float64
+}
+
+func (idx *Index) parseQuery(q string) textQuery {
+	query := textQuery{terms: dedupe(analyze(q))}
+	if len(query.terms) == 0 {
+		return query
+	}
+	docFreq := make(map[string]int, len(query.terms))
+	live := 0
+	for _, doc := range idx.docs {
+		if doc.Tombstone {
+			continue
+		}
+		live++
+		for _, term := range query.terms {
+			t := doc.terms
+			if slices.Contains(t.name, term) || slices.Contains(t.marca, term) || slices.Contains(t.notas, term) || slices.Contains(t.descripcion, term) {
+				docFreq[term]++
+			}
+		}
+	}
+	query.idf = make(map[string]float64, len(query.terms))
+	for _, term := range query.terms {
+		query.idf[term] = 1 + math.Log(float64(live+1)/float64(docFreq[term]+1))
+	}
+	return query
+}
+
+// score rates doc against the query, like edismax: each term scores its
+// best field, short queries need every term and longer ones may miss a
+// quarter of them. An empty query matches everything.
+func (q textQuery) score(doc *document) (float64, bool) {
+	if len(q.terms) == 0 {
+		return 0, true
+	}
+	t := doc.terms
+	var score, phraseWeight float64
+	matched := 0
+	for _, term := range q.terms {
+		boost := 0
+		switch {
+		case slices.Contains(t.name, term):
+			boost = nameBoost
+		case slices.Contains(t.marca, term):
+			boost = marcaBoost
+		case slices.Contains(t.notas, term):
+			boost = notasBoost
+		case slices.Contains(t.descripcion, term):
+			boost = descripcionBoost
+		}
+		phraseWeight += q.idf[term]
+		if boost > 0 {
+			matched++
+			score += float64(boost) * q.idf[term]
+		}
+	}
+	if matched < requiredTerms(len(q.terms)) {
+		return 0, false
+	}
+	if len(q.terms) > 1 {
+		if containsSequence(t.name, q.terms) {
+			score += namePhraseBoost * phraseWeight
+		}
+		if containsSequence(t.descripcion, q.terms) {
+			score += descPhraseBoost * phraseWeight
+		}
+	}
+	return score, true
+}
+
+// requiredTerms implements mm=2<-25%: up to two terms all must match,
+// beyond that a quarter of them, rounded down, may be missing.
+func requiredTerms(n int) int {
+	if n <= 2 {
+		return n
+	}
+	return n - n/4
+}
+
+// failedFilters returns the tags of the filters doc does not pass; facets
+// are named after the tag of the filter they ignore.
+func failedFilters(p models.ProductDocument, filters services.SearchFilters) []string {
+	var failed []string
+	for _, filter := range []struct {
+		tag    string
+		value  string
+		values []string
+	}{
+		{"tipo", p.Tipo, filters.Tipo},
+		{"estacion", p.Estacion, filters.Estacion},
+		{"ocasion", p.Ocasion, filters.Ocasion},
+		{"genero", p.Genero, filters.Genero},
+		{"marca", p.Marca, filters.Marca},
+	} {
+		if len(filter.values) > 0 && !matchesAny([]string{filter.value}, filter.values) {
+			failed = append(failed, filter.tag)
+		}
+	}
+	if len(filters.Notas) > 0 {
+		ok := matchesAny(p.Notas, filters.Notas)
+		if filters.NotasMatch == services.NotasMatchAll {
+			for _, want := range filters.Notas {
+				ok = ok && matchesAny(p.Notas, []string{want})
+			}
+		}
+		if !ok {
+			failed = append(failed, "notas")
+		}
+	}
+	if (filters.PrecioMin > 0 && p.Precio < filters.PrecioMin) || (filters.PrecioMax > 0 && p.Precio > filters.PrecioMax) {
+		failed = append(failed, services.FacetPrecio)
+	}
+	if filters.InStock && p.Stock < 1 {
+		failed = append(failed, "stock")
+	}
+	if filters.Concentracion != "" && !hasVariant(p, func(v models.ProductVariant) bool {
+		return strings.ToLower(v.Concentracion) == filters.Concentracion
+	}) {
+		failed = append(failed, "concentracion")
+	}
+	if filters.TamanoML > 0 && !hasVariant(p, func(v models.ProductVariant) bool { return v.TamanoML == filters.TamanoML }) {
+		failed = append(failed, "tamano_ml")
+	}
+	return failed
+}
+
+// matchesAny tells whether one of values matches one of wanted. Like the
+// tokenized Solr fields, a wanted value matches the words it appears in:
+// "carolina herrera" matches the brand "Carolina Herrera".
+func matchesAny(values, wanted []string) bool {
+	for _, value := range values {
+		fieldWords := words(value)
+		for _, want := range wanted {
+			if containsSequence(fieldWords, words(want)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasVariant(p models.ProductDocument, match func(models.ProductVariant) bool) bool {
+	for _, variant := range p.Variantes {
+		if match(variant) {
+			return true
+		}
+	}
+	return false
+}
+
+func countFacet(counts map[string]int64, facet string, p models.ProductDocument) {
+	var values []string
+	switch facet {
+	case services.FacetPrecio:
+		for _, bucket := range services.PriceRanges {
+			if p.Precio >= bucket.From && (bucket.To == 0 || p.Precio < bucket.To) {
+				values = []string{bucket.Label()}
+			}
+		}
+	case "tipo":
+		values = []string{p.Tipo}
+	case "estacion":
+		values = []string{p.Estacion}
+	case "ocasion":
+		values = []string{p.Ocasion}
+	case "genero":
+		values = []string{p.Genero}
+	case "marca":
+		values = []string{p.Marca}
+	case "notas":
+		values = dedupe(p.Notas)
+	}
+	for _, value := range values {
+		if value != "" {
+			counts[value]++
+		}
+	}
+}
+
+// facetCounts orders a facet like Solr: price buckets in range order, field
+// values by count and then by value, at most facetLimit of them.
+func facetCounts(facet string, counts map[string]int64) []services.FacetCount {
+	values := []services.FacetCount{}
+	if facet == services.FacetPrecio {
+		for _, bucket := range services.PriceRanges {
+			count := counts[bucket.Label()]
+			if count == 0 {
+				continue
+			}
+			from, to := bucket.From, bucket.To
+			value := services.FacetCount{Value: bucket.Label(), Count: count, From: &from}
+			if to > 0 {
+				value.To = &to
+			}
+			values = append(values, value)
+		}
+		return values
+	}
+	for value, count := range counts {
+		values = append(values, services.FacetCount{Value: value, Count: count})
+	}
+	sortFacetCounts(values)
+	if len(values) > facetLimit {
+		values = values[:facetLimit]
+	}
+	return values
+}
+
+func sortFacetCounts(values []services.FacetCount) {
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+}
+
+// sortHits orders hits by sorts, or by most recently updated when there are
+// none, breaking ties by id so pages are stable.
+func sortHits(hits []hit, sorts []services.SortOption) {
+	if len(sorts) == 0 {
+		sorts = []services.SortOption{{Field: "updated_at", Desc: true}}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		for _, s := range sorts {
+			var order int
+			switch s.Field {
+			case services.SortRelevance:
+				// Best first, whatever the direction.
+				order = cmp.Compare(b.score, a.score)
+			case "updated_at":
+				order = a.doc.Product.UpdatedAt.Compare(b.doc.Product.UpdatedAt)
+			case "precio":
+				order = cmp.Compare(a.doc.Product.Precio, b.doc.Product.Precio)
+			case "stock":
+				order = cmp.Compare(a.doc.Product.Stock, b.doc.Product.Stock)
+			}
+			if s.Desc && s.Field != services.SortRelevance {
+				order = -order
+			}
+			if order != 0 {
+				return order < 0
+			}
+		}
+		return a.doc.Product.ID < b.doc.Product.ID
+	})
+}
+
+// highlightHits returns the fragments of each hit matching the text query,
+// HTML-escaped, with the matches wrapped in the requested tag.
+func highlightHits(hits []hit, filters services.SearchFilters) map[string]map[string][]string {
+	if !filters.Highlight || filters.Query == "" {
+		return nil
+	}
+	terms := make(map[string]bool)
+	for _, term := range analyze(filters.Query) {
+		terms[term] = true
+	}
+	result := map[string]map[string][]string{}
+	for _, h := range hits {
+		p := h.doc.Product
+		fragments := map[string][]string{}
+		for _, field := range services.HighlightFields {
+			var values []string
+			switch field {
+			case "name":
+				values = []string{p.Name}
+			case "descripcion":
+				values = []string{p.Descripcion}
+			case "notas":
+				values = p.Notas
+			}
+			for _, value := range values {
+				if fragment, ok := highlight(value, terms, filters.HighlightTag); ok && len(fragments[field]) < highlightSnippets {
+					fragments[field] = append(fragments[field], fragment)
+				}
+			}
+		}
+		if len(fragments) > 0 {
+			result[p.ID] = fragments
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// highlight wraps the words of text whose terms are in terms in tag and
+// escapes the rest. Long texts are cut to a fragment around the first match.
+func highlight(text string, terms map[string]bool, tag string) (string, bool) {
+	type span struct{ start, end int }
+	runes := []rune(text)
+	var matches []span
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := strings.ToLower(string(runes[i:j]))
+		if _, stop := stopWords[word]; !stop && terms[fold(stem(word))] {
+			matches = append(matches, span{i, j})
+		}
+		i = j
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	from, to := 0, len(runes)
+	if to > fragmentSize {
+		from = max(matches[0].start-fragmentSize/4, 0)
+		to = min(from+fragmentSize, len(runes))
+	}
+	var b strings.Builder
+	pos := from
+	for _, m := range matches {
+		if m.end > to {
+			break
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:m.start])))
+		b.WriteString("<" + tag + ">")
+		b.WriteString(html.EscapeString(string(runes[m.start:m.end])))
+		b.WriteString("</" + tag + ">")
+		pos = m.end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:to])))
+	return b.String(), true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// dedupe drops repeated values, keeping the first of each.
+func dedupe(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	unique := values[:0:0]
+	for _, value := range values {
+		if _, dup := seen[value]; dup {
+			continue
+		}
+		seen[value] = struct{}{}
+		unique = append(unique, value)
+	}
+	return unique
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"search-api/internal/responses"
+	"search-api/internal/services"
+)
+
+// ReindexHandler lets admins rebuild the search index and follow its progress.
+type ReindexHandler struct {
+	// ctx bounds background rebuilds; it is cancelled on shutdown rather
+	// than when the request that started the rebuild returns.
+	ctx       context.Context
+	reindexer *services.Reindexer
+}
+
+// NewReindexHandler creates a ReindexHandler whose rebuilds run under ctx.
+func NewReindexHandler(ctx context.Context, reindexer *services.Reindexer) *ReindexHandler {
+	return &ReindexHandler{ctx: ctx, reindexer: reindexer}
+}
+
+// StartReindex handles POST /search/admin/reindex?new_core=true&batch_size=N.
+func (h *ReindexHandler) StartReindex(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	newCore, _ := strconv.ParseBool(query.Get("new_core"))
+
+	status, err := h.reindexer.Start(h.ctx, services.ReindexOptions{
+		BatchSize: parseInt(query.Get("batch_size"), 0),
+		NewCore:   newCore,
+	})
+	if err != nil {
+		var valErr services.ValidationError
+		switch {
+		case errors.As(err, &valErr):
+			responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", valErr.Error())
+		case errors.Is(err, services.ErrReindexRunning):
+			responses.WriteError(w, http.StatusConflict, "REINDEX_RUNNING", "A reindex is already running")
+		default:
+			log.Printf("start reindex: %v", err)
+			responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not start reindex")
+		}
+		return
+	}
+	responses.WriteJSON(w, http.StatusAccepted, status)
+}
+
+// ReindexStatus handles GET /search/admin/reindex.
+func (h *ReindexHandler) ReindexStatus(w http.ResponseWriter, r *http.Request) {
+	responses.WriteJSON(w, http.StatusOK, h.reindexer.Status())
+}
+
+// ReconcileHandler exposes the drift between products-api and the index.
+type ReconcileHandler struct {
+	reconciler *services.Reconciler
+}
+
+// NewReconcileHandler creates a ReconcileHandler.
+func NewReconcileHandler(reconciler *services.Reconciler) *ReconcileHandler {
+	return &ReconcileHandler{reconciler: reconciler}
+}
+
+// DriftReport handles GET /search/admin/reconcile with the last drift report.
+func (h *ReconcileHandler) DriftReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.reconciler.LastReport()
+	if !ok {
+		responses.WriteError(w, http.StatusNotFound, "NO_REPORT", "No reconciliation has run yet")
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, report)
+}
+
+// Reconcile handles POST /search/admin/reconcile?dry_run=true and returns
+// the drift report once the comparison finishes.
+func (h *ReconcileHandler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	report, err := h.reconciler.Reconcile(r.Context(), dryRun)
+	if err != nil {
+		if errors.Is(err, services.ErrReconcileRunning) {
+			responses.WriteError(w, http.StatusConflict, "RECONCILE_RUNNING", "A reconciliation is already running")
+			return
+		}
+		log.Printf("reconcile index: %v", err)
+		responses.WriteError(w, http.StatusBadGateway, "RECONCILE_FAILED", "Reconciliation did not finish: "+report.Error)
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"search-api/internal/responses"
+	"search-api/internal/services"
+)
+
+// CacheHandler lets admins observe the search cache and manage single entries.
+type CacheHandler struct {
+	service *services.SearchService
+}
+
+// NewCacheHandler creates a CacheHandler.
+func NewCacheHandler(service *services.SearchService) *CacheHandler {
+	return &CacheHandler{service: service}
+}
+
+// warmRequest lists searches as the query strings of GET /search/products,
+// e.g. "q=rosa&marca=dior".
+type warmRequest struct {
+	Searches []string `json:"searches"`
+}
+
+type warmResponse struct {
+	Search string `json:"search"`
+	services.WarmResult
+}
+
+// Stats handles GET /search/admin/cache/stats with the counters of each
+// cache layer.
+func (h *CacheHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.CacheStats()
+	if err != nil {
+		responses.WriteError(w, http.StatusNotFound, "NO_CACHE_STATS", "The cache keeps no stats")
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, stats)
+}
+
+// Entry handles GET /search/admin/cache/entry with the response cached for
+// the search given by the same parameters as GET /search/products.
+func (h *CacheHandler) Entry(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseSearchFilters(r.URL.Query())
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+	entry, err := h.service.CachedSearch(filters)
+	if err != nil {
+		var valErr services.ValidationError
+		switch {
+		case errors.As(err, &valErr):
+			responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", valErr.Error())
+		case errors.Is(err, services.ErrCacheEntryNotFound):
+			responses.WriteError(w, http.StatusNotFound, "CACHE_ENTRY_NOT_FOUND", "No cached response for this search")
+		default:
+			log.Printf("read cache entry: %v", err)
+			responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not read cache entry")
+		}
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, entry)
+}
+
+// EvictEntry handles DELETE /search/admin/cache/entry, removing the response
+// cached for the search given by the same parameters as GET /search/products.
+func (h *CacheHandler) EvictEntry(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseSearchFilters(r.URL.Query())
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+	key, err := h.service.EvictSearch(filters)
+	if err != nil {
+		var valErr services.ValidationError
+		if errors.As(err, &valErr) {
+			responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", valErr.Error())
+			return
+		}
+		log.Printf("evict cache entry: %v", err)
+		responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not evict cache entry")
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, map[string]string{"evicted": key})
+}
+
+// Warm handles POST /search/admin/cache/warm with a JSON body listing
+// popular searches, and caches a fresh response for each.
+func (h *CacheHandler) Warm(w http.ResponseWriter, r *http.Request) {
+	var req warmRequest
+	defer r.Body.Close()
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload")
+		return
+	}
+
+	searches := make([]services.SearchFilters, 0, len(req.Searches))
+	for i, search := range req.Searches {
+		filters, err := parseSearchQuery(search)
+		if err != nil {
+			responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("searches[%d]: %v", i, err))
+			return
+		}
+		searches = append(searches, filters)
+	}
+
+	results, err := h.service.WarmSearches(r.Context(), searches)
+	if err != nil {
+		var valErr services.ValidationError
+		if errors.As(err, &valErr) {
+			responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", valErr.Error())
+			return
+		}
+		log.Printf("warm cache: %v", err)
+		responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not warm the cache")
+		return
+	}
+	response := make([]warmResponse, len(results))
+	for i, result := range results {
+		response[i] = warmResponse{Search: req.Searches[i], WarmResult: result}
+	}
+	responses.WriteJSON(w, http.StatusOK, response)
+}
+
+// parseSearchQuery reads a search given as the query string of
+// GET /search/products, with or without the path before it.
+func parseSearchQuery(search string) (services.SearchFilters, error) {
+	if i := strings.IndexByte(search, '?'); i >= 0 {
+		search = search[i+1:]
+	}
+	query, err := url.ParseQuery(search)
+	if err != nil {
+		return services.SearchFilters{}, services.ValidationError{Message: "invalid query string"}
+	}
+	return parseSearchFilters(query)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"search-api/internal/rabbitmq"
+	"search-api/internal/responses"
+)
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 500
+)
+
+// DeadLetterQueue exposes the dead-lettered product events.
+type DeadLetterQueue interface {
+	DeadLetters(ctx context.Context, limit int) ([]rabbitmq.DeadLetter, error)
+	ReplayDeadLetters(ctx context.Context, limit int) (int, error)
+	PurgeDeadLetters(ctx context.Context) (int, error)
+}
+
+// EventsHandler lets admins inspect and recover dead-lettered events.
+type EventsHandler struct {
+	queue DeadLetterQueue
+}
+
+// NewEventsHandler creates an EventsHandler.
+func NewEventsHandler(queue DeadLetterQueue) *EventsHandler {
+	return &EventsHandler{queue: queue}
+}
+
+// ListDeadLetters handles GET /search/events/dead-letters.
+func (h *EventsHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := h.queue.DeadLetters(r.Context(), deadLetterLimit(r))
+	if err != nil {
+		log.Printf("list dead letters: %v", err)
+		responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not read dead-letter queue")
+		return
+	}
+	if letters == nil {
+		letters = []rabbitmq.DeadLetter{}
+	}
+	responses.WriteJSON(w, http.StatusOK, letters)
+}
+
+// ReplayDeadLetters handles POST /search/events/dead-letters/replay.
+func (h *EventsHandler) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	replayed, err := h.queue.ReplayDeadLetters(r.Context(), deadLetterLimit(r))
+	if err != nil {
+		log.Printf("replay dead letters (%d replayed): %v", replayed, err)
+		responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not replay dead-lettered events")
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, map[string]int{"replayed": replayed})
+}
+
+// PurgeDeadLetters handles DELETE /search/events/dead-letters.
+func (h *EventsHandler) PurgeDeadLetters(w http.ResponseWriter, r *http.Request) {
+	purged, err := h.queue.PurgeDeadLetters(r.Context())
+	if err != nil {
+		log.Printf("purge dead letters: %v", err)
+		responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not purge dead-letter queue")
+		return
+	}
+	responses.WriteJSON(w, http.StatusOK, map[string]int{"purged": purged})
+}
+
+func deadLetterLimit(r *http.Request) int {
+	limit := parseInt(r.URL.Query().Get("limit"), defaultDeadLetterLimit)
+	if limit <= 0 {
+		return defaultDeadLetterLimit
+	}
+	return min(limit, maxDeadLetterLimit)
+}
@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -28,19 +31,10 @@ func (h *SearchHandler) SearchProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := r.URL.Query()
-	filters := services.SearchFilters{
-		Query:    strings.TrimSpace(query.Get("q")),
-		Tipo:     strings.TrimSpace(query.Get("tipo")),
-		Estacion: strings.TrimSpace(query.Get("estacion")),
-		Ocasion:  strings.TrimSpace(query.Get("ocasion")),
-		Genero:   strings.TrimSpace(query.Get("genero")),
-		Marca:    strings.TrimSpace(query.Get("marca")),
-		Page:     parseInt(query.Get("page"), 1),
-		Size:     parseInt(query.Get("size"), 10),
-	}
-	if sortParam := strings.TrimSpace(query.Get("sort")); sortParam != "" {
-		filters.Sorts = parseSorts(sortParam)
+	filters, err := parseSearchFilters(r.URL.Query())
+	if err != nil {
+		responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
 	}
 
 	result, err := h.service.SearchProducts(r.Context(), filters)
@@ -50,6 +44,11 @@ func (h *SearchHandler) SearchProducts(w http.ResponseWriter, r *http.Request) {
 			responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", valErr.Error())
 			return
 		}
+		if errors.Is(err, services.ErrSearchUnavailable) {
+			log.Printf("search unavailable: %v", err)
+			responses.WriteError(w, http.StatusServiceUnavailable, "SEARCH_UNAVAILABLE", "La búsqueda no está disponible en este momento.")
+			return
+		}
 		var backendErr services.BackendError
 		if errors.As(err, &backendErr) {
 			log.Printf("search backend error: %v", backendErr)
@@ -61,6 +60,88 @@ func (h *SearchHandler) SearchProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	markDegraded(w, result.Degraded, result.DegradedSource)
+	responses.WriteJSON(w, http.StatusOK, result)
+}
+
+// parseSearchFilters reads the search parameters of GET /search/products.
+func parseSearchFilters(query url.Values) (services.SearchFilters, error) {
+	filters := services.SearchFilters{
+		Query:         strings.TrimSpace(query.Get("q")),
+		Tipo:          parseList(query["tipo"]),
+		Estacion:      parseList(query["estacion"]),
+		Ocasion:       parseList(query["ocasion"]),
+		Genero:        parseList(query["genero"]),
+		Marca:         parseList(query["marca"]),
+		Notas:         parseList(query["notas"]),
+		NotasMatch:    strings.TrimSpace(query.Get("notas_match")),
+		InStock:       strings.EqualFold(strings.TrimSpace(query.Get("in_stock")), "true"),
+		Concentracion: strings.TrimSpace(query.Get("concentracion")),
+		TamanoML:      parseInt(query.Get("tamano_ml"), 0),
+		Page:          parseInt(query.Get("page"), 1),
+		Size:          parseInt(query.Get("size"), 10),
+		AutoCorrect:   !strings.EqualFold(strings.TrimSpace(query.Get("autocorrect")), "false"),
+		Highlight:     strings.EqualFold(strings.TrimSpace(query.Get("highlight")), "true"),
+		HighlightTag:  query.Get("highlight_tag"),
+	}
+	if sortParam := strings.TrimSpace(query.Get("sort")); sortParam != "" {
+		filters.Sorts = parseSorts(sortParam)
+	}
+	filters.Facets = parseFacets(query.Get("facets"))
+	var err error
+	if filters.PrecioMin, err = parseFloat(query.Get("precio_min")); err != nil {
+		return filters, services.ValidationError{Message: "precio_min must be a number"}
+	}
+	if filters.PrecioMax, err = parseFloat(query.Get("precio_max")); err != nil {
+		return filters, services.ValidationError{Message: "precio_max must be a number"}
+	}
+	return filters, nil
+}
+
+// SimilarProducts handles GET /search/products/{id}/similar.
+func (h *SearchHandler) SimilarProducts(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/search/products/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "similar" {
+		responses.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Resource not found")
+		return
+	}
+
+	result, err := h.service.SimilarProducts(r.Context(), parts[0], parseInt(r.URL.Query().Get("limit"), 0))
+	if err != nil {
+		var valErr services.ValidationError
+		switch {
+		case errors.As(err, &valErr):
+			responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", valErr.Error())
+		case errors.Is(err, services.ErrProductNotFound):
+			responses.WriteError(w, http.StatusNotFound, "PRODUCT_NOT_FOUND", "Product not found")
+		default:
+			log.Printf("similar products: %v", err)
+			responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not find similar products")
+		}
+		return
+	}
+
+	markDegraded(w, result.Degraded, result.DegradedSource)
+	responses.WriteJSON(w, http.StatusOK, result)
+}
+
+// SuggestProducts handles GET /search/suggest with autocomplete suggestions
+// for the partial query q.
+func (h *SearchHandler) SuggestProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	result, err := h.service.Suggest(r.Context(), query.Get("q"), parseInt(query.Get("limit"), 0))
+	if err != nil {
+		var valErr services.ValidationError
+		if errors.As(err, &valErr) {
+			responses.WriteError(w, http.StatusBadRequest, "VALIDATION_ERROR", valErr.Error())
+			return
+		}
+		log.Printf("suggest products: %v", err)
+		responses.WriteError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Could not compute suggestions")
+		return
+	}
+
+	markDegraded(w, result.Degraded, result.DegradedSource)
 	responses.WriteJSON(w, http.StatusOK, result)
 }
 
@@ -91,6 +172,58 @@ func parseInt(value string, def int) int {
 	return parsed
 }
 
+// DegradedHeader is set on responses served while the search backend is
+// down, naming where they came from (services.DegradedStaleCache, ...).
+const DegradedHeader = "X-Search-Degraded"
+
+func markDegraded(w http.ResponseWriter, degraded bool, source string) {
+	if degraded {
+		w.Header().Set(DegradedHeader, source)
+	}
+}
+
+// parseFloat reads an optional finite number; an empty value is zero.
+func parseFloat(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", value)
+	}
+	return parsed, nil
+}
+
+// parseList reads a multi-value parameter given as comma-separated values,
+// repeated parameters or both: marca=dior,chanel or marca=dior&marca=chanel.
+func parseList(raw []string) []string {
+	var values []string
+	for _, item := range raw {
+		for _, value := range strings.Split(item, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// parseFacets reads a comma-separated facet list; "all" asks for every facet.
+func parseFacets(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	if strings.EqualFold(raw, "all") {
+		return append(append([]string{}, services.FacetFields...), services.FacetPrecio)
+	}
+	return strings.Split(raw, ",")
+}
+
 func parseSorts(raw string) []services.SortOption {
 	parts := strings.Split(raw, ",")
 	var result []services.SortOption
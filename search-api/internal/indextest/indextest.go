@@ -0,0 +1,336 @@
+// Package indextest is a contract test suite for services.IndexRepository
+// implementations, so every search backend behaves the same behind the
+// service.
+package indextest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"search-api/internal/models"
+	"search-api/internal/services"
+)
+
+// Run runs the contract against the repositories built by open, which must
+// return a new, empty index on each call.
+func Run(t *testing.T, open func(t *testing.T) services.IndexRepository) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo services.IndexRepository)
+	}{
+		{"VersionedWrites", testVersionedWrites},
+		{"Filters", testFilters},
+		{"SortAndPagination", testSortAndPagination},
+		{"Relevance", testRelevance},
+		{"Facets", testFacets},
+		{"Highlights", testHighlights},
+		{"Suggest", testSuggest},
+		{"SpellCheck", testSpellCheck},
+		{"Similar", testSimilar},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, open(t))
+		})
+	}
+}
+
+var baseTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// catalog is indexed by every test but VersionedWrites.
+var catalog = []models.ProductDocument{
+	{
+		ID: "p1", Name: "Rosa Imperial", Descripcion: "Un clasico floral para el dia",
+		Marca: "Dior", Tipo: "Floral", Estacion: "Primavera", Ocasion: "Dia", Genero: "Mujer",
+		Notas: []string{"Rosa", "Jazmin", "Almizcle"}, Precio: 45, Stock: 5,
+		Variantes: []models.ProductVariant{{SKU: "p1-50", TamanoML: 50, Concentracion: "EDP", Precio: 45, Stock: 5}},
+		UpdatedAt: baseTime.Add(1 * time.Hour), Version: 1,
+	},
+	{
+		ID: "p2", Name: "Bosque Nocturno", Descripcion: "Maderas oscuras con un toque de rosa",
+		Marca: "Armani", Tipo: "Amaderado", Estacion: "Invierno", Ocasion: "Noche", Genero: "Hombre",
+		Notas: []string{"Cedro", "Vainilla", "Ambar"}, Precio: 120, Stock: 0,
+		Variantes: []models.ProductVariant{{SKU: "p2-100", TamanoML: 100, Concentracion: "EDT", Precio: 120}},
+		UpdatedAt: baseTime.Add(2 * time.Hour), Version: 1,
+	},
+	{
+		ID: "p3", Name: "Jardin de Rosas", Descripcion: "Flores frescas y dulces",
+		Marca: "Chanel", Tipo: "Floral", Estacion: "Verano", Ocasion: "Dia", Genero: "Mujer",
+		Notas: []string{"Rosa", "Vainilla"}, Precio: 80, Stock: 3,
+		Variantes: []models.ProductVariant{{SKU: "p3-100", TamanoML: 100, Concentracion: "EDP", Precio: 80, Stock: 3}},
+		UpdatedAt: baseTime.Add(3 * time.Hour), Version: 1,
+	},
+	{
+		ID: "p4", Name: "Citrico Azul", Descripcion: "Frescura marina",
+		Marca: "Dior", Tipo: "Citrico", Estacion: "Verano", Ocasion: "Deporte", Genero: "Unisex",
+		Notas: []string{"Limon", "Bergamota"}, Precio: 250, Stock: 10,
+		Variantes: []models.ProductVariant{{SKU: "p4-50", TamanoML: 50, Concentracion: "EDT", Precio: 250, Stock: 10}},
+		UpdatedAt: baseTime.Add(4 * time.Hour), Version: 1,
+	},
+}
+
+func seed(t *testing.T, repo services.IndexRepository) {
+	t.Helper()
+	for _, product := range catalog {
+		if err := repo.IndexProduct(context.Background(), product, 0); err != nil {
+			t.Fatalf("index %s: %v", product.ID, err)
+		}
+	}
+}
+
+// search runs filters with the service defaults for paging.
+func search(t *testing.T, repo services.IndexRepository, filters services.SearchFilters) *services.SearchResult {
+	t.Helper()
+	if filters.Page == 0 {
+		filters.Page = 1
+	}
+	if filters.Size == 0 {
+		filters.Size = 10
+	}
+	if filters.NotasMatch == "" {
+		filters.NotasMatch = services.NotasMatchAny
+	}
+	result, err := repo.Search(context.Background(), filters)
+	if err != nil {
+		t.Fatalf("search %+v: %v", filters, err)
+	}
+	return result
+}
+
+func ids(products []models.ProductDocument) []string {
+	list := make([]string, len(products))
+	for i, product := range products {
+		list[i] = product.ID
+	}
+	return list
+}
+
+func sorted(list []string) []string {
+	list = slices.Clone(list)
+	slices.Sort(list)
+	return list
+}
+
+func testVersionedWrites(t *testing.T, repo services.IndexRepository) {
+	ctx := context.Background()
+	if _, found, err := repo.IndexedVersion(ctx, "p1"); err != nil || found {
+		t.Fatalf("expected p1 to be absent, got found=%t err=%v", found, err)
+	}
+
+	product := catalog[0]
+	if err := repo.IndexProduct(ctx, product, services.RevisionAbsent); err != nil {
+		t.Fatalf("create p1: %v", err)
+	}
+	if err := repo.IndexProduct(ctx, product, services.RevisionAbsent); !errors.Is(err, services.ErrRevisionConflict) {
+		t.Fatalf("expected creating p1 twice to conflict, got %v", err)
+	}
+	state, found, err := repo.IndexedVersion(ctx, "p1")
+	if err != nil || !found || state.Version != 1 || state.Tombstone || state.Revision <= 0 {
+		t.Fatalf("unexpected state after create: %+v found=%t err=%v", state, found, err)
+	}
+
+	product.Version = 2
+	if err := repo.IndexProduct(ctx, product, state.Revision); err != nil {
+		t.Fatalf("update p1 at its revision: %v", err)
+	}
+	product.Version = 3
+	if err := repo.IndexProduct(ctx, product, state.Revision); !errors.Is(err, services.ErrRevisionConflict) {
+		t.Fatalf("expected update at a stale revision to conflict, got %v", err)
+	}
+
+	updated, _, err := repo.IndexedVersion(ctx, "p1")
+	if err != nil || updated.Version != 2 {
+		t.Fatalf("expected version 2, got %+v err=%v", updated, err)
+	}
+	if err := repo.DeleteProduct(ctx, "p1", 4, updated.Revision); err != nil {
+		t.Fatalf("delete p1: %v", err)
+	}
+	deleted, found, err := repo.IndexedVersion(ctx, "p1")
+	if err != nil || !found || !deleted.Tombstone || deleted.Version != 4 {
+		t.Fatalf("expected a tombstone at version 4, got %+v found=%t err=%v", deleted, found, err)
+	}
+	if result := search(t, repo, services.SearchFilters{}); result.Total != 0 {
+		t.Fatalf("expected tombstones to be hidden from search, got %v", ids(result.Items))
+	}
+}
+
+func testFilters(t *testing.T, repo services.IndexRepository) {
+	seed(t, repo)
+	tests := []struct {
+		name    string
+		filters services.SearchFilters
+		want    []string
+	}{
+		{"tipo", services.SearchFilters{Tipo: []string{"floral"}}, []string{"p1", "p3"}},
+		{"tipo any of", services.SearchFilters{Tipo: []string{"floral", "citrico"}}, []string{"p1", "p3", "p4"}},
+		{"marca", services.SearchFilters{Marca: []string{"dior"}}, []string{"p1", "p4"}},
+		{"notas any", services.SearchFilters{Notas: []string{"rosa", "vainilla"}}, []string{"p1", "p2", "p3"}},
+		{"notas all", services.SearchFilters{Notas: []string{"rosa", "vainilla"}, NotasMatch: services.NotasMatchAll}, []string{"p3"}},
+		{"precio range", services.SearchFilters{PrecioMin: 50, PrecioMax: 150}, []string{"p2", "p3"}},
+		{"precio min", services.SearchFilters{PrecioMin: 100}, []string{"p2", "p4"}},
+		{"in stock", services.SearchFilters{InStock: true}, []string{"p1", "p3", "p4"}},
+		{"concentracion", services.SearchFilters{Concentracion: "edp"}, []string{"p1", "p3"}},
+		{"tamano", services.SearchFilters{TamanoML: 100}, []string{"p2", "p3"}},
+		{"combined", services.SearchFilters{Tipo: []string{"floral"}, Estacion: []string{"verano"}}, []string{"p3"}},
+	}
+	for _, tt := range tests {
+		got := sorted(ids(search(t, repo, tt.filters).Items))
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func testSortAndPagination(t *testing.T, repo services.IndexRepository) {
+	seed(t, repo)
+	if got := ids(search(t, repo, services.SearchFilters{}).Items); !slices.Equal(got, []string{"p4", "p3", "p2", "p1"}) {
+		t.Fatalf("expected newest first by default, got %v", got)
+	}
+
+	byPrice := []services.SortOption{{Field: "precio"}}
+	first := search(t, repo, services.SearchFilters{Sorts: byPrice, Page: 1, Size: 2})
+	second := search(t, repo, services.SearchFilters{Sorts: byPrice, Page: 2, Size: 2})
+	if first.Total != 4 || second.Total != 4 {
+		t.Fatalf("expected a total of 4 on every page, got %d and %d", first.Total, second.Total)
+	}
+	if got := append(ids(first.Items), ids(second.Items)...); !slices.Equal(got, []string{"p1", "p3", "p2", "p4"}) {
+		t.Fatalf("expected pages ordered by precio, got %v", got)
+	}
+	if got := ids(search(t, repo, services.SearchFilters{Sorts: []services.SortOption{{Field: "stock", Desc: true}}}).Items); !slices.Equal(got, []string{"p4", "p1", "p3", "p2"}) {
+		t.Fatalf("expected products ordered by stock desc, got %v", got)
+	}
+	if past := search(t, repo, services.SearchFilters{Page: 3, Size: 2}); len(past.Items) != 0 || past.Total != 4 {
+		t.Fatalf("expected an empty page past the end, got %v (total %d)", ids(past.Items), past.Total)
+	}
+}
+
+func testRelevance(t *testing.T, repo services.IndexRepository) {
+	seed(t, repo)
+	relevance := []services.SortOption{{Field: services.SortRelevance, Desc: true}}
+
+	result := search(t, repo, services.SearchFilters{Query: "rosas", Sorts: relevance})
+	got := ids(result.Items)
+	if result.Total != 3 || len(got) != 3 {
+		t.Fatalf("expected the stemmed query to match 3 products, got %v", got)
+	}
+	if got[2] != "p2" {
+		t.Fatalf("expected the description match to rank last, got %v", got)
+	}
+
+	if got := ids(search(t, repo, services.SearchFilters{Query: "rosa imperial", Sorts: relevance}).Items); !slices.Equal(got, []string{"p1"}) {
+		t.Fatalf("expected short queries to require every word, got %v", got)
+	}
+	if got := ids(search(t, repo, services.SearchFilters{Query: "jardín", Sorts: relevance}).Items); !slices.Equal(got, []string{"p3"}) {
+		t.Fatalf("expected accents to be ignored, got %v", got)
+	}
+	if got := ids(search(t, repo, services.SearchFilters{Query: "rosa", Tipo: []string{"amaderado"}, Sorts: relevance}).Items); !slices.Equal(got, []string{"p2"}) {
+		t.Fatalf("expected filters to apply to text queries, got %v", got)
+	}
+}
+
+func testFacets(t *testing.T, repo services.IndexRepository) {
+	seed(t, repo)
+	result := search(t, repo, services.SearchFilters{
+		Tipo:   []string{"floral"},
+		Facets: []string{"tipo", "marca", services.FacetPrecio},
+	})
+	if result.Total != 2 {
+		t.Fatalf("expected 2 floral products, got %d", result.Total)
+	}
+	if got := facetMap(result.Facets["tipo"]); len(got) != 3 || got["Floral"] != 2 || got["Amaderado"] != 1 || got["Citrico"] != 1 {
+		t.Fatalf("expected the tipo facet to ignore its own filter, got %v", got)
+	}
+	if got := facetMap(result.Facets["marca"]); len(got) != 2 || got["Dior"] != 1 || got["Chanel"] != 1 {
+		t.Fatalf("expected the marca facet to count floral products, got %v", got)
+	}
+	precio := result.Facets[services.FacetPrecio]
+	if got := facetMap(precio); len(got) != 2 || got["0-50"] != 1 || got["50-100"] != 1 {
+		t.Fatalf("expected non-empty price buckets only, got %v", got)
+	}
+	if precio[0].From == nil || *precio[0].From != 0 || precio[0].To == nil || *precio[0].To != 50 {
+		t.Fatalf("expected price buckets to carry their bounds, got %+v", precio[0])
+	}
+}
+
+func facetMap(counts []services.FacetCount) map[string]int64 {
+	values := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		values[count.Value] = count.Count
+	}
+	return values
+}
+
+func testHighlights(t *testing.T, repo services.IndexRepository) {
+	seed(t, repo)
+	result := search(t, repo, services.SearchFilters{Query: "rosa", Highlight: true, HighlightTag: "mark"})
+	name := result.Highlights["p1"]["name"]
+	if len(name) == 0 || !strings.Contains(name[0], "<mark>Rosa</mark>") {
+		t.Fatalf("expected the name of p1 to be highlighted, got %v", result.Highlights["p1"])
+	}
+	if fragments := result.Highlights["p2"]["descripcion"]; len(fragments) == 0 || !strings.Contains(fragments[0], "<mark>rosa</mark>") {
+		t.Fatalf("expected the description of p2 to be highlighted, got %v", result.Highlights["p2"])
+	}
+	if plain := search(t, repo, services.SearchFilters{Query: "rosa"}); plain.Highlights != nil {
+		t.Fatalf("expected no highlights unless requested, got %v", plain.Highlights)
+	}
+}
+
+func testSuggest(t *testing.T, repo services.IndexRepository) {
+	seed(t, repo)
+	candidates, err := repo.Suggest(context.Background(), "jar ros", 5)
+	if err != nil {
+		t.Fatalf("suggest: %v", err)
+	}
+	if got := ids(candidates.Products); !slices.Equal(got, []string{"p3"}) {
+		t.Fatalf("expected every word to match a prefix, got %v", got)
+	}
+
+	candidates, err = repo.Suggest(context.Background(), "dio", 5)
+	if err != nil {
+		t.Fatalf("suggest: %v", err)
+	}
+	if got := sorted(ids(candidates.Products)); !slices.Equal(got, []string{"p1", "p4"}) {
+		t.Fatalf("expected the Dior products, got %v", got)
+	}
+	if got := facetMap(candidates.Brands); got["Dior"] != 2 {
+		t.Fatalf("expected Dior to be counted twice, got %v", got)
+	}
+}
+
+func testSpellCheck(t *testing.T, repo services.IndexRepository) {
+	seed(t, repo)
+	collations, err := repo.SpellCheck(context.Background(), services.SearchFilters{Query: "vainila", Page: 1, Size: 10})
+	if err != nil {
+		t.Fatalf("spellcheck: %v", err)
+	}
+	if len(collations) == 0 || collations[0].Query != "vainilla" || collations[0].Hits != 2 {
+		t.Fatalf("expected vainilla with 2 hits first, got %+v", collations)
+	}
+
+	collations, err = repo.SpellCheck(context.Background(), services.SearchFilters{Query: "vainila", Tipo: []string{"citrico"}, Page: 1, Size: 10})
+	if err != nil {
+		t.Fatalf("spellcheck: %v", err)
+	}
+	if len(collations) != 0 {
+		t.Fatalf("expected corrections without hits under the filters to be dropped, got %+v", collations)
+	}
+}
+
+func testSimilar(t *testing.T, repo services.IndexRepository) {
+	seed(t, repo)
+	similar, err := repo.Similar(context.Background(), "p3", 5)
+	if err != nil {
+		t.Fatalf("similar: %v", err)
+	}
+	got := ids(similar)
+	if len(got) == 0 || got[0] != "p1" {
+		t.Fatalf("expected p1, sharing notes and tipo, first; got %v", got)
+	}
+	if slices.Contains(got, "p3") || slices.Contains(got, "p2") {
+		t.Fatalf("expected the product itself and out-of-stock products to be skipped, got %v", got)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"sync"
 	"time"
 
+	"events"
 	"search-api/internal/models"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -21,8 +24,32 @@ const (
 	EventProductDeleted = "product.deleted"
 )
 
-// ProductEvent captures information flowing through RabbitMQ.
+const (
+	headerAttempts   = "x-attempts"
+	headerRoutingKey = "x-original-routing-key"
+	headerLastError  = "x-last-error"
+	headerDeadReason = "x-dead-reason"
+	headerDeadAt     = "x-dead-at"
+
+	// DeadReasonPoison marks messages that could not be decoded.
+	DeadReasonPoison = "poison"
+	// DeadReasonMaxAttempts marks messages whose handler kept failing.
+	DeadReasonMaxAttempts = "max_attempts"
+
+	defaultWorkers        = 4
+	defaultPrefetch       = 32
+	defaultMaxAttempts    = 5
+	defaultRetryBaseDelay = time.Second
+	maxRetryDelay         = 5 * time.Minute
+	maxErrorHeaderLength  = 512
+	publishTimeout        = 10 * time.Second
+)
+
+// ProductEvent captures information flowing through RabbitMQ. ID is the
+// publisher's message id, stable across redeliveries; Product.Version orders
+// events of the same product.
 type ProductEvent struct {
+	ID      string
 	Type    string
 	Product models.ProductDocument
 }
@@ -37,15 +64,46 @@ type ConsumerConfig struct {
 	URL      string
 	Exchange string
 	Queue    string
+	// MaxAttempts is how many times a message is handled before it is dead-lettered.
+	MaxAttempts int
+	// RetryBaseDelay is the wait before the first retry; it doubles on each attempt.
+	RetryBaseDelay time.Duration
+	// Workers is how many events are handled concurrently.
+	Workers int
+	// Prefetch caps the unacknowledged messages delivered to the consumer.
+	Prefetch int
 }
 
 // Consumer consumes product events and forwards them to an EventHandler.
+// Failed messages are retried through delay queues with exponential backoff
+// and moved to a dead-letter queue once MaxAttempts is reached; messages that
+// cannot be decoded are dead-lettered right away.
 type Consumer struct {
 	conn     *amqp.Connection
 	channel  *amqp.Channel
 	queue    string
 	exchange string
 	handler  EventHandler
+
+	// control is a confirm-mode channel used to republish retries and dead
+	// letters and to serve the dead-letter admin operations; controlMu
+	// serializes its use.
+	control   *amqp.Channel
+	controlMu sync.Mutex
+	publisher messagePublisher
+
+	workers         int
+	prefetch        int
+	maxAttempts     int
+	retryDelays     []time.Duration
+	deadExchange    string
+	deadQueue       string
+	retryQueueNames []string
+}
+
+// messagePublisher publishes a message and waits for the broker to confirm it.
+type messagePublisher interface {
+	publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error
 }
 
 // NewConsumer connects to RabbitMQ, declares exchange/queue/bindings and returns a Consumer.
@@ -83,21 +141,138 @@ func NewConsumer(cfg ConsumerConfig, handler EventHandler) (*Consumer, error) {
 		}
 	}
 
-	return &Consumer{
-		conn:     conn,
-		channel:  ch,
-		queue:    queue.Name,
-		exchange: cfg.Exchange,
-		handler:  handler,
-	}, nil
+	c := newConsumer(cfg, handler)
+	c.conn = conn
+	c.channel = ch
+	c.queue = queue.Name
+	if err := c.declareRetryTopology(); err != nil {
+		_ = ch.Close()
+		_ = conn.Close()
+		return nil, err
+	}
+
+	control, err := conn.Channel()
+	if err != nil {
+		_ = ch.Close()
+		_ = conn.Close()
+		return nil, fmt.Errorf("create control channel: %w", err)
+	}
+	if err := control.Confirm(false); err != nil {
+		_ = ch.Close()
+		_ = conn.Close()
+		return nil, fmt.Errorf("enable publisher confirms: %w", err)
+	}
+	c.control = control
+	c.publisher = &confirmPublisher{channel: control}
+
+	return c, nil
+}
+
+// newConsumer applies the retry and concurrency settings without touching the broker.
+func newConsumer(cfg ConsumerConfig, handler EventHandler) *Consumer {
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	base := cfg.RetryBaseDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	prefetch := cfg.Prefetch
+	if prefetch <= 0 {
+		prefetch = defaultPrefetch
+	}
+
+	c := &Consumer{
+		queue:        cfg.Queue,
+		exchange:     cfg.Exchange,
+		handler:      handler,
+		workers:      workers,
+		prefetch:     max(prefetch, workers),
+		maxAttempts:  maxAttempts,
+		deadExchange: cfg.Queue + ".dlx",
+		deadQueue:    cfg.Queue + ".dlq",
+	}
+	for attempt := 1; attempt < maxAttempts; attempt++ {
+		delay := retryDelay(base, attempt)
+		c.retryDelays = append(c.retryDelays, delay)
+		c.retryQueueNames = append(c.retryQueueNames, fmt.Sprintf("%s.retry.%dms", cfg.Queue, delay.Milliseconds()))
+	}
+	return c
+}
+
+// declareRetryTopology declares one delay queue per retry level and the
+// dead-letter exchange and queue. Delay queues have no consumers: messages
+// expire after the queue TTL and RabbitMQ dead-letters them back to the main
+// queue through the default exchange. The delay is part of the queue name so
+// changing the retry settings never conflicts with existing queue arguments.
+func (c *Consumer) declareRetryTopology() error {
+	for i, name := range c.retryQueueNames {
+		args := amqp.Table{
+			"x-message-ttl":             c.retryDelays[i].Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": c.queue,
+		}
+		if _, err := c.channel.QueueDeclare(name, true, false, false, false, args); err != nil {
+			return fmt.Errorf("declare retry queue %s: %w", name, err)
+		}
+	}
+
+	if err := c.channel.ExchangeDeclare(c.deadExchange, "fanout", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare dead-letter exchange: %w", err)
+	}
+	if _, err := c.channel.QueueDeclare(c.deadQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare dead-letter queue: %w", err)
+	}
+	if err := c.channel.QueueBind(c.deadQueue, "", c.deadExchange, false, nil); err != nil {
+		return fmt.Errorf("bind dead-letter queue: %w", err)
+	}
+	return nil
 }
 
-// Start begins consuming messages until the context is canceled or the channel closes.
+// Start begins consuming messages until the context is canceled or the
+// channel closes. Deliveries are spread over the worker pool; on shutdown the
+// messages already handed to workers are processed before Start returns.
 func (c *Consumer) Start(ctx context.Context) error {
+	if err := c.channel.Qos(c.prefetch, 0, false); err != nil {
+		return fmt.Errorf("set prefetch: %w", err)
+	}
 	msgs, err := c.channel.Consume(c.queue, "", false, false, false, false, nil)
 	if err != nil {
 		return fmt.Errorf("consume: %w", err)
 	}
+	return c.consume(ctx, msgs)
+}
+
+// consume dispatches deliveries to workers sharded by product id, so events
+// of one product are handled in arrival order while different products are
+// indexed concurrently.
+func (c *Consumer) consume(ctx context.Context, msgs <-chan amqp.Delivery) error {
+	// In-flight events finish even after ctx is canceled.
+	handlerCtx := context.WithoutCancel(ctx)
+
+	shards := make([]chan delivery, c.workers)
+	var wg sync.WaitGroup
+	for i := range shards {
+		shards[i] = make(chan delivery, c.prefetch)
+		wg.Add(1)
+		go func(jobs <-chan delivery) {
+			defer wg.Done()
+			for job := range jobs {
+				c.handle(handlerCtx, job)
+			}
+		}(shards[i])
+	}
+	defer func() {
+		for _, shard := range shards {
+			close(shard)
+		}
+		wg.Wait()
+	}()
 
 	for {
 		select {
@@ -107,25 +282,116 @@ func (c *Consumer) Start(ctx context.Context) error {
 			if !ok {
 				return fmt.Errorf("channel closed")
 			}
-
-			event, err := decodeProductEvent(msg.RoutingKey, msg.Body)
-			if err != nil {
-				log.Printf("skip message (decode error): %v", err)
-				_ = msg.Ack(false)
+			job, ok := c.decode(msg)
+			if !ok {
 				continue
 			}
-
-			if err := c.handler.HandleProductEvent(ctx, event); err != nil {
-				log.Printf("handler error: %v", err)
+			// A busy shard must not hold up shutdown; the broker redelivers
+			// the requeued message to the next consumer.
+			select {
+			case shards[shardFor(job.event.Product.ID, len(shards))] <- job:
+			case <-ctx.Done():
+				_ = msg.Nack(false, true)
+				return ctx.Err()
 			}
-
-			_ = msg.Ack(false)
 		}
 	}
 }
 
+// delivery is a decoded message waiting for a worker.
+type delivery struct {
+	msg        amqp.Delivery
+	routingKey string
+	event      ProductEvent
+}
+
+// decode parses a message; undecodable (poison) messages are dead-lettered
+// right away and reported as not ok.
+func (c *Consumer) decode(msg amqp.Delivery) (delivery, bool) {
+	routingKey := originalRoutingKey(msg)
+	event, err := decodeProductEvent(routingKey, msg.Body)
+	if err != nil {
+		log.Printf("dead-letter poison message %s: %v", msg.MessageId, err)
+		c.settle(msg, c.deadLetter(msg, routingKey, DeadReasonPoison, err))
+		return delivery{}, false
+	}
+	if event.ID == "" {
+		event.ID = msg.MessageId
+	}
+	return delivery{msg: msg, routingKey: routingKey, event: event}, true
+}
+
+// handle runs the handler and settles the message: ack on success, republish
+// to a delay queue on failure, or move it to the dead-letter queue once it is
+// out of attempts. The original is acked only after the republish was
+// confirmed, so a broker failure leaves it in the queue.
+func (c *Consumer) handle(ctx context.Context, job delivery) {
+	msg, routingKey, event := job.msg, job.routingKey, job.event
+	err := c.handler.HandleProductEvent(ctx, event)
+	if err == nil {
+		_ = msg.Ack(false)
+		return
+	}
+
+	attempts := headerInt(msg.Headers, headerAttempts) + 1
+	if attempts >= c.maxAttempts {
+		log.Printf("dead-letter %s for product %s after %d attempts: %v", routingKey, event.Product.ID, attempts, err)
+		c.settle(msg, c.deadLetter(msg, routingKey, DeadReasonMaxAttempts, err))
+		return
+	}
+	log.Printf("retry %s for product %s in %s (attempt %d): %v", routingKey, event.Product.ID, c.retryDelays[attempts-1], attempts, err)
+	c.settle(msg, c.retry(msg, routingKey, attempts, err))
+}
+
+func (c *Consumer) retry(msg amqp.Delivery, routingKey string, attempts int, cause error) error {
+	headers := copyHeaders(msg.Headers)
+	headers[headerAttempts] = int32(attempts)
+	headers[headerRoutingKey] = routingKey
+	headers[headerLastError] = truncate(cause.Error(), maxErrorHeaderLength)
+	return c.republish("", c.retryQueueNames[attempts-1], msg, headers)
+}
+
+func (c *Consumer) deadLetter(msg amqp.Delivery, routingKey, reason string, cause error) error {
+	headers := copyHeaders(msg.Headers)
+	headers[headerAttempts] = int32(headerInt(msg.Headers, headerAttempts) + 1)
+	headers[headerRoutingKey] = routingKey
+	headers[headerLastError] = truncate(cause.Error(), maxErrorHeaderLength)
+	headers[headerDeadReason] = reason
+	headers[headerDeadAt] = time.Now().UTC().Format(time.RFC3339)
+	return c.republish(c.deadExchange, "", msg, headers)
+}
+
+func (c *Consumer) republish(exchange, key string, msg amqp.Delivery, headers amqp.Table) error {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	return c.publisher.publish(ctx, exchange, key, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  msg.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.MessageId,
+		Timestamp:    msg.Timestamp,
+		Body:         msg.Body,
+	})
+}
+
+// settle acks the original once its copy was republished, or requeues it.
+func (c *Consumer) settle(msg amqp.Delivery, republishErr error) {
+	if republishErr != nil {
+		log.Printf("republish message %s: %v", msg.MessageId, republishErr)
+		_ = msg.Nack(false, true)
+		return
+	}
+	_ = msg.Ack(false)
+}
+
 // Close releases underlying AMQP resources.
 func (c *Consumer) Close() {
+	if c.control != nil {
+		_ = c.control.Close()
+	}
 	if c.channel != nil {
 		_ = c.channel.Close()
 	}
@@ -134,7 +400,102 @@ func (c *Consumer) Close() {
 	}
 }
 
+// confirmPublisher publishes on a confirm-mode channel. Callers must not
+// share the channel concurrently.
+type confirmPublisher struct {
+	channel *amqp.Channel
+}
+
+func (p *confirmPublisher) publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	confirmation, err := p.channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("wait confirm: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("message nacked by broker")
+	}
+	return nil
+}
+
+// shardFor maps a product id to a worker.
+func shardFor(productID string, shards int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(productID))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// retryDelay doubles base for every attempt after the first, up to maxRetryDelay.
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// originalRoutingKey returns the key the event was first published with;
+// retried and replayed messages arrive with the queue name as routing key.
+func originalRoutingKey(msg amqp.Delivery) string {
+	if key, ok := msg.Headers[headerRoutingKey].(string); ok && key != "" {
+		return key
+	}
+	return msg.RoutingKey
+}
+
+func headerInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int:
+		return v
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	out := make(amqp.Table, len(headers)+4)
+	for key, value := range headers {
+		// x-death grows on every pass through a delay queue; the attempt
+		// counter already carries what we need.
+		if key == "x-death" {
+			continue
+		}
+		out[key] = value
+	}
+	return out
+}
+
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return value[:limit]
+}
+
+// decodeProductEvent reads both enveloped (v1) events and the legacy bare
+// product payload. The envelope is validated against its data schema and its
+// type wins over the routing key.
 func decodeProductEvent(routingKey string, body []byte) (ProductEvent, error) {
+	var eventID string
+	if events.IsEnvelope(body) {
+		envelope, err := events.Decode(body)
+		if err != nil {
+			return ProductEvent{}, err
+		}
+		eventID, routingKey, body = envelope.ID, envelope.Type, envelope.Data
+	}
+
 	eventType, err := normalizeRoutingKey(routingKey)
 	if err != nil {
 		return ProductEvent{}, err
@@ -146,6 +507,7 @@ func decodeProductEvent(routingKey string, body []byte) (ProductEvent, error) {
 	}
 
 	event := ProductEvent{
+		ID:   eventID,
 		Type: eventType,
 		Product: models.ProductDocument{
 			ID:          payload.ID,
@@ -153,6 +515,7 @@ func decodeProductEvent(routingKey string, body []byte) (ProductEvent, error) {
 			Descripcion: payload.Descripcion,
 			Precio:      payload.Precio,
 			Stock:       payload.Stock,
+			Variantes:   payload.Variantes,
 			Tipo:        payload.Tipo,
 			Estacion:    payload.Estacion,
 			Ocasion:     payload.Ocasion,
@@ -160,6 +523,7 @@ func decodeProductEvent(routingKey string, body []byte) (ProductEvent, error) {
 			Genero:      payload.Genero,
 			Marca:       payload.Marca,
 			Imagen:      payload.Imagen,
+			Version:     payload.Version,
 		},
 	}
 
@@ -183,18 +547,20 @@ func normalizeRoutingKey(routingKey string) (string, error) {
 }
 
 type productMessage struct {
-	ID          string     `json:"id"`
-	Name        string     `json:"name"`
-	Descripcion string     `json:"descripcion"`
-	Precio      float64    `json:"precio"`
-	Stock       int        `json:"stock"`
-	Tipo        string     `json:"tipo"`
-	Estacion    string     `json:"estacion"`
-	Ocasion     string     `json:"ocasion"`
-	Notas       []string   `json:"notas"`
-	Genero      string     `json:"genero"`
-	Marca       string     `json:"marca"`
-	Imagen      string     `json:"imagen"`
-	CreatedAt   *time.Time `json:"created_at,omitempty"`
-	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	ID          string                  `json:"id"`
+	Name        string                  `json:"name"`
+	Descripcion string                  `json:"descripcion"`
+	Precio      float64                 `json:"precio"`
+	Stock       int                     `json:"stock"`
+	Variantes   []models.ProductVariant `json:"variantes"`
+	Tipo        string                  `json:"tipo"`
+	Estacion    string                  `json:"estacion"`
+	Ocasion     string                  `json:"ocasion"`
+	Notas       []string                `json:"notas"`
+	Genero      string                  `json:"genero"`
+	Marca       string                  `json:"marca"`
+	Imagen      string                  `json:"imagen"`
+	CreatedAt   *time.Time              `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time              `json:"updated_at,omitempty"`
+	Version     int64                   `json:"version"`
 }
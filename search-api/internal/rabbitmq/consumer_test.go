@@ -0,0 +1,378 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"events"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestProcessRetriesWithBackoffThenDeadLetters(t *testing.T) {
+	handler := &fakeHandler{err: errors.New("solr down")}
+	publisher := &fakePublisher{}
+	consumer := newConsumer(ConsumerConfig{Queue: "search", MaxAttempts: 3, RetryBaseDelay: time.Second}, handler)
+	consumer.publisher = publisher
+
+	acks := &fakeAcknowledger{}
+	process(consumer, newDelivery(acks, EventProductUpdated, `{"id":"p1"}`, nil))
+
+	if acks.acked != 1 || len(publisher.sent) != 1 {
+		t.Fatalf("expected the failed message to be republished and acked, got %+v", acks)
+	}
+	retry := publisher.sent[0]
+	if retry.exchange != "" || retry.key != "search.retry.1000ms" {
+		t.Fatalf("expected first retry to go to the 1s delay queue, got %s/%s", retry.exchange, retry.key)
+	}
+	if headerInt(retry.msg.Headers, headerAttempts) != 1 || retry.msg.Headers[headerRoutingKey] != EventProductUpdated {
+		t.Fatalf("expected attempt and routing key headers, got %v", retry.msg.Headers)
+	}
+
+	// The delay queue dead-letters the copy back with the queue name as routing key.
+	process(consumer, newDelivery(acks, "search", `{"id":"p1"}`, retry.msg.Headers))
+	second := publisher.sent[1]
+	if second.key != "search.retry.2000ms" || headerInt(second.msg.Headers, headerAttempts) != 2 {
+		t.Fatalf("expected second retry to double the delay, got %s attempts=%d", second.key, headerInt(second.msg.Headers, headerAttempts))
+	}
+	if handler.events[1].Type != EventProductUpdated {
+		t.Fatalf("expected retried event to keep its original type, got %s", handler.events[1].Type)
+	}
+
+	process(consumer, newDelivery(acks, "search", `{"id":"p1"}`, second.msg.Headers))
+	dead := publisher.sent[2]
+	if dead.exchange != "search.dlx" || dead.msg.Headers[headerDeadReason] != DeadReasonMaxAttempts {
+		t.Fatalf("expected message to be dead-lettered after 3 attempts, got %s %v", dead.exchange, dead.msg.Headers)
+	}
+	if dead.msg.Headers[headerLastError] != "solr down" {
+		t.Fatalf("expected last error header, got %v", dead.msg.Headers[headerLastError])
+	}
+	if acks.acked != 3 || acks.requeued != 0 {
+		t.Fatalf("expected every delivery to be acked once, got %+v", acks)
+	}
+}
+
+func TestProcessDeadLettersPoisonMessages(t *testing.T) {
+	handler := &fakeHandler{}
+	publisher := &fakePublisher{}
+	consumer := newConsumer(ConsumerConfig{Queue: "search"}, handler)
+	consumer.publisher = publisher
+
+	acks := &fakeAcknowledger{}
+	process(consumer, newDelivery(acks, EventProductCreated, `{not json`, nil))
+
+	if len(handler.events) != 0 {
+		t.Fatalf("expected poison message not to reach the handler")
+	}
+	if len(publisher.sent) != 1 || publisher.sent[0].msg.Headers[headerDeadReason] != DeadReasonPoison {
+		t.Fatalf("expected poison message to be dead-lettered, got %+v", publisher.sent)
+	}
+	letter := toDeadLetter(amqp.Delivery{Headers: publisher.sent[0].msg.Headers, Body: publisher.sent[0].msg.Body})
+	if letter.RawBody != "{not json" || letter.RoutingKey != EventProductCreated || letter.DeadAt == nil {
+		t.Fatalf("unexpected dead letter view: %+v", letter)
+	}
+}
+
+func TestProcessRequeuesWhenRepublishFails(t *testing.T) {
+	consumer := newConsumer(ConsumerConfig{Queue: "search"}, &fakeHandler{err: errors.New("solr down")})
+	consumer.publisher = &fakePublisher{err: errors.New("channel closed")}
+
+	acks := &fakeAcknowledger{}
+	process(consumer, newDelivery(acks, EventProductDeleted, `{"id":"p1"}`, nil))
+
+	if acks.acked != 0 || acks.requeued != 1 {
+		t.Fatalf("expected message to be requeued when the retry could not be published, got %+v", acks)
+	}
+}
+
+func TestRetryDelayIsCapped(t *testing.T) {
+	if retryDelay(time.Second, 1) != time.Second || retryDelay(time.Second, 3) != 4*time.Second {
+		t.Fatalf("expected exponential delays")
+	}
+	if retryDelay(time.Second, 30) != maxRetryDelay {
+		t.Fatalf("expected delay to be capped")
+	}
+}
+
+func TestConsumePreservesPerProductOrderAcrossWorkers(t *testing.T) {
+	handler := &fakeHandler{delay: time.Millisecond}
+	consumer := newConsumer(ConsumerConfig{Queue: "search", Workers: 4, Prefetch: 64}, handler)
+	consumer.publisher = &fakePublisher{}
+
+	acks := &fakeAcknowledger{}
+	msgs := make(chan amqp.Delivery, 64)
+	products := []string{"p1", "p2", "p3", "p4", "p5", "p6"}
+	for i := 0; i < 5; i++ {
+		for _, id := range products {
+			body := fmt.Sprintf(`{"id":%q,"stock":%d}`, id, i)
+			msgs <- newDelivery(acks, EventProductUpdated, body, nil)
+		}
+	}
+	close(msgs)
+
+	if err := consumer.consume(context.Background(), msgs); err == nil {
+		t.Fatalf("expected consume to report the closed channel")
+	}
+	if acks.count() != 30 {
+		t.Fatalf("expected all 30 messages acked, got %d", acks.count())
+	}
+	for _, id := range products {
+		stocks := handler.stocksFor(id)
+		if len(stocks) != 5 {
+			t.Fatalf("expected 5 events for %s, got %v", id, stocks)
+		}
+		for i, stock := range stocks {
+			if stock != i {
+				t.Fatalf("expected events of %s in order, got %v", id, stocks)
+			}
+		}
+	}
+	if handler.maxConcurrent < 2 {
+		t.Fatalf("expected events of different products to run concurrently")
+	}
+}
+
+func TestConsumeDrainsDispatchedMessagesOnShutdown(t *testing.T) {
+	release := make(chan struct{})
+	handler := &fakeHandler{block: release}
+	consumer := newConsumer(ConsumerConfig{Queue: "search", Workers: 2, Prefetch: 8}, handler)
+	consumer.publisher = &fakePublisher{}
+
+	acks := &fakeAcknowledger{}
+	msgs := make(chan amqp.Delivery, 8)
+	for i := 0; i < 4; i++ {
+		msgs <- newDelivery(acks, EventProductUpdated, fmt.Sprintf(`{"id":"p%d"}`, i), nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.consume(ctx, msgs) }()
+
+	for len(msgs) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+		t.Fatalf("expected consume to wait for in-flight events")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if acks.count() != 4 {
+		t.Fatalf("expected dispatched messages to be acked before returning, got %d", acks.count())
+	}
+}
+
+func TestConsumeRequeuesMessagesBlockedOnABusyShardAtShutdown(t *testing.T) {
+	release := make(chan struct{})
+	handler := &fakeHandler{block: release}
+	consumer := newConsumer(ConsumerConfig{Queue: "search", Workers: 1, Prefetch: 1}, handler)
+	consumer.publisher = &fakePublisher{}
+
+	// The worker holds the first message and the shard buffers the second,
+	// so dispatching the third blocks.
+	acks := &fakeAcknowledger{}
+	msgs := make(chan amqp.Delivery, 3)
+	for i := 0; i < 3; i++ {
+		msgs <- newDelivery(acks, EventProductUpdated, `{"id":"p1"}`, nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.consume(ctx, msgs) }()
+
+	for len(msgs) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	for acks.requeuedCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if acks.count() != 2 || acks.requeuedCount() != 1 {
+		t.Fatalf("expected 2 handled messages and 1 requeued, got %d and %d", acks.count(), acks.requeuedCount())
+	}
+}
+
+func TestDecodeReadsEnvelopedAndLegacyEvents(t *testing.T) {
+	data := map[string]interface{}{
+		"id":         "65f1c0ffee0000000000abcd",
+		"name":       "Luna",
+		"precio":     50,
+		"stock":      3,
+		"variantes":  []map[string]interface{}{{"sku": "LUNA-50", "precio": 50, "stock": 3}},
+		"created_at": time.Now().UTC(),
+		"updated_at": time.Now().UTC(),
+		"version":    7,
+	}
+	body, err := events.New("evt-1", EventProductUpdated, "65f1c0ffee0000000000abcd", events.SchemaProductV1, time.Now(), data)
+	if err != nil {
+		t.Fatalf("build envelope: %v", err)
+	}
+
+	// The envelope type is authoritative, even for replayed messages whose
+	// routing key is the queue name.
+	event, err := decodeProductEvent("search", body)
+	if err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	if event.ID != "evt-1" || event.Type != EventProductUpdated || event.Product.Version != 7 || event.Product.Name != "Luna" {
+		t.Fatalf("unexpected event from envelope: %+v", event)
+	}
+
+	legacy, err := decodeProductEvent(EventProductDeleted, []byte(`{"id":"65f1c0ffee0000000000abcd"}`))
+	if err != nil || legacy.Type != EventProductDeleted || legacy.ID != "" {
+		t.Fatalf("expected legacy payload to decode, got %+v (%v)", legacy, err)
+	}
+}
+
+func TestProcessDeadLettersEnvelopesThatBreakTheSchema(t *testing.T) {
+	handler := &fakeHandler{}
+	publisher := &fakePublisher{}
+	consumer := newConsumer(ConsumerConfig{Queue: "search"}, handler)
+	consumer.publisher = publisher
+
+	body := `{"specversion":"1.0","id":"evt-2","type":"product.deleted","source":"/products-api",` +
+		`"time":"2024-05-01T10:00:00Z","dataschema":"urn:products-api:schema:product-deleted:v1","data":{"id":"65f1c0ffee0000000000abcd"}}`
+	acks := &fakeAcknowledger{}
+	process(consumer, newDelivery(acks, EventProductDeleted, body, nil))
+
+	if len(handler.events) != 0 || len(publisher.sent) != 1 {
+		t.Fatalf("expected invalid envelope to be dead-lettered without reaching the handler")
+	}
+	if reason := publisher.sent[0].msg.Headers[headerDeadReason]; reason != DeadReasonPoison {
+		t.Fatalf("expected poison reason, got %v", reason)
+	}
+}
+
+// --- fakes ---
+
+func process(c *Consumer, msg amqp.Delivery) {
+	if job, ok := c.decode(msg); ok {
+		c.handle(context.Background(), job)
+	}
+}
+
+func newDelivery(acks *fakeAcknowledger, routingKey, body string, headers amqp.Table) amqp.Delivery {
+	return amqp.Delivery{
+		Acknowledger: acks,
+		RoutingKey:   routingKey,
+		Headers:      headers,
+		Body:         []byte(body),
+	}
+}
+
+type fakeHandler struct {
+	mu            sync.Mutex
+	err           error
+	delay         time.Duration
+	block         chan struct{}
+	events        []ProductEvent
+	running       int
+	maxConcurrent int
+}
+
+func (f *fakeHandler) HandleProductEvent(ctx context.Context, event ProductEvent) error {
+	f.mu.Lock()
+	f.events = append(f.events, event)
+	f.running++
+	f.maxConcurrent = max(f.maxConcurrent, f.running)
+	f.mu.Unlock()
+
+	if f.block != nil {
+		<-f.block
+	}
+	time.Sleep(f.delay)
+
+	f.mu.Lock()
+	f.running--
+	f.mu.Unlock()
+	return f.err
+}
+
+func (f *fakeHandler) stocksFor(id string) []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var stocks []int
+	for _, event := range f.events {
+		if event.Product.ID == id {
+			stocks = append(stocks, event.Product.Stock)
+		}
+	}
+	return stocks
+}
+
+type sentMessage struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+type fakePublisher struct {
+	mu   sync.Mutex
+	err  error
+	sent []sentMessage
+}
+
+func (f *fakePublisher) publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, sentMessage{exchange: exchange, key: key, msg: msg})
+	return nil
+}
+
+type fakeAcknowledger struct {
+	mu       sync.Mutex
+	acked    int
+	requeued int
+	rejected int
+}
+
+func (f *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.acked++
+	return nil
+}
+
+func (f *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if requeue {
+		f.requeued++
+	} else {
+		f.rejected++
+	}
+	return nil
+}
+
+func (f *fakeAcknowledger) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.acked
+}
+
+func (f *fakeAcknowledger) requeuedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requeued
+}
+
+func (f *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return f.Nack(tag, false, requeue)
+}
@@ -0,0 +1,122 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetter describes a message parked in the dead-letter queue.
+type DeadLetter struct {
+	MessageID  string          `json:"message_id,omitempty"`
+	RoutingKey string          `json:"routing_key"`
+	Reason     string          `json:"reason"`
+	Error      string          `json:"error,omitempty"`
+	Attempts   int             `json:"attempts"`
+	DeadAt     *time.Time      `json:"dead_at,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	RawBody    string          `json:"raw_body,omitempty"`
+}
+
+// DeadLetters returns up to limit dead-lettered messages without removing
+// them. Inspected messages are requeued, which keeps their relative order.
+func (c *Consumer) DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	var (
+		letters []DeadLetter
+		last    *amqp.Delivery
+	)
+	for len(letters) < limit && ctx.Err() == nil {
+		msg, ok, err := c.control.Get(c.deadQueue, false)
+		if err != nil {
+			return nil, fmt.Errorf("get dead letter: %w", err)
+		}
+		if !ok {
+			break
+		}
+		letters = append(letters, toDeadLetter(msg))
+		last = &msg
+	}
+	if last != nil {
+		if err := last.Nack(true, true); err != nil {
+			return nil, fmt.Errorf("requeue dead letters: %w", err)
+		}
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters moves up to limit dead-lettered messages back to the main
+// queue with a fresh attempt counter and returns how many were replayed.
+func (c *Consumer) ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	replayed := 0
+	for replayed < limit && ctx.Err() == nil {
+		msg, ok, err := c.control.Get(c.deadQueue, false)
+		if err != nil {
+			return replayed, fmt.Errorf("get dead letter: %w", err)
+		}
+		if !ok {
+			break
+		}
+
+		publishCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+		err = c.publisher.publish(publishCtx, "", c.queue, amqp.Publishing{
+			Headers:      amqp.Table{headerRoutingKey: originalRoutingKey(msg)},
+			ContentType:  msg.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    msg.MessageId,
+			Timestamp:    msg.Timestamp,
+			Body:         msg.Body,
+		})
+		cancel()
+		if err != nil {
+			_ = msg.Nack(false, true)
+			return replayed, fmt.Errorf("replay dead letter: %w", err)
+		}
+		if err := msg.Ack(false); err != nil {
+			return replayed, fmt.Errorf("ack dead letter: %w", err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// PurgeDeadLetters drops every dead-lettered message and returns how many were removed.
+func (c *Consumer) PurgeDeadLetters(ctx context.Context) (int, error) {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	purged, err := c.control.QueuePurge(c.deadQueue, false)
+	if err != nil {
+		return 0, fmt.Errorf("purge dead letters: %w", err)
+	}
+	return purged, nil
+}
+
+func toDeadLetter(msg amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		MessageID:  msg.MessageId,
+		RoutingKey: originalRoutingKey(msg),
+		Attempts:   headerInt(msg.Headers, headerAttempts),
+	}
+	letter.Reason, _ = msg.Headers[headerDeadReason].(string)
+	letter.Error, _ = msg.Headers[headerLastError].(string)
+	if raw, ok := msg.Headers[headerDeadAt].(string); ok {
+		if deadAt, err := time.Parse(time.RFC3339, raw); err == nil {
+			letter.DeadAt = &deadAt
+		}
+	}
+	if json.Valid(msg.Body) {
+		letter.Payload = json.RawMessage(msg.Body)
+	} else {
+		letter.RawBody = string(msg.Body)
+	}
+	return letter
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"search-api/internal/models"
+)
+
+// ErrCircuitOpen is returned without calling the search backend while the
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("search backend circuit is open")
+
+// Circuit breaker states, as reported by CircuitBreaker.State.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops calling a failing backend for a while. After
+// threshold consecutive failures it opens for openFor; then a single probe
+// call is let through and its outcome closes or reopens the circuit.
+type CircuitBreaker struct {
+	threshold int
+	openFor   time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker builds a closed breaker.
+func NewCircuitBreaker(threshold int, openFor time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if openFor <= 0 {
+		openFor = 30 * time.Second
+	}
+	return &CircuitBreaker{threshold: threshold, openFor: openFor, now: time.Now, state: CircuitClosed}
+}
+
+// State reports whether the breaker is closed, open or half-open.
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow tells whether a call may go through, moving an open breaker whose
+// pause is over to half-open for one probe.
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitClosed:
+		return true
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.openFor {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		return true
+	default:
+		// The probe is still running.
+		return false
+	}
+}
+
+// record updates the breaker with the outcome of an allowed call.
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !isBackendFailure(err) {
+		if b.state != CircuitClosed {
+			log.Printf("search backend circuit closed")
+		}
+		b.state = CircuitClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		if b.state != CircuitOpen {
+			log.Printf("search backend circuit opened after %d failures: %v", b.failures, err)
+		}
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// isBackendFailure tells whether err means the backend is unhealthy. Version
+// conflicts and canceled requests are normal outcomes.
+func isBackendFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrRevisionConflict) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var backendErr BackendError
+	return errors.As(err, &backendErr)
+}
+
+// guard runs call through breaker.
+func guard[T any](breaker *CircuitBreaker, call func() (T, error)) (T, error) {
+	if !breaker.allow() {
+		var zero T
+		return zero, BackendError{Message: "search backend unavailable", Err: ErrCircuitOpen}
+	}
+	result, err := call()
+	breaker.record(err)
+	return result, err
+}
+
+// breakerIndexRepository fails fast while the backend behind it is down.
+type breakerIndexRepository struct {
+	repo    IndexRepository
+	breaker *CircuitBreaker
+}
+
+// WithCircuitBreaker wraps repo so its calls go through breaker.
+func WithCircuitBreaker(repo IndexRepository, breaker *CircuitBreaker) IndexRepository {
+	return &breakerIndexRepository{repo: repo, breaker: breaker}
+}
+
+func (r *breakerIndexRepository) Search(ctx context.Context, filters SearchFilters) (*SearchResult, error) {
+	return guard(r.breaker, func() (*SearchResult, error) { return r.repo.Search(ctx, filters) })
+}
+
+func (r *breakerIndexRepository) IndexedVersion(ctx context.Context, id string) (IndexedVersion, bool, error) {
+	var found bool
+	state, err := guard(r.breaker, func() (IndexedVersion, error) {
+		state, ok, err := r.repo.IndexedVersion(ctx, id)
+		found = ok
+		return state, err
+	})
+	return state, found, err
+}
+
+func (r *breakerIndexRepository) IndexProduct(ctx context.Context, product models.ProductDocument, revision int64) error {
+	_, err := guard(r.breaker, func() (struct{}, error) { return struct{}{}, r.repo.IndexProduct(ctx, product, revision) })
+	return err
+}
+
+func (r *breakerIndexRepository) DeleteProduct(ctx context.Context, id string, version, revision int64) error {
+	_, err := guard(r.breaker, func() (struct{}, error) { return struct{}{}, r.repo.DeleteProduct(ctx, id, version, revision) })
+	return err
+}
+
+func (r *breakerIndexRepository) Suggest(ctx context.Context, query string, limit int) (*SuggestCandidates, error) {
+	return guard(r.breaker, func() (*SuggestCandidates, error) { return r.repo.Suggest(ctx, query, limit) })
+}
+
+func (r *breakerIndexRepository) SpellCheck(ctx context.Context, filters SearchFilters) ([]Collation, error) {
+	return guard(r.breaker, func() ([]Collation, error) { return r.repo.SpellCheck(ctx, filters) })
+}
+
+func (r *breakerIndexRepository) Similar(ctx context.Context, id string, limit int) ([]models.ProductDocument, error) {
+	return guard(r.breaker, func() ([]models.ProductDocument, error) { return r.repo.Similar(ctx, id, limit) })
+}
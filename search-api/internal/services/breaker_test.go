@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"search-api/internal/models"
+)
+
+func TestCircuitBreakerFailsFastAndProbesAfterThePause(t *testing.T) {
+	repo := &mockIndexRepo{searchErr: BackendError{Message: "solr returned status 503"}}
+	breaker := NewCircuitBreaker(2, time.Minute)
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+	guarded := WithCircuitBreaker(repo, breaker)
+
+	for i := 0; i < 3; i++ {
+		_, _ = guarded.Search(context.Background(), SearchFilters{})
+	}
+	if repo.searchCount != 2 || breaker.State() != CircuitOpen {
+		t.Fatalf("expected the circuit to open after 2 failures, got %d calls and state %s", repo.searchCount, breaker.State())
+	}
+	if _, err := guarded.Search(context.Background(), SearchFilters{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected an open circuit error, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	repo.searchErr = nil
+	if _, err := guarded.Search(context.Background(), SearchFilters{}); err != nil {
+		t.Fatalf("expected the probe to go through, got %v", err)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("expected a successful probe to close the circuit, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreakerIgnoresVersionConflicts(t *testing.T) {
+	repo := &mockIndexRepo{versions: map[string]IndexedVersion{"p1": {Version: 1, Revision: 1}}, conflicts: 5}
+	breaker := NewCircuitBreaker(1, time.Minute)
+	guarded := WithCircuitBreaker(repo, breaker)
+
+	err := guarded.IndexProduct(context.Background(), models.ProductDocument{ID: "p1", Version: 2}, 1)
+	if !errors.Is(err, ErrRevisionConflict) || breaker.State() != CircuitClosed {
+		t.Fatalf("expected a conflict to leave the circuit closed, got %v and %s", err, breaker.State())
+	}
+}
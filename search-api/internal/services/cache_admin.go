@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"search-api/internal/cache"
+)
+
+// ErrCacheEntryNotFound is returned when no response is cached for a search.
+var ErrCacheEntryNotFound = errors.New("no cached response for the search")
+
+// ErrCacheStatsUnavailable is returned when the cache keeps no stats.
+var ErrCacheStatsUnavailable = errors.New("the cache keeps no stats")
+
+// MaxWarmSearches bounds the searches warmed by one call, as each one is a
+// backend query.
+const MaxWarmSearches = 100
+
+// layerStatsReporter is implemented by caches made of several layers, such
+// as cache.LayeredCache.
+type layerStatsReporter interface {
+	LayerStats() map[string]cache.Stats
+}
+
+// CacheEntry is a cached search response as admins see it.
+type CacheEntry struct {
+	Key string `json:"key"`
+	// State is fresh, revalidate (expired but served while refreshed) or
+	// stale (served only while the backend is down).
+	State      string          `json:"state"`
+	FreshUntil time.Time       `json:"fresh_until"`
+	Value      json.RawMessage `json:"value"`
+}
+
+// WarmResult tells whether one search of a warm-up was cached.
+type WarmResult struct {
+	Key    string `json:"key,omitempty"`
+	Warmed bool   `json:"warmed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CacheStats returns the stats of each cache layer by name.
+func (s *SearchService) CacheStats() (map[string]cache.Stats, error) {
+	switch c := s.cache.(type) {
+	case layerStatsReporter:
+		return c.LayerStats(), nil
+	case cache.StatsReporter:
+		return map[string]cache.Stats{"cache": c.Stats()}, nil
+	}
+	return nil, ErrCacheStatsUnavailable
+}
+
+// CachedSearch returns the response cached for filters, as SearchProducts
+// would look it up.
+func (s *SearchService) CachedSearch(filters SearchFilters) (*CacheEntry, error) {
+	_, key, err := s.prepareSearch(filters)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := s.cacheRead(key)
+	if !ok {
+		return nil, ErrCacheEntryNotFound
+	}
+	return &CacheEntry{
+		Key:        key,
+		State:      s.entryState(entry).String(),
+		FreshUntil: entry.FreshUntil,
+		Value:      entry.Value,
+	}, nil
+}
+
+// EvictSearch removes the response cached for filters from every cache
+// layer and returns its key, so the next such search queries the backend.
+func (s *SearchService) EvictSearch(filters SearchFilters) (string, error) {
+	_, key, err := s.prepareSearch(filters)
+	if err != nil {
+		return "", err
+	}
+	if s.cache != nil {
+		s.cache.Delete(key)
+	}
+	return key, nil
+}
+
+// WarmSearches runs each search on the backend and caches its response,
+// replacing any cached one, so popular searches do not wait for the backend
+// after a deploy or an invalidation. Searches are run one at a time and a
+// failed one does not stop the others; nothing is cached in degraded mode.
+func (s *SearchService) WarmSearches(ctx context.Context, searches []SearchFilters) ([]WarmResult, error) {
+	if len(searches) == 0 {
+		return nil, ValidationError{Message: "searches must list at least one search"}
+	}
+	if len(searches) > MaxWarmSearches {
+		return nil, ValidationError{Message: fmt.Sprintf("searches cannot list more than %d searches", MaxWarmSearches)}
+	}
+	results := make([]WarmResult, len(searches))
+	for i, filters := range searches {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		filters, key, err := s.prepareSearch(filters)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Key = key
+		if _, err := s.storeSearch(ctx, key, filters); err != nil {
+			log.Printf("warm search %s: %v", key, err)
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Warmed = true
+	}
+	return results, nil
+}
+
+func (state cacheState) String() string {
+	switch state {
+	case cacheFresh:
+		return "fresh"
+	case cacheRevalidate:
+		return "revalidate"
+	case cacheStale:
+		return "stale"
+	}
+	return "miss"
+}
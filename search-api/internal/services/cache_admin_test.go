@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"search-api/internal/cache"
+)
+
+func TestAdminsCanInspectAndEvictCachedSearches(t *testing.T) {
+	repo := &mockIndexRepo{}
+	service := NewSearchService(repo, newMapCache(), time.Minute)
+	ctx := context.Background()
+	// Equivalent spellings of a search share its entry.
+	filters := SearchFilters{Query: " rosa ", Marca: []string{"Dior"}}
+
+	if _, err := service.CachedSearch(filters); !errors.Is(err, ErrCacheEntryNotFound) {
+		t.Fatalf("expected no cached entry before searching, got %v", err)
+	}
+	if _, err := service.SearchProducts(ctx, SearchFilters{Query: "rosa", Marca: []string{"dior"}}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	entry, err := service.CachedSearch(filters)
+	if err != nil {
+		t.Fatalf("cached search: %v", err)
+	}
+	if entry.State != "fresh" || len(entry.Value) == 0 || entry.Key == "" {
+		t.Fatalf("expected the fresh cached response, got %+v", entry)
+	}
+
+	key, err := service.EvictSearch(filters)
+	if err != nil || key != entry.Key {
+		t.Fatalf("expected %s to be evicted, got %q err=%v", entry.Key, key, err)
+	}
+	if _, err := service.SearchProducts(ctx, filters); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if repo.searchCount != 2 {
+		t.Fatalf("expected the evicted search to query the backend, got %d calls", repo.searchCount)
+	}
+
+	if _, err := service.CachedSearch(SearchFilters{PrecioMin: -1}); !errors.As(err, &ValidationError{}) {
+		t.Fatalf("expected invalid filters to be rejected, got %v", err)
+	}
+}
+
+func TestWarmSearchesCachesFreshResponses(t *testing.T) {
+	repo := &mockIndexRepo{}
+	service := NewSearchService(repo, newMapCache(), time.Minute)
+	ctx := context.Background()
+
+	results, err := service.WarmSearches(ctx, []SearchFilters{{Query: "rosa"}, {PrecioMin: -1}, {Tipo: []string{"floral"}}})
+	if err != nil {
+		t.Fatalf("warm: %v", err)
+	}
+	if !results[0].Warmed || results[1].Warmed || results[1].Error == "" || !results[2].Warmed {
+		t.Fatalf("expected the valid searches to be warmed, got %+v", results)
+	}
+	if _, err := service.SearchProducts(ctx, SearchFilters{Query: "rosa"}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if repo.searchCount != 2 {
+		t.Fatalf("expected the warmed search to be served from cache, got %d backend calls", repo.searchCount)
+	}
+
+	// Warming replaces what is cached.
+	if _, err := service.WarmSearches(ctx, []SearchFilters{{Query: "rosa"}}); err != nil {
+		t.Fatalf("warm: %v", err)
+	}
+	if repo.searchCount != 3 {
+		t.Fatalf("expected warming to query the backend again, got %d calls", repo.searchCount)
+	}
+
+	repo.searchErr = errors.New("solr down")
+	results, err = service.WarmSearches(ctx, []SearchFilters{{Query: "jazmin"}})
+	if err != nil || results[0].Warmed || results[0].Error == "" {
+		t.Fatalf("expected a failed warm-up to be reported, got %+v err=%v", results, err)
+	}
+	if _, err := service.CachedSearch(SearchFilters{Query: "jazmin"}); !errors.Is(err, ErrCacheEntryNotFound) {
+		t.Fatalf("expected nothing cached for a failed warm-up, got %v", err)
+	}
+
+	if _, err := service.WarmSearches(ctx, nil); !errors.As(err, &ValidationError{}) {
+		t.Fatalf("expected an empty list to be rejected, got %v", err)
+	}
+}
+
+func TestCacheStatsComeFromTheLayers(t *testing.T) {
+	layered := cache.NewLayeredCache(cache.NewCCacheLayer(10), nil, time.Minute)
+	service := NewSearchService(&mockIndexRepo{}, layered, time.Minute)
+	if _, err := service.SearchProducts(context.Background(), SearchFilters{}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	stats, err := service.CacheStats()
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats["layered"].Sets == 0 || stats["memory"].Sets == 0 {
+		t.Fatalf("expected the search to be counted, got %+v", stats)
+	}
+	if _, ok := stats["distributed"]; ok {
+		t.Fatalf("expected no stats for a missing layer")
+	}
+
+	if _, err := NewSearchService(&mockIndexRepo{}, newMapCache(), time.Minute).CacheStats(); !errors.Is(err, ErrCacheStatsUnavailable) {
+		t.Fatalf("expected a cache without stats to report none, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// refreshTimeout bounds a backend call made on behalf of several callers or
+// in the background, which no single request context can bound.
+const refreshTimeout = 30 * time.Second
+
+// flightGroup coalesces concurrent backend calls for the same cache key, so
+// an expired popular entry costs one backend call instead of one per
+// request.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a call in progress and, once done is closed, its result.
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+	// joined counts the callers that waited for the call instead of
+	// making their own.
+	joined int
+}
+
+// begin returns the flight for key, starting one if none is in progress;
+// leader tells whether the caller must run it.
+func (g *flightGroup) begin(key string) (f *flight, leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.flights[key]; ok {
+		f.joined++
+		return f, false
+	}
+	if g.flights == nil {
+		g.flights = map[string]*flight{}
+	}
+	f = &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+// finish publishes the result of f and lets the next call for key start.
+func (g *flightGroup) finish(key string, f *flight, value interface{}, err error) {
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+	f.value, f.err = value, err
+	close(f.done)
+}
+
+// coalesce runs fn once for the concurrent callers with the same key and
+// hands them all its result, which they must not modify. fn runs detached
+// from the callers' contexts, so one caller going away does not fail the
+// others; a caller whose context ends stops waiting.
+func coalesce[T any](ctx context.Context, g *flightGroup, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	f := startFlight(ctx, g, key, fn)
+	select {
+	case <-f.done:
+		value, _ := f.value.(T)
+		return value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// revalidate runs fn in the background for key, unless a call for key is
+// already in progress. Callers arriving meanwhile share its result.
+func revalidate[T any](g *flightGroup, key string, fn func(ctx context.Context) (T, error)) {
+	startFlight(context.Background(), g, key, fn)
+}
+
+func startFlight[T any](ctx context.Context, g *flightGroup, key string, fn func(ctx context.Context) (T, error)) *flight {
+	f, leader := g.begin(key)
+	if !leader {
+		return f
+	}
+	go func() {
+		callCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		defer cancel()
+		value, err := fn(callCtx)
+		g.finish(key, f, value, err)
+	}()
+	return f
+}
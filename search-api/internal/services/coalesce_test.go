@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"search-api/internal/models"
+)
+
+// gatedSearchRepo blocks searches until release is closed.
+type gatedSearchRepo struct {
+	mockIndexRepo
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (r *gatedSearchRepo) Search(ctx context.Context, filters SearchFilters) (*SearchResult, error) {
+	r.calls.Add(1)
+	<-r.release
+	return &SearchResult{Items: []models.ProductDocument{{ID: "p1"}}, Page: filters.Page, Size: filters.Size, Total: 1}, nil
+}
+
+// waitFor polls cond until it holds or a second passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (g *flightGroup) joinedCount(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.flights[key]; ok {
+		return f.joined
+	}
+	return -1
+}
+
+func (g *flightGroup) inFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.flights)
+}
+
+func TestConcurrentMissesCallTheBackendOnce(t *testing.T) {
+	repo := &gatedSearchRepo{release: make(chan struct{})}
+	service := NewSearchService(repo, newMapCache(), time.Minute)
+	filters := SearchFilters{Query: "rosa"}
+	_, key, err := service.prepareSearch(filters)
+	if err != nil {
+		t.Fatalf("prepare search: %v", err)
+	}
+
+	const callers = 20
+	var wg sync.WaitGroup
+	results := make(chan *SearchResult, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := service.SearchProducts(context.Background(), filters)
+			if err != nil {
+				t.Errorf("search: %v", err)
+			}
+			results <- result
+		}()
+	}
+	waitFor(t, "every caller to join the backend call", func() bool { return service.flights.joinedCount(key) == callers-1 })
+	close(repo.release)
+	wg.Wait()
+	close(results)
+
+	if calls := repo.calls.Load(); calls != 1 {
+		t.Fatalf("expected one backend call, got %d", calls)
+	}
+	for result := range results {
+		if result == nil || result.Total != 1 {
+			t.Fatalf("expected every caller to get the result, got %+v", result)
+		}
+	}
+}
+
+func TestExpiredEntriesAreServedWhileOneRefreshRuns(t *testing.T) {
+	repo := &gatedSearchRepo{release: make(chan struct{})}
+	close(repo.release)
+	service := NewSearchService(repo, newMapCache(), time.Millisecond).WithStaleWhileRevalidate(time.Minute)
+	ctx := context.Background()
+	filters := SearchFilters{Query: "rosa"}
+
+	if _, err := service.SearchProducts(ctx, filters); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	repo.release = make(chan struct{})
+	search := func() {
+		t.Helper()
+		result, err := service.SearchProducts(ctx, filters)
+		if err != nil || result.Total != 1 || result.Degraded {
+			t.Fatalf("expected the expired result without waiting, got %+v err=%v", result, err)
+		}
+	}
+	search()
+	waitFor(t, "the background refresh", func() bool { return repo.calls.Load() == 2 })
+	for i := 0; i < 10; i++ {
+		search()
+	}
+	if calls := repo.calls.Load(); calls != 2 {
+		t.Fatalf("expected a single background refresh, got %d", calls-1)
+	}
+	close(repo.release)
+	waitFor(t, "the refresh to finish", func() bool { return service.flights.inFlight() == 0 })
+}
+
+func TestEntriesPastTheRevalidationWindowWaitForTheBackend(t *testing.T) {
+	repo := &gatedSearchRepo{release: make(chan struct{})}
+	close(repo.release)
+	service := NewSearchService(repo, newMapCache(), time.Millisecond).
+		WithStaleCache(time.Minute).
+		WithStaleWhileRevalidate(time.Millisecond)
+	ctx := context.Background()
+
+	if _, err := service.SearchProducts(ctx, SearchFilters{Query: "rosa"}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := service.SearchProducts(ctx, SearchFilters{Query: "rosa"}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if calls := repo.calls.Load(); calls != 2 {
+		t.Fatalf("expected the stale entry to be searched again, got %d backend calls", calls)
+	}
+	if service.flights.inFlight() != 0 {
+		t.Fatalf("expected no background refresh")
+	}
+}
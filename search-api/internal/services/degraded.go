@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrSearchUnavailable is returned when the search backend failed and no
+// stale result or fallback could answer instead.
+var ErrSearchUnavailable = errors.New("search is unavailable")
+
+// Sources of a degraded response, reported in SearchResult.DegradedSource.
+const (
+	// DegradedStaleCache serves a cached response past its TTL.
+	DegradedStaleCache = "stale-cache"
+	// DegradedFallback serves the results of the FallbackSearcher.
+	DegradedFallback = "products-api"
+	// DegradedUnavailable serves an empty response.
+	DegradedUnavailable = "unavailable"
+)
+
+// FallbackSearcher answers searches while the index is down, with fewer
+// features: no relevance ranking, facets, highlighting or spellcheck.
+type FallbackSearcher interface {
+	SearchProducts(ctx context.Context, filters SearchFilters) (*SearchResult, error)
+}
+
+// WithStaleCache keeps cached responses for maxStale after they expire, to
+// serve them when the search backend fails.
+func (s *SearchService) WithStaleCache(maxStale time.Duration) *SearchService {
+	s.staleTTL = maxStale
+	return s
+}
+
+// WithFallback sets the backend searches go to when the index fails and no
+// stale response is cached.
+func (s *SearchService) WithFallback(fallback FallbackSearcher) *SearchService {
+	s.fallback = fallback
+	return s
+}
+
+// cacheEntry is what the service stores in the cache: a response and the
+// time it stops being fresh. Entries outlive their freshness by staleTTL.
+type cacheEntry struct {
+	FreshUntil time.Time       `json:"fresh_until"`
+	Value      json.RawMessage `json:"value"`
+}
+
+// WithStaleWhileRevalidate serves entries that expired less than window ago
+// as they are while one background call refreshes them, so popular entries
+// do not make requests wait for the backend when they expire.
+func (s *SearchService) WithStaleWhileRevalidate(window time.Duration) *SearchService {
+	s.revalidateWindow = window
+	return s
+}
+
+// cacheState tells how a cached entry can be used.
+type cacheState int
+
+const (
+	cacheMiss cacheState = iota
+	// cacheFresh entries are served as they are.
+	cacheFresh
+	// cacheRevalidate entries expired within the revalidation window: they
+	// are served while a background call refreshes them.
+	cacheRevalidate
+	// cacheStale entries are only served while degraded.
+	cacheStale
+)
+
+// cacheLoad decodes the entry stored under key into dest and tells how it
+// can be used.
+func (s *SearchService) cacheLoad(key string, dest interface{}) cacheState {
+	entry, ok := s.cacheRead(key)
+	if !ok {
+		return cacheMiss
+	}
+	if err := json.Unmarshal(entry.Value, dest); err != nil {
+		return cacheMiss
+	}
+	return s.entryState(entry)
+}
+
+// cacheRead returns the entry stored under key without decoding its value.
+func (s *SearchService) cacheRead(key string) (cacheEntry, bool) {
+	var entry cacheEntry
+	if s.cache == nil {
+		return entry, false
+	}
+	data, found := s.cache.Get(key)
+	if !found {
+		return entry, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil || len(entry.Value) == 0 {
+		return entry, false
+	}
+	return entry, true
+}
+
+func (s *SearchService) entryState(entry cacheEntry) cacheState {
+	now := time.Now()
+	switch {
+	case now.Before(entry.FreshUntil):
+		return cacheFresh
+	case now.Before(entry.FreshUntil.Add(s.revalidateWindow)):
+		return cacheRevalidate
+	default:
+		return cacheStale
+	}
+}
+
+// cacheStore stores value under key, fresh for ttl.
+func (s *SearchService) cacheStore(key string, value interface{}, ttl time.Duration) {
+	if s.cache == nil {
+		return
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	entry, err := json.Marshal(cacheEntry{FreshUntil: time.Now().Add(ttl), Value: encoded})
+	if err != nil {
+		return
+	}
+	s.cache.Set(key, entry, ttl+max(s.staleTTL, s.revalidateWindow))
+}
+
+// degradedSearch answers a search whose backend call failed with cause:
+// first from a stale cache entry, then from the fallback backend.
+func (s *SearchService) degradedSearch(ctx context.Context, filters SearchFilters, stale *SearchResult, cause error) (*SearchResult, error) {
+	if stale != nil {
+		stale.Degraded = true
+		stale.DegradedSource = DegradedStaleCache
+		return stale, nil
+	}
+	if s.fallback != nil {
+		result, err := s.fallback.SearchProducts(ctx, filters)
+		if err == nil && result != nil {
+			result.Degraded = true
+			result.DegradedSource = DegradedFallback
+			return result, nil
+		}
+		log.Printf("fallback search failed: %v", err)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrSearchUnavailable, cause)
+}
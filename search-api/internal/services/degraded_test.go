@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"search-api/internal/models"
+)
+
+func TestSearchServesStaleResultsWhileTheBackendFails(t *testing.T) {
+	repo := &mockIndexRepo{result: &SearchResult{Items: []models.ProductDocument{{ID: "p1"}}, Total: 1}}
+	// Entries go stale at once but are kept for an hour.
+	service := NewSearchService(repo, newMapCache(), time.Nanosecond).WithStaleCache(time.Hour)
+
+	if _, err := service.SearchProducts(context.Background(), SearchFilters{Query: "vainilla"}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	repo.searchErr = errors.New("connection refused")
+
+	result, err := service.SearchProducts(context.Background(), SearchFilters{Query: "vainilla"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if !result.Degraded || result.DegradedSource != DegradedStaleCache || result.Total != 1 {
+		t.Fatalf("expected the stale result flagged as degraded, got %+v", result)
+	}
+}
+
+func TestSearchFallsBackToTheSecondaryBackend(t *testing.T) {
+	repo := &mockIndexRepo{searchErr: errors.New("connection refused")}
+	fallback := &fakeFallback{result: &SearchResult{Items: []models.ProductDocument{{ID: "p2"}}, Total: 1}}
+	service := NewSearchService(repo, newMapCache(), time.Minute).WithFallback(fallback)
+
+	result, err := service.SearchProducts(context.Background(), SearchFilters{Query: "vainilla"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if !result.Degraded || result.DegradedSource != DegradedFallback || result.Items[0].ID != "p2" {
+		t.Fatalf("expected the fallback result flagged as degraded, got %+v", result)
+	}
+
+	fallback.err = errors.New("products-api returned 502")
+	if _, err := service.SearchProducts(context.Background(), SearchFilters{Query: "vainilla"}); !errors.Is(err, ErrSearchUnavailable) {
+		t.Fatalf("expected an outage to be reported, got %v", err)
+	}
+}
+
+func TestFallbackSearchMatchesBrandsAsTyped(t *testing.T) {
+	// products-api stores brands as typed and matches filters ignoring case.
+	catalog := []models.ProductDocument{{ID: "p1", Marca: "Dior"}, {ID: "p2", Marca: "Chanel"}}
+	var forwarded string
+	productsAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.URL.Query().Get("marca")
+		items := []models.ProductDocument{}
+		for _, product := range catalog {
+			if strings.EqualFold(product.Marca, forwarded) {
+				items = append(items, product)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"items": items, "page": 1, "size": 10, "total": len(items)}})
+	}))
+	defer productsAPI.Close()
+
+	repo := &mockIndexRepo{searchErr: errors.New("connection refused")}
+	service := NewSearchService(repo, newMapCache(), time.Minute).WithFallback(NewProductsAPISource(productsAPI.URL))
+
+	result, err := service.SearchProducts(context.Background(), SearchFilters{Marca: []string{"Dior"}})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if forwarded != "dior" {
+		t.Fatalf("expected the normalized brand to be forwarded, got %q", forwarded)
+	}
+	if result.DegradedSource != DegradedFallback || result.Total != 1 || result.Items[0].ID != "p1" {
+		t.Fatalf("expected the Dior product from the fallback, got %+v", result)
+	}
+}
+
+type fakeFallback struct {
+	result *SearchResult
+	err    error
+}
+
+func (f *fakeFallback) SearchProducts(ctx context.Context, filters SearchFilters) (*SearchResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	copied := *f.result
+	return &copied, nil
+}
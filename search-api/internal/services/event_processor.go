@@ -4,18 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"sync"
 
 	"search-api/internal/models"
 	"search-api/internal/rabbitmq"
 )
 
+// recentEventCapacity is how many applied event ids are remembered for deduplication.
+const recentEventCapacity = 10000
+
 // EventProcessor implements rabbitmq.EventHandler and delegates to SearchService.
 type EventProcessor struct {
 	service        *SearchService
 	productsAPIURL string
 	httpClient     *http.Client
+	recent         *recentEvents
 }
 
 // NewEventProcessor builds an EventProcessor.
@@ -24,27 +30,40 @@ func NewEventProcessor(service *SearchService, productsAPIURL string) *EventProc
 		service:        service,
 		productsAPIURL: strings.TrimRight(productsAPIURL, "/"),
 		httpClient:     &http.Client{},
+		recent:         newRecentEvents(recentEventCapacity),
 	}
 }
 
 // HandleProductEvent processes product events emitted by products-api.
+// Redelivered events are skipped by id; stale ones are skipped by version.
 func (p *EventProcessor) HandleProductEvent(ctx context.Context, event rabbitmq.ProductEvent) error {
+	if event.ID != "" && p.recent.contains(event.ID) {
+		log.Printf("skip duplicate event %s", event.ID)
+		return nil
+	}
+
 	switch event.Type {
 	case rabbitmq.EventProductCreated, rabbitmq.EventProductUpdated:
 		doc := event.Product
-		if fetched, err := p.fetchProduct(ctx, event.Product.ID); err == nil && fetched.ID != "" {
+		// The current product is at least as new as the event; prefer it so
+		// the index converges even when events were skipped.
+		if fetched, err := p.fetchProduct(ctx, event.Product.ID); err == nil && fetched.ID != "" && fetched.Version >= doc.Version {
 			doc = fetched
 		}
 		if err := p.service.IndexProduct(ctx, doc); err != nil {
 			return fmt.Errorf("index product: %w", err)
 		}
 	case rabbitmq.EventProductDeleted:
-		if err := p.service.DeleteProduct(ctx, event.Product.ID); err != nil {
+		if err := p.service.DeleteProduct(ctx, event.Product.ID, event.Product.Version); err != nil {
 			return fmt.Errorf("delete product: %w", err)
 		}
 	default:
 		return fmt.Errorf("unsupported event type %s", event.Type)
 	}
+
+	if event.ID != "" {
+		p.recent.add(event.ID)
+	}
 	return nil
 }
 
@@ -78,3 +97,36 @@ func (p *EventProcessor) fetchProduct(ctx context.Context, id string) (models.Pr
 
 	return envelope.Data, nil
 }
+
+// recentEvents is a bounded set of event ids that forgets the oldest first.
+type recentEvents struct {
+	mu    sync.Mutex
+	ids   map[string]struct{}
+	order []string
+	next  int
+}
+
+func newRecentEvents(capacity int) *recentEvents {
+	return &recentEvents{ids: make(map[string]struct{}, capacity), order: make([]string, capacity)}
+}
+
+func (r *recentEvents) contains(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.ids[id]
+	return ok
+}
+
+func (r *recentEvents) add(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.ids[id]; ok {
+		return
+	}
+	if evicted := r.order[r.next]; evicted != "" {
+		delete(r.ids, evicted)
+	}
+	r.order[r.next] = id
+	r.ids[id] = struct{}{}
+	r.next = (r.next + 1) % len(r.order)
+}
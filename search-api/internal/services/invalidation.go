@@ -0,0 +1,214 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"search-api/internal/models"
+)
+
+// Cached responses are invalidated by generations instead of flushes. Every
+// response depends on a few tags; its cache key embeds the current
+// generation of each of them, so bumping a tag's generation makes the
+// entries that depend on it unreachable and they expire on their own. A
+// product change bumps only the tags of the values it had and has, so the
+// result pages that could not contain it stay cached. Generations and
+// product tags must be read from the cache shared by every instance (see
+// cache.LayeredCache.WithSharedPrefix): a copy kept in one instance's memory
+// would miss bumps made elsewhere.
+const (
+	// GenerationKeyPrefix starts the cache key of a tag generation.
+	GenerationKeyPrefix = "gen:"
+	// ProductTagsKeyPrefix starts the cache key of the tags a product was
+	// last indexed with, which its next change must bump too.
+	ProductTagsKeyPrefix = "ptags:"
+
+	// tagGlobal is part of every key: bumping it invalidates everything.
+	tagGlobal = "global"
+	// tagAll scopes responses that any product can change.
+	tagAll = "all"
+)
+
+// scopeFields are the product fields a cached search can be scoped by, most
+// selective first.
+var scopeFields = []string{"marca", "tipo", "genero", "estacion", "ocasion"}
+
+// productTags returns the tags a product change must bump: tagAll and one
+// per word of each scope field, as searches match words of those fields.
+func productTags(product models.ProductDocument) []string {
+	tags := []string{tagAll}
+	for _, field := range scopeFields {
+		for _, word := range scopeWords(productField(product, field)) {
+			tags = append(tags, field+":"+word)
+		}
+	}
+	return tags
+}
+
+// searchTags returns the tags a search response depends on. A search
+// filtered by a scope field can only contain products with one of its
+// values, so it depends on their words. A facet on that field counts every
+// value, so the field cannot scope a search that requests it; searches
+// without a usable filter depend on tagAll.
+func searchTags(filters SearchFilters) []string {
+	for _, field := range scopeFields {
+		values := filterValues(filters, field)
+		if len(values) == 0 || slices.Contains(filters.Facets, field) {
+			continue
+		}
+		var tags []string
+		for _, value := range values {
+			for _, word := range scopeWords(value) {
+				tags = append(tags, field+":"+word)
+			}
+		}
+		if len(tags) > 0 {
+			return tags
+		}
+	}
+	return []string{tagAll}
+}
+
+func productField(product models.ProductDocument, field string) string {
+	switch field {
+	case "marca":
+		return product.Marca
+	case "tipo":
+		return product.Tipo
+	case "genero":
+		return product.Genero
+	case "estacion":
+		return product.Estacion
+	case "ocasion":
+		return product.Ocasion
+	}
+	return ""
+}
+
+func filterValues(filters SearchFilters, field string) []string {
+	switch field {
+	case "marca":
+		return filters.Marca
+	case "tipo":
+		return filters.Tipo
+	case "genero":
+		return filters.Genero
+	case "estacion":
+		return filters.Estacion
+	case "ocasion":
+		return filters.Ocasion
+	}
+	return nil
+}
+
+// scopeWords splits a value into lowercased words, as the index tokenizes
+// the scope fields.
+func scopeWords(value string) []string {
+	return strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// scopedKey appends to key a digest of the current generations of the
+// global tag and of tags.
+func (s *SearchService) scopedKey(key string, tags []string) string {
+	if s.cache == nil {
+		return key
+	}
+	var b strings.Builder
+	for _, tag := range append([]string{tagGlobal}, tags...) {
+		b.WriteString(tag)
+		b.WriteByte('=')
+		b.WriteString(s.generation(tag))
+		b.WriteByte('|')
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return fmt.Sprintf("%s:%x", key, sum[:8])
+}
+
+// generation returns the current generation of tag. A missing generation,
+// never set or evicted, starts a new one rather than reading as a default
+// value an older generation may have had.
+func (s *SearchService) generation(tag string) string {
+	if value, ok := s.cache.Get(GenerationKeyPrefix + tag); ok {
+		return string(value)
+	}
+	return s.bumpGeneration(tag)
+}
+
+// bumpGeneration starts a new generation of tag. Generations never expire.
+func (s *SearchService) bumpGeneration(tag string) string {
+	value := strconv.FormatInt(time.Now().UnixNano(), 36)
+	s.cache.Set(GenerationKeyPrefix+tag, []byte(value), 0)
+	return value
+}
+
+// invalidateProduct bumps the tags of a product that was written: those it
+// was last indexed with, if it existed, and those of product, nil for a
+// deletion, which also forgets its tags. Without a record of the old tags
+// nothing tells which responses held the product, so every response is
+// invalidated.
+func (s *SearchService) invalidateProduct(id string, product *models.ProductDocument, existed bool) {
+	if s.cache == nil {
+		return
+	}
+	tags := []string{tagAll}
+	if existed {
+		old, ok := s.loadProductTags(id)
+		if !ok {
+			log.Printf("no cached tags for product %s, invalidating every cached response", id)
+			tags = []string{tagGlobal}
+		}
+		tags = append(tags, old...)
+	}
+	if product != nil {
+		tags = append(tags, s.rememberProductTags(*product)...)
+	} else {
+		s.cache.Delete(ProductTagsKeyPrefix + id)
+	}
+	slices.Sort(tags)
+	for _, tag := range slices.Compact(tags) {
+		s.bumpGeneration(tag)
+	}
+}
+
+// rememberProductTags records the tags of product for its next change and
+// returns them.
+func (s *SearchService) rememberProductTags(product models.ProductDocument) []string {
+	tags := productTags(product)
+	if s.cache == nil {
+		return tags
+	}
+	if encoded, err := json.Marshal(tags); err == nil {
+		s.cache.Set(ProductTagsKeyPrefix+product.ID, encoded, 0)
+	}
+	return tags
+}
+
+func (s *SearchService) loadProductTags(id string) ([]string, bool) {
+	data, ok := s.cache.Get(ProductTagsKeyPrefix + id)
+	if !ok {
+		return nil, false
+	}
+	var tags []string
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, false
+	}
+	return tags, true
+}
+
+// invalidateCaches makes every cached response unreachable, after changes
+// too broad to track per product such as a reindex.
+func (s *SearchService) invalidateCaches() {
+	if s.cache == nil {
+		return
+	}
+	s.bumpGeneration(tagGlobal)
+}
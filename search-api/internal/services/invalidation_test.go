@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"search-api/internal/models"
+)
+
+func TestProductChangesInvalidateOnlySearchesThatCouldContainThem(t *testing.T) {
+	repo := &mockIndexRepo{}
+	cache := newMapCache()
+	service := NewSearchService(repo, cache, time.Minute)
+	ctx := context.Background()
+
+	searches := map[string]SearchFilters{
+		"dior":   {Marca: []string{"dior"}},
+		"chanel": {Marca: []string{"chanel"}},
+		"all":    {},
+	}
+	backendCalls := func(name string) int {
+		t.Helper()
+		before := repo.searchCount
+		if _, err := service.SearchProducts(ctx, searches[name]); err != nil {
+			t.Fatalf("search %s: %v", name, err)
+		}
+		return repo.searchCount - before
+	}
+	for name := range searches {
+		backendCalls(name)
+	}
+
+	if err := service.IndexProduct(ctx, models.ProductDocument{ID: "p1", Marca: "Dior", Version: 1}); err != nil {
+		t.Fatalf("index p1: %v", err)
+	}
+	if backendCalls("dior") != 1 || backendCalls("all") != 1 {
+		t.Fatalf("expected searches that can contain p1 to be invalidated")
+	}
+	if backendCalls("chanel") != 0 {
+		t.Fatalf("expected the chanel search to stay cached")
+	}
+
+	// Moving p1 to another brand changes the pages of both brands.
+	if err := service.IndexProduct(ctx, models.ProductDocument{ID: "p1", Marca: "Chanel", Version: 2}); err != nil {
+		t.Fatalf("update p1: %v", err)
+	}
+	if backendCalls("dior") != 1 || backendCalls("chanel") != 1 {
+		t.Fatalf("expected the old and new brand searches to be invalidated")
+	}
+
+	if err := service.DeleteProduct(ctx, "p1", 3); err != nil {
+		t.Fatalf("delete p1: %v", err)
+	}
+	if backendCalls("dior") != 0 || backendCalls("chanel") != 1 {
+		t.Fatalf("expected deleting p1 to invalidate only the brand it had")
+	}
+	if cache.flushes != 0 {
+		t.Fatalf("expected no flush, got %d", cache.flushes)
+	}
+}
+
+func TestSearchTagsSkipFieldsWithTheirOwnFacet(t *testing.T) {
+	tags := searchTags(SearchFilters{Marca: []string{"carolina herrera"}, Tipo: []string{"floral"}, Facets: []string{"marca"}})
+	if !slices.Equal(tags, []string{"tipo:floral"}) {
+		t.Fatalf("expected the search to be scoped by tipo, got %v", tags)
+	}
+	tags = searchTags(SearchFilters{Marca: []string{"carolina herrera"}})
+	if !slices.Equal(tags, []string{"marca:carolina", "marca:herrera"}) {
+		t.Fatalf("expected one tag per brand word, got %v", tags)
+	}
+	if tags := searchTags(SearchFilters{Tipo: []string{"floral"}, Facets: []string{"tipo"}}); !slices.Equal(tags, []string{tagAll}) {
+		t.Fatalf("expected a faceted search on its only filter to depend on everything, got %v", tags)
+	}
+}
+
+func TestChangeOfAProductWithoutTagsInvalidatesEverything(t *testing.T) {
+	repo := &mockIndexRepo{versions: map[string]IndexedVersion{"p1": {Version: 1, Revision: 1}}, revision: 1}
+	cache := newMapCache()
+	service := NewSearchService(repo, cache, time.Minute)
+	ctx := context.Background()
+
+	if _, err := service.SearchProducts(ctx, SearchFilters{Marca: []string{"chanel"}}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if err := service.IndexProduct(ctx, models.ProductDocument{ID: "p1", Marca: "Dior", Version: 2}); err != nil {
+		t.Fatalf("update p1: %v", err)
+	}
+	if _, err := service.SearchProducts(ctx, SearchFilters{Marca: []string{"chanel"}}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if repo.searchCount != 2 {
+		t.Fatalf("expected the unknown previous brand to invalidate every search, got %d backend calls", repo.searchCount)
+	}
+
+	// From then on the tags are known.
+	if err := service.IndexProduct(ctx, models.ProductDocument{ID: "p1", Marca: "Dior", Version: 3}); err != nil {
+		t.Fatalf("update p1: %v", err)
+	}
+	if _, err := service.SearchProducts(ctx, SearchFilters{Marca: []string{"chanel"}}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if repo.searchCount != 2 {
+		t.Fatalf("expected the chanel search to stay cached, got %d backend calls", repo.searchCount)
+	}
+}
+
+func TestDeletingAProductForgetsItsTags(t *testing.T) {
+	repo := &mockIndexRepo{}
+	cache := newMapCache()
+	service := NewSearchService(repo, cache, time.Minute)
+	ctx := context.Background()
+
+	if err := service.IndexProduct(ctx, models.ProductDocument{ID: "p1", Marca: "Dior", Version: 1}); err != nil {
+		t.Fatalf("index p1: %v", err)
+	}
+	if err := service.DeleteProduct(ctx, "p1", 2); err != nil {
+		t.Fatalf("delete p1: %v", err)
+	}
+	if _, ok := cache.Get(ProductTagsKeyPrefix + "p1"); ok {
+		t.Fatalf("expected the tags of the deleted product to be removed")
+	}
+
+	// Recreating it replaces a tombstone, whose missing tags are expected.
+	globalBumps := cache.bumps[tagGlobal]
+	if err := service.IndexProduct(ctx, models.ProductDocument{ID: "p1", Marca: "Dior", Version: 3}); err != nil {
+		t.Fatalf("recreate p1: %v", err)
+	}
+	if cache.bumps[tagGlobal] != globalBumps {
+		t.Fatalf("expected recreating a deleted product not to invalidate everything")
+	}
+}
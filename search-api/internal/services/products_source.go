@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"search-api/internal/models"
+)
+
+// ProductsAPISource reads the catalog through the products-api export endpoint.
+type ProductsAPISource struct {
+	productsAPIURL string
+	httpClient     *http.Client
+}
+
+// NewProductsAPISource builds a ProductSource backed by products-api.
+func NewProductsAPISource(productsAPIURL string) *ProductsAPISource {
+	return &ProductsAPISource{
+		productsAPIURL: strings.TrimRight(productsAPIURL, "/"),
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// ExportProducts fetches the page of products that follows cursor.
+func (s *ProductsAPISource) ExportProducts(ctx context.Context, cursor string, limit int) ([]models.ProductDocument, string, error) {
+	params := url.Values{}
+	params.Set("limit", strconv.Itoa(limit))
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/products/export?%s", s.productsAPIURL, params.Encode()), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("products-api returned %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Data struct {
+			Items      []models.ProductDocument `json:"items"`
+			NextCursor string                   `json:"next_cursor"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, "", fmt.Errorf("decode export page: %w", err)
+	}
+	return envelope.Data.Items, envelope.Data.NextCursor, nil
+}
+
+// FetchProduct reads a single product. found is false when products-api
+// answers 404.
+func (s *ProductsAPISource) FetchProduct(ctx context.Context, id string) (models.ProductDocument, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/products/%s", s.productsAPIURL, url.PathEscape(id)), nil)
+	if err != nil {
+		return models.ProductDocument{}, false, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return models.ProductDocument{}, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return models.ProductDocument{}, false, nil
+	default:
+		return models.ProductDocument{}, false, fmt.Errorf("products-api returned %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Data models.ProductDocument `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return models.ProductDocument{}, false, fmt.Errorf("decode product: %w", err)
+	}
+	return envelope.Data, true, nil
+}
+
+// fallbackSearchTimeout bounds a fallback search so a struggling
+// products-api does not hold requests for the export timeout.
+const fallbackSearchTimeout = 3 * time.Second
+
+// SearchProducts implements FallbackSearcher with the products-api listing.
+// products-api matches the text as a substring of the name or description
+// and compares filter values ignoring case, as they arrive lowercased; it
+// cannot filter by variant, so such searches fail rather than return
+// unfiltered products.
+func (s *ProductsAPISource) SearchProducts(ctx context.Context, filters SearchFilters) (*SearchResult, error) {
+	if filters.Concentracion != "" || filters.TamanoML > 0 {
+		return nil, errors.New("products-api cannot filter by variant")
+	}
+	params := url.Values{}
+	if filters.Query != "" {
+		// The listing takes a regular expression.
+		params.Set("q", regexp.QuoteMeta(filters.Query))
+	}
+	for name, values := range map[string][]string{
+		"tipo": filters.Tipo, "estacion": filters.Estacion, "ocasion": filters.Ocasion,
+		"genero": filters.Genero, "marca": filters.Marca, "notas": filters.Notas,
+	} {
+		if len(values) > 0 {
+			params.Set(name, strings.Join(values, ","))
+		}
+	}
+	if len(filters.Notas) > 0 && filters.NotasMatch != "" {
+		params.Set("notas_match", filters.NotasMatch)
+	}
+	if filters.PrecioMin > 0 {
+		params.Set("precio_min", strconv.FormatFloat(filters.PrecioMin, 'f', -1, 64))
+	}
+	if filters.PrecioMax > 0 {
+		params.Set("precio_max", strconv.FormatFloat(filters.PrecioMax, 'f', -1, 64))
+	}
+	if filters.InStock {
+		params.Set("in_stock", "true")
+	}
+	params.Set("page", strconv.Itoa(filters.Page))
+	params.Set("size", strconv.Itoa(filters.Size))
+
+	ctx, cancel := context.WithTimeout(ctx, fallbackSearchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/products?%s", s.productsAPIURL, params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("products-api returned %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Data struct {
+			Items []models.ProductDocument `json:"items"`
+			Page  int                      `json:"page"`
+			Size  int                      `json:"size"`
+			Total int64                    `json:"total"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("decode product listing: %w", err)
+	}
+	items := envelope.Data.Items
+	if items == nil {
+		items = []models.ProductDocument{}
+	}
+	return &SearchResult{Items: items, Page: envelope.Data.Page, Size: envelope.Data.Size, Total: envelope.Data.Total}, nil
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"search-api/internal/models"
+)
+
+const (
+	defaultReconcilePageSize = 200
+	driftSampleSize          = 10
+)
+
+// ErrReconcileRunning is returned when a reconciliation is requested while another runs.
+var ErrReconcileRunning = errors.New("a reconciliation is already running")
+
+// ProductCatalog is the products-api view the reconciler compares against.
+type ProductCatalog interface {
+	ProductSource
+	FetchProduct(ctx context.Context, id string) (models.ProductDocument, bool, error)
+}
+
+// IndexEntry is the bookkeeping of one indexed document.
+type IndexEntry struct {
+	ID        string
+	Version   int64
+	Tombstone bool
+	UpdatedAt time.Time
+}
+
+// IndexScanner pages through every indexed document ordered by id, the same
+// order the products-api export uses.
+type IndexScanner interface {
+	ScanIndex(ctx context.Context, cursor string, limit int) ([]IndexEntry, string, error)
+}
+
+// DriftCount counts one kind of divergence and keeps a few ids as examples.
+type DriftCount struct {
+	Count  int      `json:"count"`
+	Sample []string `json:"sample"`
+}
+
+func (d *DriftCount) add(id string) {
+	d.Count++
+	if len(d.Sample) < driftSampleSize {
+		d.Sample = append(d.Sample, id)
+	}
+}
+
+// DriftReport is the result of comparing products-api with the index.
+type DriftReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DryRun     bool      `json:"dry_run"`
+	Checked    int       `json:"checked"`
+	// Missing products are not indexed, stale ones are indexed with an older
+	// version or a different updated_at, and orphaned documents belong to
+	// products that no longer exist.
+	Missing      DriftCount `json:"missing"`
+	Stale        DriftCount `json:"stale"`
+	Orphaned     DriftCount `json:"orphaned"`
+	Repaired     int        `json:"repaired"`
+	RepairFailed int        `json:"repair_failed"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// Reconciler periodically compares the products-api catalog with the index
+// and repairs what events missed.
+type Reconciler struct {
+	service  *SearchService
+	catalog  ProductCatalog
+	scanner  IndexScanner
+	pageSize int
+
+	running sync.Mutex
+	mu      sync.Mutex
+	last    *DriftReport
+}
+
+// NewReconciler builds a Reconciler that reads both sides pageSize items at a time.
+func NewReconciler(service *SearchService, catalog ProductCatalog, scanner IndexScanner, pageSize int) *Reconciler {
+	if pageSize <= 0 {
+		pageSize = defaultReconcilePageSize
+	}
+	return &Reconciler{service: service, catalog: catalog, scanner: scanner, pageSize: pageSize}
+}
+
+// Start reconciles every interval until ctx is cancelled.
+func (r *Reconciler) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reconcile(ctx, false); err != nil && !errors.Is(err, ErrReconcileRunning) {
+				log.Printf("reconcile index: %v", err)
+			}
+		}
+	}
+}
+
+// LastReport returns the report of the last finished reconciliation.
+func (r *Reconciler) LastReport() (DriftReport, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last == nil {
+		return DriftReport{}, false
+	}
+	return *r.last, true
+}
+
+// Reconcile walks products-api and the index side by side in id order and
+// repairs every divergence unless dryRun is set.
+func (r *Reconciler) Reconcile(ctx context.Context, dryRun bool) (DriftReport, error) {
+	if !r.running.TryLock() {
+		return DriftReport{}, ErrReconcileRunning
+	}
+	defer r.running.Unlock()
+
+	report := DriftReport{StartedAt: time.Now().UTC(), DryRun: dryRun}
+	err := r.compare(ctx, &report)
+	report.FinishedAt = time.Now().UTC()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	r.last = &report
+	r.mu.Unlock()
+
+	log.Printf("reconcile index: %d checked, %d missing, %d stale, %d orphaned, %d repaired, %d repair failures",
+		report.Checked, report.Missing.Count, report.Stale.Count, report.Orphaned.Count, report.Repaired, report.RepairFailed)
+	return report, err
+}
+
+func (r *Reconciler) compare(ctx context.Context, report *DriftReport) error {
+	products := &pager[models.ProductDocument]{fetch: func(cursor string) ([]models.ProductDocument, string, error) {
+		return r.catalog.ExportProducts(ctx, cursor, r.pageSize)
+	}}
+	entries := &pager[IndexEntry]{fetch: func(cursor string) ([]IndexEntry, string, error) {
+		return r.scanner.ScanIndex(ctx, cursor, r.pageSize)
+	}}
+
+	for {
+		product, err := products.peek()
+		if err != nil {
+			return fmt.Errorf("export products: %w", err)
+		}
+		entry, err := entries.peek()
+		if err != nil {
+			return fmt.Errorf("scan index: %w", err)
+		}
+
+		switch {
+		case product == nil && entry == nil:
+			return nil
+		case entry == nil || (product != nil && product.ID < entry.ID):
+			report.Checked++
+			report.Missing.add(product.ID)
+			r.repair(report, func() (bool, error) { return r.service.indexProduct(ctx, *product, true) })
+			products.next()
+		case product == nil || entry.ID < product.ID:
+			if !entry.Tombstone {
+				r.checkOrphan(ctx, report, *entry)
+			}
+			entries.next()
+		default:
+			report.Checked++
+			if entry.Tombstone {
+				report.Missing.add(product.ID)
+				r.repair(report, func() (bool, error) { return r.service.indexProduct(ctx, *product, true) })
+			} else if product.Version > entry.Version || product.UpdatedAt.UnixMilli() != entry.UpdatedAt.UnixMilli() {
+				report.Stale.add(product.ID)
+				r.repair(report, func() (bool, error) { return r.service.indexProduct(ctx, *product, true) })
+			}
+			products.next()
+			entries.next()
+		}
+	}
+}
+
+// checkOrphan confirms with products-api that an indexed product is really
+// gone before removing it: it may have been created after the export passed
+// its id.
+func (r *Reconciler) checkOrphan(ctx context.Context, report *DriftReport, entry IndexEntry) {
+	if _, found, err := r.catalog.FetchProduct(ctx, entry.ID); err != nil || found {
+		if err != nil {
+			log.Printf("reconcile: check product %s: %v", entry.ID, err)
+		}
+		return
+	}
+	report.Orphaned.add(entry.ID)
+	r.repair(report, func() (bool, error) { return r.service.deleteProduct(ctx, entry.ID, entry.Version+1) })
+}
+
+func (r *Reconciler) repair(report *DriftReport, fix func() (bool, error)) {
+	if report.DryRun {
+		return
+	}
+	applied, err := fix()
+	switch {
+	case err != nil:
+		report.RepairFailed++
+		log.Printf("reconcile: repair failed: %v", err)
+	case applied:
+		report.Repaired++
+	}
+}
+
+// pager iterates over a cursor-paged listing one item at a time.
+type pager[T any] struct {
+	fetch  func(cursor string) ([]T, string, error)
+	items  []T
+	cursor string
+	done   bool
+}
+
+// peek returns the current item, or nil once the listing is exhausted.
+func (p *pager[T]) peek() (*T, error) {
+	for len(p.items) == 0 && !p.done {
+		items, next, err := p.fetch(p.cursor)
+		if err != nil {
+			return nil, err
+		}
+		p.items, p.cursor, p.done = items, next, next == ""
+	}
+	if len(p.items) == 0 {
+		return nil, nil
+	}
+	return &p.items[0], nil
+}
+
+func (p *pager[T]) next() {
+	p.items = p.items[1:]
+}
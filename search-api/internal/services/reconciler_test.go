@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReconcileRepairsMissingStaleAndOrphanedDocuments(t *testing.T) {
+	reconciler, repo := newDriftFixture()
+
+	report, err := reconciler.Reconcile(context.Background(), false)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.Checked != 4 || report.Missing.Count != 1 || report.Stale.Count != 2 || report.Orphaned.Count != 1 {
+		t.Fatalf("unexpected drift report %+v", report)
+	}
+	if report.Missing.Sample[0] != "product-1" || report.Orphaned.Sample[0] != "orphan" {
+		t.Fatalf("unexpected samples %+v %+v", report.Missing, report.Orphaned)
+	}
+	if report.Repaired != 4 || report.RepairFailed != 0 {
+		t.Fatalf("expected the 4 divergences to be repaired, got %+v", report)
+	}
+
+	if state := repo.versions["orphan"]; !state.Tombstone {
+		t.Fatalf("expected orphan to be tombstoned, got %+v", state)
+	}
+	if state := repo.versions["product-2"]; state.Version != 2 {
+		t.Fatalf("expected stale product to be reindexed at version 2, got %+v", state)
+	}
+	if _, ok := repo.versions["created-later"]; ok {
+		t.Fatalf("a product that still exists in products-api must not be deleted")
+	}
+	if last, ok := reconciler.LastReport(); !ok || last.Checked != report.Checked {
+		t.Fatalf("expected last report to be kept, got %+v", last)
+	}
+}
+
+func TestReconcileDryRunOnlyReports(t *testing.T) {
+	reconciler, repo := newDriftFixture()
+
+	report, err := reconciler.Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.Missing.Count+report.Stale.Count+report.Orphaned.Count != 4 || report.Repaired != 0 {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+	if repo.indexCount != 0 || repo.deleteCount != 0 {
+		t.Fatalf("dry run must not write, got %d writes and %d deletes", repo.indexCount, repo.deleteCount)
+	}
+}
+
+// newDriftFixture builds a catalog of four products and an index where
+// product-1 is missing, product-2 is an older version, product-3 was edited
+// in the database without a version bump and orphan no longer exists.
+func newDriftFixture() (*Reconciler, *mockIndexRepo) {
+	updated := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	source := &fakeProductSource{catalog: catalogOf(4), existing: map[string]bool{"created-later": true}}
+	for i := range source.catalog {
+		source.catalog[i].UpdatedAt = updated
+	}
+	source.catalog[2].Version = 2
+	source.catalog[3].UpdatedAt = updated.Add(time.Minute)
+
+	entries := []IndexEntry{
+		{ID: "created-later", Version: 1, UpdatedAt: updated},
+		{ID: "orphan", Version: 4, UpdatedAt: updated},
+		{ID: "product-0", Version: 1, UpdatedAt: updated},
+		{ID: "product-2", Version: 1, UpdatedAt: updated},
+		{ID: "product-3", Version: 1, UpdatedAt: updated},
+		{ID: "removed", Version: 3, Tombstone: true, UpdatedAt: updated},
+	}
+	repo := &mockIndexRepo{versions: map[string]IndexedVersion{}}
+	for i, entry := range entries {
+		repo.versions[entry.ID] = IndexedVersion{Version: entry.Version, Tombstone: entry.Tombstone, Revision: int64(i + 1)}
+	}
+	repo.revision = int64(len(entries))
+	delete(repo.versions, "created-later")
+
+	service := NewSearchService(repo, nil, 0)
+	return NewReconciler(service, source, &fakeIndexScanner{entries: entries}, 2), repo
+}
+
+type fakeIndexScanner struct {
+	entries []IndexEntry
+}
+
+func (f *fakeIndexScanner) ScanIndex(ctx context.Context, cursor string, limit int) ([]IndexEntry, string, error) {
+	start := 0
+	if cursor != "" {
+		fmt.Sscanf(cursor, "%d", &start)
+	}
+	end := min(start+limit, len(f.entries))
+	next := ""
+	if end < len(f.entries) {
+		next = fmt.Sprint(end)
+	}
+	return f.entries[start:end], next, nil
+}
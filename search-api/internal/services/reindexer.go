@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"search-api/internal/models"
+)
+
+const (
+	defaultReindexBatchSize = 200
+	maxReindexBatchSize     = 500
+	reindexConcurrency      = 32
+)
+
+// ErrReindexRunning is returned when a reindex is requested while another runs.
+var ErrReindexRunning = errors.New("a reindex is already running")
+
+// ProductSource pages through the full product catalog. The returned cursor
+// is passed back to get the next page and is empty after the last one.
+type ProductSource interface {
+	ExportProducts(ctx context.Context, cursor string, limit int) ([]models.ProductDocument, string, error)
+}
+
+// CoreAdmin manages the backend cores used to rebuild the index off to the
+// side. SwapCores exchanges the names of two cores atomically, so readers of
+// core start seeing other's documents at once.
+type CoreAdmin interface {
+	CreateCore(ctx context.Context, name string) (IndexRepository, error)
+	SwapCores(ctx context.Context, core, other string) error
+	UnloadCore(ctx context.Context, name string) error
+}
+
+// ReindexOptions tunes a reindex run.
+type ReindexOptions struct {
+	BatchSize int
+	// NewCore builds the index into a fresh core and swaps it with the live
+	// one when finished, instead of rewriting the live core in place.
+	NewCore bool
+}
+
+// ReindexStatus reports the progress of the current or last reindex.
+type ReindexStatus struct {
+	Running    bool       `json:"running"`
+	NewCore    bool       `json:"new_core"`
+	Core       string     `json:"core,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Batches    int        `json:"batches"`
+	Indexed    int        `json:"indexed"`
+	Skipped    int        `json:"skipped"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Reindexer rebuilds the search index from the products-api catalog.
+type Reindexer struct {
+	service  *SearchService
+	source   ProductSource
+	admin    CoreAdmin
+	liveCore string
+
+	mu     sync.Mutex
+	status ReindexStatus
+}
+
+// NewReindexer builds a Reindexer. admin may be nil, in which case only
+// in-place rebuilds are available.
+func NewReindexer(service *SearchService, source ProductSource, admin CoreAdmin, liveCore string) *Reindexer {
+	return &Reindexer{service: service, source: source, admin: admin, liveCore: liveCore}
+}
+
+// Status returns a snapshot of the reindex progress.
+func (r *Reindexer) Status() ReindexStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Start launches a reindex in the background and returns its initial status.
+func (r *Reindexer) Start(ctx context.Context, opts ReindexOptions) (ReindexStatus, error) {
+	opts, err := r.begin(opts)
+	if err != nil {
+		return ReindexStatus{}, err
+	}
+	go r.run(ctx, opts)
+	return r.Status(), nil
+}
+
+// Run reindexes synchronously and returns the final status.
+func (r *Reindexer) Run(ctx context.Context, opts ReindexOptions) (ReindexStatus, error) {
+	opts, err := r.begin(opts)
+	if err != nil {
+		return ReindexStatus{}, err
+	}
+	err = r.run(ctx, opts)
+	return r.Status(), err
+}
+
+func (r *Reindexer) begin(opts ReindexOptions) (ReindexOptions, error) {
+	if opts.NewCore && r.admin == nil {
+		return opts, ValidationError{Message: "building into a new core is not supported by the index backend"}
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = defaultReindexBatchSize
+	}
+	opts.BatchSize = min(opts.BatchSize, maxReindexBatchSize)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status.Running {
+		return opts, ErrReindexRunning
+	}
+	now := time.Now().UTC()
+	r.status = ReindexStatus{Running: true, NewCore: opts.NewCore, Core: r.liveCore, StartedAt: &now}
+	return opts, nil
+}
+
+func (r *Reindexer) run(ctx context.Context, opts ReindexOptions) error {
+	err := r.rebuild(ctx, opts)
+
+	r.mu.Lock()
+	now := time.Now().UTC()
+	r.status.Running = false
+	r.status.FinishedAt = &now
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	status := r.status
+	r.mu.Unlock()
+
+	if err != nil {
+		log.Printf("reindex failed after %d products: %v", status.Indexed, err)
+		return err
+	}
+	log.Printf("reindex finished: %d indexed, %d skipped, %d failed in %d batches", status.Indexed, status.Skipped, status.Failed, status.Batches)
+	return nil
+}
+
+// rebuild pages through the catalog and writes every product with the same
+// version checks as events. When building into a new core, events keep being
+// applied to both cores until the swap, so the new core does not lose
+// changes made during the rebuild.
+func (r *Reindexer) rebuild(ctx context.Context, opts ReindexOptions) error {
+	target := r.service.indexRepo
+	staging := ""
+	if opts.NewCore {
+		staging = fmt.Sprintf("%s-%s", r.liveCore, time.Now().UTC().Format("20060102150405"))
+		repo, err := r.admin.CreateCore(ctx, staging)
+		if err != nil {
+			return fmt.Errorf("create core %s: %w", staging, err)
+		}
+		r.update(func(s *ReindexStatus) { s.Core = staging })
+		r.service.beginRebuild(repo)
+		target = repo
+	}
+
+	err := r.copyCatalog(ctx, target, opts.BatchSize)
+	if err == nil && opts.NewCore {
+		err = r.admin.SwapCores(ctx, r.liveCore, staging)
+		if err == nil {
+			r.update(func(s *ReindexStatus) { s.Core = r.liveCore })
+		}
+	}
+	if opts.NewCore {
+		// After a successful swap the staging name holds the old index;
+		// after a failure it holds the partial one. Either way it goes.
+		r.service.endRebuild()
+		if unloadErr := r.admin.UnloadCore(context.WithoutCancel(ctx), staging); unloadErr != nil {
+			log.Printf("unload core %s: %v", staging, unloadErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	r.service.invalidateCaches()
+	return nil
+}
+
+func (r *Reindexer) copyCatalog(ctx context.Context, target IndexRepository, batchSize int) error {
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		products, next, err := r.source.ExportProducts(ctx, cursor, batchSize)
+		if err != nil {
+			return fmt.Errorf("export products: %w", err)
+		}
+
+		// Products of a page are written concurrently so a batching index
+		// backend can send them together.
+		var (
+			mu                       sync.Mutex
+			wg                       sync.WaitGroup
+			indexed, skipped, failed int
+		)
+		slots := make(chan struct{}, reindexConcurrency)
+		for _, product := range products {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(product models.ProductDocument) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				applied, _, err := r.service.indexInto(ctx, target, product, false)
+				if applied {
+					// The rebuilt index is the one later changes start from.
+					r.service.rememberProductTags(product)
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err != nil:
+					failed++
+					log.Printf("reindex product %s: %v", product.ID, err)
+				case applied:
+					indexed++
+				default:
+					skipped++
+				}
+			}(product)
+		}
+		wg.Wait()
+		status := r.update(func(s *ReindexStatus) {
+			s.Batches++
+			s.Indexed += indexed
+			s.Skipped += skipped
+			s.Failed += failed
+		})
+		log.Printf("reindex batch %d: %d products so far (%d skipped, %d failed)", status.Batches, status.Indexed, status.Skipped, status.Failed)
+
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (r *Reindexer) update(change func(*ReindexStatus)) ReindexStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(&r.status)
+	return r.status
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"search-api/internal/models"
+)
+
+func TestReindexInPlaceSkipsUpToDateProducts(t *testing.T) {
+	repo := &mockIndexRepo{versions: map[string]IndexedVersion{"p1": {Version: 3, Revision: 1}}}
+	cache := newMapCache()
+	service := NewSearchService(repo, cache, 0)
+	source := &fakeProductSource{catalog: catalogOf(5)}
+	source.catalog[0].ID, source.catalog[0].Version = "p1", 3
+
+	status, err := NewReindexer(service, source, nil, "products-core").Run(context.Background(), ReindexOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	if status.Running || status.Batches != 3 || status.Indexed != 4 || status.Skipped != 1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if cache.bumps[tagGlobal] != 1 {
+		t.Fatalf("expected cached responses to be invalidated once, got %d", cache.bumps[tagGlobal])
+	}
+}
+
+func TestReindexIntoNewCoreKeepsChangesMadeDuringTheRebuild(t *testing.T) {
+	live := &mockIndexRepo{}
+	service := NewSearchService(live, nil, 0)
+	admin := &fakeCoreAdmin{}
+	source := &fakeProductSource{catalog: catalogOf(4)}
+	deleted := source.catalog[0]
+	// The first page is already in the new core when the product is deleted.
+	source.afterPage = func(page int) {
+		if page == 1 {
+			if err := service.DeleteProduct(context.Background(), deleted.ID, deleted.Version+1); err != nil {
+				t.Fatalf("delete during rebuild: %v", err)
+			}
+		}
+	}
+
+	reindexer := NewReindexer(service, source, admin, "products-core")
+	status, err := reindexer.Run(context.Background(), ReindexOptions{BatchSize: 2, NewCore: true})
+	if err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	if status.Indexed != 4 || status.Core != "products-core" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	if len(admin.swaps) != 1 || admin.swaps[0][0] != "products-core" || admin.swaps[0][1] != admin.created {
+		t.Fatalf("expected live core to be swapped with %s, got %v", admin.created, admin.swaps)
+	}
+	if admin.unloaded != admin.created {
+		t.Fatalf("expected the old index to be unloaded, got %q", admin.unloaded)
+	}
+	if state := admin.staging.versions[deleted.ID]; !state.Tombstone {
+		t.Fatalf("expected delete made during the rebuild to reach the new core, got %+v", state)
+	}
+	if service.stagingRepo() != nil {
+		t.Fatalf("expected updates to stop being mirrored after the swap")
+	}
+
+	if _, err := reindexer.Run(context.Background(), ReindexOptions{NewCore: true}); err != nil {
+		t.Fatalf("second reindex: %v", err)
+	}
+}
+
+func TestReindexDropsTheNewCoreWhenTheExportFails(t *testing.T) {
+	admin := &fakeCoreAdmin{}
+	service := NewSearchService(&mockIndexRepo{}, nil, 0)
+	source := &fakeProductSource{err: errors.New("products-api down")}
+
+	status, err := NewReindexer(service, source, admin, "products-core").Run(context.Background(), ReindexOptions{NewCore: true})
+	if err == nil || status.Error == "" {
+		t.Fatalf("expected reindex to fail, got %+v", status)
+	}
+	if len(admin.swaps) != 0 || admin.unloaded != admin.created {
+		t.Fatalf("expected no swap and the partial core unloaded, got swaps %v unloaded %q", admin.swaps, admin.unloaded)
+	}
+}
+
+func catalogOf(n int) []models.ProductDocument {
+	catalog := make([]models.ProductDocument, n)
+	for i := range catalog {
+		catalog[i] = models.ProductDocument{ID: fmt.Sprintf("product-%d", i), Name: "Producto", Version: 1}
+	}
+	return catalog
+}
+
+type fakeProductSource struct {
+	catalog []models.ProductDocument
+	// existing lists products that FetchProduct finds besides the catalog.
+	existing  map[string]bool
+	err       error
+	pages     int
+	afterPage func(page int)
+}
+
+func (f *fakeProductSource) ExportProducts(ctx context.Context, cursor string, limit int) ([]models.ProductDocument, string, error) {
+	if f.err != nil {
+		return nil, "", f.err
+	}
+	if f.pages > 0 && f.afterPage != nil {
+		f.afterPage(f.pages)
+	}
+	f.pages++
+
+	start := 0
+	if cursor != "" {
+		fmt.Sscanf(cursor, "%d", &start)
+	}
+	end := min(start+limit, len(f.catalog))
+	next := ""
+	if end < len(f.catalog) {
+		next = fmt.Sprint(end)
+	}
+	return f.catalog[start:end], next, nil
+}
+
+func (f *fakeProductSource) FetchProduct(ctx context.Context, id string) (models.ProductDocument, bool, error) {
+	for _, product := range f.catalog {
+		if product.ID == id {
+			return product, true, nil
+		}
+	}
+	return models.ProductDocument{ID: id}, f.existing[id], nil
+}
+
+type fakeCoreAdmin struct {
+	created  string
+	staging  *mockIndexRepo
+	swaps    [][2]string
+	unloaded string
+}
+
+func (f *fakeCoreAdmin) CreateCore(ctx context.Context, name string) (IndexRepository, error) {
+	f.created = name
+	f.staging = &mockIndexRepo{}
+	return f.staging, nil
+}
+
+func (f *fakeCoreAdmin) SwapCores(ctx context.Context, core, other string) error {
+	f.swaps = append(f.swaps, [2]string{core, other})
+	return nil
+}
+
+func (f *fakeCoreAdmin) UnloadCore(ctx context.Context, name string) error {
+	f.unloaded = name
+	return nil
+}
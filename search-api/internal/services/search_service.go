@@ -3,10 +3,13 @@ package services
 import (
 	"context"
 	"crypto/sha256"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"search-api/internal/cache"
@@ -42,15 +45,39 @@ func (e BackendError) Unwrap() error {
 
 // SearchFilters encapsulates query parameters for product search.
 type SearchFilters struct {
-	Query    string
-	Tipo     string
-	Estacion string
-	Ocasion  string
-	Genero   string
-	Marca    string
-	Page     int
-	Size     int
-	Sorts    []SortOption
+	Query string
+	// Tipo, Estacion, Ocasion, Genero and Marca match products with any of
+	// the given values.
+	Tipo     []string
+	Estacion []string
+	Ocasion  []string
+	Genero   []string
+	Marca    []string
+	// Notas matches products with any or, with NotasMatch NotasMatchAll,
+	// all of the given notes.
+	Notas      []string
+	NotasMatch string
+	// PrecioMin and PrecioMax bound the product price; zero leaves the
+	// bound open.
+	PrecioMin float64
+	PrecioMax float64
+	// InStock keeps only products with stock.
+	InStock bool
+	// Concentracion and TamanoML match products with at least one such variant.
+	Concentracion string
+	TamanoML      int
+	Page          int
+	Size          int
+	Sorts         []SortOption
+	// Facets lists the facets to count, from FacetFields and FacetPrecio.
+	Facets []string
+	// AutoCorrect replaces the results of a text query that matches nothing
+	// with those of its best spelling correction.
+	AutoCorrect bool
+	// Highlight returns the fragments of HighlightFields matching the text
+	// query, HTML-escaped, with the matches wrapped in HighlightTag.
+	Highlight    bool
+	HighlightTag string
 }
 
 // SearchResult represents a paginated Solr response.
@@ -59,19 +86,119 @@ type SearchResult struct {
 	Page  int                      `json:"page"`
 	Size  int                      `json:"size"`
 	Total int64                    `json:"total"`
+	// Facets maps each requested facet to its counts. A facet is counted
+	// without its own filter, so the shop can offer the other values too.
+	Facets map[string][]FacetCount `json:"facets,omitempty"`
+	// Suggestions are spelling corrections of a text query that matched few
+	// products, best first.
+	Suggestions []string `json:"suggestions,omitempty"`
+	// Corrected flags that the results are those of CorrectedQuery because
+	// the query as typed matched nothing.
+	Corrected      bool   `json:"corrected,omitempty"`
+	CorrectedQuery string `json:"corrected_query,omitempty"`
+	// Highlights maps product ids to the matching fragments of each of
+	// their HighlightFields, when highlighting was requested.
+	Highlights map[string]map[string][]string `json:"highlights,omitempty"`
+	// Degraded flags a response not served by a healthy search backend;
+	// DegradedSource tells where it came from instead.
+	Degraded       bool   `json:"degraded,omitempty"`
+	DegradedSource string `json:"degraded_source,omitempty"`
 }
 
+// HighlightFields are the product fields highlighted in search results.
+var HighlightFields = []string{"name", "descripcion", "notas"}
+
+// HighlightTags are the tags a caller can wrap highlighted matches in; the
+// rest of the fragment is HTML-escaped.
+var HighlightTags = []string{"em", "mark", "strong", "b"}
+
+// DefaultHighlightTag wraps matches when the caller does not choose a tag.
+const DefaultHighlightTag = "em"
+
+// FacetCount is the number of matching products for one facet value. Price
+// buckets also carry their bounds; To is absent for the last, open bucket.
+type FacetCount struct {
+	Value string   `json:"value"`
+	Count int64    `json:"count"`
+	From  *float64 `json:"from,omitempty"`
+	To    *float64 `json:"to,omitempty"`
+}
+
+// FacetFields are the product fields that can be faceted by value.
+var FacetFields = []string{"tipo", "estacion", "ocasion", "genero", "marca", "notas"}
+
+// FacetPrecio counts products per PriceRanges bucket.
+const FacetPrecio = "precio"
+
+// PriceRange is a [From, To) price bucket; To 0 leaves it open-ended.
+type PriceRange struct {
+	From float64
+	To   float64
+}
+
+// Label names the bucket in the facet response, e.g. "50-100" or "200+".
+func (p PriceRange) Label() string {
+	if p.To == 0 {
+		return fmt.Sprintf("%g+", p.From)
+	}
+	return fmt.Sprintf("%g-%g", p.From, p.To)
+}
+
+// PriceRanges are the buckets of the precio facet.
+var PriceRanges = []PriceRange{{0, 50}, {50, 100}, {100, 200}, {200, 0}}
+
+// NotasMatchAny and NotasMatchAll are the ways Notas can match a product.
+const (
+	NotasMatchAny = "any"
+	NotasMatchAll = "all"
+)
+
+// maxFilterValues bounds the values of a multi-value filter.
+const maxFilterValues = 20
+
 // SortOption represents a sort field and direction.
 type SortOption struct {
 	Field string
 	Desc  bool
 }
 
-// IndexRepository abstracts the search/index backend (Solr).
+// SortRelevance orders by how well products match the text query, best
+// first; its direction is ignored.
+const SortRelevance = "relevance"
+
+// RevisionAbsent makes a conditional index write succeed only when the
+// document does not exist yet. A zero revision writes unconditionally.
+const RevisionAbsent int64 = -1
+
+// maxIndexWriteAttempts bounds the read-compare-write retries on conflicts.
+const maxIndexWriteAttempts = 3
+
+// ErrRevisionConflict is returned by conditional writes when the document
+// changed since its revision was read.
+var ErrRevisionConflict = errors.New("index document changed concurrently")
+
+// IndexedVersion is the version bookkeeping the index keeps for a product.
+// Deleted products stay in the index as tombstones so late updates cannot
+// bring them back.
+type IndexedVersion struct {
+	Version   int64
+	Tombstone bool
+	// Revision is the backend document revision used for conditional writes.
+	Revision int64
+}
+
+// IndexRepository abstracts the search/index backend (Solr or the embedded
+// index). Writes take the revision read through IndexedVersion (or
+// RevisionAbsent) and fail with ErrRevisionConflict if the document changed
+// in between.
 type IndexRepository interface {
 	Search(ctx context.Context, filters SearchFilters) (*SearchResult, error)
-	IndexProduct(ctx context.Context, product models.ProductDocument) error
-	DeleteProduct(ctx context.Context, id string) error
+	IndexedVersion(ctx context.Context, id string) (IndexedVersion, bool, error)
+	IndexProduct(ctx context.Context, product models.ProductDocument, revision int64) error
+	DeleteProduct(ctx context.Context, id string, version, revision int64) error
+	Suggest(ctx context.Context, query string, limit int) (*SuggestCandidates, error)
+	SpellCheck(ctx context.Context, filters SearchFilters) ([]Collation, error)
+	Similar(ctx context.Context, id string, limit int) ([]models.ProductDocument, error)
 }
 
 // SearchService coordinates search, cache and index updates.
@@ -79,100 +206,279 @@ type SearchService struct {
 	indexRepo IndexRepository
 	cache     cache.Cache
 	cacheTTL  time.Duration
+	// suggestTTL is the cache lifetime of autocomplete suggestions.
+	suggestTTL time.Duration
+	// staleTTL is how long expired entries stay cached for degraded mode.
+	staleTTL time.Duration
+	fallback FallbackSearcher
+	// revalidateWindow is how long expired entries are still served while
+	// they are refreshed in the background.
+	revalidateWindow time.Duration
+	// flights coalesces concurrent backend calls per cache key.
+	flights flightGroup
+
+	// staging is the core being rebuilt by a Reindexer, if any. Index
+	// updates are applied to it as well so it does not miss changes made
+	// while the rebuild pages through the catalog.
+	stagingMu sync.RWMutex
+	staging   IndexRepository
 }
 
 // NewSearchService wires the service with its dependencies.
 func NewSearchService(indexRepo IndexRepository, cache cache.Cache, cacheTTL time.Duration) *SearchService {
 	return &SearchService{
-		indexRepo: indexRepo,
-		cache:     cache,
-		cacheTTL:  cacheTTL,
+		indexRepo:  indexRepo,
+		cache:      cache,
+		cacheTTL:   cacheTTL,
+		suggestTTL: defaultSuggestCacheTTL,
 	}
 }
 
 // SearchProducts runs a search over Solr with layered caching.
 func (s *SearchService) SearchProducts(ctx context.Context, filters SearchFilters) (*SearchResult, error) {
+	filters, key, err := s.prepareSearch(filters)
+	if err != nil {
+		return nil, err
+	}
+	var cached SearchResult
+	state := s.cacheLoad(key, &cached)
+	switch state {
+	case cacheFresh:
+		return &cached, nil
+	case cacheRevalidate:
+		// The copy keeps the background call from touching what is returned.
+		stale := cached
+		revalidate(&s.flights, key, func(ctx context.Context) (*SearchResult, error) {
+			return s.searchIndex(ctx, key, filters, &stale)
+		})
+		return &cached, nil
+	}
+	var stale *SearchResult
+	if state == cacheStale {
+		stale = &cached
+	}
+	return coalesce(ctx, &s.flights, key, func(ctx context.Context) (*SearchResult, error) {
+		return s.searchIndex(ctx, key, filters, stale)
+	})
+}
+
+// prepareSearch normalizes and validates filters and returns them with the
+// cache key of their response.
+func (s *SearchService) prepareSearch(filters SearchFilters) (SearchFilters, string, error) {
 	filters = applySearchDefaults(filters)
 	filters = normalizeFilters(filters)
 	if err := ValidateSearchFilters(filters); err != nil {
-		return nil, err
+		return filters, "", err
 	}
 	filters.Page, filters.Size = sanitizePagination(filters.Page, filters.Size)
+	return filters, s.scopedKey(buildCacheKey(filters), searchTags(filters)), nil
+}
 
-	key := buildCacheKey(filters)
-	if s.cache != nil {
-		if data, ok := s.cache.Get(key); ok {
-			var cached SearchResult
-			if err := json.Unmarshal(data, &cached); err == nil {
-				return &cached, nil
-			}
-		}
+// searchIndex runs a search on the index and caches its result. When the
+// index fails it answers in degraded mode, from stale if given.
+func (s *SearchService) searchIndex(ctx context.Context, key string, filters SearchFilters, stale *SearchResult) (*SearchResult, error) {
+	result, err := s.storeSearch(ctx, key, filters)
+	if err != nil {
+		log.Printf("search backend error: %v", err)
+		return s.degradedSearch(ctx, filters, stale, err)
 	}
+	return result, nil
+}
 
+// storeSearch runs a search on the index and caches its result under key.
+func (s *SearchService) storeSearch(ctx context.Context, key string, filters SearchFilters) (*SearchResult, error) {
 	result, err := s.indexRepo.Search(ctx, filters)
 	if err != nil {
-		// Fallback suave: si el backend de bÇ§squeda falla, devolvemos vacÇðo para no romper la UI.
-		log.Printf("search backend error: %v", err)
-		return &SearchResult{Items: []models.ProductDocument{}, Page: filters.Page, Size: filters.Size, Total: 0}, nil
+		return nil, err
 	}
-
-	if s.cache != nil && result != nil {
-		if encoded, err := json.Marshal(result); err == nil {
-			s.cache.Set(key, encoded, s.cacheTTL)
-		}
+	if result == nil {
+		return nil, BackendError{Message: "search backend returned no result"}
 	}
+	result = s.checkSpelling(ctx, filters, result)
+
+	s.cacheStore(key, result, s.cacheTTL)
 	return result, nil
 }
 
-// IndexProduct indexes or updates a product document.
+// IndexProduct indexes or updates a product document, skipping it when the
+// index already holds the same or a newer version, or the product was deleted.
 func (s *SearchService) IndexProduct(ctx context.Context, product models.ProductDocument) error {
+	_, err := s.indexProduct(ctx, product, false)
+	return err
+}
+
+// DeleteProduct replaces a product with a tombstone carrying the deletion version.
+func (s *SearchService) DeleteProduct(ctx context.Context, id string, version int64) error {
+	_, err := s.deleteProduct(ctx, id, version)
+	return err
+}
+
+// indexProduct writes product to the live index and to the core being
+// rebuilt, if any. With overwrite, a document of the same version is
+// rewritten too, which repairs edits that did not bump the version.
+func (s *SearchService) indexProduct(ctx context.Context, product models.ProductDocument, overwrite bool) (bool, error) {
 	if strings.TrimSpace(product.ID) == "" {
-		return ValidationError{Message: "product id is required"}
+		return false, ValidationError{Message: "product id is required"}
 	}
-	if err := s.indexRepo.IndexProduct(ctx, product); err != nil {
-		return err
+	applied, existed, err := s.indexInto(ctx, s.indexRepo, product, overwrite)
+	if err != nil {
+		return false, err
 	}
-	s.invalidateCaches()
-	return nil
+	if staging := s.stagingRepo(); staging != nil {
+		if _, _, err := s.indexInto(ctx, staging, product, overwrite); err != nil {
+			return applied, fmt.Errorf("index product into rebuild core: %w", err)
+		}
+	}
+	if applied {
+		s.invalidateProduct(product.ID, &product, existed)
+	}
+	return applied, nil
 }
 
-// DeleteProduct removes a product from the index.
-func (s *SearchService) DeleteProduct(ctx context.Context, id string) error {
+func (s *SearchService) deleteProduct(ctx context.Context, id string, version int64) (bool, error) {
 	if strings.TrimSpace(id) == "" {
-		return ValidationError{Message: "product id is required"}
+		return false, ValidationError{Message: "product id is required"}
 	}
-	if err := s.indexRepo.DeleteProduct(ctx, id); err != nil {
-		return err
+	applied, existed, err := s.deleteFrom(ctx, s.indexRepo, id, version)
+	if err != nil {
+		return false, err
 	}
-	s.invalidateCaches()
-	return nil
+	if staging := s.stagingRepo(); staging != nil {
+		if _, _, err := s.deleteFrom(ctx, staging, id, version); err != nil {
+			return applied, fmt.Errorf("delete product from rebuild core: %w", err)
+		}
+	}
+	if applied {
+		s.invalidateProduct(id, nil, existed)
+	}
+	return applied, nil
 }
 
-// FlushCaches clears all caches explicitly (used by admin endpoint).
-func (s *SearchService) FlushCaches(ctx context.Context) error {
-	if s.cache == nil {
-		return nil
+func (s *SearchService) indexInto(ctx context.Context, repo IndexRepository, product models.ProductDocument, overwrite bool) (bool, bool, error) {
+	return writeVersioned(ctx, repo, product.ID, product.Version, overwrite, func(version, revision int64) error {
+		product.Version = version
+		return repo.IndexProduct(ctx, product, revision)
+	})
+}
+
+func (s *SearchService) deleteFrom(ctx context.Context, repo IndexRepository, id string, version int64) (bool, bool, error) {
+	return writeVersioned(ctx, repo, id, version, false, func(version, revision int64) error {
+		return repo.DeleteProduct(ctx, id, version, revision)
+	})
+}
+
+// beginRebuild starts mirroring index updates into staging.
+func (s *SearchService) beginRebuild(staging IndexRepository) {
+	s.stagingMu.Lock()
+	defer s.stagingMu.Unlock()
+	s.staging = staging
+}
+
+// endRebuild stops mirroring index updates.
+func (s *SearchService) endRebuild() {
+	s.stagingMu.Lock()
+	defer s.stagingMu.Unlock()
+	s.staging = nil
+}
+
+func (s *SearchService) stagingRepo() IndexRepository {
+	s.stagingMu.RLock()
+	defer s.stagingMu.RUnlock()
+	return s.staging
+}
+
+// writeVersioned runs write unless the indexed state is newer than version,
+// retrying when another writer changed the document in between. Version 0
+// comes from publishers that predate versioning: it is written with the
+// indexed version so later versioned events still compare correctly. It
+// reports whether the write was applied and whether it replaced a live
+// document, not a tombstone.
+func writeVersioned(ctx context.Context, repo IndexRepository, id string, version int64, overwrite bool, write func(version, revision int64) error) (bool, bool, error) {
+	for attempt := 0; attempt < maxIndexWriteAttempts; attempt++ {
+		state, found, err := repo.IndexedVersion(ctx, id)
+		if err != nil {
+			return false, false, err
+		}
+		revision := RevisionAbsent
+		writeVersion := version
+		if found {
+			if isStale(state, version, overwrite) {
+				log.Printf("skip stale write for product %s (version %d, indexed %d)", id, version, state.Version)
+				return false, !state.Tombstone, nil
+			}
+			revision = state.Revision
+			writeVersion = max(version, state.Version)
+		}
+		err = write(writeVersion, revision)
+		if errors.Is(err, ErrRevisionConflict) {
+			continue
+		}
+		return err == nil, found && !state.Tombstone, err
 	}
-	return s.cache.Flush()
+	return false, false, fmt.Errorf("product %s: %w", id, ErrRevisionConflict)
 }
 
-func (s *SearchService) invalidateCaches() {
-	if s.cache == nil {
-		return
+func isStale(state IndexedVersion, version int64, overwrite bool) bool {
+	if version == 0 {
+		return state.Tombstone
 	}
-	_ = s.cache.Flush()
+	if overwrite && !state.Tombstone {
+		return version < state.Version
+	}
+	return version <= state.Version
+}
+
+// FlushCaches invalidates every cached response (used by admin endpoint).
+// It starts a new global generation rather than flushing Memcached, which
+// other services may share.
+func (s *SearchService) FlushCaches(ctx context.Context) error {
+	s.invalidateCaches()
+	return nil
 }
 
 func normalizeFilters(f SearchFilters) SearchFilters {
 	f.Query = strings.TrimSpace(f.Query)
-	f.Tipo = strings.ToLower(strings.TrimSpace(f.Tipo))
-	f.Estacion = strings.ToLower(strings.TrimSpace(f.Estacion))
-	f.Ocasion = strings.ToLower(strings.TrimSpace(f.Ocasion))
-	f.Genero = strings.ToLower(strings.TrimSpace(f.Genero))
-	f.Marca = strings.ToLower(strings.TrimSpace(f.Marca))
+	f.Tipo = normalizeValues(f.Tipo)
+	f.Estacion = normalizeValues(f.Estacion)
+	f.Ocasion = normalizeValues(f.Ocasion)
+	f.Genero = normalizeValues(f.Genero)
+	f.Marca = normalizeValues(f.Marca)
+	f.Notas = normalizeValues(f.Notas)
+	f.NotasMatch = strings.ToLower(strings.TrimSpace(f.NotasMatch))
+	if f.NotasMatch == "" {
+		f.NotasMatch = NotasMatchAny
+	}
+	f.Concentracion = strings.ToLower(strings.TrimSpace(f.Concentracion))
+	f.Facets = normalizeValues(f.Facets)
+	f.HighlightTag = strings.ToLower(strings.TrimSpace(f.HighlightTag))
+	if !f.Highlight {
+		f.HighlightTag = ""
+	} else if f.HighlightTag == "" {
+		f.HighlightTag = DefaultHighlightTag
+	}
 	return f
 }
 
+// normalizeValues lowercases, deduplicates and orders the values of a
+// multi-value parameter so equivalent requests share a cache entry.
+func normalizeValues(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(values))
+	var normalized []string
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if _, dup := seen[value]; value == "" || dup {
+			continue
+		}
+		seen[value] = struct{}{}
+		normalized = append(normalized, value)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
 func sanitizePagination(page, size int) (int, int) {
 	const (
 		defaultPageSize = 10
@@ -199,8 +505,10 @@ func buildCacheKey(f SearchFilters) string {
 		}
 		sortParts = append(sortParts, prefix+s.Field)
 	}
-	rawKey := fmt.Sprintf("q=%s|tipo=%s|estacion=%s|ocasion=%s|genero=%s|marca=%s|page=%d|size=%d|sort=%s",
-		f.Query, f.Tipo, f.Estacion, f.Ocasion, f.Genero, f.Marca, f.Page, f.Size, strings.Join(sortParts, ","))
+	rawKey := fmt.Sprintf("q=%s|tipo=%s|estacion=%s|ocasion=%s|genero=%s|marca=%s|notas=%s|notas_match=%s|precio=%g-%g|in_stock=%t|concentracion=%s|tamano_ml=%d|page=%d|size=%d|sort=%s|facets=%s|autocorrect=%t|highlight=%s",
+		f.Query, strings.Join(f.Tipo, ","), strings.Join(f.Estacion, ","), strings.Join(f.Ocasion, ","), strings.Join(f.Genero, ","), strings.Join(f.Marca, ","),
+		strings.Join(f.Notas, ","), f.NotasMatch, f.PrecioMin, f.PrecioMax, f.InStock,
+		f.Concentracion, f.TamanoML, f.Page, f.Size, strings.Join(sortParts, ","), strings.Join(f.Facets, ","), f.AutoCorrect, f.HighlightTag)
 	sum := sha256.Sum256([]byte(rawKey))
 	return fmt.Sprintf("search:%x", sum[:])
 }
@@ -215,6 +523,26 @@ func ValidateSearchFilters(filters SearchFilters) error {
 			return ValidationError{Message: "q must have 200 characters or fewer"}
 		}
 	}
+	if filters.TamanoML < 0 {
+		return ValidationError{Message: "tamano_ml must be zero or greater"}
+	}
+	for name, values := range map[string][]string{
+		"tipo": filters.Tipo, "estacion": filters.Estacion, "ocasion": filters.Ocasion,
+		"genero": filters.Genero, "marca": filters.Marca, "notas": filters.Notas,
+	} {
+		if len(values) > maxFilterValues {
+			return ValidationError{Message: fmt.Sprintf("%s accepts at most %d values", name, maxFilterValues)}
+		}
+	}
+	if filters.NotasMatch != "" && filters.NotasMatch != NotasMatchAny && filters.NotasMatch != NotasMatchAll {
+		return ValidationError{Message: "notas_match must be any or all"}
+	}
+	if filters.PrecioMin < 0 || filters.PrecioMax < 0 {
+		return ValidationError{Message: "precio_min and precio_max must be zero or greater"}
+	}
+	if filters.PrecioMax > 0 && filters.PrecioMin > filters.PrecioMax {
+		return ValidationError{Message: "precio_min must not be greater than precio_max"}
+	}
 	if filters.Page < 1 {
 		return ValidationError{Message: "page must be greater or equal to 1"}
 	}
@@ -222,9 +550,10 @@ func ValidateSearchFilters(filters SearchFilters) error {
 		return ValidationError{Message: "size must be between 1 and 100"}
 	}
 	allowedSort := map[string]struct{}{
-		"updated_at": {},
-		"precio":     {},
-		"stock":      {},
+		SortRelevance: {},
+		"updated_at":  {},
+		"precio":      {},
+		"stock":       {},
 	}
 	if len(filters.Sorts) > 3 {
 		return ValidationError{Message: "too many sort fields"}
@@ -234,6 +563,14 @@ func ValidateSearchFilters(filters SearchFilters) error {
 			return ValidationError{Message: "invalid sort field"}
 		}
 	}
+	if filters.HighlightTag != "" && !slices.Contains(HighlightTags, filters.HighlightTag) {
+		return ValidationError{Message: "highlight_tag must be one of " + strings.Join(HighlightTags, ", ")}
+	}
+	for _, facet := range filters.Facets {
+		if facet != FacetPrecio && !slices.Contains(FacetFields, facet) {
+			return ValidationError{Message: "invalid facet " + facet}
+		}
+	}
 	return nil
 }
 
@@ -245,7 +582,11 @@ func applySearchDefaults(filters SearchFilters) SearchFilters {
 		filters.Size = 10
 	}
 	if len(filters.Sorts) == 0 {
-		filters.Sorts = []SortOption{{Field: "updated_at", Desc: true}}
+		if strings.TrimSpace(filters.Query) != "" {
+			filters.Sorts = []SortOption{{Field: SortRelevance, Desc: true}}
+		} else {
+			filters.Sorts = []SortOption{{Field: "updated_at", Desc: true}}
+		}
 	}
 	return filters
 }
@@ -2,6 +2,11 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -58,8 +63,8 @@ func TestEventProcessorRoutesEvents(t *testing.T) {
 	if repo.indexCount != 1 {
 		t.Fatalf("expected index to be called on create event")
 	}
-	if cache.flushes != 1 {
-		t.Fatalf("expected caches to be flushed after create")
+	if cache.bumps[tagAll] != 1 {
+		t.Fatalf("expected cached searches to be invalidated after create")
 	}
 
 	deleteEvent := rabbitmq.ProductEvent{
@@ -74,66 +79,320 @@ func TestEventProcessorRoutesEvents(t *testing.T) {
 	if repo.deleteCount != 1 {
 		t.Fatalf("expected delete to be called on delete event")
 	}
-	if cache.flushes != 2 {
-		t.Fatalf("expected caches flushed twice")
+	if cache.bumps[tagAll] != 2 || cache.bumps[tagGlobal] != 0 || cache.flushes != 0 {
+		t.Fatalf("expected cached searches invalidated twice without a flush, got %v", cache.bumps)
+	}
+}
+
+func TestIndexerSkipsStaleAndDuplicateEvents(t *testing.T) {
+	repo := &mockIndexRepo{}
+	cache := newMapCache()
+	processor := NewEventProcessor(NewSearchService(repo, cache, time.Minute), "")
+	ctx := context.Background()
+
+	update := func(id string, version int64) rabbitmq.ProductEvent {
+		return rabbitmq.ProductEvent{
+			ID:      id,
+			Type:    rabbitmq.EventProductUpdated,
+			Product: models.ProductDocument{ID: "p1", Version: version},
+		}
+	}
+
+	if err := processor.HandleProductEvent(ctx, update("e3", 3)); err != nil {
+		t.Fatalf("handle v3: %v", err)
+	}
+	if err := processor.HandleProductEvent(ctx, update("e2", 2)); err != nil {
+		t.Fatalf("handle v2: %v", err)
+	}
+	if repo.indexCount != 1 || repo.versions["p1"].Version != 3 {
+		t.Fatalf("expected delayed v2 to be skipped, got %+v", repo.versions["p1"])
+	}
+
+	repo.versions["p1"] = IndexedVersion{Version: 1, Revision: repo.versions["p1"].Revision}
+	if err := processor.HandleProductEvent(ctx, update("e3", 3)); err != nil {
+		t.Fatalf("handle duplicate: %v", err)
+	}
+	if repo.indexCount != 1 {
+		t.Fatalf("expected redelivered event id to be skipped")
+	}
+
+	deleted := rabbitmq.ProductEvent{ID: "e5", Type: rabbitmq.EventProductDeleted, Product: models.ProductDocument{ID: "p1", Version: 5}}
+	if err := processor.HandleProductEvent(ctx, deleted); err != nil {
+		t.Fatalf("handle delete: %v", err)
+	}
+	if err := processor.HandleProductEvent(ctx, update("e4", 4)); err != nil {
+		t.Fatalf("handle late update: %v", err)
+	}
+	if state := repo.versions["p1"]; !state.Tombstone || state.Version != 5 {
+		t.Fatalf("expected tombstone to block the late update, got %+v", state)
+	}
+	if cache.bumps[tagAll] != 2 {
+		t.Fatalf("expected caches invalidated only for applied writes, got %d", cache.bumps[tagAll])
+	}
+}
+
+func TestIndexerRetriesRevisionConflicts(t *testing.T) {
+	repo := &mockIndexRepo{conflicts: 2}
+	service := NewSearchService(repo, newMapCache(), time.Minute)
+
+	if err := service.IndexProduct(context.Background(), models.ProductDocument{ID: "p1", Version: 1}); err != nil {
+		t.Fatalf("expected write to succeed after retries, got %v", err)
+	}
+	if repo.indexCount != 1 {
+		t.Fatalf("expected one applied write")
+	}
+
+	repo.conflicts = maxIndexWriteAttempts
+	err := service.IndexProduct(context.Background(), models.ProductDocument{ID: "p1", Version: 2})
+	if !errors.Is(err, ErrRevisionConflict) {
+		t.Fatalf("expected conflict after exhausting retries, got %v", err)
 	}
 }
 
 // --- test doubles ---
 
+func TestSearchRanksTextQueriesByRelevanceByDefault(t *testing.T) {
+	repo := &mockIndexRepo{}
+	service := NewSearchService(repo, nil, 0)
+
+	if _, err := service.SearchProducts(context.Background(), SearchFilters{Query: "vainilla otoño"}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if sorts := repo.lastSearch.Sorts; len(sorts) != 1 || sorts[0].Field != SortRelevance {
+		t.Fatalf("expected relevance sort for a text query, got %+v", sorts)
+	}
+
+	if _, err := service.SearchProducts(context.Background(), SearchFilters{Tipo: []string{"floral"}}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if sorts := repo.lastSearch.Sorts; len(sorts) != 1 || sorts[0].Field != "updated_at" || !sorts[0].Desc {
+		t.Fatalf("expected newest first without a text query, got %+v", sorts)
+	}
+}
+
+func TestSearchValidatesAndNormalizesFacets(t *testing.T) {
+	repo := &mockIndexRepo{}
+	service := NewSearchService(repo, newMapCache(), time.Minute)
+
+	if _, err := service.SearchProducts(context.Background(), SearchFilters{Facets: []string{"color"}}); err == nil {
+		t.Fatalf("expected unknown facet to be rejected")
+	}
+
+	if _, err := service.SearchProducts(context.Background(), SearchFilters{Facets: []string{" Marca", "precio", "marca"}}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if facets := repo.lastSearch.Facets; len(facets) != 2 || facets[0] != "marca" || facets[1] != FacetPrecio {
+		t.Fatalf("expected deduplicated facets, got %v", facets)
+	}
+	if _, err := service.SearchProducts(context.Background(), SearchFilters{Facets: []string{"precio", "marca"}}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if repo.searchCount != 1 {
+		t.Fatalf("expected the same facets in another order to hit the cache, got %d searches", repo.searchCount)
+	}
+}
+
 type mockIndexRepo struct {
+	mu          sync.Mutex
 	searchCount int
+	lastSearch  SearchFilters
 	indexCount  int
 	deleteCount int
 	result      *SearchResult
 	searchErr   error
+
+	suggestCount int
+	candidates   *SuggestCandidates
+
+	// byQuery overrides result for specific text queries.
+	byQuery    map[string]*SearchResult
+	collations []Collation
+	spellCount int
+
+	similar      []models.ProductDocument
+	similarCount int
+
+	versions  map[string]IndexedVersion
+	revision  int64
+	conflicts int
 }
 
 func (m *mockIndexRepo) Search(ctx context.Context, filters SearchFilters) (*SearchResult, error) {
 	m.searchCount++
+	m.lastSearch = filters
 	if m.searchErr != nil {
 		return nil, m.searchErr
 	}
+	if result, ok := m.byQuery[filters.Query]; ok {
+		return result, nil
+	}
 	if m.result != nil {
 		return m.result, nil
 	}
 	return &SearchResult{Items: []models.ProductDocument{}, Page: filters.Page, Size: filters.Size, Total: 0}, nil
 }
 
-func (m *mockIndexRepo) IndexProduct(ctx context.Context, product models.ProductDocument) error {
+func (m *mockIndexRepo) Suggest(ctx context.Context, query string, limit int) (*SuggestCandidates, error) {
+	m.suggestCount++
+	if m.searchErr != nil {
+		return nil, m.searchErr
+	}
+	if m.candidates != nil {
+		return m.candidates, nil
+	}
+	return &SuggestCandidates{}, nil
+}
+
+func (m *mockIndexRepo) SpellCheck(ctx context.Context, filters SearchFilters) ([]Collation, error) {
+	m.spellCount++
+	return m.collations, nil
+}
+
+func (m *mockIndexRepo) Similar(ctx context.Context, id string, limit int) ([]models.ProductDocument, error) {
+	m.similarCount++
+	return m.similar[:min(limit, len(m.similar))], nil
+}
+
+func (m *mockIndexRepo) IndexedVersion(ctx context.Context, id string) (IndexedVersion, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.versions[id]
+	return state, ok, nil
+}
+
+func (m *mockIndexRepo) IndexProduct(ctx context.Context, product models.ProductDocument, revision int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(product.ID, product.Version, false, revision); err != nil {
+		return err
+	}
 	m.indexCount++
 	return nil
 }
 
-func (m *mockIndexRepo) DeleteProduct(ctx context.Context, id string) error {
+func (m *mockIndexRepo) DeleteProduct(ctx context.Context, id string, version, revision int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(id, version, true, revision); err != nil {
+		return err
+	}
 	m.deleteCount++
 	return nil
 }
 
+// write mimics Solr's _version_ checks; conflicts simulates concurrent writers.
+func (m *mockIndexRepo) write(id string, version int64, tombstone bool, revision int64) error {
+	if m.versions == nil {
+		m.versions = map[string]IndexedVersion{}
+	}
+	current, exists := m.versions[id]
+	if m.conflicts > 0 {
+		m.conflicts--
+		return ErrRevisionConflict
+	}
+	if (revision == RevisionAbsent && exists) || (revision > 0 && revision != current.Revision) {
+		return ErrRevisionConflict
+	}
+	m.revision++
+	m.versions[id] = IndexedVersion{Version: version, Tombstone: tombstone, Revision: m.revision}
+	return nil
+}
+
 type mapCache struct {
+	mu      sync.Mutex
 	store   map[string][]byte
 	flushes int
+	// bumps counts the generations started per tag.
+	bumps map[string]int
 }
 
 func newMapCache() *mapCache {
-	return &mapCache{store: map[string][]byte{}}
+	return &mapCache{store: map[string][]byte{}, bumps: map[string]int{}}
 }
 
 func (m *mapCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	val, ok := m.store[key]
 	return val, ok
 }
 
 func (m *mapCache) Set(key string, value []byte, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.store[key] = value
+	if tag, ok := strings.CutPrefix(key, GenerationKeyPrefix); ok {
+		m.bumps[tag]++
+	}
 }
 
 func (m *mapCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.store, key)
 }
 
 func (m *mapCache) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.store = map[string][]byte{}
 	m.flushes++
 	return nil
 }
+
+func TestSearchValidatesAndNormalizesRangeAndMultiValueFilters(t *testing.T) {
+	repo := &mockIndexRepo{}
+	service := NewSearchService(repo, newMapCache(), time.Minute)
+
+	for _, filters := range []SearchFilters{
+		{PrecioMin: 100, PrecioMax: 50},
+		{PrecioMin: -1},
+		{Notas: []string{"vainilla"}, NotasMatch: "some"},
+		{Marca: make([]string, maxFilterValues+1)},
+	} {
+		for i := range filters.Marca {
+			filters.Marca[i] = fmt.Sprintf("marca-%d", i)
+		}
+		var validationErr ValidationError
+		if _, err := service.SearchProducts(context.Background(), filters); !errors.As(err, &validationErr) {
+			t.Fatalf("expected %+v to be rejected, got %v", filters, err)
+		}
+	}
+
+	filters := SearchFilters{Marca: []string{"Dior", " chanel"}, Notas: []string{"Vainilla"}, PrecioMax: 100, InStock: true}
+	if _, err := service.SearchProducts(context.Background(), filters); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if got := repo.lastSearch; !slices.Equal(got.Marca, []string{"chanel", "dior"}) || got.NotasMatch != NotasMatchAny {
+		t.Fatalf("expected normalized filters, got %+v", got)
+	}
+	filters.Marca = []string{"CHANEL", "dior", "Dior"}
+	if _, err := service.SearchProducts(context.Background(), filters); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	filters.InStock = false
+	if _, err := service.SearchProducts(context.Background(), filters); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if repo.searchCount != 2 {
+		t.Fatalf("expected equivalent filters to share a cache entry and in_stock to be part of the key, got %d searches", repo.searchCount)
+	}
+}
+
+func TestSearchAcceptsOnlyKnownHighlightTags(t *testing.T) {
+	repo := &mockIndexRepo{}
+	service := NewSearchService(repo, nil, 0)
+
+	_, err := service.SearchProducts(context.Background(), SearchFilters{Query: "vainilla", Highlight: true, HighlightTag: `em onmouseover="x"`})
+	var validationErr ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected an unknown tag to be rejected, got %v", err)
+	}
+
+	if _, err := service.SearchProducts(context.Background(), SearchFilters{Query: "vainilla", Highlight: true}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if repo.lastSearch.HighlightTag != DefaultHighlightTag {
+		t.Fatalf("expected the default tag, got %q", repo.lastSearch.HighlightTag)
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"search-api/internal/models"
+)
+
+// ErrProductNotFound is returned when the index has no live document for a product.
+var ErrProductNotFound = errors.New("product not found in the index")
+
+const (
+	defaultSimilarLimit = 6
+	// maxSimilarLimit is also the number of products fetched and cached per
+	// source product; smaller limits are served from the same entry.
+	maxSimilarLimit = 20
+)
+
+// SimilarCacheKeyPrefix starts the cache key of the similar products of a
+// product, followed by its id.
+const SimilarCacheKeyPrefix = "similar:"
+
+// SimilarResult lists the products most similar to a product.
+type SimilarResult struct {
+	ProductID string                   `json:"product_id"`
+	Items     []models.ProductDocument `json:"items"`
+	// Degraded flags recommendations not served by a healthy search backend.
+	Degraded       bool   `json:"degraded,omitempty"`
+	DegradedSource string `json:"degraded_source,omitempty"`
+}
+
+// SimilarProducts returns in-stock products that resemble product id by
+// notes, tipo, estacion and ocasion, most similar first, excluding the
+// product itself. Results are cached per product until the index changes.
+func (s *SearchService) SimilarProducts(ctx context.Context, id string, limit int) (*SimilarResult, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, ValidationError{Message: "product id is required"}
+	}
+	if limit <= 0 {
+		limit = defaultSimilarLimit
+	}
+	limit = min(limit, maxSimilarLimit)
+
+	result, err := s.similarItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// result may be shared with concurrent callers.
+	trimmed := *result
+	trimmed.Items = result.Items[:min(limit, len(result.Items))]
+	return &trimmed, nil
+}
+
+func (s *SearchService) similarItems(ctx context.Context, id string) (*SimilarResult, error) {
+	// Any product can become similar to this one, or stop being so.
+	key := s.scopedKey(SimilarCacheKeyPrefix+id, []string{tagAll})
+	var cached []models.ProductDocument
+	state := s.cacheLoad(key, &cached)
+	switch state {
+	case cacheFresh:
+		return &SimilarResult{ProductID: id, Items: cached}, nil
+	case cacheRevalidate:
+		revalidate(&s.flights, key, func(ctx context.Context) (*SimilarResult, error) {
+			return s.similarItemsFromIndex(ctx, key, id, cached)
+		})
+		return &SimilarResult{ProductID: id, Items: cached}, nil
+	}
+	var stale []models.ProductDocument
+	if state == cacheStale {
+		stale = cached
+	}
+	return coalesce(ctx, &s.flights, key, func(ctx context.Context) (*SimilarResult, error) {
+		return s.similarItemsFromIndex(ctx, key, id, stale)
+	})
+}
+
+// similarItemsFromIndex asks the index for the products similar to id and
+// caches them. When the index fails it answers from stale, if not nil.
+func (s *SearchService) similarItemsFromIndex(ctx context.Context, key, id string, stale []models.ProductDocument) (*SimilarResult, error) {
+	items, err := s.similarFromIndex(ctx, id)
+	if errors.Is(err, ErrProductNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		// Recommendations are optional on the product page: show stale ones or none.
+		log.Printf("similar products backend error: %v", err)
+		if stale != nil {
+			return &SimilarResult{ProductID: id, Items: stale, Degraded: true, DegradedSource: DegradedStaleCache}, nil
+		}
+		return &SimilarResult{ProductID: id, Items: []models.ProductDocument{}, Degraded: true, DegradedSource: DegradedUnavailable}, nil
+	}
+
+	s.cacheStore(key, items, s.cacheTTL)
+	return &SimilarResult{ProductID: id, Items: items}, nil
+}
+
+func (s *SearchService) similarFromIndex(ctx context.Context, id string) ([]models.ProductDocument, error) {
+	state, found, err := s.indexRepo.IndexedVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !found || state.Tombstone {
+		return nil, ErrProductNotFound
+	}
+	items, err := s.indexRepo.Similar(ctx, id, maxSimilarLimit)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []models.ProductDocument{}
+	}
+	return items, nil
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"search-api/internal/models"
+)
+
+func TestSimilarProductsAreCachedUntilTheSourceChanges(t *testing.T) {
+	repo := &mockIndexRepo{
+		versions: map[string]IndexedVersion{"p1": {Version: 1, Revision: 1}},
+		similar:  []models.ProductDocument{{ID: "p2"}, {ID: "p3"}, {ID: "p4"}},
+	}
+	service := NewSearchService(repo, newMapCache(), time.Minute)
+
+	result, err := service.SimilarProducts(context.Background(), "p1", 2)
+	if err != nil {
+		t.Fatalf("similar: %v", err)
+	}
+	if len(result.Items) != 2 || result.Items[0].ID != "p2" {
+		t.Fatalf("expected the 2 most similar products, got %+v", result.Items)
+	}
+	if result, _ = service.SimilarProducts(context.Background(), "p1", 0); len(result.Items) != 3 {
+		t.Fatalf("expected a larger limit to be served from the cache, got %+v", result.Items)
+	}
+	if repo.similarCount != 1 {
+		t.Fatalf("expected one backend query, got %d", repo.similarCount)
+	}
+
+	if err := service.IndexProduct(context.Background(), models.ProductDocument{ID: "p1", Version: 2}); err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	if _, err := service.SimilarProducts(context.Background(), "p1", 2); err != nil {
+		t.Fatalf("similar: %v", err)
+	}
+	if repo.similarCount != 2 {
+		t.Fatalf("expected a change to the product to invalidate its similar products")
+	}
+}
+
+func TestSimilarProductsRequireALiveProduct(t *testing.T) {
+	repo := &mockIndexRepo{versions: map[string]IndexedVersion{"gone": {Version: 3, Tombstone: true, Revision: 1}}}
+	service := NewSearchService(repo, newMapCache(), time.Minute)
+
+	for _, id := range []string{"gone", "missing"} {
+		if _, err := service.SimilarProducts(context.Background(), id, 0); !errors.Is(err, ErrProductNotFound) {
+			t.Fatalf("expected %s to be not found, got %v", id, err)
+		}
+	}
+	if repo.similarCount != 0 {
+		t.Fatalf("expected no similarity query for missing products")
+	}
+}
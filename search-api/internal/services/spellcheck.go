@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"log"
+)
+
+// spellcheckMaxHits is the number of results below which a text query is
+// checked for misspellings.
+const spellcheckMaxHits = 3
+
+// Collation is a corrected version of a text query and the number of
+// products it matches with the same filters.
+type Collation struct {
+	Query string
+	Hits  int64
+}
+
+// checkSpelling adds spelling suggestions to a text search with few results
+// and, when it found nothing and filters allow it, returns the results of
+// the best correction instead, flagged as corrected. Spellcheck failures
+// leave result as is.
+func (s *SearchService) checkSpelling(ctx context.Context, filters SearchFilters, result *SearchResult) *SearchResult {
+	if filters.Query == "" || result == nil || result.Total >= spellcheckMaxHits {
+		return result
+	}
+	collations, err := s.indexRepo.SpellCheck(ctx, filters)
+	if err != nil {
+		log.Printf("spellcheck backend error: %v", err)
+		return result
+	}
+
+	var best *Collation
+	for i, collation := range collations {
+		if collation.Query == "" || collation.Query == filters.Query {
+			continue
+		}
+		if best == nil && collation.Hits > result.Total {
+			best = &collations[i]
+		}
+		result.Suggestions = append(result.Suggestions, collation.Query)
+	}
+	if best == nil || result.Total > 0 || !filters.AutoCorrect {
+		return result
+	}
+
+	corrected := filters
+	corrected.Query = best.Query
+	correctedResult, err := s.indexRepo.Search(ctx, corrected)
+	if err != nil || correctedResult == nil {
+		log.Printf("search corrected query %q: %v", best.Query, err)
+		return result
+	}
+	correctedResult.Suggestions = result.Suggestions
+	correctedResult.Corrected = true
+	correctedResult.CorrectedQuery = best.Query
+	return correctedResult
+}
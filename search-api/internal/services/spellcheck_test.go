@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"search-api/internal/models"
+)
+
+func TestSearchCorrectsMisspelledQueriesWithoutResults(t *testing.T) {
+	repo := &mockIndexRepo{
+		byQuery: map[string]*SearchResult{
+			"vainilla": {Items: []models.ProductDocument{{ID: "p1"}}, Total: 1},
+		},
+		collations: []Collation{{Query: "vainilla", Hits: 1}, {Query: "vainas", Hits: 0}},
+	}
+	service := NewSearchService(repo, nil, 0)
+
+	result, err := service.SearchProducts(context.Background(), SearchFilters{Query: "vainila", AutoCorrect: true})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if !result.Corrected || result.CorrectedQuery != "vainilla" || result.Total != 1 {
+		t.Fatalf("expected the results of the corrected query, got %+v", result)
+	}
+	if len(result.Suggestions) != 2 || result.Suggestions[0] != "vainilla" {
+		t.Fatalf("expected the corrections as suggestions, got %v", result.Suggestions)
+	}
+
+	result, err = service.SearchProducts(context.Background(), SearchFilters{Query: "vainila"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if result.Corrected || result.Total != 0 || len(result.Suggestions) != 2 {
+		t.Fatalf("expected only suggestions without autocorrect, got %+v", result)
+	}
+}
+
+func TestSearchSkipsSpellcheckWhenTheQueryMatchesEnough(t *testing.T) {
+	repo := &mockIndexRepo{result: &SearchResult{Total: spellcheckMaxHits}}
+	service := NewSearchService(repo, nil, 0)
+
+	if _, err := service.SearchProducts(context.Background(), SearchFilters{Query: "vainilla", AutoCorrect: true}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if repo.spellCount != 0 {
+		t.Fatalf("expected no spellcheck, got %d", repo.spellCount)
+	}
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"search-api/internal/models"
+)
+
+const (
+	// SuggestionProduct, SuggestionBrand and SuggestionNote are the kinds of
+	// autocomplete suggestions.
+	SuggestionProduct = "product"
+	SuggestionBrand   = "brand"
+	SuggestionNote    = "note"
+
+	// SuggestCacheKeyPrefix starts every suggestion cache key, so the cache
+	// can give them their own short lifetime.
+	SuggestCacheKeyPrefix = "suggest:"
+
+	defaultSuggestLimit    = 8
+	maxSuggestLimit        = 20
+	maxSuggestQueryLength  = 50
+	defaultSuggestCacheTTL = 10 * time.Second
+)
+
+// SuggestCandidates are the index matches for a partial query: products
+// whose name, brand or notes start with the typed words, and the brand and
+// note values of those products with their counts.
+type SuggestCandidates struct {
+	Products []models.ProductDocument
+	Brands   []FacetCount
+	Notes    []FacetCount
+}
+
+// Suggestion is one autocomplete entry. Highlight wraps the typed prefix of
+// each matching word in <em> tags.
+type Suggestion struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Highlight string `json:"highlight"`
+	ProductID string `json:"product_id,omitempty"`
+	Count     int64  `json:"count,omitempty"`
+}
+
+// SuggestResult is the response of the autocomplete endpoint.
+type SuggestResult struct {
+	Query       string       `json:"query"`
+	Suggestions []Suggestion `json:"suggestions"`
+	// Degraded flags suggestions not served by a healthy search backend.
+	Degraded       bool   `json:"degraded,omitempty"`
+	DegradedSource string `json:"degraded_source,omitempty"`
+}
+
+// WithSuggestCacheTTL sets how long suggestions are cached; they go stale
+// faster than searches matter, so the default is short.
+func (s *SearchService) WithSuggestCacheTTL(ttl time.Duration) *SearchService {
+	s.suggestTTL = ttl
+	return s
+}
+
+// Suggest returns typed suggestions for what the user has typed so far.
+// Products come first, then brands and notes, up to limit entries.
+func (s *SearchService) Suggest(ctx context.Context, query string, limit int) (*SuggestResult, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	if query == "" {
+		return nil, ValidationError{Message: "q is required"}
+	}
+	if len([]rune(query)) > maxSuggestQueryLength {
+		return nil, ValidationError{Message: fmt.Sprintf("q must have %d characters or fewer", maxSuggestQueryLength)}
+	}
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+	limit = min(limit, maxSuggestLimit)
+
+	key := SuggestCacheKeyPrefix + fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("q=%s|limit=%d", foldText(query), limit))))
+	key = s.scopedKey(key, []string{tagAll})
+	var cached SuggestResult
+	state := s.cacheLoad(key, &cached)
+	switch state {
+	case cacheFresh:
+		return &cached, nil
+	case cacheRevalidate:
+		stale := cached
+		revalidate(&s.flights, key, func(ctx context.Context) (*SuggestResult, error) {
+			return s.suggestFromIndex(ctx, key, query, limit, &stale)
+		})
+		return &cached, nil
+	}
+	var stale *SuggestResult
+	if state == cacheStale {
+		stale = &cached
+	}
+	return coalesce(ctx, &s.flights, key, func(ctx context.Context) (*SuggestResult, error) {
+		return s.suggestFromIndex(ctx, key, query, limit, stale)
+	})
+}
+
+// suggestFromIndex asks the index for suggestions and caches them.
+func (s *SearchService) suggestFromIndex(ctx context.Context, key, query string, limit int, stale *SuggestResult) (*SuggestResult, error) {
+	candidates, err := s.indexRepo.Suggest(ctx, query, limit)
+	if err != nil {
+		// Autocomplete is best effort: stale or no suggestions keep the UI working.
+		log.Printf("suggest backend error: %v", err)
+		if stale != nil {
+			stale.Degraded, stale.DegradedSource = true, DegradedStaleCache
+			return stale, nil
+		}
+		return &SuggestResult{Query: query, Suggestions: []Suggestion{}, Degraded: true, DegradedSource: DegradedUnavailable}, nil
+	}
+	result := &SuggestResult{Query: query, Suggestions: buildSuggestions(query, candidates, limit)}
+
+	s.cacheStore(key, result, s.suggestTTL)
+	return result, nil
+}
+
+func buildSuggestions(query string, candidates *SuggestCandidates, limit int) []Suggestion {
+	suggestions := []Suggestion{}
+	if candidates == nil {
+		return suggestions
+	}
+	terms := strings.Fields(foldText(query))
+	seen := map[string]struct{}{}
+	add := func(suggestion Suggestion) {
+		key := suggestion.Type + "|" + foldText(suggestion.Value)
+		if _, dup := seen[key]; dup || len(suggestions) >= limit {
+			return
+		}
+		seen[key] = struct{}{}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	for _, product := range candidates.Products {
+		highlight, _ := highlightPrefixes(product.Name, terms)
+		add(Suggestion{Type: SuggestionProduct, Value: product.Name, Highlight: highlight, ProductID: product.ID})
+	}
+	// Brand and note values come from the matching products, which may
+	// match through another field; keep only the values that match.
+	for _, group := range []struct {
+		kind   string
+		values []FacetCount
+	}{{SuggestionBrand, candidates.Brands}, {SuggestionNote, candidates.Notes}} {
+		for _, value := range group.values {
+			if highlight, ok := highlightPrefixes(value.Value, terms); ok {
+				add(Suggestion{Type: group.kind, Value: value.Value, Highlight: highlight, Count: value.Count})
+			}
+		}
+	}
+	return suggestions
+}
+
+// highlightPrefixes wraps the part of each word of text that starts with one
+// of terms in <em> tags, comparing without case or accents, and escapes the
+// rest so the result can be rendered as HTML. ok reports whether every term
+// matched a word.
+func highlightPrefixes(text string, terms []string) (string, bool) {
+	matched := make(map[string]bool, len(terms))
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+		end := i
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		word := runes[i:end]
+		folded := foldText(string(word))
+		best := 0
+		for _, term := range terms {
+			if strings.HasPrefix(folded, term) {
+				matched[term] = true
+				best = max(best, len([]rune(term)))
+			}
+		}
+		if best > 0 {
+			b.WriteString("<em>" + string(word[:best]) + "</em>" + string(word[best:]))
+		} else {
+			b.WriteString(string(word))
+		}
+		i = end
+	}
+	return b.String(), len(matched) == len(terms)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// foldText lowercases text and strips the accents used in Spanish and
+// French product names, keeping one rune per rune so offsets still match.
+func foldText(text string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if folded, ok := accentFolds[r]; ok {
+			return folded
+		}
+		return r
+	}, text)
+}
+
+var accentFolds = map[rune]rune{
+	'á': 'a', 'à': 'a', 'â': 'a', 'ä': 'a', 'ã': 'a',
+	'é': 'e', 'è': 'e', 'ê': 'e', 'ë': 'e',
+	'í': 'i', 'ì': 'i', 'î': 'i', 'ï': 'i',
+	'ó': 'o', 'ò': 'o', 'ô': 'o', 'ö': 'o', 'õ': 'o',
+	'ú': 'u', 'ù': 'u', 'û': 'u', 'ü': 'u',
+	'ñ': 'n', 'ç': 'c',
+}
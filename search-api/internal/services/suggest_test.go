@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"search-api/internal/models"
+)
+
+func TestSuggestReturnsTypedHighlightedSuggestions(t *testing.T) {
+	repo := &mockIndexRepo{candidates: &SuggestCandidates{
+		Products: []models.ProductDocument{{ID: "p1", Name: "Vainilla Ámbar"}},
+		Brands:   []FacetCount{{Value: "Armani", Count: 3}, {Value: "Dior", Count: 2}},
+		Notes:    []FacetCount{{Value: "ámbar", Count: 5}, {Value: "vainilla", Count: 4}},
+	}}
+	service := NewSearchService(repo, newMapCache(), 0)
+
+	result, err := service.Suggest(context.Background(), "  am ", 0)
+	if err != nil {
+		t.Fatalf("suggest: %v", err)
+	}
+	want := []Suggestion{
+		{Type: SuggestionProduct, Value: "Vainilla Ámbar", Highlight: "Vainilla <em>Ám</em>bar", ProductID: "p1"},
+		{Type: SuggestionNote, Value: "ámbar", Highlight: "<em>ám</em>bar", Count: 5},
+	}
+	if len(result.Suggestions) != len(want) {
+		t.Fatalf("expected %d suggestions, got %+v", len(want), result.Suggestions)
+	}
+	for i := range want {
+		if result.Suggestions[i] != want[i] {
+			t.Fatalf("suggestion %d: expected %+v, got %+v", i, want[i], result.Suggestions[i])
+		}
+	}
+
+	if _, err := service.Suggest(context.Background(), "ÁM", 0); err != nil {
+		t.Fatalf("suggest: %v", err)
+	}
+	if repo.suggestCount != 1 {
+		t.Fatalf("expected the folded query to hit the cache, got %d lookups", repo.suggestCount)
+	}
+}
+
+func TestSuggestRequiresAShortQuery(t *testing.T) {
+	service := NewSearchService(&mockIndexRepo{}, nil, 0)
+	for _, query := range []string{" ", strings.Repeat("a", maxSuggestQueryLength+1)} {
+		var validationErr ValidationError
+		if _, err := service.Suggest(context.Background(), query, 0); !errors.As(err, &validationErr) {
+			t.Fatalf("expected a validation error for %q, got %v", query, err)
+		}
+	}
+}
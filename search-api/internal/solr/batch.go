@@ -0,0 +1,173 @@
+package solr
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"search-api/internal/services"
+)
+
+// BatchConfig tunes how index writes are grouped into bulk updates.
+type BatchConfig struct {
+	// MaxDocs flushes a batch as soon as it holds this many documents.
+	MaxDocs int
+	// Interval flushes a partial batch this long after its first document.
+	Interval time.Duration
+	// MaxAttempts bounds the attempts of a batch before it is split into
+	// single-document writes.
+	MaxAttempts int
+	RetryDelay  time.Duration
+	// Timeout bounds each update request.
+	Timeout time.Duration
+}
+
+// EnableBatching makes the client buffer document writes and send them in
+// bulk. Each write still waits for the outcome of its own document.
+func (c *Client) EnableBatching(cfg BatchConfig) *Client {
+	if cfg.MaxDocs <= 1 {
+		c.batch = nil
+		return c
+	}
+	c.batch = newBatcher(c, cfg)
+	return c
+}
+
+// batcher collects documents for one core and flushes them by size or time.
+type batcher struct {
+	client *Client
+	cfg    BatchConfig
+
+	mu      sync.Mutex
+	pending []*pendingDoc
+	timer   *time.Timer
+}
+
+type pendingDoc struct {
+	doc  map[string]interface{}
+	done chan error
+}
+
+func newBatcher(client *Client, cfg BatchConfig) *batcher {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 100 * time.Millisecond
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = 200 * time.Millisecond
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &batcher{client: client, cfg: cfg}
+}
+
+// submit queues doc and waits until the batch holding it was written. If ctx
+// ends first the document may still be written; callers retry idempotently.
+func (b *batcher) submit(ctx context.Context, doc map[string]interface{}) error {
+	pending := &pendingDoc{doc: doc, done: make(chan error, 1)}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, pending)
+	if len(b.pending) >= b.cfg.MaxDocs {
+		batch := b.take()
+		b.mu.Unlock()
+		go b.flush(batch)
+	} else {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.cfg.Interval, b.flushPending)
+		}
+		b.mu.Unlock()
+	}
+
+	select {
+	case err := <-pending.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *batcher) flushPending() {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+	b.flush(batch)
+}
+
+// take empties the buffer; b.mu must be held.
+func (b *batcher) take() []*pendingDoc {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+// flush writes batch, retrying transient failures. A batch that still fails
+// is split so every document gets its own result: a version conflict or a
+// bad document then only fails its own write.
+func (b *batcher) flush(batch []*pendingDoc) {
+	if len(batch) == 0 {
+		return
+	}
+	docs := make([]map[string]interface{}, len(batch))
+	for i, pending := range batch {
+		docs[i] = pending.doc
+	}
+
+	var err error
+	for attempt := 1; attempt <= b.cfg.MaxAttempts; attempt++ {
+		if err = b.post(docs); err == nil || errors.Is(err, services.ErrRevisionConflict) {
+			break
+		}
+		if attempt < b.cfg.MaxAttempts {
+			time.Sleep(b.cfg.RetryDelay * time.Duration(attempt))
+		}
+	}
+	if err == nil || len(batch) == 1 {
+		for _, pending := range batch {
+			pending.done <- err
+		}
+		return
+	}
+
+	log.Printf("solr batch of %d documents failed, writing them one by one: %v", len(batch), err)
+	for _, pending := range batch {
+		err := b.post([]map[string]interface{}{pending.doc})
+		if errors.Is(err, services.ErrRevisionConflict) && b.alreadyApplied(pending.doc) {
+			err = nil
+		}
+		pending.done <- err
+	}
+}
+
+func (b *batcher) post(docs []map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.Timeout)
+	defer cancel()
+	return b.client.postUpdate(ctx, docs)
+}
+
+// alreadyApplied tells whether doc was written by the failed batch before
+// the failure: Solr keeps the documents that precede a conflict, so resending
+// them with their old _version_ conflicts with themselves.
+func (b *batcher) alreadyApplied(doc map[string]interface{}) bool {
+	version, ok := doc["product_version"].(int64)
+	if !ok {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.Timeout)
+	defer cancel()
+	state, found, err := b.client.IndexedVersion(ctx, stringValue(doc["id"]))
+	if err != nil || !found {
+		return false
+	}
+	tombstone, _ := doc["tombstone"].(bool)
+	return state.Version == version && state.Tombstone == tombstone
+}
@@ -0,0 +1,125 @@
+package solr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"search-api/internal/models"
+	"search-api/internal/services"
+)
+
+func TestBatchingSendsConcurrentWritesInOneSoftCommittedRequest(t *testing.T) {
+	solr := newFakeSolr()
+	server := httptest.NewServer(solr)
+	defer server.Close()
+	client := NewClient(server.URL, "products-core").EnableBatching(BatchConfig{MaxDocs: 3, Interval: time.Minute})
+
+	errs := writeConcurrently(client, "a", "b", "c")
+	for id, err := range errs {
+		if err != nil {
+			t.Fatalf("write %s: %v", id, err)
+		}
+	}
+	if len(solr.requests) != 1 || solr.requests[0] != 3 {
+		t.Fatalf("expected one request with 3 documents, got %v", solr.requests)
+	}
+	if !solr.softCommit {
+		t.Fatalf("expected updates to soft commit")
+	}
+}
+
+func TestBatchingReportsFailuresPerDocument(t *testing.T) {
+	solr := newFakeSolr()
+	solr.conflicting = "b"
+	server := httptest.NewServer(solr)
+	defer server.Close()
+	client := NewClient(server.URL, "products-core").EnableBatching(BatchConfig{MaxDocs: 50, Interval: 20 * time.Millisecond})
+
+	errs := writeConcurrently(client, "a", "b", "c")
+	if !errors.Is(errs["b"], services.ErrRevisionConflict) {
+		t.Fatalf("expected the conflicting document to fail alone, got %v", errs["b"])
+	}
+	// a may have been kept by Solr before the conflict; it must not be
+	// reported as a conflict with itself.
+	if errs["a"] != nil || errs["c"] != nil {
+		t.Fatalf("expected the other documents to be written, got a=%v c=%v", errs["a"], errs["c"])
+	}
+	if solr.requests[0] != 3 || len(solr.requests) != 4 {
+		t.Fatalf("expected the failed batch to be split into single writes, got %v", solr.requests)
+	}
+}
+
+func writeConcurrently(client *Client, ids ...string) map[string]error {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = map[string]error{}
+	)
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			err := client.IndexProduct(context.Background(), models.ProductDocument{ID: id, Version: 2}, 7)
+			mu.Lock()
+			errs[id] = err
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return errs
+}
+
+// fakeSolr mimics the update and real-time get handlers. A batch containing
+// the conflicting id fails after keeping the documents sent before it.
+type fakeSolr struct {
+	mu          sync.Mutex
+	conflicting string
+	requests    []int
+	softCommit  bool
+	stored      map[string]int64
+}
+
+func newFakeSolr() *fakeSolr {
+	return &fakeSolr{stored: map[string]int64{}}
+}
+
+func (f *fakeSolr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/products-core/update":
+		f.softCommit = r.URL.Query().Get("softCommit") == "true"
+		var docs []map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&docs); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.requests = append(f.requests, len(docs))
+		for _, doc := range docs {
+			id := doc["id"].(string)
+			if _, kept := f.stored[id]; kept || id == f.conflicting {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			f.stored[id] = int64(doc["product_version"].(float64))
+		}
+	case "/products-core/get":
+		id := r.URL.Query().Get("id")
+		version, ok := f.stored[id]
+		if !ok {
+			fmt.Fprint(w, `{"doc":null}`)
+			return
+		}
+		fmt.Fprintf(w, `{"doc":{"id":%q,"product_version":%d,"_version_":8}}`, id, version)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
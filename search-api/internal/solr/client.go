@@ -20,6 +20,8 @@ type Client struct {
 	baseURL    string
 	core       string
 	httpClient *http.Client
+	// batch groups writes into bulk updates when batching is enabled.
+	batch *batcher
 }
 
 // NewClient builds a Solr client with sane defaults.
@@ -39,31 +41,23 @@ func NewClient(baseURL, core string) *Client {
 	}
 }
 
-// Search runs a query against Solr and returns a paginated result.
-func (c *Client) Search(ctx context.Context, filters services.SearchFilters) (*services.SearchResult, error) {
-	params := url.Values{}
-	params.Set("wt", "json")
-	params.Set("q", "*:*")
+const (
+	// textQueryFields ranks matches in the name above the brand, the notes
+	// and the description.
+	textQueryFields   = "name_es^8 marca_es^4 notas_es^2 descripcion_es"
+	phraseQueryFields = "name_es^16 descripcion_es^2"
+	// minimumShouldMatch requires every word of short queries and lets
+	// longer ones miss a quarter of them.
+	minimumShouldMatch = "2<-25%"
+)
 
-	if filters.Query != "" {
-		term := escapeTerm(filters.Query)
-		params.Add("fq", fmt.Sprintf("(name:*%s* OR descripcion:*%s*)", term, term))
-	}
-	if filters.Tipo != "" {
-		params.Add("fq", fmt.Sprintf("tipo:%s", escapeTerm(filters.Tipo)))
-	}
-	if filters.Estacion != "" {
-		params.Add("fq", fmt.Sprintf("estacion:%s", escapeTerm(filters.Estacion)))
-	}
-	if filters.Ocasion != "" {
-		params.Add("fq", fmt.Sprintf("ocasion:%s", escapeTerm(filters.Ocasion)))
-	}
-	if filters.Genero != "" {
-		params.Add("fq", fmt.Sprintf("genero:%s", escapeTerm(filters.Genero)))
-	}
-	if filters.Marca != "" {
-		params.Add("fq", fmt.Sprintf("marca:%s", escapeTerm(filters.Marca)))
-	}
+// Search runs a query against Solr and returns a paginated result. The text
+// query is parsed by edismax over the Spanish-analyzed fields, so results
+// are ranked by relevance.
+func (c *Client) Search(ctx context.Context, filters services.SearchFilters) (*services.SearchResult, error) {
+	params := queryParams(filters)
+	addFacetParams(params, filters.Facets)
+	addHighlightParams(params, filters)
 
 	start := (filters.Page - 1) * filters.Size
 	if start < 0 {
@@ -76,6 +70,10 @@ func (c *Client) Search(ctx context.Context, filters services.SearchFilters) (*s
 	} else {
 		var sorts []string
 		for _, s := range filters.Sorts {
+			if s.Field == services.SortRelevance {
+				sorts = append(sorts, "score desc")
+				continue
+			}
 			order := "asc"
 			if s.Desc {
 				order = "desc"
@@ -109,39 +107,320 @@ func (c *Client) Search(ctx context.Context, filters services.SearchFilters) (*s
 	}
 
 	return &services.SearchResult{
-		Items: convertDocs(solrResp.Response.Docs),
-		Page:  filters.Page,
-		Size:  filters.Size,
-		Total: solrResp.Response.NumFound,
+		Items:      convertDocs(solrResp.Response.Docs),
+		Page:       filters.Page,
+		Size:       filters.Size,
+		Total:      solrResp.Response.NumFound,
+		Facets:     convertFacets(solrResp.FacetCounts, filters.Facets),
+		Highlights: convertHighlights(solrResp.Highlighting, filters),
 	}, nil
 }
 
-// IndexProduct adds or updates a product document.
-func (c *Client) IndexProduct(ctx context.Context, product models.ProductDocument) error {
-	payload := map[string]interface{}{
-		"add": map[string]interface{}{
-			"doc":       product,
-			"overwrite": true,
-		},
+// highlightSuffix names the stored, Spanish-analyzed copy of a highlighted field.
+const highlightSuffix = "_hl"
+
+// addHighlightParams asks the unified highlighter for the fragments matching
+// the text query. Field matches are not required: the query targets the
+// *_es fields and the *_hl copies share their analysis. The html encoder
+// escapes the text around the tags.
+func addHighlightParams(params url.Values, filters services.SearchFilters) {
+	if !filters.Highlight || filters.Query == "" {
+		return
+	}
+	fields := make([]string, len(services.HighlightFields))
+	for i, field := range services.HighlightFields {
+		fields[i] = field + highlightSuffix
+	}
+	params.Set("hl", "true")
+	params.Set("hl.method", "unified")
+	params.Set("hl.fl", strings.Join(fields, ","))
+	params.Set("hl.requireFieldMatch", "false")
+	params.Set("hl.defaultSummary", "false")
+	params.Set("hl.encoder", "html")
+	params.Set("hl.tag.pre", "<"+filters.HighlightTag+">")
+	params.Set("hl.tag.post", "</"+filters.HighlightTag+">")
+	params.Set("hl.snippets", "2")
+	params.Set("hl.fragsize", "160")
+}
+
+func convertHighlights(highlighting map[string]map[string][]string, filters services.SearchFilters) map[string]map[string][]string {
+	if !filters.Highlight || len(highlighting) == 0 {
+		return nil
+	}
+	result := make(map[string]map[string][]string, len(highlighting))
+	for id, fields := range highlighting {
+		for field, fragments := range fields {
+			if len(fragments) == 0 {
+				continue
+			}
+			if result[id] == nil {
+				result[id] = map[string][]string{}
+			}
+			result[id][strings.TrimSuffix(field, highlightSuffix)] = fragments
+		}
+	}
+	return result
+}
+
+// queryParams translates the text query and the filters of a search,
+// leaving out paging, sorting and facets.
+func queryParams(filters services.SearchFilters) url.Values {
+	params := url.Values{}
+	params.Set("wt", "json")
+	if filters.Query != "" {
+		params.Set("q", filters.Query)
+		params.Set("defType", "edismax")
+		params.Set("qf", textQueryFields)
+		params.Set("pf", phraseQueryFields)
+		params.Set("mm", minimumShouldMatch)
+		// Users type words, not Solr syntax: no fielded queries.
+		params.Set("uf", "-*")
+	} else {
+		params.Set("q", "*:*")
+	}
+	for _, filter := range []struct {
+		field  string
+		values []string
+	}{
+		{"tipo", filters.Tipo},
+		{"estacion", filters.Estacion},
+		{"ocasion", filters.Ocasion},
+		{"genero", filters.Genero},
+		{"marca", filters.Marca},
+	} {
+		if len(filter.values) > 0 {
+			params.Add("fq", fmt.Sprintf("{!tag=%s}%s", filter.field, anyOf(filter.field, filter.values, "OR")))
+		}
+	}
+	if len(filters.Notas) > 0 {
+		op := "OR"
+		if filters.NotasMatch == services.NotasMatchAll {
+			op = "AND"
+		}
+		params.Add("fq", "{!tag=notas}"+anyOf("notas", filters.Notas, op))
+	}
+	if filters.PrecioMin > 0 || filters.PrecioMax > 0 {
+		params.Add("fq", fmt.Sprintf("{!tag=precio}precio:[%s TO %s]", rangeBound(filters.PrecioMin), rangeBound(filters.PrecioMax)))
+	}
+	if filters.InStock {
+		params.Add("fq", "stock:[1 TO *]")
+	}
+	if filters.Concentracion != "" {
+		params.Add("fq", fmt.Sprintf("variante_concentracion:%s", escapeTerm(filters.Concentracion)))
+	}
+	if filters.TamanoML > 0 {
+		params.Add("fq", fmt.Sprintf("variante_tamano_ml:%d", filters.TamanoML))
+	}
+	params.Add("fq", "-tombstone:true")
+	return params
+}
+
+// facetLimit bounds the values returned per facet field.
+const facetLimit = 30
+
+// addFacetParams counts the requested facets. Each facet excludes the filter
+// tagged with its own name, so selecting a value keeps the alternatives.
+func addFacetParams(params url.Values, facets []string) {
+	if len(facets) == 0 {
+		return
+	}
+	params.Set("facet", "true")
+	params.Set("facet.mincount", "1")
+	params.Set("facet.limit", strconv.Itoa(facetLimit))
+	for _, facet := range facets {
+		if facet == services.FacetPrecio {
+			for _, bucket := range services.PriceRanges {
+				upper := "*"
+				if bucket.To > 0 {
+					upper = strconv.FormatFloat(bucket.To, 'f', -1, 64)
+				}
+				params.Add("facet.query", fmt.Sprintf("{!ex=precio key=%q}precio:[%s TO %s}",
+					bucket.Label(), strconv.FormatFloat(bucket.From, 'f', -1, 64), upper))
+			}
+			continue
+		}
+		params.Add("facet.field", fmt.Sprintf("{!ex=%s key=%s}facet_%s", facet, facet, facet))
+	}
+}
+
+func convertFacets(counts *solrFacetCounts, facets []string) map[string][]services.FacetCount {
+	if counts == nil || len(facets) == 0 {
+		return nil
+	}
+	result := make(map[string][]services.FacetCount, len(facets))
+	for _, facet := range facets {
+		values := []services.FacetCount{}
+		if facet == services.FacetPrecio {
+			for _, bucket := range services.PriceRanges {
+				count := int64Value(counts.FacetQueries[bucket.Label()])
+				if count == 0 {
+					continue
+				}
+				from, to := bucket.From, bucket.To
+				value := services.FacetCount{Value: bucket.Label(), Count: count, From: &from}
+				if to > 0 {
+					value.To = &to
+				}
+				values = append(values, value)
+			}
+			result[facet] = values
+			continue
+		}
+		// Solr returns facet fields as a flat [value, count, value, count...] list.
+		flat := counts.FacetFields[facet]
+		for i := 0; i+1 < len(flat); i += 2 {
+			values = append(values, services.FacetCount{Value: stringValue(flat[i]), Count: int64Value(flat[i+1])})
+		}
+		result[facet] = values
+	}
+	return result
+}
+
+// ScanIndex pages through every document, tombstones included, ordered by
+// id. It uses Solr cursors, so the cursor is a cursorMark and is empty once
+// the last page was returned.
+func (c *Client) ScanIndex(ctx context.Context, cursor string, limit int) ([]services.IndexEntry, string, error) {
+	if cursor == "" {
+		cursor = "*"
+	}
+	params := url.Values{}
+	params.Set("wt", "json")
+	params.Set("q", "*:*")
+	params.Set("fl", "id,product_version,tombstone,updated_at")
+	params.Set("sort", "id asc")
+	params.Set("rows", strconv.Itoa(limit))
+	params.Set("cursorMark", cursor)
+
+	endpoint := fmt.Sprintf("%s/%s/select?%s", c.baseURL, c.core, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, "", services.BackendError{Message: "build solr scan request", Err: err}
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", services.BackendError{Message: "solr scan failed", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", services.BackendError{
+			Message: fmt.Sprintf("solr scan returned status %d", resp.StatusCode),
+		}
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var body struct {
+		solrResponse
+		NextCursorMark string `json:"nextCursorMark"`
+	}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, "", services.BackendError{Message: "decode solr scan response", Err: err}
+	}
+
+	entries := make([]services.IndexEntry, 0, len(body.Response.Docs))
+	for _, doc := range body.Response.Docs {
+		entries = append(entries, services.IndexEntry{
+			ID:        stringValue(doc["id"]),
+			Version:   int64Value(doc["product_version"]),
+			Tombstone: boolValue(doc["tombstone"]),
+			UpdatedAt: timeValue(doc["updated_at"]),
+		})
+	}
+	next := body.NextCursorMark
+	if next == cursor {
+		next = ""
+	}
+	return entries, next, nil
+}
+
+// IndexedVersion reads the version fields of a product through the real-time
+// get handler, which also sees uncommitted updates.
+func (c *Client) IndexedVersion(ctx context.Context, id string) (services.IndexedVersion, bool, error) {
+	params := url.Values{}
+	params.Set("wt", "json")
+	params.Set("id", id)
+	params.Set("fl", "id,product_version,tombstone,_version_")
+
+	endpoint := fmt.Sprintf("%s/%s/get?%s", c.baseURL, c.core, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return services.IndexedVersion{}, false, services.BackendError{Message: "build solr get request", Err: err}
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return services.IndexedVersion{}, false, services.BackendError{Message: "solr get failed", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return services.IndexedVersion{}, false, services.BackendError{
+			Message: fmt.Sprintf("solr get returned status %d", resp.StatusCode),
+		}
+	}
+
+	// _version_ does not fit in a float64 without losing precision.
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var body struct {
+		Doc map[string]interface{} `json:"doc"`
+	}
+	if err := decoder.Decode(&body); err != nil {
+		return services.IndexedVersion{}, false, services.BackendError{Message: "decode solr get response", Err: err}
+	}
+	if body.Doc == nil {
+		return services.IndexedVersion{}, false, nil
+	}
+	return services.IndexedVersion{
+		Version:   int64Value(body.Doc["product_version"]),
+		Tombstone: boolValue(body.Doc["tombstone"]),
+		Revision:  int64Value(body.Doc["_version_"]),
+	}, true, nil
+}
+
+// IndexProduct adds or updates a product document. A non-zero revision makes
+// the write conditional on Solr's _version_ (optimistic concurrency).
+func (c *Client) IndexProduct(ctx context.Context, product models.ProductDocument, revision int64) error {
+	doc, err := toSolrDoc(product)
+	if err != nil {
+		return err
 	}
-	return c.postUpdate(ctx, payload)
+	return c.addDoc(ctx, doc, revision)
 }
 
-// DeleteProduct removes a product document by id.
-func (c *Client) DeleteProduct(ctx context.Context, id string) error {
-	payload := map[string]interface{}{
-		"delete": map[string]string{"id": id},
+// DeleteProduct replaces a product document with a tombstone that keeps the
+// deletion version, so older events for the product are recognized as stale.
+func (c *Client) DeleteProduct(ctx context.Context, id string, version, revision int64) error {
+	doc := map[string]interface{}{
+		"id":              id,
+		"product_version": version,
+		"tombstone":       true,
+		"updated_at":      time.Now().UTC(),
 	}
-	return c.postUpdate(ctx, payload)
+	return c.addDoc(ctx, doc, revision)
 }
 
-func (c *Client) postUpdate(ctx context.Context, payload interface{}) error {
-	body, err := json.Marshal(payload)
+func (c *Client) addDoc(ctx context.Context, doc map[string]interface{}, revision int64) error {
+	if revision != 0 {
+		doc["_version_"] = revision
+	}
+	if c.batch != nil {
+		return c.batch.submit(ctx, doc)
+	}
+	return c.postUpdate(ctx, []map[string]interface{}{doc})
+}
+
+// postUpdate adds docs in a single request. It soft commits so the changes
+// are searchable when it returns; hard commits are left to Solr's autoCommit.
+// A version conflict on any document fails the whole request, and Solr keeps
+// the documents it added before the conflicting one.
+func (c *Client) postUpdate(ctx context.Context, docs []map[string]interface{}) error {
+	body, err := json.Marshal(docs)
 	if err != nil {
 		return fmt.Errorf("marshal payload: %w", err)
 	}
 
-	endpoint := fmt.Sprintf("%s/%s/update?commit=true", c.baseURL, c.core)
+	endpoint := fmt.Sprintf("%s/%s/update?softCommit=true", c.baseURL, c.core)
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("build solr update request: %w", err)
@@ -154,16 +433,196 @@ func (c *Client) postUpdate(ctx context.Context, payload interface{}) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusConflict {
+		return services.ErrRevisionConflict
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return fmt.Errorf("solr update returned status %d", resp.StatusCode)
 	}
 	return nil
 }
 
+// defaultConfigSet is the configset new cores are created from; it is the
+// one solr-precreate uses for the live core.
+const defaultConfigSet = "_default"
+
+// CreateCore creates an empty core with the search schema and returns a
+// client bound to it.
+func (c *Client) CreateCore(ctx context.Context, name string) (services.IndexRepository, error) {
+	params := url.Values{}
+	params.Set("action", "CREATE")
+	params.Set("name", name)
+	params.Set("configSet", defaultConfigSet)
+	if err := c.coreAdmin(ctx, params); err != nil {
+		return nil, err
+	}
+	core := c.withCore(name)
+	if err := core.EnsureSchema(ctx); err != nil {
+		return nil, err
+	}
+	return core, nil
+}
+
+// SwapCores atomically exchanges the names of two cores. Clients bound to
+// core serve the documents of other from then on.
+func (c *Client) SwapCores(ctx context.Context, core, other string) error {
+	params := url.Values{}
+	params.Set("action", "SWAP")
+	params.Set("core", core)
+	params.Set("other", other)
+	return c.coreAdmin(ctx, params)
+}
+
+// UnloadCore removes a core together with its index and instance directory.
+func (c *Client) UnloadCore(ctx context.Context, name string) error {
+	params := url.Values{}
+	params.Set("action", "UNLOAD")
+	params.Set("core", name)
+	params.Set("deleteIndex", "true")
+	params.Set("deleteInstanceDir", "true")
+	return c.coreAdmin(ctx, params)
+}
+
+func (c *Client) withCore(core string) *Client {
+	clone := *c
+	clone.core = core
+	if c.batch != nil {
+		clone.batch = newBatcher(&clone, c.batch.cfg)
+	}
+	return &clone
+}
+
+func (c *Client) coreAdmin(ctx context.Context, params url.Values) error {
+	params.Set("wt", "json")
+	endpoint := fmt.Sprintf("%s/admin/cores?%s", c.baseURL, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return services.BackendError{Message: "build solr core admin request", Err: err}
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return services.BackendError{Message: "solr core admin failed", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return services.BackendError{
+			Message: fmt.Sprintf("solr core admin %s returned status %d", params.Get("action"), resp.StatusCode),
+		}
+	}
+	return nil
+}
+
+// toSolrDoc flattens a product into a Solr document. Variant attributes are
+// indexed as multi-valued fields for filtering, and the full variant list is
+// kept as a stored JSON string so it can be returned as-is.
+func toSolrDoc(product models.ProductDocument) (map[string]interface{}, error) {
+	doc := map[string]interface{}{
+		"id":          product.ID,
+		"name":        product.Name,
+		"descripcion": product.Descripcion,
+		"precio":      product.Precio,
+		"stock":       product.Stock,
+		"tipo":        product.Tipo,
+		"estacion":    product.Estacion,
+		"ocasion":     product.Ocasion,
+		"notas":       product.Notas,
+		"genero":      product.Genero,
+		"marca":       product.Marca,
+		"imagen":      product.Imagen,
+		"created_at":  product.CreatedAt,
+		"updated_at":  product.UpdatedAt,
+
+		"name_es":        product.Name,
+		"marca_es":       product.Marca,
+		"notas_es":       product.Notas,
+		"descripcion_es": product.Descripcion,
+
+		"facet_tipo":     product.Tipo,
+		"facet_estacion": product.Estacion,
+		"facet_ocasion":  product.Ocasion,
+		"facet_genero":   product.Genero,
+		"facet_marca":    product.Marca,
+		"facet_notas":    product.Notas,
+
+		"name_prefix":  product.Name,
+		"marca_prefix": product.Marca,
+		"notas_prefix": product.Notas,
+
+		"name_hl":        product.Name,
+		"descripcion_hl": product.Descripcion,
+		"notas_hl":       product.Notas,
+
+		"spell": append([]string{product.Name, product.Marca, product.Descripcion}, product.Notas...),
+	}
+	if product.Version > 0 {
+		doc["product_version"] = product.Version
+	}
+	if len(product.Variantes) == 0 {
+		return doc, nil
+	}
+
+	encoded, err := json.Marshal(product.Variantes)
+	if err != nil {
+		return nil, fmt.Errorf("marshal variants: %w", err)
+	}
+	skus := make([]string, 0, len(product.Variantes))
+	sizes := make([]int, 0, len(product.Variantes))
+	concentrations := make([]string, 0, len(product.Variantes))
+	prices := make([]float64, 0, len(product.Variantes))
+	for _, variant := range product.Variantes {
+		skus = append(skus, variant.SKU)
+		if variant.TamanoML > 0 {
+			sizes = append(sizes, variant.TamanoML)
+		}
+		if variant.Concentracion != "" {
+			concentrations = append(concentrations, strings.ToLower(variant.Concentracion))
+		}
+		prices = append(prices, variant.Precio)
+	}
+	doc["variante_sku"] = skus
+	doc["variante_precio"] = prices
+	if len(sizes) > 0 {
+		doc["variante_tamano_ml"] = sizes
+	}
+	if len(concentrations) > 0 {
+		doc["variante_concentracion"] = concentrations
+	}
+	doc["variantes_json"] = string(encoded)
+	return doc, nil
+}
+
+// anyOf matches field against values joined by op ("OR" or "AND").
+func anyOf(field string, values []string, op string) string {
+	if len(values) == 1 {
+		return fmt.Sprintf("%s:%s", field, escapeTerm(values[0]))
+	}
+	terms := make([]string, len(values))
+	for i, value := range values {
+		terms[i] = escapeTerm(value)
+	}
+	return fmt.Sprintf("%s:(%s)", field, strings.Join(terms, " "+op+" "))
+}
+
+// rangeBound formats a range query bound; zero leaves it open.
+func rangeBound(value float64) string {
+	if value <= 0 {
+		return "*"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// escapeTerm escapes the query syntax characters of a term so user values
+// are always matched literally.
 func escapeTerm(term string) string {
-	term = strings.ReplaceAll(term, ":", "\\:")
-	term = strings.ReplaceAll(term, " ", "\\ ")
-	return term
+	var b strings.Builder
+	for _, r := range term {
+		if strings.ContainsRune(`\+-!():^[]"{}~*?|&/ `, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
 }
 
 type solrResponse struct {
@@ -171,6 +630,13 @@ type solrResponse struct {
 		NumFound int64                    `json:"numFound"`
 		Docs     []map[string]interface{} `json:"docs"`
 	} `json:"response"`
+	FacetCounts  *solrFacetCounts               `json:"facet_counts"`
+	Highlighting map[string]map[string][]string `json:"highlighting"`
+}
+
+type solrFacetCounts struct {
+	FacetQueries map[string]interface{}   `json:"facet_queries"`
+	FacetFields  map[string][]interface{} `json:"facet_fields"`
 }
 
 func convertDocs(docs []map[string]interface{}) []models.ProductDocument {
@@ -188,6 +654,7 @@ func mapSolrDoc(doc map[string]interface{}) models.ProductDocument {
 		Descripcion: stringValue(doc["descripcion"]),
 		Precio:      floatValue(doc["precio"]),
 		Stock:       intValue(doc["stock"]),
+		Variantes:   variantsValue(doc["variantes_json"]),
 		Tipo:        stringValue(doc["tipo"]),
 		Estacion:    stringValue(doc["estacion"]),
 		Ocasion:     stringValue(doc["ocasion"]),
@@ -197,6 +664,7 @@ func mapSolrDoc(doc map[string]interface{}) models.ProductDocument {
 		Imagen:      stringValue(doc["imagen"]),
 		CreatedAt:   timeValue(doc["created_at"]),
 		UpdatedAt:   timeValue(doc["updated_at"]),
+		Version:     int64Value(doc["product_version"]),
 	}
 }
 
@@ -292,6 +760,35 @@ func intValue(value interface{}) int {
 	return 0
 }
 
+func int64Value(value interface{}) int64 {
+	scalar := firstScalar(value)
+	switch v := scalar.(type) {
+	case json.Number:
+		if parsed, err := v.Int64(); err == nil {
+			return parsed
+		}
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case string:
+		if parsed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return parsed
+		}
+	}
+	return 0
+}
+
+func boolValue(value interface{}) bool {
+	switch v := firstScalar(value).(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(strings.TrimSpace(v), "true")
+	}
+	return false
+}
+
 func stringSliceValue(value interface{}) []string {
 	switch v := value.(type) {
 	case []string:
@@ -319,6 +816,18 @@ func stringSliceValue(value interface{}) []string {
 	return nil
 }
 
+func variantsValue(value interface{}) []models.ProductVariant {
+	raw := stringValue(value)
+	if raw == "" {
+		return nil
+	}
+	var variants []models.ProductVariant
+	if err := json.Unmarshal([]byte(raw), &variants); err != nil {
+		return nil
+	}
+	return variants
+}
+
 func timeValue(value interface{}) time.Time {
 	if str := stringValue(value); str != "" {
 		if parsed, err := time.Parse(time.RFC3339, str); err == nil {
@@ -0,0 +1,193 @@
+package solr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"search-api/internal/services"
+)
+
+func TestSearchCountsFacetsWithoutTheirOwnFilter(t *testing.T) {
+	var params url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = r.URL.Query()
+		fmt.Fprint(w, `{
+			"response": {"numFound": 1, "docs": [{"id": "p1", "name": ["Luna"]}]},
+			"facet_counts": {
+				"facet_queries": {"0-50": 0, "50-100": 3, "100-200": 1, "200+": 2},
+				"facet_fields": {"tipo": ["floral", 4, "amaderado", 2]}
+			}
+		}`)
+	}))
+	defer server.Close()
+
+	result, err := NewClient(server.URL, "products-core").Search(context.Background(), services.SearchFilters{
+		Tipo:   []string{"floral"},
+		Page:   1,
+		Size:   10,
+		Facets: []string{"precio", "tipo"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if !slices.Contains(params["fq"], "{!tag=tipo}tipo:floral") {
+		t.Fatalf("expected the tipo filter to be tagged, got %v", params["fq"])
+	}
+	if !slices.Contains(params["facet.field"], "{!ex=tipo key=tipo}facet_tipo") {
+		t.Fatalf("expected the tipo facet to exclude its filter, got %v", params["facet.field"])
+	}
+
+	tipos := result.Facets["tipo"]
+	if len(tipos) != 2 || tipos[1].Value != "amaderado" || tipos[1].Count != 2 {
+		t.Fatalf("unexpected tipo facet %+v", tipos)
+	}
+	precios := result.Facets["precio"]
+	if len(precios) != 3 || precios[0].Value != "50-100" || *precios[0].From != 50 || *precios[0].To != 100 {
+		t.Fatalf("unexpected precio facet %+v", precios)
+	}
+	if last := precios[2]; last.Value != "200+" || last.To != nil {
+		t.Fatalf("expected an open-ended last bucket, got %+v", last)
+	}
+}
+
+func TestSpellCheckReturnsCollationsWithTheSearchFilters(t *testing.T) {
+	var (
+		path   string
+		params url.Values
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, params = r.URL.Path, r.URL.Query()
+		fmt.Fprint(w, `{
+			"response": {"numFound": 0, "docs": []},
+			"spellcheck": {
+				"suggestions": ["vainila", {"numFound": 1, "suggestion": ["vainilla"]}],
+				"collations": [
+					"collation", {"collationQuery": "vainilla", "hits": 4},
+					"collation", {"collationQuery": "vainas", "hits": 1}
+				]
+			}
+		}`)
+	}))
+	defer server.Close()
+
+	collations, err := NewClient(server.URL, "products-core").SpellCheck(context.Background(), services.SearchFilters{
+		Query: "vainila",
+		Marca: []string{"dior"},
+	})
+	if err != nil {
+		t.Fatalf("spellcheck: %v", err)
+	}
+
+	if path != "/products-core/spell_es" || params.Get("spellcheck.q") != "vainila" {
+		t.Fatalf("unexpected spellcheck request %s?%s", path, params.Encode())
+	}
+	if !slices.Contains(params["fq"], "{!tag=marca}marca:dior") {
+		t.Fatalf("expected collations to be tried with the filters, got %v", params["fq"])
+	}
+	want := []services.Collation{{Query: "vainilla", Hits: 4}, {Query: "vainas", Hits: 1}}
+	if !slices.Equal(collations, want) {
+		t.Fatalf("expected %+v, got %+v", want, collations)
+	}
+}
+
+func TestSearchTranslatesRangeAndMultiValueFilters(t *testing.T) {
+	var params url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = r.URL.Query()
+		fmt.Fprint(w, `{"response": {"numFound": 0, "docs": []}}`)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, "products-core").Search(context.Background(), services.SearchFilters{
+		Marca:      []string{"carolina herrera", "dior"},
+		Notas:      []string{"ambar", "vainilla"},
+		NotasMatch: services.NotasMatchAll,
+		PrecioMin:  50,
+		InStock:    true,
+		Page:       1,
+		Size:       10,
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	for _, want := range []string{
+		`{!tag=marca}marca:(carolina\ herrera OR dior)`,
+		`{!tag=notas}notas:(ambar AND vainilla)`,
+		`{!tag=precio}precio:[50 TO *]`,
+		`stock:[1 TO *]`,
+	} {
+		if !slices.Contains(params["fq"], want) {
+			t.Fatalf("expected filter %s, got %v", want, params["fq"])
+		}
+	}
+}
+
+func TestSearchReturnsEscapedHighlightsPerProductField(t *testing.T) {
+	var params url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = r.URL.Query()
+		fmt.Fprint(w, `{
+			"response": {"numFound": 1, "docs": [{"id": "p1", "name": ["Vainilla & Co"]}]},
+			"highlighting": {
+				"p1": {
+					"name_hl": ["<mark>Vainilla</mark> &amp; Co"],
+					"descripcion_hl": [],
+					"notas_hl": ["<mark>vainilla</mark>"]
+				}
+			}
+		}`)
+	}))
+	defer server.Close()
+
+	result, err := NewClient(server.URL, "products-core").Search(context.Background(), services.SearchFilters{
+		Query:        "vainilla",
+		Highlight:    true,
+		HighlightTag: "mark",
+		Page:         1,
+		Size:         10,
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if params.Get("hl.encoder") != "html" || params.Get("hl.tag.pre") != "<mark>" || params.Get("hl.fl") != "name_hl,descripcion_hl,notas_hl" {
+		t.Fatalf("unexpected highlight parameters %v", params)
+	}
+	highlights := result.Highlights["p1"]
+	if len(highlights) != 2 || highlights["name"][0] != "<mark>Vainilla</mark> &amp; Co" || highlights["notas"][0] != "<mark>vainilla</mark>" {
+		t.Fatalf("unexpected highlights %+v", result.Highlights)
+	}
+}
+
+func TestSimilarExcludesTheSourceAndOutOfStockProducts(t *testing.T) {
+	var params url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = r.URL.Query()
+		fmt.Fprint(w, `{"response": {"numFound": 1, "docs": [{"id": "p2", "name": ["Ambar"]}]}}`)
+	}))
+	defer server.Close()
+
+	items, err := NewClient(server.URL, "products-core").Similar(context.Background(), "p1", 5)
+	if err != nil {
+		t.Fatalf("similar: %v", err)
+	}
+
+	if params.Get("mlt_id") != "p1" || params.Get("rows") != "5" {
+		t.Fatalf("unexpected similar request %v", params)
+	}
+	for _, want := range []string{"-tombstone:true", "stock:[1 TO *]", "-id:p1"} {
+		if !slices.Contains(params["fq"], want) {
+			t.Fatalf("expected filter %s, got %v", want, params["fq"])
+		}
+	}
+	if len(items) != 1 || items[0].ID != "p2" {
+		t.Fatalf("unexpected items %+v", items)
+	}
+}
@@ -0,0 +1,38 @@
+package solr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"search-api/internal/indextest"
+	"search-api/internal/services"
+)
+
+// TestClientContract runs the index contract against a live Solr, in a
+// throwaway core per test. It needs SOLR_TEST_URL, e.g.
+// http://localhost:8983/solr.
+func TestClientContract(t *testing.T) {
+	baseURL := os.Getenv("SOLR_TEST_URL")
+	if baseURL == "" {
+		t.Skip("SOLR_TEST_URL not set")
+	}
+	admin := NewClient(baseURL, "")
+	indextest.Run(t, func(t *testing.T) services.IndexRepository {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		name := fmt.Sprintf("contract-%d", time.Now().UnixNano())
+		repo, err := admin.CreateCore(ctx, name)
+		if err != nil {
+			t.Fatalf("create core %s: %v", name, err)
+		}
+		t.Cleanup(func() {
+			if err := admin.UnloadCore(context.Background(), name); err != nil {
+				t.Logf("unload core %s: %v", name, err)
+			}
+		})
+		return repo
+	})
+}
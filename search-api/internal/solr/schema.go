@@ -0,0 +1,190 @@
+package solr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"search-api/internal/services"
+)
+
+// spanishTextType analyzes text in Spanish: stop words, light stemming and
+// accent folding, so "otoño" and "otono" or "flores" and "flor" match.
+// Stop words are removed before folding because the list is accented.
+var spanishTextType = map[string]interface{}{
+	"name":                 "text_es",
+	"class":                "solr.TextField",
+	"positionIncrementGap": "100",
+	"analyzer": map[string]interface{}{
+		"tokenizer": map[string]interface{}{"class": "solr.StandardTokenizerFactory"},
+		"filters": []map[string]interface{}{
+			{"class": "solr.LowerCaseFilterFactory"},
+			{"class": "solr.StopFilterFactory", "words": "lang/stopwords_es.txt", "format": "snowball", "ignoreCase": "true"},
+			{"class": "solr.SpanishLightStemFilterFactory"},
+			{"class": "solr.ASCIIFoldingFilterFactory"},
+		},
+	},
+}
+
+// spanishTextFields are the searchable copies of the text fields. They are
+// indexed only; the original fields keep the stored values.
+var spanishTextFields = []map[string]interface{}{
+	{"name": "name_es", "type": "text_es", "stored": false},
+	{"name": "marca_es", "type": "text_es", "stored": false},
+	{"name": "notas_es", "type": "text_es", "stored": false, "multiValued": true},
+	{"name": "descripcion_es", "type": "text_es", "stored": false},
+}
+
+// highlightFields are stored copies of the highlighted text fields with the
+// Spanish analysis, so the stemmed terms of the query mark their matches.
+var highlightFields = []map[string]interface{}{
+	{"name": "name_hl", "type": "text_es", "stored": true},
+	{"name": "descripcion_hl", "type": "text_es", "stored": true},
+	{"name": "notas_hl", "type": "text_es", "stored": true, "multiValued": true},
+}
+
+// facetFields keep the exact values of the faceted fields; the original
+// fields are tokenized by the schemaless mode and would be counted per word.
+var facetFields = []map[string]interface{}{
+	{"name": "facet_tipo", "type": "string", "stored": false, "docValues": true},
+	{"name": "facet_estacion", "type": "string", "stored": false, "docValues": true},
+	{"name": "facet_ocasion", "type": "string", "stored": false, "docValues": true},
+	{"name": "facet_genero", "type": "string", "stored": false, "docValues": true},
+	{"name": "facet_marca", "type": "string", "stored": false, "docValues": true},
+	{"name": "facet_notas", "type": "string", "stored": false, "docValues": true, "multiValued": true},
+}
+
+// prefixTextType indexes every leading part of each word so a search can
+// match what the user has typed so far; queries are not split into grams.
+var prefixTextType = map[string]interface{}{
+	"name":                 "text_prefix",
+	"class":                "solr.TextField",
+	"positionIncrementGap": "100",
+	"indexAnalyzer": map[string]interface{}{
+		"tokenizer": map[string]interface{}{"class": "solr.StandardTokenizerFactory"},
+		"filters": []map[string]interface{}{
+			{"class": "solr.LowerCaseFilterFactory"},
+			{"class": "solr.ASCIIFoldingFilterFactory"},
+			{"class": "solr.EdgeNGramFilterFactory", "minGramSize": "1", "maxGramSize": "20"},
+		},
+	},
+	"queryAnalyzer": map[string]interface{}{
+		"tokenizer": map[string]interface{}{"class": "solr.StandardTokenizerFactory"},
+		"filters": []map[string]interface{}{
+			{"class": "solr.LowerCaseFilterFactory"},
+			{"class": "solr.ASCIIFoldingFilterFactory"},
+		},
+	},
+}
+
+// prefixFields back the autocomplete over names, brands and notes.
+var prefixFields = []map[string]interface{}{
+	{"name": "name_prefix", "type": "text_prefix", "stored": false},
+	{"name": "marca_prefix", "type": "text_prefix", "stored": false},
+	{"name": "notas_prefix", "type": "text_prefix", "stored": false, "multiValued": true},
+}
+
+// spellTextType keeps whole lowercased words, accents included, so the
+// corrections offered read like the catalog.
+var spellTextType = map[string]interface{}{
+	"name":                 "text_spell",
+	"class":                "solr.TextField",
+	"positionIncrementGap": "100",
+	"analyzer": map[string]interface{}{
+		"tokenizer": map[string]interface{}{"class": "solr.StandardTokenizerFactory"},
+		"filters": []map[string]interface{}{
+			{"class": "solr.LowerCaseFilterFactory"},
+		},
+	},
+}
+
+// spellField gathers the names, brands, descriptions and notes the
+// spellchecker draws its corrections from.
+var spellField = map[string]interface{}{"name": "spell", "type": "text_spell", "stored": false, "multiValued": true}
+
+// spellcheckComponent suggests indexed words within two edits of each
+// misspelled query word; it reads the index directly and needs no build.
+var spellcheckComponent = map[string]interface{}{
+	"name":                   "spellcheck_es",
+	"class":                  "solr.SpellCheckComponent",
+	"queryAnalyzerFieldType": "text_spell",
+	"spellchecker": map[string]interface{}{
+		"name":              "default",
+		"field":             "spell",
+		"classname":         "solr.DirectSolrSpellChecker",
+		"distanceMeasure":   "internal",
+		"accuracy":          0.5,
+		"maxEdits":          2,
+		"minPrefix":         1,
+		"maxInspections":    5,
+		"minQueryLength":    4,
+		"maxQueryFrequency": 0.01,
+	},
+}
+
+// spellHandler is a search handler with the spellcheck component, used to
+// check and collate queries with the same parameters as the search.
+var spellHandler = map[string]interface{}{
+	"name":            "/spell_es",
+	"class":           "solr.SearchHandler",
+	"last-components": []string{"spellcheck_es"},
+}
+
+// EnsureSchema adds the field types and the text, highlight, facet, prefix
+// and spell fields the search relies on to the core, plus the spellcheck
+// handler. It is idempotent; it must run before documents are indexed,
+// otherwise the schemaless mode guesses a generic type for the new fields.
+func (c *Client) EnsureSchema(ctx context.Context) error {
+	for _, fieldType := range []map[string]interface{}{spanishTextType, prefixTextType, spellTextType} {
+		if err := c.apiCommand(ctx, "schema", "add-field-type", fieldType); err != nil {
+			return err
+		}
+	}
+	fields := append(append(append([]map[string]interface{}{}, spanishTextFields...), facetFields...), prefixFields...)
+	fields = append(append(fields, highlightFields...), spellField)
+	for _, field := range fields {
+		if err := c.apiCommand(ctx, "schema", "add-field", field); err != nil {
+			return err
+		}
+	}
+	if err := c.apiCommand(ctx, "config", "add-searchcomponent", spellcheckComponent); err != nil {
+		return err
+	}
+	return c.apiCommand(ctx, "config", "add-requesthandler", spellHandler)
+}
+
+// apiCommand sends one command to the Schema or Config API of the core.
+func (c *Client) apiCommand(ctx context.Context, api, command string, definition map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{command: definition})
+	if err != nil {
+		return fmt.Errorf("marshal %s command: %w", api, err)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/%s", c.baseURL, c.core, api)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return services.BackendError{Message: fmt.Sprintf("build solr %s request", api), Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return services.BackendError{Message: fmt.Sprintf("solr %s request failed", api), Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if strings.Contains(string(detail), "already exists") {
+		return nil
+	}
+	return services.BackendError{
+		Message: fmt.Sprintf("solr %s %v returned status %d: %s", command, definition["name"], resp.StatusCode, strings.TrimSpace(string(detail))),
+	}
+}
@@ -0,0 +1,55 @@
+package solr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"search-api/internal/models"
+	"search-api/internal/services"
+)
+
+// similarQuery finds products sharing the notes, tipo, estacion and ocasion
+// of the document referenced by $mlt_id, weighting notes the most. The mlt
+// parser reads the terms from stored values: notas_hl is the stored
+// Spanish-analyzed copy of the notes.
+const similarQuery = "{!mlt qf='notas_hl^3,tipo^2,estacion,ocasion' boost=true mintf=1 mindf=1 v=$mlt_id}"
+
+// Similar runs a MoreLikeThis query for product id, skipping deleted and
+// out-of-stock products and the product itself.
+func (c *Client) Similar(ctx context.Context, id string, limit int) ([]models.ProductDocument, error) {
+	params := url.Values{}
+	params.Set("wt", "json")
+	params.Set("q", similarQuery)
+	params.Set("mlt_id", id)
+	params.Add("fq", "-tombstone:true")
+	params.Add("fq", "stock:[1 TO *]")
+	params.Add("fq", "-id:"+escapeTerm(id))
+	params.Set("rows", strconv.Itoa(limit))
+
+	endpoint := fmt.Sprintf("%s/%s/select?%s", c.baseURL, c.core, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, services.BackendError{Message: "build solr similar request", Err: err}
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, services.BackendError{Message: "solr similar request failed", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, services.BackendError{
+			Message: fmt.Sprintf("solr similar request returned status %d", resp.StatusCode),
+		}
+	}
+
+	var solrResp solrResponse
+	if err := json.NewDecoder(resp.Body).Decode(&solrResp); err != nil {
+		return nil, services.BackendError{Message: "decode solr similar response", Err: err}
+	}
+	return convertDocs(solrResp.Response.Docs), nil
+}
@@ -0,0 +1,68 @@
+package solr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"search-api/internal/services"
+)
+
+// spellcheckCollations bounds the corrected queries returned; each one is
+// tried against the index with the search filters to count its hits.
+const spellcheckCollations = 3
+
+// SpellCheck returns corrected versions of the text query of filters, best
+// first, with the number of products each matches under the same filters.
+func (c *Client) SpellCheck(ctx context.Context, filters services.SearchFilters) ([]services.Collation, error) {
+	params := queryParams(filters)
+	params.Set("rows", "0")
+	params.Set("spellcheck", "true")
+	params.Set("spellcheck.q", filters.Query)
+	params.Set("spellcheck.count", "5")
+	params.Set("spellcheck.collate", "true")
+	params.Set("spellcheck.maxCollations", fmt.Sprint(spellcheckCollations))
+	params.Set("spellcheck.maxCollationTries", "10")
+	params.Set("spellcheck.collateExtendedResults", "true")
+
+	endpoint := fmt.Sprintf("%s/%s/spell_es?%s", c.baseURL, c.core, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, services.BackendError{Message: "build solr spellcheck request", Err: err}
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, services.BackendError{Message: "solr spellcheck failed", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, services.BackendError{
+			Message: fmt.Sprintf("solr spellcheck returned status %d", resp.StatusCode),
+		}
+	}
+
+	var body struct {
+		Spellcheck struct {
+			// Collations is a flat ["collation", {...}, "collation", {...}] list.
+			Collations []json.RawMessage `json:"collations"`
+		} `json:"spellcheck"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, services.BackendError{Message: "decode solr spellcheck response", Err: err}
+	}
+
+	var collations []services.Collation
+	for i := 1; i < len(body.Spellcheck.Collations); i += 2 {
+		var collation struct {
+			CollationQuery string `json:"collationQuery"`
+			Hits           int64  `json:"hits"`
+		}
+		if err := json.Unmarshal(body.Spellcheck.Collations[i], &collation); err != nil {
+			return nil, services.BackendError{Message: "decode solr collation", Err: err}
+		}
+		collations = append(collations, services.Collation{Query: collation.CollationQuery, Hits: collation.Hits})
+	}
+	return collations, nil
+}
@@ -0,0 +1,69 @@
+package solr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"search-api/internal/services"
+)
+
+const (
+	// suggestQueryFields match what the user has typed so far against the
+	// edge n-grams of names, brands and notes.
+	suggestQueryFields = "name_prefix^3 marca_prefix^2 notas_prefix"
+	// suggestFacetLimit bounds the brand and note values considered; the
+	// service keeps those that match the query.
+	suggestFacetLimit = 50
+)
+
+// Suggest finds the products matching every typed word as a word prefix,
+// and counts their brands and notes, in a single request.
+func (c *Client) Suggest(ctx context.Context, query string, limit int) (*services.SuggestCandidates, error) {
+	params := url.Values{}
+	params.Set("wt", "json")
+	params.Set("q", query)
+	params.Set("defType", "edismax")
+	params.Set("qf", suggestQueryFields)
+	params.Set("mm", "100%")
+	params.Set("uf", "-*")
+	params.Add("fq", "-tombstone:true")
+	params.Set("fl", "id,name,marca")
+	params.Set("rows", strconv.Itoa(limit))
+	params.Set("facet", "true")
+	params.Set("facet.mincount", "1")
+	params.Set("facet.limit", strconv.Itoa(suggestFacetLimit))
+	params.Add("facet.field", "{!key=marca}facet_marca")
+	params.Add("facet.field", "{!key=notas}facet_notas")
+
+	endpoint := fmt.Sprintf("%s/%s/select?%s", c.baseURL, c.core, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, services.BackendError{Message: "build solr suggest request", Err: err}
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, services.BackendError{Message: "solr suggest failed", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, services.BackendError{
+			Message: fmt.Sprintf("solr suggest returned status %d", resp.StatusCode),
+		}
+	}
+
+	var solrResp solrResponse
+	if err := json.NewDecoder(resp.Body).Decode(&solrResp); err != nil {
+		return nil, services.BackendError{Message: "decode solr suggest response", Err: err}
+	}
+	facets := convertFacets(solrResp.FacetCounts, []string{"marca", "notas"})
+	return &services.SuggestCandidates{
+		Products: convertDocs(solrResp.Response.Docs),
+		Brands:   facets["marca"],
+		Notes:    facets["notas"],
+	}, nil
+}